@@ -5,14 +5,20 @@ import (
 	"net"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
 	"github.com/chizheg/forum/internal/auth/delivery/grpc"
+	"github.com/chizheg/forum/internal/auth/domain"
+	"github.com/chizheg/forum/internal/auth/mailer"
+	"github.com/chizheg/forum/internal/auth/oidc"
 	"github.com/chizheg/forum/internal/auth/repository/postgres"
 	"github.com/chizheg/forum/internal/auth/service"
+	"github.com/chizheg/forum/pkg/audit"
 	"github.com/chizheg/forum/pkg/database"
 	"github.com/chizheg/forum/pkg/logger"
 	pb "github.com/chizheg/forum/proto"
+	"go.uber.org/zap"
 	"google.golang.org/grpc"
 )
 
@@ -47,7 +53,10 @@ func main() {
 	repo := postgres.NewRepository(db)
 
 	// Initialize service
-	svc := service.NewService(repo)
+	svc := service.NewService(repo, audit.NewPostgresStore(db), smtpMailer(log), service.TwoFactorConfig{
+		Issuer:        "Forum",
+		RequiredRoles: []string{domain.RoleAdmin, domain.RoleModerator},
+	}, oidcProviders(log), log.Logger)
 
 	// Initialize gRPC server
 	lis, err := net.Listen("tcp", ":"+defaultPort)
@@ -55,8 +64,13 @@ func main() {
 		log.Fatal("Failed to listen", err)
 	}
 
+	authServer, err := grpc.NewAuthServer(svc, trustedPeers(), log.Logger)
+	if err != nil {
+		log.Fatal("Failed to initialize gRPC server", err)
+	}
+
 	s := grpc.NewServer()
-	pb.RegisterAuthServiceServer(s, grpc.NewAuthServer(svc, log.Logger))
+	pb.RegisterAuthServiceServer(s, authServer)
 
 	// Start server
 	go func() {
@@ -74,3 +88,69 @@ func main() {
 	log.Info("Shutting down gRPC server...")
 	s.GracefulStop()
 }
+
+// trustedPeers returns the CIDRs in TRUSTED_PEERS, separated by commas, of
+// the services allowed to forward the address and user agent of their
+// clients, like the forum
+func trustedPeers() []string {
+	var peers []string
+	for _, cidr := range strings.Split(os.Getenv("TRUSTED_PEERS"), ",") {
+		if cidr = strings.TrimSpace(cidr); cidr != "" {
+			peers = append(peers, cidr)
+		}
+	}
+	return peers
+}
+
+// oidcProviders configures the identity providers named in OIDC_PROVIDERS,
+// separated by commas, from the OIDC_<NAME>_ISSUER_URL, _CLIENT_ID,
+// _CLIENT_SECRET and _REDIRECT_URL environment variables. Providers that
+// can't be discovered are left out rather than keeping the service down.
+func oidcProviders(log *logger.Logger) map[string]domain.IdentityProvider {
+	providers := map[string]domain.IdentityProvider{}
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		provider, err := oidc.NewProvider(oidc.Config{
+			IssuerURL:    os.Getenv(prefix + "ISSUER_URL"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+		})
+		if err != nil {
+			log.Error("Failed to configure identity provider", zap.String("provider", name), zap.Error(err))
+			continue
+		}
+		providers[name] = provider
+	}
+
+	return providers
+}
+
+// smtpMailer configures the mailer from the SMTP_ADDR, SMTP_USERNAME,
+// SMTP_PASSWORD, SMTP_FROM and CONFIRM_EMAIL_URL environment variables.
+// Without it email changes are refused.
+func smtpMailer(log *logger.Logger) domain.Mailer {
+	if os.Getenv("SMTP_ADDR") == "" {
+		log.Warn("SMTP_ADDR not set, email changes are disabled")
+		return nil
+	}
+
+	m, err := mailer.NewSMTPMailer(mailer.Config{
+		Addr:            os.Getenv("SMTP_ADDR"),
+		Username:        os.Getenv("SMTP_USERNAME"),
+		Password:        os.Getenv("SMTP_PASSWORD"),
+		From:            os.Getenv("SMTP_FROM"),
+		ConfirmEmailURL: os.Getenv("CONFIRM_EMAIL_URL"),
+	})
+	if err != nil {
+		log.Error("Failed to configure mailer", zap.Error(err))
+		return nil
+	}
+
+	return m
+}
@@ -2,29 +2,52 @@ package grpc
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
 
 	"github.com/chizheg/forum/internal/auth/domain"
+	"github.com/chizheg/forum/pkg/audit"
 	pb "github.com/chizheg/forum/proto"
 	"go.uber.org/zap"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 )
 
 type AuthServer struct {
 	pb.UnimplementedAuthServiceServer
 	service domain.Service
-	logger  *zap.Logger
+	// trustedPeers are the networks of the services, like the forum, whose
+	// forwarded client address and user agent are used in audit entries
+	trustedPeers []*net.IPNet
+	logger       *zap.Logger
 }
 
-func NewAuthServer(service domain.Service, logger *zap.Logger) *AuthServer {
-	return &AuthServer{
-		service: service,
-		logger:  logger,
+// NewAuthServer creates the gRPC server, trustedPeers are CIDRs
+func NewAuthServer(service domain.Service, trustedPeers []string, logger *zap.Logger) (*AuthServer, error) {
+	peers := make([]*net.IPNet, 0, len(trustedPeers))
+	for _, cidr := range trustedPeers {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing trusted peer: %w", err)
+		}
+		peers = append(peers, network)
 	}
+
+	return &AuthServer{
+		service:      service,
+		trustedPeers: peers,
+		logger:       logger,
+	}, nil
 }
 
 func (s *AuthServer) Register(ctx context.Context, req *pb.RegisterRequest) (*pb.RegisterResponse, error) {
-	token, err := s.service.Register(req.Username, req.Email, req.Password)
+	token, err := s.service.Register(req.Username, req.Email, req.Password, s.sourceFromContext(ctx))
 	if err != nil {
 		s.logger.Error("failed to register user", zap.Error(err))
 		return &pb.RegisterResponse{
@@ -39,20 +62,22 @@ func (s *AuthServer) Register(ctx context.Context, req *pb.RegisterRequest) (*pb
 	}, nil
 }
 
-func (s *AuthServer) Login(ctx context.Context, req *pb.LoginRequest) (*pb.LoginResponse, error) {
-	token, err := s.service.Login(req.Username, req.Password)
+func (s *AuthServer) Login(ctx context.Context, req *pb.LoginRequest) (*pb.AuthResponse, error) {
+	result, err := s.service.Login(req.Username, req.Password, s.sourceFromContext(ctx))
 	if err != nil {
-		s.logger.Error("failed to login user", zap.Error(err))
-		return &pb.LoginResponse{
-			Success: false,
-			Error:   err.Error(),
-		}, status.Error(codes.Internal, err.Error())
+		return &pb.AuthResponse{Error: err.Error()}, s.statusError("failed to login user", err)
 	}
 
-	return &pb.LoginResponse{
-		Success: true,
-		Token:   token,
-	}, nil
+	return authResponse(result), nil
+}
+
+func (s *AuthServer) VerifyLogin(ctx context.Context, req *pb.VerifyLoginRequest) (*pb.AuthResponse, error) {
+	result, err := s.service.VerifyLogin(req.ChallengeToken, req.Code, s.sourceFromContext(ctx))
+	if err != nil {
+		return &pb.AuthResponse{Error: err.Error()}, s.statusError("failed to verify login", err)
+	}
+
+	return authResponse(result), nil
 }
 
 func (s *AuthServer) ValidateToken(ctx context.Context, req *pb.ValidateTokenRequest) (*pb.ValidateTokenResponse, error) {
@@ -70,3 +95,544 @@ func (s *AuthServer) ValidateToken(ctx context.Context, req *pb.ValidateTokenReq
 		UserId: int32(userID),
 	}, nil
 }
+
+func (s *AuthServer) GetUsers(ctx context.Context, req *pb.GetUsersRequest) (*pb.GetUsersResponse, error) {
+	ids := make([]int, len(req.UserIds))
+	for i, id := range req.UserIds {
+		ids[i] = int(id)
+	}
+
+	users, err := s.service.GetUsers(ids)
+	if err != nil {
+		s.logger.Error("failed to get users", zap.Error(err))
+		return &pb.GetUsersResponse{
+			Error: err.Error(),
+		}, status.Error(codes.Internal, err.Error())
+	}
+
+	byUsername, err := s.service.GetUsersByUsernames(req.Usernames)
+	if err != nil {
+		s.logger.Error("failed to get users", zap.Error(err))
+		return &pb.GetUsersResponse{
+			Error: err.Error(),
+		}, status.Error(codes.Internal, err.Error())
+	}
+
+	resp := &pb.GetUsersResponse{
+		Users: make([]*pb.UserInfo, 0, len(users)+len(byUsername)),
+	}
+	seen := make(map[int]bool, cap(resp.Users))
+	for _, user := range append(users, byUsername...) {
+		if seen[user.ID] {
+			continue
+		}
+		seen[user.ID] = true
+
+		resp.Users = append(resp.Users, &pb.UserInfo{
+			Id:        int32(user.ID),
+			Username:  user.Username,
+			Role:      user.Role,
+			CreatedAt: user.CreatedAt.Unix(),
+		})
+	}
+
+	return resp, nil
+}
+
+func (s *AuthServer) Logout(ctx context.Context, req *pb.LogoutRequest) (*pb.LogoutResponse, error) {
+	if err := s.service.Logout(req.Token, s.sourceFromContext(ctx)); err != nil {
+		return &pb.LogoutResponse{Error: err.Error()}, s.statusError("failed to logout user", err)
+	}
+
+	return &pb.LogoutResponse{Success: true}, nil
+}
+
+func (s *AuthServer) GetAuditLog(ctx context.Context, req *pb.GetAuditLogRequest) (*pb.GetAuditLogResponse, error) {
+	filter := audit.Filter{
+		ActorID: int(req.ActorId),
+		Action:  audit.Action(req.Action),
+		Limit:   int(req.Limit),
+		Offset:  int(req.Offset),
+	}
+	if req.Since != 0 {
+		filter.Since = time.Unix(req.Since, 0)
+	}
+	if req.Until != 0 {
+		filter.Until = time.Unix(req.Until, 0)
+	}
+
+	entries, err := s.service.GetAuditLog(req.Token, filter)
+	if err != nil {
+		return &pb.GetAuditLogResponse{Error: err.Error()}, s.statusError("failed to get audit log", err)
+	}
+
+	resp := &pb.GetAuditLogResponse{
+		Entries: make([]*pb.AuditEntry, len(entries)),
+	}
+	for i, entry := range entries {
+		details, _ := json.Marshal(entry.Details)
+		resp.Entries[i] = &pb.AuditEntry{
+			Id:         entry.ID,
+			ActorId:    int32(entry.ActorID),
+			Action:     string(entry.Action),
+			TargetType: entry.TargetType,
+			TargetId:   int32(entry.TargetID),
+			Ip:         entry.IP,
+			UserAgent:  entry.UserAgent,
+			Details:    string(details),
+			CreatedAt:  entry.CreatedAt.Unix(),
+		}
+	}
+
+	return resp, nil
+}
+
+func (s *AuthServer) ListUsers(ctx context.Context, req *pb.ListUsersRequest) (*pb.ListUsersResponse, error) {
+	users, total, err := s.service.ListUsers(req.Token, domain.UserFilter{
+		Query:    req.Query,
+		Role:     req.Role,
+		Disabled: req.DisabledOnly,
+		Limit:    int(req.Limit),
+		Offset:   int(req.Offset),
+	})
+	if err != nil {
+		return &pb.ListUsersResponse{Error: err.Error()}, s.statusError("failed to list users", err)
+	}
+
+	resp := &pb.ListUsersResponse{
+		Users: make([]*pb.UserDetails, len(users)),
+		Total: int32(total),
+	}
+	for i, user := range users {
+		resp.Users[i] = userDetails(user)
+	}
+
+	return resp, nil
+}
+
+func (s *AuthServer) ChangeUserRole(ctx context.Context, req *pb.ChangeUserRoleRequest) (*pb.ChangeUserRoleResponse, error) {
+	user, err := s.service.ChangeRole(req.Token, int(req.UserId), req.Role, s.sourceFromContext(ctx))
+	if err != nil {
+		return &pb.ChangeUserRoleResponse{Error: err.Error()}, s.statusError("failed to change user role", err)
+	}
+
+	return &pb.ChangeUserRoleResponse{User: userDetails(user)}, nil
+}
+
+func (s *AuthServer) DisableUser(ctx context.Context, req *pb.UserActionRequest) (*pb.UserActionResponse, error) {
+	if err := s.service.DisableUser(req.Token, int(req.UserId), s.sourceFromContext(ctx)); err != nil {
+		return &pb.UserActionResponse{Error: err.Error()}, s.statusError("failed to disable user", err)
+	}
+
+	return &pb.UserActionResponse{Success: true}, nil
+}
+
+func (s *AuthServer) EnableUser(ctx context.Context, req *pb.UserActionRequest) (*pb.UserActionResponse, error) {
+	if err := s.service.EnableUser(req.Token, int(req.UserId), s.sourceFromContext(ctx)); err != nil {
+		return &pb.UserActionResponse{Error: err.Error()}, s.statusError("failed to enable user", err)
+	}
+
+	return &pb.UserActionResponse{Success: true}, nil
+}
+
+func (s *AuthServer) ForcePasswordReset(ctx context.Context, req *pb.UserActionRequest) (*pb.ForcePasswordResetResponse, error) {
+	resetToken, err := s.service.ForcePasswordReset(req.Token, int(req.UserId), s.sourceFromContext(ctx))
+	if err != nil {
+		return &pb.ForcePasswordResetResponse{Error: err.Error()}, s.statusError("failed to force password reset", err)
+	}
+
+	return &pb.ForcePasswordResetResponse{ResetToken: resetToken}, nil
+}
+
+func (s *AuthServer) ResetPassword(ctx context.Context, req *pb.ResetPasswordRequest) (*pb.UserActionResponse, error) {
+	if err := s.service.ResetPassword(req.ResetToken, req.NewPassword, s.sourceFromContext(ctx)); err != nil {
+		return &pb.UserActionResponse{Error: err.Error()}, s.statusError("failed to reset password", err)
+	}
+
+	return &pb.UserActionResponse{Success: true}, nil
+}
+
+func (s *AuthServer) GetProfile(ctx context.Context, req *pb.GetProfileRequest) (*pb.ProfileResponse, error) {
+	profile, err := s.service.GetProfile(int(req.UserId))
+	if err != nil {
+		return &pb.ProfileResponse{Error: err.Error()}, s.statusError("failed to get profile", err)
+	}
+
+	return &pb.ProfileResponse{Profile: profileInfo(profile)}, nil
+}
+
+func (s *AuthServer) GetProfilesBatch(ctx context.Context, req *pb.GetProfilesBatchRequest) (*pb.GetProfilesBatchResponse, error) {
+	ids := make([]int, len(req.UserIds))
+	for i, id := range req.UserIds {
+		ids[i] = int(id)
+	}
+
+	profiles, err := s.service.GetProfilesBatch(ids)
+	if err != nil {
+		return &pb.GetProfilesBatchResponse{Error: err.Error()}, s.statusError("failed to get profiles", err)
+	}
+
+	resp := &pb.GetProfilesBatchResponse{
+		Profiles: make([]*pb.Profile, len(profiles)),
+	}
+	for i, profile := range profiles {
+		resp.Profiles[i] = profileInfo(profile)
+	}
+
+	return resp, nil
+}
+
+func (s *AuthServer) UpdateProfile(ctx context.Context, req *pb.UpdateProfileRequest) (*pb.ProfileResponse, error) {
+	profile, err := s.service.UpdateProfile(req.Token, &domain.Profile{
+		DisplayName: req.DisplayName,
+		AvatarURL:   req.AvatarUrl,
+		Bio:         req.Bio,
+		Timezone:    req.Timezone,
+	})
+	if err != nil {
+		return &pb.ProfileResponse{Error: err.Error()}, s.statusError("failed to update profile", err)
+	}
+
+	return &pb.ProfileResponse{Profile: profileInfo(profile)}, nil
+}
+
+func (s *AuthServer) ChangePassword(ctx context.Context, req *pb.ChangePasswordRequest) (*pb.UserActionResponse, error) {
+	if err := s.service.ChangePassword(req.Token, req.CurrentPassword, req.Code, req.NewPassword, s.sourceFromContext(ctx)); err != nil {
+		return &pb.UserActionResponse{Error: err.Error()}, s.statusError("failed to change password", err)
+	}
+
+	return &pb.UserActionResponse{Success: true}, nil
+}
+
+func (s *AuthServer) ChangeEmail(ctx context.Context, req *pb.ChangeEmailRequest) (*pb.UserActionResponse, error) {
+	if err := s.service.ChangeEmail(req.Token, req.CurrentPassword, req.NewEmail, s.sourceFromContext(ctx)); err != nil {
+		return &pb.UserActionResponse{Error: err.Error()}, s.statusError("failed to change email", err)
+	}
+
+	return &pb.UserActionResponse{Success: true}, nil
+}
+
+func (s *AuthServer) ConfirmEmailChange(ctx context.Context, req *pb.ConfirmEmailChangeRequest) (*pb.UserActionResponse, error) {
+	if err := s.service.ConfirmEmailChange(req.VerificationToken, s.sourceFromContext(ctx)); err != nil {
+		return &pb.UserActionResponse{Error: err.Error()}, s.statusError("failed to confirm email change", err)
+	}
+
+	return &pb.UserActionResponse{Success: true}, nil
+}
+
+func (s *AuthServer) DeleteAccount(ctx context.Context, req *pb.DeleteAccountRequest) (*pb.UserActionResponse, error) {
+	if err := s.service.DeleteAccount(req.Token, req.Password, s.sourceFromContext(ctx)); err != nil {
+		return &pb.UserActionResponse{Error: err.Error()}, s.statusError("failed to delete account", err)
+	}
+
+	return &pb.UserActionResponse{Success: true}, nil
+}
+
+func (s *AuthServer) ExportAccount(ctx context.Context, req *pb.ExportAccountRequest) (*pb.ExportAccountResponse, error) {
+	export, err := s.service.ExportAccount(req.Token, s.sourceFromContext(ctx))
+	if err != nil {
+		return &pb.ExportAccountResponse{Error: err.Error()}, s.statusError("failed to export account", err)
+	}
+
+	// Session tokens are credentials, they are never exported
+	resp := &pb.ExportAccountResponse{
+		User:     userDetails(export.User),
+		Profile:  profileInfo(export.Profile),
+		Sessions: make([]*pb.SessionInfo, len(export.Sessions)),
+	}
+	for i, session := range export.Sessions {
+		resp.Sessions[i] = &pb.SessionInfo{
+			Id:        int32(session.ID),
+			CreatedAt: session.CreatedAt.Unix(),
+			ExpiresAt: session.ExpiresAt.Unix(),
+			Current:   session.Token == req.Token,
+		}
+	}
+
+	return resp, nil
+}
+
+func (s *AuthServer) GetAccountDeletions(ctx context.Context, req *pb.GetAccountDeletionsRequest) (*pb.GetAccountDeletionsResponse, error) {
+	deletions, err := s.service.GetAccountDeletions(req.AfterId, int(req.Limit))
+	if err != nil {
+		return &pb.GetAccountDeletionsResponse{Error: err.Error()}, s.statusError("failed to get account deletions", err)
+	}
+
+	resp := &pb.GetAccountDeletionsResponse{
+		Deletions: make([]*pb.AccountDeletion, len(deletions)),
+	}
+	for i, deletion := range deletions {
+		resp.Deletions[i] = &pb.AccountDeletion{
+			Id:        deletion.ID,
+			UserId:    int32(deletion.UserID),
+			DeletedAt: deletion.DeletedAt.Unix(),
+		}
+	}
+
+	return resp, nil
+}
+
+func profileInfo(profile *domain.Profile) *pb.Profile {
+	return &pb.Profile{
+		UserId:      int32(profile.UserID),
+		Username:    profile.Username,
+		DisplayName: profile.DisplayName,
+		AvatarUrl:   profile.AvatarURL,
+		Bio:         profile.Bio,
+		Timezone:    profile.Timezone,
+		UpdatedAt:   profile.UpdatedAt.Unix(),
+	}
+}
+
+func userDetails(user *domain.User) *pb.UserDetails {
+	details := &pb.UserDetails{
+		Id:                    int32(user.ID),
+		Username:              user.Username,
+		Email:                 user.Email,
+		Role:                  user.Role,
+		PasswordResetRequired: user.PasswordResetRequired,
+		TwoFactorEnabled:      user.TOTPEnabledAt != nil,
+		CreatedAt:             user.CreatedAt.Unix(),
+	}
+	if user.DisabledAt != nil {
+		details.DisabledAt = user.DisabledAt.Unix()
+	}
+	if user.DeletedAt != nil {
+		details.DeletedAt = user.DeletedAt.Unix()
+	}
+
+	return details
+}
+
+func (s *AuthServer) EnrollTOTP(ctx context.Context, req *pb.EnrollTOTPRequest) (*pb.EnrollTOTPResponse, error) {
+	enrollment, err := s.service.EnrollTOTP(req.Token)
+	if err != nil {
+		return &pb.EnrollTOTPResponse{Error: err.Error()}, s.statusError("failed to enroll totp", err)
+	}
+
+	return &pb.EnrollTOTPResponse{
+		Secret:     enrollment.Secret,
+		OtpauthUri: enrollment.URI,
+	}, nil
+}
+
+func (s *AuthServer) ConfirmTOTP(ctx context.Context, req *pb.TwoFactorCodeRequest) (*pb.RecoveryCodesResponse, error) {
+	codes, err := s.service.ConfirmTOTP(req.Token, req.Code, s.sourceFromContext(ctx))
+	if err != nil {
+		return &pb.RecoveryCodesResponse{Error: err.Error()}, s.statusError("failed to confirm totp", err)
+	}
+
+	return &pb.RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+func (s *AuthServer) DisableTOTP(ctx context.Context, req *pb.DisableTOTPRequest) (*pb.UserActionResponse, error) {
+	if err := s.service.DisableTOTP(req.Token, req.Password, req.Code, s.sourceFromContext(ctx)); err != nil {
+		return &pb.UserActionResponse{Error: err.Error()}, s.statusError("failed to disable totp", err)
+	}
+
+	return &pb.UserActionResponse{Success: true}, nil
+}
+
+func (s *AuthServer) RegenerateRecoveryCodes(ctx context.Context, req *pb.TwoFactorCodeRequest) (*pb.RecoveryCodesResponse, error) {
+	codes, err := s.service.RegenerateRecoveryCodes(req.Token, req.Code, s.sourceFromContext(ctx))
+	if err != nil {
+		return &pb.RecoveryCodesResponse{Error: err.Error()}, s.statusError("failed to regenerate recovery codes", err)
+	}
+
+	return &pb.RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+func (s *AuthServer) StartOIDCLogin(ctx context.Context, req *pb.StartOIDCLoginRequest) (*pb.StartOIDCLoginResponse, error) {
+	authURL, err := s.service.StartOIDCLogin(req.Provider)
+	if err != nil {
+		return &pb.StartOIDCLoginResponse{Error: err.Error()}, s.statusError("failed to start oidc login", err)
+	}
+
+	return &pb.StartOIDCLoginResponse{AuthorizationUrl: authURL}, nil
+}
+
+func (s *AuthServer) StartOIDCLink(ctx context.Context, req *pb.StartOIDCLoginRequest) (*pb.StartOIDCLoginResponse, error) {
+	authURL, err := s.service.StartOIDCLink(req.Token, req.Provider)
+	if err != nil {
+		return &pb.StartOIDCLoginResponse{Error: err.Error()}, s.statusError("failed to start oidc link", err)
+	}
+
+	return &pb.StartOIDCLoginResponse{AuthorizationUrl: authURL}, nil
+}
+
+func (s *AuthServer) CompleteOIDCLogin(ctx context.Context, req *pb.CompleteOIDCLoginRequest) (*pb.AuthResponse, error) {
+	result, err := s.service.CompleteOIDCLogin(req.Provider, req.State, req.Code, s.sourceFromContext(ctx))
+	if err != nil {
+		return &pb.AuthResponse{Error: err.Error()}, s.statusError("failed to complete oidc login", err)
+	}
+
+	return authResponse(result), nil
+}
+
+func (s *AuthServer) GetIdentities(ctx context.Context, req *pb.GetIdentitiesRequest) (*pb.GetIdentitiesResponse, error) {
+	identities, err := s.service.GetIdentities(req.Token)
+	if err != nil {
+		return &pb.GetIdentitiesResponse{Error: err.Error()}, s.statusError("failed to get identities", err)
+	}
+
+	resp := &pb.GetIdentitiesResponse{Identities: make([]*pb.IdentityInfo, 0, len(identities))}
+	for _, identity := range identities {
+		resp.Identities = append(resp.Identities, identityInfo(identity))
+	}
+
+	return resp, nil
+}
+
+func (s *AuthServer) UnlinkIdentity(ctx context.Context, req *pb.UnlinkIdentityRequest) (*pb.UserActionResponse, error) {
+	if err := s.service.UnlinkIdentity(req.Token, req.Provider, s.sourceFromContext(ctx)); err != nil {
+		return &pb.UserActionResponse{Error: err.Error()}, s.statusError("failed to unlink identity", err)
+	}
+
+	return &pb.UserActionResponse{Success: true}, nil
+}
+
+func identityInfo(identity *domain.Identity) *pb.IdentityInfo {
+	return &pb.IdentityInfo{
+		Provider:  identity.Provider,
+		Subject:   identity.Subject,
+		Email:     identity.Email,
+		CreatedAt: identity.CreatedAt.Unix(),
+	}
+}
+
+func authResponse(result *domain.LoginResult) *pb.AuthResponse {
+	resp := &pb.AuthResponse{
+		Token:         result.Token,
+		RecoveryCodes: result.RecoveryCodes,
+	}
+	if c := result.Challenge; c != nil {
+		resp.Challenge = &pb.LoginChallenge{
+			Token:     c.Token,
+			ExpiresAt: c.ExpiresAt.Unix(),
+		}
+		if c.Enrollment != nil {
+			resp.Challenge.EnrollmentRequired = true
+			resp.Challenge.TotpSecret = c.Enrollment.Secret
+			resp.Challenge.OtpauthUri = c.Enrollment.URI
+		}
+	}
+	if result.LinkedIdentity != nil {
+		resp.LinkedIdentity = identityInfo(result.LinkedIdentity)
+	}
+
+	return resp
+}
+
+// statusError maps domain errors to gRPC status errors, unexpected errors
+// are logged with the message
+func (s *AuthServer) statusError(msg string, err error) error {
+	code := codes.Internal
+	switch {
+	case errors.Is(err, domain.ErrUserNotFound),
+		errors.Is(err, domain.ErrUnknownProvider),
+		errors.Is(err, domain.ErrIdentityNotFound):
+		code = codes.NotFound
+	case errors.Is(err, domain.ErrForbidden),
+		errors.Is(err, domain.ErrCannotModifySelf):
+		code = codes.PermissionDenied
+	case errors.Is(err, domain.ErrSessionNotFound),
+		errors.Is(err, domain.ErrSessionExpired),
+		errors.Is(err, domain.ErrUserDisabled),
+		errors.Is(err, domain.ErrInvalidPassword),
+		errors.Is(err, domain.ErrInvalidChallenge),
+		errors.Is(err, domain.ErrInvalidCode),
+		errors.Is(err, domain.ErrInvalidOIDCState),
+		errors.Is(err, domain.ErrInvalidAuthCode),
+		errors.Is(err, domain.ErrInvalidIDToken):
+		code = codes.Unauthenticated
+	case errors.Is(err, domain.ErrTwoFactorEnabled),
+		errors.Is(err, domain.ErrTwoFactorNotEnabled),
+		errors.Is(err, domain.ErrTwoFactorNotEnrolled),
+		errors.Is(err, domain.ErrTwoFactorRequired),
+		errors.Is(err, domain.ErrEmailNotVerified),
+		errors.Is(err, domain.ErrLastSignInMethod),
+		errors.Is(err, domain.ErrEmailDeliveryDisabled),
+		errors.Is(err, domain.ErrPasswordResetRequired),
+		errors.Is(err, domain.ErrReauthenticationRequired):
+		code = codes.FailedPrecondition
+	case errors.Is(err, domain.ErrEmailTaken),
+		errors.Is(err, domain.ErrIdentityLinked),
+		errors.Is(err, domain.ErrUsernameTaken):
+		code = codes.AlreadyExists
+	case errors.Is(err, domain.ErrTooManyCodeAttempts):
+		code = codes.ResourceExhausted
+	case errors.Is(err, domain.ErrInvalidRole),
+		errors.Is(err, domain.ErrInvalidResetToken),
+		errors.Is(err, domain.ErrPasswordTooShort),
+		errors.Is(err, domain.ErrDisplayNameTooLong),
+		errors.Is(err, domain.ErrInvalidDisplayName),
+		errors.Is(err, domain.ErrBioTooLong),
+		errors.Is(err, domain.ErrInvalidAvatarURL),
+		errors.Is(err, domain.ErrInvalidTimezone),
+		errors.Is(err, domain.ErrInvalidEmail),
+		errors.Is(err, domain.ErrEmailUnchanged),
+		errors.Is(err, domain.ErrInvalidVerificationToken),
+		errors.Is(err, audit.ErrInvalidFilter):
+		code = codes.InvalidArgument
+	default:
+		s.logger.Error(msg, zap.Error(err))
+	}
+
+	return status.Error(code, err.Error())
+}
+
+// sourceFromContext returns where the request came from. Services calling
+// on behalf of a user forward the client address in x-forwarded-for and
+// its user agent in x-forwarded-user-agent, this metadata is only read
+// from trusted peers. x-forwarded-for is walked from the right so
+// addresses prepended by the client are ignored.
+func (s *AuthServer) sourceFromContext(ctx context.Context) audit.Source {
+	var source audit.Source
+
+	var ip net.IP
+	if p, ok := peer.FromContext(ctx); ok {
+		source.IP = p.Addr.String()
+		if host, _, err := net.SplitHostPort(source.IP); err == nil {
+			source.IP = host
+		}
+		ip = net.ParseIP(source.IP)
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get("user-agent"); len(values) > 0 {
+		source.UserAgent = values[0]
+	}
+
+	if ip == nil || !s.trusted(ip) {
+		return source
+	}
+
+	if values := md.Get("x-forwarded-for"); len(values) > 0 {
+		hops := strings.Split(strings.Join(values, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := net.ParseIP(strings.TrimSpace(hops[i]))
+			if hop == nil {
+				break
+			}
+			ip = hop
+			if !s.trusted(hop) {
+				break
+			}
+		}
+		source.IP = ip.String()
+	}
+	if values := md.Get("x-forwarded-user-agent"); len(values) > 0 {
+		source.UserAgent = values[0]
+	}
+
+	return source
+}
+
+func (s *AuthServer) trusted(ip net.IP) bool {
+	for _, network := range s.trustedPeers {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidEmail             = errors.New("invalid email")
+	ErrEmailTaken               = errors.New("email is already in use")
+	ErrEmailUnchanged           = errors.New("new email is the current email")
+	ErrInvalidVerificationToken = errors.New("invalid or expired verification token")
+	ErrEmailDeliveryDisabled    = errors.New("email delivery is not configured")
+	ErrReauthenticationRequired = errors.New("sign in again to confirm this change")
+)
+
+// Mailer delivers emails to users
+type Mailer interface {
+	// SendEmailChange sends the token confirming a change of email to the
+	// new address
+	SendEmailChange(email, verificationToken string) error
+}
+
+// EmailChange is a pending change of the email of a user. The new address
+// only replaces the old one once it is verified with the one-time token,
+// of which only the hash is stored.
+type EmailChange struct {
+	ID        int
+	UserID    int
+	NewEmail  string
+	TokenHash string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+// AccountDeletion records that a user deleted their account, for other
+// services to erase their data of the user. IDs only increase, consumers
+// resume after the last deletion they handled.
+type AccountDeletion struct {
+	ID        int64
+	UserID    int
+	DeletedAt time.Time
+}
+
+// AccountExport is the data the auth service keeps about a user
+type AccountExport struct {
+	User     *User
+	Profile  *Profile
+	Sessions []*Session
+}
@@ -0,0 +1,44 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidRole           = errors.New("invalid role")
+	ErrCannotModifySelf      = errors.New("admins can't change their own account")
+	ErrPasswordResetRequired = errors.New("password reset required")
+	ErrInvalidResetToken     = errors.New("invalid or expired password reset token")
+	ErrPasswordTooShort      = errors.New("password is too short")
+)
+
+// UserFilter selects a page of users for admins
+type UserFilter struct {
+	// Query matches part of the username or email, case-insensitively
+	Query string
+	Role  string
+	// Disabled limits the list to disabled accounts
+	Disabled bool
+	Limit    int
+	Offset   int
+}
+
+// PasswordReset is a one-time token letting a user set a new password
+// after an admin forced a reset. Only the hash of the token is stored.
+type PasswordReset struct {
+	ID        int
+	UserID    int
+	TokenHash string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+// ValidRole reports whether the role exists
+func ValidRole(role string) bool {
+	switch role {
+	case RoleUser, RoleModerator, RoleAdmin:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrUnknownProvider  = errors.New("unknown identity provider")
+	ErrInvalidOIDCState = errors.New("invalid or expired sign-in state")
+	ErrInvalidAuthCode  = errors.New("authorization code was rejected")
+	ErrInvalidIDToken   = errors.New("invalid id token")
+	ErrEmailNotVerified = errors.New("identity provider did not return a verified email")
+	ErrIdentityLinked   = errors.New("identity is already linked to an account")
+	ErrIdentityNotFound = errors.New("identity not found")
+	ErrUsernameTaken    = errors.New("username is already taken")
+	ErrLastSignInMethod = errors.New("cannot unlink the only way to sign in")
+)
+
+// ExternalIdentity is a user as asserted by the verified ID token of a
+// provider
+type ExternalIdentity struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+}
+
+// IdentityProvider is an OpenID Connect provider users can sign in with
+type IdentityProvider interface {
+	// AuthCodeURL returns the URL of the authorization endpoint to send the
+	// user to. The code verifier is only sent as its S256 challenge.
+	AuthCodeURL(state, nonce, codeVerifier string) string
+	// Exchange redeems the authorization code and returns the identity of
+	// the ID token after checking its signature, audience and nonce
+	Exchange(code, codeVerifier, nonce string) (*ExternalIdentity, error)
+}
+
+// Identity links the subject of a provider to a user
+type Identity struct {
+	ID       int    `json:"id"`
+	UserID   int    `json:"user_id"`
+	Provider string `json:"provider"`
+	Subject  string `json:"subject"`
+	// Email is the address the provider reported when the identity was
+	// linked, for display only
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OIDCState is a sign-in waiting for the user to come back from the
+// provider. Only the hash of the state is stored.
+type OIDCState struct {
+	ID           int
+	Provider     string
+	StateHash    string
+	Nonce        string
+	CodeVerifier string
+	// LinkUserID is set when a signed in user links the provider to their
+	// account instead of signing in
+	LinkUserID int
+	ExpiresAt  time.Time
+	CreatedAt  time.Time
+}
@@ -0,0 +1,27 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrDisplayNameTooLong = errors.New("display name is too long")
+	ErrInvalidDisplayName = errors.New("display name contains invalid characters")
+	ErrBioTooLong         = errors.New("bio is too long")
+	ErrInvalidAvatarURL   = errors.New("avatar must be an http or https URL")
+	ErrInvalidTimezone    = errors.New("unknown timezone")
+)
+
+// Profile is the public information users show about themselves
+type Profile struct {
+	UserID   int    `json:"user_id"`
+	Username string `json:"username"`
+	// DisplayName falls back to the username when the user hasn't set one
+	DisplayName string `json:"display_name"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+	Bio         string `json:"bio,omitempty"`
+	// Timezone is an IANA time zone name such as Europe/Moscow
+	Timezone  string    `json:"timezone"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,53 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidChallenge     = errors.New("invalid or expired login challenge")
+	ErrInvalidCode          = errors.New("invalid two-factor code")
+	ErrTwoFactorEnabled     = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled  = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorNotEnrolled = errors.New("two-factor enrollment has not been started")
+	ErrTwoFactorRequired    = errors.New("two-factor authentication is required for this role")
+	ErrTooManyCodeAttempts  = errors.New("too many invalid two-factor codes, try again later")
+)
+
+// LoginResult is the outcome of a login step. Accounts with two-factor
+// authentication get a challenge to complete with VerifyLogin instead of a
+// session token.
+type LoginResult struct {
+	Token     string
+	Challenge *LoginChallenge
+	// RecoveryCodes are set once, when the login completed an enrollment
+	RecoveryCodes []string
+	// LinkedIdentity is set instead of the token when a signed in user
+	// linked an identity provider
+	LinkedIdentity *Identity
+}
+
+// LoginChallenge is the pending second step of a login. Only the hash of
+// the token is stored, Token is only set when the challenge is created.
+type LoginChallenge struct {
+	ID        int
+	UserID    int
+	Token     string
+	TokenHash string
+	// Attempts counts the invalid codes entered so far
+	Attempts  int
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	// Enrollment is set when the role of the user requires two-factor
+	// authentication but it is not set up yet, the login then completes
+	// the enrollment
+	Enrollment *TOTPEnrollment
+}
+
+// TOTPEnrollment is a secret waiting to be confirmed with a first code
+type TOTPEnrollment struct {
+	Secret string
+	// URI is the otpauth URI of the secret for authenticator apps
+	URI string
+}
@@ -1,15 +1,48 @@
 package domain
 
-import "time"
+import (
+	"errors"
+	"time"
+
+	"github.com/chizheg/forum/pkg/audit"
+)
+
+var (
+	ErrUserNotFound    = errors.New("user not found")
+	ErrSessionNotFound = errors.New("session not found")
+	ErrSessionExpired  = errors.New("session expired")
+	ErrInvalidPassword = errors.New("invalid password")
+	ErrForbidden       = errors.New("forbidden")
+	ErrUserDisabled    = errors.New("account is disabled")
+)
+
+// User roles as stored in the user_role enum
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
 
 // User represents the user entity
 type User struct {
-	ID           int       `json:"id"`
-	Username     string    `json:"username"`
-	Email        string    `json:"email"`
-	PasswordHash string    `json:"-"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID           int    `json:"id"`
+	Username     string `json:"username"`
+	Email        string `json:"email"`
+	PasswordHash string `json:"-"`
+	Role         string `json:"role"`
+	// DisabledAt is set while an admin has disabled the account
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+	// PasswordResetRequired blocks logins until the password is reset
+	PasswordResetRequired bool `json:"password_reset_required"`
+	// DeletedAt is set once the user deleted the account, the record is
+	// kept anonymized
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// TOTPSecret is the pending or active two-factor secret, it is active
+	// once TOTPEnabledAt is set
+	TOTPSecret    string     `json:"-"`
+	TOTPEnabledAt *time.Time `json:"totp_enabled_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
 }
 
 // Session represents a user session
@@ -19,6 +52,8 @@ type Session struct {
 	Token     string    `json:"token"`
 	ExpiresAt time.Time `json:"expires_at"`
 	CreatedAt time.Time `json:"created_at"`
+	// UserDisabled reports whether the account of the session is disabled
+	UserDisabled bool `json:"-"`
 }
 
 // Repository defines the interface for user data access
@@ -26,14 +61,171 @@ type Repository interface {
 	CreateUser(user *User) error
 	GetUserByUsername(username string) (*User, error)
 	GetUserByID(id int) (*User, error)
+	GetUsersByIDs(ids []int) ([]*User, error)
+	GetUsersByUsernames(usernames []string) ([]*User, error)
 	CreateSession(session *Session) error
 	GetSessionByToken(token string) (*Session, error)
 	DeleteSession(token string) error
+
+	// ListUsers returns a page of users matching the filter and the total
+	// number of matching users
+	ListUsers(filter UserFilter) ([]*User, int, error)
+	// UpdateRole sets the role of the user and returns the previous one
+	UpdateRole(userID int, role string) (string, error)
+	// SetDisabled disables or enables the account, it reports false if it
+	// already was
+	SetDisabled(userID int, disabled bool) (bool, error)
+	// DeleteUserSessions revokes every session of the user
+	DeleteUserSessions(userID int) (int, error)
+	// RequirePasswordReset blocks logins of the user, including those
+	// waiting for a second factor, and stores the reset
+	RequirePasswordReset(reset *PasswordReset) error
+	// ResetPassword sets the password of the user holding the unused,
+	// unexpired reset and clears the reset requirement
+	ResetPassword(tokenHash, passwordHash string) (int, error)
+
+	// GetProfiles returns the profiles of the existing users among ids
+	GetProfiles(ids []int) ([]*Profile, error)
+	UpdateProfile(profile *Profile) error
+
+	// UpdatePassword sets the password hash of the user
+	UpdatePassword(userID int, passwordHash string) error
+	// DeleteOtherSessions revokes every session of the user except the one
+	// of the token
+	DeleteOtherSessions(userID int, token string) (int, error)
+	// CreateEmailChange stores the change, replacing pending ones of the
+	// user
+	CreateEmailChange(change *EmailChange) error
+	// ConfirmEmailChange applies the unused, unexpired change and returns
+	// it
+	ConfirmEmailChange(tokenHash string) (*EmailChange, error)
+
+	// DeleteAccount anonymizes the user, removes their sessions and
+	// personal data and records the deletion
+	DeleteAccount(userID int) (*AccountDeletion, error)
+	// GetAccountDeletions returns the deletions after the given ID, oldest
+	// first
+	GetAccountDeletions(afterID int64, limit int) ([]*AccountDeletion, error)
+	GetUserSessions(userID int) ([]*Session, error)
+
+	// SetTOTPSecret stores a pending secret, it reports false if two-factor
+	// authentication is already enabled
+	SetTOTPSecret(userID int, secret string) (bool, error)
+	// EnableTOTP activates the pending secret, marks the step of the code
+	// used to confirm it as used and replaces the recovery codes
+	EnableTOTP(userID int, step int64, recoveryCodeHashes []string) error
+	// DisableTOTP removes the secret and the recovery codes
+	DisableTOTP(userID int) error
+	// UseTOTPStep marks the time step as used, it reports false if the
+	// step or a later one was already used
+	UseTOTPStep(userID int, step int64) (bool, error)
+	ReplaceRecoveryCodes(userID int, codeHashes []string) error
+	// UseRecoveryCode consumes the unused code, it reports false if there
+	// is none
+	UseRecoveryCode(userID int, codeHash string) (bool, error)
+	CreateLoginChallenge(challenge *LoginChallenge) error
+	// GetLoginChallenge returns the unexpired challenge of the token hash
+	GetLoginChallenge(tokenHash string) (*LoginChallenge, error)
+	// UseChallengeAttempt counts a code entered for the challenge and
+	// returns the attempts so far, it returns ErrInvalidChallenge once
+	// maxAttempts were counted
+	UseChallengeAttempt(id, maxAttempts int) (int, error)
+	// UseCodeAttempt counts a code entered at login by the user, it reports
+	// false if maxFailures were counted since the given time. Failures
+	// older than that start the count again.
+	UseCodeAttempt(userID, maxFailures int, since time.Time) (bool, error)
+	// ResetCodeFailures clears the count of UseCodeAttempt after a valid
+	// code
+	ResetCodeFailures(userID int) error
+	DeleteLoginChallenge(id int) error
+
+	CreateOIDCState(state *OIDCState) error
+	// ConsumeOIDCState deletes and returns the unexpired state of the
+	// provider, so each state is only used once
+	ConsumeOIDCState(provider, stateHash string) (*OIDCState, error)
+	GetIdentity(provider, subject string) (*Identity, error)
+	GetUserIdentities(userID int) ([]*Identity, error)
+	// CreateIdentity links the identity to its user, it fails with
+	// ErrIdentityLinked if the subject or the provider is already linked
+	CreateIdentity(identity *Identity) error
+	// CreateUserWithIdentity creates a user without a password together
+	// with the identity they signed up with
+	CreateUserWithIdentity(user *User, identity *Identity) error
+	DeleteIdentity(userID int, provider string) error
 }
 
 // Service defines the interface for user business logic
 type Service interface {
-	Register(username, email, password string) (string, error)
-	Login(username, password string) (string, error)
+	Register(username, email, password string, source audit.Source) (string, error)
+	// Login checks the password. Accounts with two-factor authentication,
+	// or whose role requires it, get a challenge instead of a session.
+	Login(username, password string, source audit.Source) (*LoginResult, error)
+	// VerifyLogin completes a challenge with a TOTP or recovery code
+	VerifyLogin(challengeToken, code string, source audit.Source) (*LoginResult, error)
+	// Logout revokes the session of the token
+	Logout(token string, source audit.Source) error
 	ValidateToken(token string) (int, error)
-} 
\ No newline at end of file
+	GetUsers(ids []int) ([]*User, error)
+	GetUsersByUsernames(usernames []string) ([]*User, error)
+	// GetAuditLog queries the audit log, the token must belong to an admin
+	GetAuditLog(token string, filter audit.Filter) ([]*audit.Entry, error)
+
+	// Admin user management, the token must belong to an admin
+	ListUsers(token string, filter UserFilter) ([]*User, int, error)
+	ChangeRole(token string, userID int, role string, source audit.Source) (*User, error)
+	// DisableUser disables the account and revokes its sessions
+	DisableUser(token string, userID int, source audit.Source) error
+	EnableUser(token string, userID int, source audit.Source) error
+	// ForcePasswordReset revokes the sessions of the user and blocks logins
+	// until the password is reset with the returned one-time token
+	ForcePasswordReset(token string, userID int, source audit.Source) (string, error)
+	ResetPassword(resetToken, newPassword string, source audit.Source) error
+
+	// Profiles
+	GetProfile(userID int) (*Profile, error)
+	GetProfilesBatch(ids []int) ([]*Profile, error)
+	// UpdateProfile replaces the profile of the user the token belongs to
+	UpdateProfile(token string, profile *Profile) (*Profile, error)
+
+	// Credentials, the current password of the user the token belongs to
+	// is required again. Accounts without a password pass an empty one and
+	// return ErrReauthenticationRequired unless the session is recent.
+	// ChangePassword also requires a TOTP or recovery code when two-factor
+	// authentication is enabled, and revokes every other session.
+	ChangePassword(token, currentPassword, code, newPassword string, source audit.Source) error
+	// ChangeEmail mails a one-time token to the new address, the email
+	// only changes once it is passed to ConfirmEmailChange
+	ChangeEmail(token, currentPassword, newEmail string, source audit.Source) error
+	ConfirmEmailChange(verificationToken string, source audit.Source) error
+
+	// DeleteAccount deletes the account of the token after checking the
+	// password, other services learn about it from GetAccountDeletions
+	DeleteAccount(token, password string, source audit.Source) error
+	// ExportAccount returns the data kept about the user of the token
+	ExportAccount(token string, source audit.Source) (*AccountExport, error)
+	GetAccountDeletions(afterID int64, limit int) ([]*AccountDeletion, error)
+
+	// Two-factor authentication of the user the token belongs to.
+	// EnrollTOTP starts an enrollment that ConfirmTOTP completes, which
+	// returns the recovery codes.
+	EnrollTOTP(token string) (*TOTPEnrollment, error)
+	ConfirmTOTP(token, code string, source audit.Source) ([]string, error)
+	// DisableTOTP requires the password and a code, it fails for roles
+	// that require two-factor authentication
+	DisableTOTP(token, password, code string, source audit.Source) error
+	RegenerateRecoveryCodes(token, code string, source audit.Source) ([]string, error)
+
+	// OpenID Connect sign-in. StartOIDCLogin returns the URL to send the
+	// user to, the provider sends them back with the state and a code for
+	// CompleteOIDCLogin. Unknown identities sign up a new user.
+	StartOIDCLogin(provider string) (string, error)
+	// StartOIDCLink is StartOIDCLogin for linking the provider to the
+	// account the token belongs to, the completed sign-in returns the
+	// linked identity instead of a session
+	StartOIDCLink(token, provider string) (string, error)
+	CompleteOIDCLogin(provider, state, code string, source audit.Source) (*LoginResult, error)
+	GetIdentities(token string) ([]*Identity, error)
+	// UnlinkIdentity fails for the last identity of users without a
+	// password
+	UnlinkIdentity(token, provider string, source audit.Source) error
+}
@@ -0,0 +1,95 @@
+// Package mailer delivers the emails of the auth service over SMTP.
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/url"
+	"time"
+
+	"github.com/chizheg/forum/internal/auth/domain"
+)
+
+// Config holds the SMTP server and the links put in the emails
+type Config struct {
+	// Addr is the host:port of the SMTP server
+	Addr string
+	// Username and Password authenticate with PLAIN auth when set
+	Username string
+	Password string
+	// From is the sender address
+	From string
+	// ConfirmEmailURL is the page confirming email changes, the token is
+	// added as the token query parameter
+	ConfirmEmailURL string
+}
+
+type smtpMailer struct {
+	cfg        Config
+	confirmURL *url.URL
+	auth       smtp.Auth
+	// send is smtp.SendMail, replaced in tests
+	send func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// NewSMTPMailer creates a mailer sending through the SMTP server
+func NewSMTPMailer(cfg Config) (domain.Mailer, error) {
+	if cfg.Addr == "" || cfg.From == "" {
+		return nil, errors.New("smtp address and sender are required")
+	}
+
+	confirmURL, err := url.Parse(cfg.ConfirmEmailURL)
+	if err != nil || !confirmURL.IsAbs() {
+		return nil, fmt.Errorf("invalid confirm email url %q", cfg.ConfirmEmailURL)
+	}
+
+	var auth smtp.Auth
+	if cfg.Username != "" {
+		host, _, err := net.SplitHostPort(cfg.Addr)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing smtp address: %w", err)
+		}
+		auth = smtp.PlainAuth("", cfg.Username, cfg.Password, host)
+	}
+
+	return &smtpMailer{
+		cfg:        cfg,
+		confirmURL: confirmURL,
+		auth:       auth,
+		send:       smtp.SendMail,
+	}, nil
+}
+
+func (m *smtpMailer) SendEmailChange(email, verificationToken string) error {
+	link := *m.confirmURL
+	q := link.Query()
+	q.Set("token", verificationToken)
+	link.RawQuery = q.Encode()
+
+	body := "Someone asked to use this address for their forum account.\r\n\r\n" +
+		"Open the link below within a day to confirm the change:\r\n\r\n" +
+		link.String() + "\r\n\r\n" +
+		"If this wasn't you, ignore this email.\r\n"
+
+	return m.sendMail(email, "Confirm your new email address", body)
+}
+
+func (m *smtpMailer) sendMail(to, subject, body string) error {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", m.cfg.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(body)
+
+	if err := m.send(m.cfg.Addr, m.auth, m.cfg.From, []string{to}, msg.Bytes()); err != nil {
+		return fmt.Errorf("error sending email: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package mailer
+
+import (
+	"net/smtp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSMTPMailer_SendEmailChange(t *testing.T) {
+	m, err := NewSMTPMailer(Config{
+		Addr:            "smtp.example.com:587",
+		Username:        "forum",
+		Password:        "secret",
+		From:            "forum@example.com",
+		ConfirmEmailURL: "https://forum.example.com/account/email?lang=en",
+	})
+	require.NoError(t, err)
+
+	var sentTo []string
+	var sent string
+	m.(*smtpMailer).send = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		assert.Equal(t, "smtp.example.com:587", addr)
+		assert.NotNil(t, a)
+		assert.Equal(t, "forum@example.com", from)
+		sentTo = to
+		sent = string(msg)
+		return nil
+	}
+
+	require.NoError(t, m.SendEmailChange("bob@example.com", "a+b/c="))
+	assert.Equal(t, []string{"bob@example.com"}, sentTo)
+	assert.Contains(t, sent, "To: bob@example.com\r\n")
+	assert.Contains(t, sent, "https://forum.example.com/account/email?lang=en&token=a%2Bb%2Fc%3D\r\n")
+
+	headers, _, ok := strings.Cut(sent, "\r\n\r\n")
+	require.True(t, ok)
+	assert.Contains(t, headers, "Subject: Confirm your new email address")
+}
+
+func TestNewSMTPMailer_Config(t *testing.T) {
+	_, err := NewSMTPMailer(Config{From: "forum@example.com", ConfirmEmailURL: "https://forum.example.com"})
+	assert.Error(t, err)
+
+	_, err = NewSMTPMailer(Config{Addr: "localhost:25", From: "forum@example.com", ConfirmEmailURL: "/account/email"})
+	assert.Error(t, err)
+
+	_, err = NewSMTPMailer(Config{Addr: "localhost", Username: "forum", From: "forum@example.com", ConfirmEmailURL: "https://forum.example.com"})
+	assert.Error(t, err)
+}
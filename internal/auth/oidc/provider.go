@@ -0,0 +1,149 @@
+// Package oidc signs users in with OpenID Connect providers using the
+// authorization code flow with PKCE. Providers are configured by their
+// issuer URL, endpoints and signing keys are discovered from it.
+package oidc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/chizheg/forum/internal/auth/domain"
+	gooidc "github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+const defaultTimeout = 10 * time.Second
+
+// Config holds the configuration of a provider
+type Config struct {
+	// IssuerURL serves the discovery document and must match the iss
+	// claim of the ID tokens
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the callback registered with the provider
+	RedirectURL string
+	// Scopes are requested in addition to openid, defaults to email and
+	// profile
+	Scopes []string
+	// Timeout bounds each request to the provider
+	Timeout time.Duration
+	// HTTPClient is used for requests to the provider, for tests
+	HTTPClient *http.Client
+}
+
+type provider struct {
+	oauth    oauth2.Config
+	verifier *gooidc.IDTokenVerifier
+	client   *http.Client
+	timeout  time.Duration
+}
+
+// NewProvider fetches the discovery document of the issuer and returns a
+// provider verifying ID tokens with the keys it publishes
+func NewProvider(cfg Config) (domain.IdentityProvider, error) {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"email", "profile"}
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: cfg.Timeout}
+	}
+
+	ctx, cancel := context.WithTimeout(gooidc.ClientContext(context.Background(), client), cfg.Timeout)
+	defer cancel()
+
+	p, err := gooidc.NewProvider(ctx, cfg.IssuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("error discovering provider: %w", err)
+	}
+
+	return &provider{
+		oauth: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Endpoint:     p.Endpoint(),
+			Scopes:       append([]string{gooidc.ScopeOpenID}, cfg.Scopes...),
+		},
+		// The key set is refreshed with the client of the discovery
+		// request when a token is signed with an unknown key
+		verifier: p.Verifier(&gooidc.Config{ClientID: cfg.ClientID}),
+		client:   client,
+		timeout:  cfg.Timeout,
+	}, nil
+}
+
+func (p *provider) AuthCodeURL(state, nonce, codeVerifier string) string {
+	return p.oauth.AuthCodeURL(state,
+		gooidc.Nonce(nonce),
+		oauth2.S256ChallengeOption(codeVerifier),
+	)
+}
+
+func (p *provider) Exchange(code, codeVerifier, nonce string) (*domain.ExternalIdentity, error) {
+	ctx, cancel := context.WithTimeout(gooidc.ClientContext(context.Background(), p.client), p.timeout)
+	defer cancel()
+
+	token, err := p.oauth.Exchange(ctx, code, oauth2.VerifierOption(codeVerifier))
+	var retrieveErr *oauth2.RetrieveError
+	if errors.As(err, &retrieveErr) {
+		return nil, fmt.Errorf("%w: %s", domain.ErrInvalidAuthCode, retrieveErr.ErrorCode)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error exchanging code: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: missing from token response", domain.ErrInvalidIDToken)
+	}
+
+	// Verify checks the signature, issuer, audience and expiry
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", domain.ErrInvalidIDToken, err)
+	}
+	if idToken.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", domain.ErrInvalidIDToken)
+	}
+
+	var claims struct {
+		Email             string    `json:"email"`
+		EmailVerified     claimBool `json:"email_verified"`
+		Name              string    `json:"name"`
+		PreferredUsername string    `json:"preferred_username"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", domain.ErrInvalidIDToken, err)
+	}
+
+	return &domain.ExternalIdentity{
+		Subject:           idToken.Subject,
+		Email:             claims.Email,
+		EmailVerified:     bool(claims.EmailVerified),
+		Name:              claims.Name,
+		PreferredUsername: claims.PreferredUsername,
+	}, nil
+}
+
+// claimBool is a boolean claim that some providers send as a string
+type claimBool bool
+
+func (b *claimBool) UnmarshalJSON(data []byte) error {
+	switch string(data) {
+	case `true`, `"true"`:
+		*b = true
+	case `false`, `"false"`, `null`:
+		*b = false
+	default:
+		return fmt.Errorf("invalid boolean claim %s", data)
+	}
+	return nil
+}
@@ -0,0 +1,265 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chizheg/forum/internal/auth/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+const (
+	testClientID     = "forum"
+	testClientSecret = "secret"
+	testRedirectURL  = "https://forum.example.com/oidc/callback"
+)
+
+// fakeProvider is a minimal OpenID Connect provider. Authorization codes
+// are issued by authorize instead of a login page.
+type fakeProvider struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+	// signingKey signs the ID tokens, it is key unless a test replaces it
+	signingKey *rsa.PrivateKey
+	// claims adjusts the claims of the next ID tokens
+	claims func(claims map[string]any)
+
+	mu    sync.Mutex
+	codes map[string]authRequest
+}
+
+type authRequest struct {
+	challenge string
+	nonce     string
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	f := &fakeProvider{
+		key:        key,
+		signingKey: key,
+		codes:      map[string]authRequest{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", f.discovery)
+	mux.HandleFunc("/jwks", f.jwks)
+	mux.HandleFunc("/token", f.token)
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+
+	return f
+}
+
+func (f *fakeProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]any{
+		"issuer":                                f.URL,
+		"authorization_endpoint":                f.URL + "/authorize",
+		"token_endpoint":                        f.URL + "/token",
+		"jwks_uri":                              f.URL + "/jwks",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (f *fakeProvider) jwks(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(f.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(f.key.E)).Bytes()),
+		}},
+	})
+}
+
+// authorize checks the authorization request like the provider would and
+// returns the code it redirects back with
+func (f *fakeProvider) authorize(t *testing.T, authURL string) string {
+	u, err := url.Parse(authURL)
+	require.NoError(t, err)
+	q := u.Query()
+
+	require.Equal(t, f.URL+"/authorize", u.Scheme+"://"+u.Host+u.Path)
+	require.Equal(t, "code", q.Get("response_type"))
+	require.Equal(t, testClientID, q.Get("client_id"))
+	require.Equal(t, testRedirectURL, q.Get("redirect_uri"))
+	require.Equal(t, "S256", q.Get("code_challenge_method"))
+
+	code := "code-" + q.Get("state")
+	f.mu.Lock()
+	f.codes[code] = authRequest{challenge: q.Get("code_challenge"), nonce: q.Get("nonce")}
+	f.mu.Unlock()
+
+	return code
+}
+
+func (f *fakeProvider) token(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+	if clientID != testClientID || clientSecret != testClientSecret {
+		tokenError(w, "invalid_client")
+		return
+	}
+
+	f.mu.Lock()
+	req, ok := f.codes[r.PostFormValue("code")]
+	delete(f.codes, r.PostFormValue("code"))
+	f.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != req.challenge {
+		tokenError(w, "invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	claims := map[string]any{
+		"iss":            f.URL,
+		"sub":            "subject-1",
+		"aud":            testClientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+		"nonce":          req.nonce,
+		"email":          "alice@example.com",
+		"email_verified": true,
+		"name":           "Alice",
+	}
+	if f.claims != nil {
+		f.claims(claims)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"access_token": "access-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     f.sign(claims),
+	})
+}
+
+// sign returns the claims as a JWT signed with RS256
+func (f *fakeProvider) sign(claims map[string]any) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sum := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, f.signingKey, crypto.SHA256, sum[:])
+	if err != nil {
+		panic(err)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func tokenError(w http.ResponseWriter, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{"error": code})
+}
+
+func newTestProvider(t *testing.T, f *fakeProvider) domain.IdentityProvider {
+	p, err := NewProvider(Config{
+		IssuerURL:    f.URL,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		RedirectURL:  testRedirectURL,
+	})
+	require.NoError(t, err)
+	return p
+}
+
+func TestProvider_Exchange(t *testing.T) {
+	f := newFakeProvider(t)
+	p := newTestProvider(t, f)
+
+	verifier := oauth2.GenerateVerifier()
+	authURL := p.AuthCodeURL("state", "nonce", verifier)
+	assert.NotContains(t, authURL, verifier)
+	assert.Contains(t, authURL, "scope=openid+email+profile")
+
+	identity, err := p.Exchange(f.authorize(t, authURL), verifier, "nonce")
+	require.NoError(t, err)
+	assert.Equal(t, &domain.ExternalIdentity{
+		Subject:       "subject-1",
+		Email:         "alice@example.com",
+		EmailVerified: true,
+		Name:          "Alice",
+	}, identity)
+
+	// Test codes are only redeemed once
+	_, err = p.Exchange("code-state", verifier, "nonce")
+	assert.ErrorIs(t, err, domain.ErrInvalidAuthCode)
+
+	// Test email_verified sent as a string
+	f.claims = func(claims map[string]any) { claims["email_verified"] = "false" }
+	identity, err = p.Exchange(f.authorize(t, p.AuthCodeURL("state", "nonce", verifier)), verifier, "nonce")
+	require.NoError(t, err)
+	assert.False(t, identity.EmailVerified)
+}
+
+func TestProvider_ExchangeRejectsCodeVerifier(t *testing.T) {
+	f := newFakeProvider(t)
+	p := newTestProvider(t, f)
+
+	code := f.authorize(t, p.AuthCodeURL("state", "nonce", oauth2.GenerateVerifier()))
+	_, err := p.Exchange(code, oauth2.GenerateVerifier(), "nonce")
+	assert.ErrorIs(t, err, domain.ErrInvalidAuthCode)
+}
+
+func TestProvider_ExchangeRejectsIDToken(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		nonce  string
+		claims func(claims map[string]any)
+		key    *rsa.PrivateKey
+	}{
+		{name: "nonce mismatch", nonce: "other nonce"},
+		{name: "unknown signing key", key: otherKey},
+		{name: "other audience", claims: func(claims map[string]any) { claims["aud"] = "other client" }},
+		{name: "other issuer", claims: func(claims map[string]any) { claims["iss"] = "https://evil.example.com" }},
+		{name: "expired", claims: func(claims map[string]any) { claims["exp"] = time.Now().Add(-time.Minute).Unix() }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeProvider(t)
+			p := newTestProvider(t, f)
+			f.claims = tt.claims
+			if tt.key != nil {
+				f.signingKey = tt.key
+			}
+			nonce := tt.nonce
+			if nonce == "" {
+				nonce = "nonce"
+			}
+
+			verifier := oauth2.GenerateVerifier()
+			code := f.authorize(t, p.AuthCodeURL("state", "nonce", verifier))
+			_, err := p.Exchange(code, verifier, nonce)
+			assert.ErrorIs(t, err, domain.ErrInvalidIDToken)
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/chizheg/forum/internal/auth/domain"
+	"github.com/lib/pq"
+)
+
+// uniqueViolation is the PostgreSQL error code of unique constraint
+// violations
+const uniqueViolation = "23505"
+
+func (r *repository) UpdatePassword(userID int, passwordHash string) error {
+	query := `
+		UPDATE users
+		SET password_hash = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`
+
+	result, err := r.db.Exec(query, userID, passwordHash)
+	if err != nil {
+		return fmt.Errorf("error updating password: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if n == 0 {
+		return domain.ErrUserNotFound
+	}
+
+	return nil
+}
+
+func (r *repository) DeleteOtherSessions(userID int, token string) (int, error) {
+	result, err := r.db.Exec(`DELETE FROM sessions WHERE user_id = $1 AND token <> $2`, userID, token)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting sessions: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error getting rows affected: %w", err)
+	}
+
+	return int(n), nil
+}
+
+func (r *repository) CreateEmailChange(change *domain.EmailChange) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Only the latest requested address can be verified
+	_, err = tx.Exec(`
+		UPDATE email_changes
+		SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND used_at IS NULL`, change.UserID)
+	if err != nil {
+		return fmt.Errorf("error revoking email changes: %w", err)
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO email_changes (user_id, new_email, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`,
+		change.UserID, change.NewEmail, change.TokenHash, change.ExpiresAt,
+	).Scan(&change.ID, &change.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("error creating email change: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) ConfirmEmailChange(tokenHash string) (*domain.EmailChange, error) {
+	// The token stays usable if the address was taken in the meantime, as
+	// the whole statement fails
+	query := `
+		WITH change AS (
+			UPDATE email_changes
+			SET used_at = CURRENT_TIMESTAMP
+			WHERE token_hash = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+			RETURNING id, user_id, new_email, expires_at, created_at
+		)
+		UPDATE users u
+		SET email = change.new_email, updated_at = CURRENT_TIMESTAMP
+		FROM change
+		WHERE u.id = change.user_id
+		RETURNING change.id, change.user_id, change.new_email, change.expires_at, change.created_at`
+
+	change := &domain.EmailChange{TokenHash: tokenHash}
+	err := r.db.QueryRow(query, tokenHash).Scan(
+		&change.ID,
+		&change.UserID,
+		&change.NewEmail,
+		&change.ExpiresAt,
+		&change.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrInvalidVerificationToken
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		return nil, domain.ErrEmailTaken
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error confirming email change: %w", err)
+	}
+
+	return change, nil
+}
+
+func (r *repository) DeleteAccount(userID int) (*domain.AccountDeletion, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// The row is kept, with placeholders for the unique columns, so the ID
+	// is never reused for the audit log and messages of other services.
+	// The empty password hash never matches.
+	result, err := tx.Exec(`
+		UPDATE users
+		SET username = 'deleted-' || id,
+			email = 'deleted-' || id || '@deleted.invalid',
+			password_hash = '',
+			role = 'user',
+			password_reset_required = false,
+			disabled_at = COALESCE(disabled_at, CURRENT_TIMESTAMP),
+			totp_secret = NULL,
+			totp_enabled_at = NULL,
+			totp_last_step = NULL,
+			deleted_at = CURRENT_TIMESTAMP,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND deleted_at IS NULL`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error anonymizing user: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return nil, fmt.Errorf("error getting rows affected: %w", err)
+	} else if n == 0 {
+		return nil, domain.ErrUserNotFound
+	}
+
+	for _, table := range []string{
+		"sessions",
+		"profiles",
+		"password_resets",
+		"email_changes",
+		"recovery_codes",
+		"login_challenges",
+		"identities",
+	} {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE user_id = $1`, userID); err != nil {
+			return nil, fmt.Errorf("error deleting %s: %w", table, err)
+		}
+	}
+
+	deletion := &domain.AccountDeletion{UserID: userID}
+	err = tx.QueryRow(`
+		INSERT INTO account_deletions (user_id)
+		VALUES ($1)
+		RETURNING id, deleted_at`, userID,
+	).Scan(&deletion.ID, &deletion.DeletedAt)
+	if err != nil {
+		return nil, fmt.Errorf("error recording account deletion: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return deletion, nil
+}
+
+func (r *repository) GetAccountDeletions(afterID int64, limit int) ([]*domain.AccountDeletion, error) {
+	query := `
+		SELECT id, user_id, deleted_at
+		FROM account_deletions
+		WHERE id > $1
+		ORDER BY id
+		LIMIT $2`
+
+	rows, err := r.db.Query(query, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error getting account deletions: %w", err)
+	}
+	defer rows.Close()
+
+	deletions := []*domain.AccountDeletion{}
+	for rows.Next() {
+		deletion := &domain.AccountDeletion{}
+		if err := rows.Scan(&deletion.ID, &deletion.UserID, &deletion.DeletedAt); err != nil {
+			return nil, fmt.Errorf("error scanning account deletion: %w", err)
+		}
+		deletions = append(deletions, deletion)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error getting account deletions: %w", err)
+	}
+
+	return deletions, nil
+}
+
+func (r *repository) GetUserSessions(userID int) ([]*domain.Session, error) {
+	query := `
+		SELECT id, user_id, token, expires_at, created_at
+		FROM sessions
+		WHERE user_id = $1
+		ORDER BY created_at`
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []*domain.Session{}
+	for rows.Next() {
+		session := &domain.Session{}
+		err := rows.Scan(&session.ID, &session.UserID, &session.Token, &session.ExpiresAt, &session.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error getting sessions: %w", err)
+	}
+
+	return sessions, nil
+}
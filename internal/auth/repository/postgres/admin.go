@@ -0,0 +1,199 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/chizheg/forum/internal/auth/domain"
+)
+
+// likeEscaper escapes the LIKE wildcards of search queries
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func (r *repository) ListUsers(filter domain.UserFilter) ([]*domain.User, int, error) {
+	var conditions []string
+	var args []any
+	where := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.Query != "" {
+		pattern := "%" + likeEscaper.Replace(filter.Query) + "%"
+		where("(username ILIKE $%[1]d OR email ILIKE $%[1]d)", pattern)
+	}
+	if filter.Role != "" {
+		where("role = $%d", filter.Role)
+	}
+	if filter.Disabled {
+		conditions = append(conditions, "disabled_at IS NOT NULL")
+	}
+
+	whereClause := ""
+	if len(conditions) > 0 {
+		whereClause = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := r.db.QueryRow(`SELECT count(*) FROM users `+whereClause, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("error counting users: %w", err)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM users
+		%s
+		ORDER BY id
+		LIMIT $%d OFFSET $%d`, userColumns, whereClause, len(args)+1, len(args)+2)
+
+	users, err := r.queryUsers(query, append(args, filter.Limit, filter.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	if users == nil {
+		users = []*domain.User{}
+	}
+
+	return users, total, nil
+}
+
+func (r *repository) UpdateRole(userID int, role string) (string, error) {
+	query := `
+		UPDATE users u
+		SET role = $2, updated_at = CURRENT_TIMESTAMP
+		FROM (SELECT id, role FROM users WHERE id = $1 FOR UPDATE) old
+		WHERE u.id = old.id
+		RETURNING old.role`
+
+	var oldRole string
+	err := r.db.QueryRow(query, userID, role).Scan(&oldRole)
+	if err == sql.ErrNoRows {
+		return "", domain.ErrUserNotFound
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("error updating role: %w", err)
+	}
+
+	return oldRole, nil
+}
+
+func (r *repository) SetDisabled(userID int, disabled bool) (bool, error) {
+	query := `
+		UPDATE users
+		SET disabled_at = CASE WHEN $2 THEN CURRENT_TIMESTAMP END, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND (disabled_at IS NOT NULL) <> $2`
+
+	result, err := r.db.Exec(query, userID, disabled)
+	if err != nil {
+		return false, fmt.Errorf("error updating user: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if n > 0 {
+		return true, nil
+	}
+
+	// Tell unknown users from accounts already in the requested state
+	if _, err := r.GetUserByID(userID); err != nil {
+		return false, err
+	}
+
+	return false, nil
+}
+
+func (r *repository) DeleteUserSessions(userID int) (int, error) {
+	result, err := r.db.Exec(`DELETE FROM sessions WHERE user_id = $1`, userID)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting sessions: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error getting rows affected: %w", err)
+	}
+
+	return int(n), nil
+}
+
+func (r *repository) RequirePasswordReset(reset *domain.PasswordReset) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE users
+		SET password_reset_required = true, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`, reset.UserID)
+	if err != nil {
+		return fmt.Errorf("error updating user: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	} else if n == 0 {
+		return domain.ErrUserNotFound
+	}
+
+	// Logins waiting for a second factor can't complete either
+	if _, err := tx.Exec(`DELETE FROM login_challenges WHERE user_id = $1`, reset.UserID); err != nil {
+		return fmt.Errorf("error deleting login challenges: %w", err)
+	}
+
+	// Earlier reset tokens of the user stop working
+	_, err = tx.Exec(`
+		UPDATE password_resets
+		SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND used_at IS NULL`, reset.UserID)
+	if err != nil {
+		return fmt.Errorf("error revoking password resets: %w", err)
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO password_resets (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at`,
+		reset.UserID, reset.TokenHash, reset.ExpiresAt,
+	).Scan(&reset.ID, &reset.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("error creating password reset: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) ResetPassword(tokenHash, passwordHash string) (int, error) {
+	query := `
+		WITH reset AS (
+			UPDATE password_resets
+			SET used_at = CURRENT_TIMESTAMP
+			WHERE token_hash = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+			RETURNING user_id
+		)
+		UPDATE users u
+		SET password_hash = $2, password_reset_required = false, updated_at = CURRENT_TIMESTAMP
+		FROM reset
+		WHERE u.id = reset.user_id
+		RETURNING u.id`
+
+	var userID int
+	err := r.db.QueryRow(query, tokenHash, passwordHash).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, domain.ErrInvalidResetToken
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("error resetting password: %w", err)
+	}
+
+	return userID, nil
+}
@@ -0,0 +1,214 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/chizheg/forum/internal/auth/domain"
+	"github.com/lib/pq"
+)
+
+func (r *repository) CreateOIDCState(state *domain.OIDCState) error {
+	// Abandoned sign-ins are dropped here rather than by a cleanup job
+	if _, err := r.db.Exec(`DELETE FROM oidc_states WHERE expires_at < CURRENT_TIMESTAMP`); err != nil {
+		return fmt.Errorf("error deleting expired oidc states: %w", err)
+	}
+
+	query := `
+		INSERT INTO oidc_states (provider, state_hash, nonce, code_verifier, link_user_id, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`
+
+	err := r.db.QueryRow(
+		query,
+		state.Provider,
+		state.StateHash,
+		state.Nonce,
+		state.CodeVerifier,
+		sql.NullInt64{Int64: int64(state.LinkUserID), Valid: state.LinkUserID != 0},
+		state.ExpiresAt,
+	).Scan(&state.ID, &state.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("error creating oidc state: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) ConsumeOIDCState(provider, stateHash string) (*domain.OIDCState, error) {
+	query := `
+		DELETE FROM oidc_states
+		WHERE provider = $1 AND state_hash = $2 AND expires_at > CURRENT_TIMESTAMP
+		RETURNING id, provider, state_hash, nonce, code_verifier, link_user_id, expires_at, created_at`
+
+	state := &domain.OIDCState{}
+	var linkUserID sql.NullInt64
+	err := r.db.QueryRow(query, provider, stateHash).Scan(
+		&state.ID,
+		&state.Provider,
+		&state.StateHash,
+		&state.Nonce,
+		&state.CodeVerifier,
+		&linkUserID,
+		&state.ExpiresAt,
+		&state.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrInvalidOIDCState
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error consuming oidc state: %w", err)
+	}
+	state.LinkUserID = int(linkUserID.Int64)
+
+	return state, nil
+}
+
+func (r *repository) GetIdentity(provider, subject string) (*domain.Identity, error) {
+	query := `
+		SELECT id, user_id, provider, subject, email, created_at
+		FROM identities
+		WHERE provider = $1 AND subject = $2`
+
+	identity, err := scanIdentity(r.db.QueryRow(query, provider, subject))
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrIdentityNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting identity: %w", err)
+	}
+
+	return identity, nil
+}
+
+func (r *repository) GetUserIdentities(userID int) ([]*domain.Identity, error) {
+	query := `
+		SELECT id, user_id, provider, subject, email, created_at
+		FROM identities
+		WHERE user_id = $1
+		ORDER BY created_at, id`
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting identities: %w", err)
+	}
+	defer rows.Close()
+
+	identities := []*domain.Identity{}
+	for rows.Next() {
+		identity, err := scanIdentity(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning identity: %w", err)
+		}
+		identities = append(identities, identity)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error getting identities: %w", err)
+	}
+
+	return identities, nil
+}
+
+func (r *repository) CreateIdentity(identity *domain.Identity) error {
+	err := insertIdentity(r.db, identity)
+	if isUniqueViolation(err) {
+		return domain.ErrIdentityLinked
+	}
+	if err != nil {
+		return fmt.Errorf("error creating identity: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) CreateUserWithIdentity(user *domain.User, identity *domain.Identity) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`
+		INSERT INTO users (username, email, password_hash)
+		VALUES ($1, $2, $3)
+		RETURNING id, role, created_at, updated_at`,
+		user.Username, user.Email, user.PasswordHash,
+	).Scan(&user.ID, &user.Role, &user.CreatedAt, &user.UpdatedAt)
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		if pqErr.Constraint == "users_username_key" {
+			return domain.ErrUsernameTaken
+		}
+		return domain.ErrEmailTaken
+	}
+	if err != nil {
+		return fmt.Errorf("error creating user: %w", err)
+	}
+
+	identity.UserID = user.ID
+	err = insertIdentity(tx, identity)
+	if isUniqueViolation(err) {
+		return domain.ErrIdentityLinked
+	}
+	if err != nil {
+		return fmt.Errorf("error creating identity: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) DeleteIdentity(userID int, provider string) error {
+	result, err := r.db.Exec(`DELETE FROM identities WHERE user_id = $1 AND provider = $2`, userID, provider)
+	if err != nil {
+		return fmt.Errorf("error deleting identity: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if n == 0 {
+		return domain.ErrIdentityNotFound
+	}
+
+	return nil
+}
+
+// queryRower is implemented by both *sql.DB and *sql.Tx
+type queryRower interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func insertIdentity(q queryRower, identity *domain.Identity) error {
+	return q.QueryRow(`
+		INSERT INTO identities (user_id, provider, subject, email)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`,
+		identity.UserID, identity.Provider, identity.Subject, identity.Email,
+	).Scan(&identity.ID, &identity.CreatedAt)
+}
+
+func scanIdentity(row scanner) (*domain.Identity, error) {
+	identity := &domain.Identity{}
+	err := row.Scan(
+		&identity.ID,
+		&identity.UserID,
+		&identity.Provider,
+		&identity.Subject,
+		&identity.Email,
+		&identity.CreatedAt,
+	)
+	return identity, err
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == uniqueViolation
+}
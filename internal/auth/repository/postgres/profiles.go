@@ -0,0 +1,80 @@
+package postgres
+
+import (
+	"fmt"
+
+	"github.com/chizheg/forum/internal/auth/domain"
+	"github.com/lib/pq"
+)
+
+func (r *repository) GetProfiles(ids []int) ([]*domain.Profile, error) {
+	// Users without a profile row get the defaults
+	query := `
+		SELECT u.id, u.username,
+			COALESCE(NULLIF(p.display_name, ''), u.username),
+			COALESCE(p.avatar_url, ''),
+			COALESCE(p.bio, ''),
+			COALESCE(p.timezone, 'UTC'),
+			COALESCE(p.updated_at, u.created_at)
+		FROM users u
+		LEFT JOIN profiles p ON p.user_id = u.id
+		WHERE u.id = ANY($1)
+		ORDER BY u.id`
+
+	rows, err := r.db.Query(query, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("error getting profiles: %w", err)
+	}
+	defer rows.Close()
+
+	profiles := []*domain.Profile{}
+	for rows.Next() {
+		profile := &domain.Profile{}
+		err := rows.Scan(
+			&profile.UserID,
+			&profile.Username,
+			&profile.DisplayName,
+			&profile.AvatarURL,
+			&profile.Bio,
+			&profile.Timezone,
+			&profile.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning profile: %w", err)
+		}
+		profiles = append(profiles, profile)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error getting profiles: %w", err)
+	}
+
+	return profiles, nil
+}
+
+func (r *repository) UpdateProfile(profile *domain.Profile) error {
+	query := `
+		INSERT INTO profiles (user_id, display_name, avatar_url, bio, timezone)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id) DO UPDATE SET
+			display_name = EXCLUDED.display_name,
+			avatar_url = EXCLUDED.avatar_url,
+			bio = EXCLUDED.bio,
+			timezone = EXCLUDED.timezone,
+			updated_at = CURRENT_TIMESTAMP
+		RETURNING updated_at`
+
+	err := r.db.QueryRow(
+		query,
+		profile.UserID,
+		profile.DisplayName,
+		profile.AvatarURL,
+		profile.Bio,
+		profile.Timezone,
+	).Scan(&profile.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("error updating profile: %w", err)
+	}
+
+	return nil
+}
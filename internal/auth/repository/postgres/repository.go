@@ -2,10 +2,10 @@ package postgres
 
 import (
 	"database/sql"
-	"errors"
 	"fmt"
 
 	"github.com/chizheg/forum/internal/auth/domain"
+	"github.com/lib/pq"
 )
 
 type repository struct {
@@ -21,14 +21,14 @@ func (r *repository) CreateUser(user *domain.User) error {
 	query := `
 		INSERT INTO users (username, email, password_hash)
 		VALUES ($1, $2, $3)
-		RETURNING id, created_at, updated_at`
+		RETURNING id, role, created_at, updated_at`
 
 	err := r.db.QueryRow(
 		query,
 		user.Username,
 		user.Email,
 		user.PasswordHash,
-	).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+	).Scan(&user.ID, &user.Role, &user.CreatedAt, &user.UpdatedAt)
 
 	if err != nil {
 		return fmt.Errorf("error creating user: %w", err)
@@ -38,23 +38,15 @@ func (r *repository) CreateUser(user *domain.User) error {
 }
 
 func (r *repository) GetUserByUsername(username string) (*domain.User, error) {
-	user := &domain.User{}
 	query := `
-		SELECT id, username, email, password_hash, created_at, updated_at
+		SELECT ` + userColumns + `
 		FROM users
 		WHERE username = $1`
 
-	err := r.db.QueryRow(query, username).Scan(
-		&user.ID,
-		&user.Username,
-		&user.Email,
-		&user.PasswordHash,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
+	user, err := scanUser(r.db.QueryRow(query, username))
 
 	if err == sql.ErrNoRows {
-		return nil, errors.New("user not found")
+		return nil, domain.ErrUserNotFound
 	}
 
 	if err != nil {
@@ -65,23 +57,15 @@ func (r *repository) GetUserByUsername(username string) (*domain.User, error) {
 }
 
 func (r *repository) GetUserByID(id int) (*domain.User, error) {
-	user := &domain.User{}
 	query := `
-		SELECT id, username, email, password_hash, created_at, updated_at
+		SELECT ` + userColumns + `
 		FROM users
 		WHERE id = $1`
 
-	err := r.db.QueryRow(query, id).Scan(
-		&user.ID,
-		&user.Username,
-		&user.Email,
-		&user.PasswordHash,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
+	user, err := scanUser(r.db.QueryRow(query, id))
 
 	if err == sql.ErrNoRows {
-		return nil, errors.New("user not found")
+		return nil, domain.ErrUserNotFound
 	}
 
 	if err != nil {
@@ -91,6 +75,49 @@ func (r *repository) GetUserByID(id int) (*domain.User, error) {
 	return user, nil
 }
 
+func (r *repository) GetUsersByIDs(ids []int) ([]*domain.User, error) {
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE id = ANY($1)
+		ORDER BY id`
+
+	return r.queryUsers(query, pq.Array(ids))
+}
+
+func (r *repository) GetUsersByUsernames(usernames []string) ([]*domain.User, error) {
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE username = ANY($1)
+		ORDER BY id`
+
+	return r.queryUsers(query, pq.Array(usernames))
+}
+
+func (r *repository) queryUsers(query string, args ...any) ([]*domain.User, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error getting users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []*domain.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning user: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error getting users: %w", err)
+	}
+
+	return users, nil
+}
+
 func (r *repository) CreateSession(session *domain.Session) error {
 	query := `
 		INSERT INTO sessions (user_id, token, expires_at)
@@ -114,9 +141,10 @@ func (r *repository) CreateSession(session *domain.Session) error {
 func (r *repository) GetSessionByToken(token string) (*domain.Session, error) {
 	session := &domain.Session{}
 	query := `
-		SELECT id, user_id, token, expires_at, created_at
-		FROM sessions
-		WHERE token = $1`
+		SELECT s.id, s.user_id, s.token, s.expires_at, s.created_at, u.disabled_at IS NOT NULL
+		FROM sessions s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.token = $1`
 
 	err := r.db.QueryRow(query, token).Scan(
 		&session.ID,
@@ -124,10 +152,11 @@ func (r *repository) GetSessionByToken(token string) (*domain.Session, error) {
 		&session.Token,
 		&session.ExpiresAt,
 		&session.CreatedAt,
+		&session.UserDisabled,
 	)
 
 	if err == sql.ErrNoRows {
-		return nil, errors.New("session not found")
+		return nil, domain.ErrSessionNotFound
 	}
 
 	if err != nil {
@@ -150,8 +179,52 @@ func (r *repository) DeleteSession(token string) error {
 	}
 
 	if rowsAffected == 0 {
-		return errors.New("session not found")
+		return domain.ErrSessionNotFound
 	}
 
 	return nil
 }
+
+const userColumns = `id, username, email, password_hash, role, disabled_at, password_reset_required, deleted_at, totp_secret, totp_enabled_at, created_at, updated_at`
+
+// scanner is implemented by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanUser scans the user columns
+func scanUser(row scanner) (*domain.User, error) {
+	user := &domain.User{}
+	var disabledAt, deletedAt, totpEnabledAt sql.NullTime
+	var totpSecret sql.NullString
+
+	err := row.Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.PasswordHash,
+		&user.Role,
+		&disabledAt,
+		&user.PasswordResetRequired,
+		&deletedAt,
+		&totpSecret,
+		&totpEnabledAt,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if disabledAt.Valid {
+		user.DisabledAt = &disabledAt.Time
+	}
+	if deletedAt.Valid {
+		user.DeletedAt = &deletedAt.Time
+	}
+	if totpEnabledAt.Valid {
+		user.TOTPEnabledAt = &totpEnabledAt.Time
+	}
+	user.TOTPSecret = totpSecret.String
+	return user, nil
+}
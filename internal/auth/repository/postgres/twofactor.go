@@ -0,0 +1,281 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/chizheg/forum/internal/auth/domain"
+)
+
+func (r *repository) SetTOTPSecret(userID int, secret string) (bool, error) {
+	query := `
+		UPDATE users
+		SET totp_secret = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND totp_enabled_at IS NULL`
+
+	result, err := r.db.Exec(query, userID, secret)
+	if err != nil {
+		return false, fmt.Errorf("error setting totp secret: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error getting rows affected: %w", err)
+	}
+
+	return n > 0, nil
+}
+
+func (r *repository) EnableTOTP(userID int, step int64, recoveryCodeHashes []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE users
+		SET totp_enabled_at = CURRENT_TIMESTAMP, totp_last_step = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND totp_secret IS NOT NULL AND totp_enabled_at IS NULL`,
+		userID, step)
+	if err != nil {
+		return fmt.Errorf("error enabling totp: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	} else if n == 0 {
+		return domain.ErrTwoFactorNotEnrolled
+	}
+
+	if err := replaceRecoveryCodes(tx, userID, recoveryCodeHashes); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) DisableTOTP(userID int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE users
+		SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("error disabling totp: %w", err)
+	}
+
+	for _, table := range []string{"recovery_codes", "login_challenges"} {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE user_id = $1`, userID); err != nil {
+			return fmt.Errorf("error deleting %s: %w", table, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) UseTOTPStep(userID int, step int64) (bool, error) {
+	// A code is accepted once, and never after a later one, so an observed
+	// code can't be replayed within its validity window
+	query := `
+		UPDATE users
+		SET totp_last_step = $2
+		WHERE id = $1 AND totp_enabled_at IS NOT NULL
+			AND (totp_last_step IS NULL OR totp_last_step < $2)`
+
+	result, err := r.db.Exec(query, userID, step)
+	if err != nil {
+		return false, fmt.Errorf("error using totp step: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error getting rows affected: %w", err)
+	}
+
+	return n > 0, nil
+}
+
+func (r *repository) ReplaceRecoveryCodes(userID int, codeHashes []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(tx, userID, codeHashes); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) UseRecoveryCode(userID int, codeHash string) (bool, error) {
+	query := `
+		UPDATE recovery_codes
+		SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+
+	result, err := r.db.Exec(query, userID, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("error using recovery code: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error getting rows affected: %w", err)
+	}
+
+	return n > 0, nil
+}
+
+func (r *repository) CreateLoginChallenge(challenge *domain.LoginChallenge) error {
+	query := `
+		INSERT INTO login_challenges (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at`
+
+	err := r.db.QueryRow(
+		query,
+		challenge.UserID,
+		challenge.TokenHash,
+		challenge.ExpiresAt,
+	).Scan(&challenge.ID, &challenge.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("error creating login challenge: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) GetLoginChallenge(tokenHash string) (*domain.LoginChallenge, error) {
+	query := `
+		SELECT id, user_id, token_hash, attempts, expires_at, created_at
+		FROM login_challenges
+		WHERE token_hash = $1 AND expires_at > CURRENT_TIMESTAMP`
+
+	challenge := &domain.LoginChallenge{}
+	err := r.db.QueryRow(query, tokenHash).Scan(
+		&challenge.ID,
+		&challenge.UserID,
+		&challenge.TokenHash,
+		&challenge.Attempts,
+		&challenge.ExpiresAt,
+		&challenge.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrInvalidChallenge
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting login challenge: %w", err)
+	}
+
+	return challenge, nil
+}
+
+func (r *repository) UseChallengeAttempt(id, maxAttempts int) (int, error) {
+	// Attempts are counted before the code is checked, so concurrent
+	// verifications can't enter more codes than allowed
+	query := `
+		UPDATE login_challenges
+		SET attempts = attempts + 1
+		WHERE id = $1 AND attempts < $2 AND expires_at > CURRENT_TIMESTAMP
+		RETURNING attempts`
+
+	var attempts int
+	err := r.db.QueryRow(query, id, maxAttempts).Scan(&attempts)
+	if err == sql.ErrNoRows {
+		return 0, domain.ErrInvalidChallenge
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error using challenge attempt: %w", err)
+	}
+
+	return attempts, nil
+}
+
+func (r *repository) UseCodeAttempt(userID, maxFailures int, since time.Time) (bool, error) {
+	query := `
+		UPDATE users
+		SET code_failures = CASE WHEN code_failed_at > $3 THEN code_failures + 1 ELSE 1 END,
+			code_failed_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND (code_failures < $2 OR code_failed_at <= $3)`
+
+	result, err := r.db.Exec(query, userID, maxFailures, since)
+	if err != nil {
+		return false, fmt.Errorf("error using code attempt: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error getting rows affected: %w", err)
+	}
+
+	return n > 0, nil
+}
+
+func (r *repository) ResetCodeFailures(userID int) error {
+	query := `
+		UPDATE users
+		SET code_failures = 0, code_failed_at = NULL
+		WHERE id = $1`
+
+	if _, err := r.db.Exec(query, userID); err != nil {
+		return fmt.Errorf("error resetting code failures: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) DeleteLoginChallenge(id int) error {
+	// Deleting reports whether this caller consumed the challenge, so two
+	// concurrent verifications can't both complete it
+	result, err := r.db.Exec(`DELETE FROM login_challenges WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("error deleting login challenge: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if n == 0 {
+		return domain.ErrInvalidChallenge
+	}
+
+	return nil
+}
+
+// replaceRecoveryCodes deletes the recovery codes of the user, used or not,
+// and stores the new ones
+func replaceRecoveryCodes(tx *sql.Tx, userID int, codeHashes []string) error {
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("error deleting recovery codes: %w", err)
+	}
+
+	for _, hash := range codeHashes {
+		_, err := tx.Exec(`INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, hash)
+		if err != nil {
+			return fmt.Errorf("error creating recovery code: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,253 @@
+package service
+
+import (
+	"net/mail"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/chizheg/forum/internal/auth/domain"
+	"github.com/chizheg/forum/pkg/audit"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	emailChangeTTL        = 24 * time.Hour
+	maxEmailLength        = 100
+	defaultDeletionsLimit = 100
+	maxDeletionsLimit     = 1000
+	// reauthWindow is how recent the session of an account without a
+	// password has to be to change its credentials or delete it
+	reauthWindow = 5 * time.Minute
+)
+
+func (s *service) ChangePassword(token, currentPassword, code, newPassword string, source audit.Source) error {
+	user, err := s.reauthenticate(token, currentPassword)
+	if err != nil {
+		return err
+	}
+
+	// A stolen session and password aren't enough to lock the user out
+	if user.TOTPEnabledAt != nil {
+		valid, err := s.checkSecondFactor(user, code, source)
+		if err != nil {
+			return err
+		}
+		if !valid {
+			return domain.ErrInvalidCode
+		}
+	}
+
+	if utf8.RuneCountInString(newPassword) < minPasswordLength {
+		return domain.ErrPasswordTooShort
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.UpdatePassword(user.ID, string(hashedPassword)); err != nil {
+		return err
+	}
+
+	// Whoever else knew the old password is logged out, the session making
+	// the change stays valid
+	revoked, err := s.repo.DeleteOtherSessions(user.ID, token)
+	if err != nil {
+		return err
+	}
+
+	s.audit(&audit.Entry{
+		ActorID:    user.ID,
+		Action:     audit.ActionPasswordChanged,
+		TargetType: audit.TargetUser,
+		TargetID:   user.ID,
+		Source:     source,
+		Details:    map[string]any{"sessions_revoked": revoked},
+	})
+
+	return nil
+}
+
+func (s *service) ChangeEmail(token, currentPassword, newEmail string, source audit.Source) error {
+	// The token proves the new address belongs to the user, so it is only
+	// ever sent there
+	if s.mailer == nil {
+		return domain.ErrEmailDeliveryDisabled
+	}
+
+	user, err := s.reauthenticate(token, currentPassword)
+	if err != nil {
+		return err
+	}
+
+	newEmail = strings.TrimSpace(newEmail)
+	if !validEmail(newEmail) {
+		return domain.ErrInvalidEmail
+	}
+	if strings.EqualFold(newEmail, user.Email) {
+		return domain.ErrEmailUnchanged
+	}
+
+	verificationToken, err := s.generateToken()
+	if err != nil {
+		return err
+	}
+
+	change := &domain.EmailChange{
+		UserID:    user.ID,
+		NewEmail:  newEmail,
+		TokenHash: hashToken(verificationToken),
+		ExpiresAt: time.Now().Add(emailChangeTTL),
+	}
+	if err := s.repo.CreateEmailChange(change); err != nil {
+		return err
+	}
+
+	if err := s.mailer.SendEmailChange(newEmail, verificationToken); err != nil {
+		return err
+	}
+
+	s.audit(&audit.Entry{
+		ActorID:    user.ID,
+		Action:     audit.ActionEmailChangeRequested,
+		TargetType: audit.TargetUser,
+		TargetID:   user.ID,
+		Source:     source,
+		Details:    map[string]any{"new_email": newEmail},
+	})
+
+	return nil
+}
+
+func (s *service) ConfirmEmailChange(verificationToken string, source audit.Source) error {
+	change, err := s.repo.ConfirmEmailChange(hashToken(verificationToken))
+	if err != nil {
+		return err
+	}
+
+	s.audit(&audit.Entry{
+		ActorID:    change.UserID,
+		Action:     audit.ActionEmailChanged,
+		TargetType: audit.TargetUser,
+		TargetID:   change.UserID,
+		Source:     source,
+		Details:    map[string]any{"new_email": change.NewEmail},
+	})
+
+	return nil
+}
+
+func (s *service) DeleteAccount(token, password string, source audit.Source) error {
+	user, err := s.reauthenticate(token, password)
+	if err != nil {
+		return err
+	}
+
+	deletion, err := s.repo.DeleteAccount(user.ID)
+	if err != nil {
+		return err
+	}
+
+	s.audit(&audit.Entry{
+		ActorID:    user.ID,
+		Action:     audit.ActionAccountDeleted,
+		TargetType: audit.TargetUser,
+		TargetID:   user.ID,
+		Source:     source,
+		Details:    map[string]any{"deletion_id": deletion.ID},
+	})
+
+	return nil
+}
+
+func (s *service) ExportAccount(token string, source audit.Source) (*domain.AccountExport, error) {
+	userID, err := s.ValidateToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	profile, err := s.GetProfile(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := s.repo.GetUserSessions(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit(&audit.Entry{
+		ActorID:    userID,
+		Action:     audit.ActionAccountExported,
+		TargetType: audit.TargetUser,
+		TargetID:   userID,
+		Source:     source,
+	})
+
+	return &domain.AccountExport{
+		User:     user,
+		Profile:  profile,
+		Sessions: sessions,
+	}, nil
+}
+
+func (s *service) GetAccountDeletions(afterID int64, limit int) ([]*domain.AccountDeletion, error) {
+	if afterID < 0 {
+		afterID = 0
+	}
+	if limit <= 0 {
+		limit = defaultDeletionsLimit
+	}
+	if limit > maxDeletionsLimit {
+		limit = maxDeletionsLimit
+	}
+
+	return s.repo.GetAccountDeletions(afterID, limit)
+}
+
+// reauthenticate returns the user the token belongs to if the password is
+// theirs. Accounts signed up with an identity provider have no password,
+// they confirm who they are by signing in with the provider again: the
+// session of the token must be at most reauthWindow old.
+func (s *service) reauthenticate(token, password string) (*domain.User, error) {
+	session, err := s.validSession(token)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.repo.GetUserByID(session.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.PasswordHash == "" && password == "" {
+		if time.Since(session.CreatedAt) > reauthWindow {
+			return nil, domain.ErrReauthenticationRequired
+		}
+		return user, nil
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return nil, domain.ErrInvalidPassword
+	}
+
+	return user, nil
+}
+
+// validEmail reports whether email is a bare address that fits the users
+// table
+func validEmail(email string) bool {
+	if len(email) > maxEmailLength {
+		return false
+	}
+
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
+}
@@ -0,0 +1,264 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chizheg/forum/internal/auth/domain"
+	"github.com/chizheg/forum/pkg/audit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MockMailer records the sent emails
+type MockMailer struct {
+	emailChanges map[string]string // email -> verification token
+}
+
+func (m *MockMailer) SendEmailChange(email, verificationToken string) error {
+	if m.emailChanges == nil {
+		m.emailChanges = map[string]string{}
+	}
+	m.emailChanges[email] = verificationToken
+	return nil
+}
+
+// newAccountTestService creates a service where "token" belongs to the user
+// 1 with the password "old password"
+func newAccountTestService(t *testing.T, mockRepo *MockRepository, auditLog *MockAuditLog) domain.Service {
+	return newMailerTestService(t, mockRepo, auditLog, new(MockMailer))
+}
+
+func newMailerTestService(t *testing.T, mockRepo *MockRepository, auditLog *MockAuditLog, mailer domain.Mailer) domain.Service {
+	hash, err := bcrypt.GenerateFromPassword([]byte("old password"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	mockRepo.On("GetSessionByToken", "token").Return(&domain.Session{UserID: 1, ExpiresAt: time.Now().Add(time.Hour)}, nil)
+	mockRepo.On("GetUserByID", 1).Return(&domain.User{ID: 1, Email: "alice@example.com", PasswordHash: string(hash)}, nil)
+
+	return NewService(mockRepo, auditLog, mailer, TwoFactorConfig{}, nil, zap.NewNop())
+}
+
+func TestService_ChangePassword(t *testing.T) {
+	mockRepo := new(MockRepository)
+	auditLog := new(MockAuditLog)
+	svc := newAccountTestService(t, mockRepo, auditLog)
+
+	// Test wrong current password
+	err := svc.ChangePassword("token", "wrong", "", "new password", audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrInvalidPassword)
+
+	// Test short passwords
+	err = svc.ChangePassword("token", "old password", "", "short", audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrPasswordTooShort)
+
+	// Test other sessions are revoked
+	mockRepo.On("UpdatePassword", 1, mock.MatchedBy(func(hash string) bool {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte("new password")) == nil
+	})).Return(nil)
+	mockRepo.On("DeleteOtherSessions", 1, "token").Return(2, nil)
+	require.NoError(t, svc.ChangePassword("token", "old password", "", "new password", audit.Source{}))
+
+	require.Len(t, auditLog.entries, 1)
+	assert.Equal(t, audit.ActionPasswordChanged, auditLog.entries[0].Action)
+	assert.Equal(t, 2, auditLog.entries[0].Details["sessions_revoked"])
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_ChangePasswordWithTwoFactor(t *testing.T) {
+	mockRepo := new(MockRepository)
+	auditLog := new(MockAuditLog)
+	svc := NewService(mockRepo, auditLog, nil, TwoFactorConfig{}, nil, zap.NewNop())
+
+	mockRepo.On("GetSessionByToken", "token").Return(&domain.Session{UserID: 1, ExpiresAt: time.Now().Add(time.Hour)}, nil)
+	mockRepo.On("GetUserByID", 1).Return(newTwoFactorTestUser(t), nil)
+
+	// Test the password alone isn't enough
+	err := svc.ChangePassword("token", "password123", "", "new password", audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrInvalidCode)
+
+	mockRepo.On("UseRecoveryCode", 1, mock.Anything).Return(false, nil).Once()
+	err = svc.ChangePassword("token", "password123", "not a code", "new password", audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrInvalidCode)
+	mockRepo.AssertNotCalled(t, "UpdatePassword", mock.Anything, mock.Anything)
+
+	// Test success with a TOTP code
+	mockRepo.On("UseTOTPStep", 1, mock.AnythingOfType("int64")).Return(true, nil)
+	mockRepo.On("UpdatePassword", 1, mock.AnythingOfType("string")).Return(nil)
+	mockRepo.On("DeleteOtherSessions", 1, "token").Return(0, nil)
+	require.NoError(t, svc.ChangePassword("token", "password123", currentCode(t, testTOTPSecret), "new password", audit.Source{}))
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_ChangeEmail(t *testing.T) {
+	mockRepo := new(MockRepository)
+	auditLog := new(MockAuditLog)
+	mailer := new(MockMailer)
+	svc := newMailerTestService(t, mockRepo, auditLog, mailer)
+
+	// Test wrong current password
+	err := svc.ChangeEmail("token", "wrong", "bob@example.com", audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrInvalidPassword)
+
+	// Test invalid addresses
+	for _, email := range []string{"", "bob", "Bob <bob@example.com>", "bob@example.com, eve@example.com"} {
+		err = svc.ChangeEmail("token", "old password", email, audit.Source{})
+		assert.ErrorIs(t, err, domain.ErrInvalidEmail, email)
+	}
+
+	// Test the current address
+	err = svc.ChangeEmail("token", "old password", "Alice@example.com", audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrEmailUnchanged)
+
+	// Test the change is stored until verified
+	var tokenHash string
+	mockRepo.On("CreateEmailChange", mock.MatchedBy(func(change *domain.EmailChange) bool {
+		return change.UserID == 1 && change.NewEmail == "bob@example.com" && change.ExpiresAt.After(time.Now())
+	})).Run(func(args mock.Arguments) {
+		tokenHash = args.Get(0).(*domain.EmailChange).TokenHash
+	}).Return(nil)
+
+	require.NoError(t, svc.ChangeEmail("token", "old password", " bob@example.com ", audit.Source{}))
+
+	// Test the token is only delivered to the new address
+	require.Len(t, mailer.emailChanges, 1)
+	verificationToken := mailer.emailChanges["bob@example.com"]
+	require.NotEmpty(t, verificationToken)
+	assert.Equal(t, hashToken(verificationToken), tokenHash)
+
+	// Test confirming needs the delivered token
+	mockRepo.On("ConfirmEmailChange", hashToken("guessed")).Return(nil, domain.ErrInvalidVerificationToken).Once()
+	err = svc.ConfirmEmailChange("guessed", audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrInvalidVerificationToken)
+
+	change := &domain.EmailChange{UserID: 1, NewEmail: "bob@example.com"}
+	mockRepo.On("ConfirmEmailChange", tokenHash).Return(change, nil).Once()
+	require.NoError(t, svc.ConfirmEmailChange(verificationToken, audit.Source{}))
+
+	require.Len(t, auditLog.entries, 2)
+	assert.Equal(t, audit.ActionEmailChangeRequested, auditLog.entries[0].Action)
+	assert.Equal(t, audit.ActionEmailChanged, auditLog.entries[1].Action)
+	assert.Equal(t, 1, auditLog.entries[1].ActorID)
+
+	// Test used tokens
+	mockRepo.On("ConfirmEmailChange", tokenHash).Return(nil, domain.ErrInvalidVerificationToken).Once()
+	err = svc.ConfirmEmailChange(verificationToken, audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrInvalidVerificationToken)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_DeleteAccount(t *testing.T) {
+	mockRepo := new(MockRepository)
+	auditLog := new(MockAuditLog)
+	svc := newAccountTestService(t, mockRepo, auditLog)
+
+	// Test wrong password
+	err := svc.DeleteAccount("token", "wrong", audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrInvalidPassword)
+
+	// Test accounts with a password can't leave it out
+	err = svc.DeleteAccount("token", "", audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrInvalidPassword)
+
+	// Test successful deletion
+	mockRepo.On("DeleteAccount", 1).Return(&domain.AccountDeletion{ID: 7, UserID: 1}, nil)
+	require.NoError(t, svc.DeleteAccount("token", "old password", audit.Source{}))
+
+	require.Len(t, auditLog.entries, 1)
+	assert.Equal(t, audit.ActionAccountDeleted, auditLog.entries[0].Action)
+	assert.Equal(t, int64(7), auditLog.entries[0].Details["deletion_id"])
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_DeleteAccountWithoutPassword(t *testing.T) {
+	mockRepo := new(MockRepository)
+	auditLog := new(MockAuditLog)
+	svc := NewService(mockRepo, auditLog, nil, TwoFactorConfig{}, nil, zap.NewNop())
+
+	// The account signed up with an identity provider
+	mockRepo.On("GetUserByID", 1).Return(&domain.User{ID: 1, Email: "alice@example.com"}, nil)
+	mockRepo.On("GetSessionByToken", "old token").Return(&domain.Session{
+		UserID:    1,
+		ExpiresAt: time.Now().Add(time.Hour),
+		CreatedAt: time.Now().Add(-time.Hour),
+	}, nil)
+	mockRepo.On("GetSessionByToken", "token").Return(&domain.Session{
+		UserID:    1,
+		ExpiresAt: time.Now().Add(time.Hour),
+		CreatedAt: time.Now().Add(-time.Minute),
+	}, nil)
+
+	// Test an older session has to sign in with the provider again
+	err := svc.DeleteAccount("old token", "", audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrReauthenticationRequired)
+
+	// Test passwords never match
+	err = svc.DeleteAccount("token", "guess", audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrInvalidPassword)
+
+	// Test a session from a recent sign-in deletes the account
+	mockRepo.On("DeleteAccount", 1).Return(&domain.AccountDeletion{ID: 8, UserID: 1}, nil)
+	require.NoError(t, svc.DeleteAccount("token", "", audit.Source{}))
+
+	require.Len(t, auditLog.entries, 1)
+	assert.Equal(t, audit.ActionAccountDeleted, auditLog.entries[0].Action)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_ExportAccount(t *testing.T) {
+	mockRepo := new(MockRepository)
+	auditLog := new(MockAuditLog)
+	svc := newAccountTestService(t, mockRepo, auditLog)
+
+	profile := &domain.Profile{UserID: 1, DisplayName: "Alice"}
+	sessions := []*domain.Session{{ID: 3, UserID: 1, Token: "token"}}
+	mockRepo.On("GetProfiles", []int{1}).Return([]*domain.Profile{profile}, nil)
+	mockRepo.On("GetUserSessions", 1).Return(sessions, nil)
+
+	export, err := svc.ExportAccount("token", audit.Source{})
+	require.NoError(t, err)
+	assert.Equal(t, "alice@example.com", export.User.Email)
+	assert.Equal(t, profile, export.Profile)
+	assert.Equal(t, sessions, export.Sessions)
+
+	require.Len(t, auditLog.entries, 1)
+	assert.Equal(t, audit.ActionAccountExported, auditLog.entries[0].Action)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_GetAccountDeletions(t *testing.T) {
+	mockRepo := new(MockRepository)
+	svc := NewService(mockRepo, new(MockAuditLog), nil, TwoFactorConfig{}, nil, zap.NewNop())
+
+	deletions := []*domain.AccountDeletion{{ID: 8, UserID: 3}}
+	mockRepo.On("GetAccountDeletions", int64(0), defaultDeletionsLimit).Return(deletions, nil)
+	mockRepo.On("GetAccountDeletions", int64(7), maxDeletionsLimit).Return(deletions, nil)
+
+	result, err := svc.GetAccountDeletions(-1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, deletions, result)
+
+	_, err = svc.GetAccountDeletions(7, maxDeletionsLimit+1)
+	require.NoError(t, err)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_ChangeEmailWithoutMailer(t *testing.T) {
+	mockRepo := new(MockRepository)
+	svc := newMailerTestService(t, mockRepo, new(MockAuditLog), nil)
+
+	err := svc.ChangeEmail("token", "old password", "bob@example.com", audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrEmailDeliveryDisabled)
+
+	mockRepo.AssertNotCalled(t, "CreateEmailChange", mock.Anything)
+}
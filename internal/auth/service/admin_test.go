@@ -0,0 +1,164 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chizheg/forum/internal/auth/domain"
+	"github.com/chizheg/forum/pkg/audit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newAdminTestService creates a service where "admin-token" belongs to the
+// admin 1 and "user-token" to the moderator 2
+func newAdminTestService(mockRepo *MockRepository, auditLog *MockAuditLog) domain.Service {
+	expires := time.Now().Add(time.Hour)
+	mockRepo.On("GetSessionByToken", "admin-token").Return(&domain.Session{UserID: 1, ExpiresAt: expires}, nil)
+	mockRepo.On("GetSessionByToken", "user-token").Return(&domain.Session{UserID: 2, ExpiresAt: expires}, nil).Maybe()
+	mockRepo.On("GetUserByID", 1).Return(&domain.User{ID: 1, Role: domain.RoleAdmin}, nil)
+	mockRepo.On("GetUserByID", 2).Return(&domain.User{ID: 2, Role: domain.RoleModerator}, nil).Maybe()
+
+	return NewService(mockRepo, auditLog, nil, TwoFactorConfig{}, nil, zap.NewNop())
+}
+
+func TestService_ListUsers(t *testing.T) {
+	mockRepo := new(MockRepository)
+	svc := newAdminTestService(mockRepo, new(MockAuditLog))
+
+	users := []*domain.User{{ID: 3, Username: "alice"}}
+	mockRepo.On("ListUsers", domain.UserFilter{Query: "ali", Limit: defaultUserLimit}).Return(users, 1, nil)
+
+	result, total, err := svc.ListUsers("admin-token", domain.UserFilter{Query: "ali", Offset: -1})
+	require.NoError(t, err)
+	assert.Equal(t, users, result)
+	assert.Equal(t, 1, total)
+
+	// Test invalid role filter
+	_, _, err = svc.ListUsers("admin-token", domain.UserFilter{Role: "owner"})
+	assert.ErrorIs(t, err, domain.ErrInvalidRole)
+
+	// Test non-admins
+	_, _, err = svc.ListUsers("user-token", domain.UserFilter{})
+	assert.ErrorIs(t, err, domain.ErrForbidden)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_ChangeRole(t *testing.T) {
+	mockRepo := new(MockRepository)
+	auditLog := new(MockAuditLog)
+	svc := newAdminTestService(mockRepo, auditLog)
+
+	mockRepo.On("UpdateRole", 2, domain.RoleUser).Return(domain.RoleModerator, nil)
+	user, err := svc.ChangeRole("admin-token", 2, domain.RoleUser, audit.Source{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, user.ID)
+
+	require.Len(t, auditLog.entries, 1)
+	assert.Equal(t, audit.ActionRoleChanged, auditLog.entries[0].Action)
+	assert.Equal(t, map[string]any{"old_role": domain.RoleModerator, "new_role": domain.RoleUser}, auditLog.entries[0].Details)
+
+	// Test invalid changes
+	_, err = svc.ChangeRole("admin-token", 2, "owner", audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrInvalidRole)
+	_, err = svc.ChangeRole("admin-token", 1, domain.RoleUser, audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrCannotModifySelf)
+	_, err = svc.ChangeRole("user-token", 3, domain.RoleAdmin, audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrForbidden)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_DisableUser(t *testing.T) {
+	mockRepo := new(MockRepository)
+	auditLog := new(MockAuditLog)
+	svc := newAdminTestService(mockRepo, auditLog)
+
+	// Test disabling revokes the sessions
+	mockRepo.On("SetDisabled", 3, true).Return(true, nil)
+	mockRepo.On("DeleteUserSessions", 3).Return(2, nil)
+	require.NoError(t, svc.DisableUser("admin-token", 3, audit.Source{}))
+
+	require.Len(t, auditLog.entries, 1)
+	assert.Equal(t, audit.ActionUserDisabled, auditLog.entries[0].Action)
+	assert.Equal(t, 2, auditLog.entries[0].Details["sessions_revoked"])
+
+	// Test enabling an enabled account records nothing
+	mockRepo.On("SetDisabled", 4, false).Return(false, nil)
+	require.NoError(t, svc.EnableUser("admin-token", 4, audit.Source{}))
+	assert.Len(t, auditLog.entries, 1)
+
+	// Test admins can't disable themselves
+	assert.ErrorIs(t, svc.DisableUser("admin-token", 1, audit.Source{}), domain.ErrCannotModifySelf)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_DisabledUser(t *testing.T) {
+	mockRepo := new(MockRepository)
+	auditLog := new(MockAuditLog)
+	svc := NewService(mockRepo, auditLog, nil, TwoFactorConfig{}, nil, zap.NewNop())
+
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	disabledAt := time.Now()
+	mockRepo.On("GetUserByUsername", "disabled").Return(&domain.User{ID: 3, PasswordHash: string(hashedPassword), DisabledAt: &disabledAt}, nil)
+	mockRepo.On("GetUserByUsername", "reset").Return(&domain.User{ID: 4, PasswordHash: string(hashedPassword), PasswordResetRequired: true}, nil)
+
+	// Test logins are refused
+	_, err := svc.Login("disabled", "password123", audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrUserDisabled)
+	_, err = svc.Login("reset", "password123", audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrPasswordResetRequired)
+
+	// Test the state is hidden from wrong passwords
+	_, err = svc.Login("disabled", "wrongpassword", audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrInvalidPassword)
+
+	// Test remaining sessions are rejected
+	mockRepo.On("GetSessionByToken", "token").Return(&domain.Session{UserID: 3, ExpiresAt: time.Now().Add(time.Hour), UserDisabled: true}, nil)
+	_, err = svc.ValidateToken("token")
+	assert.ErrorIs(t, err, domain.ErrUserDisabled)
+
+	mockRepo.AssertNotCalled(t, "CreateSession", mock.Anything)
+	assert.Len(t, auditLog.entries, 3)
+}
+
+func TestService_PasswordReset(t *testing.T) {
+	mockRepo := new(MockRepository)
+	auditLog := new(MockAuditLog)
+	svc := newAdminTestService(mockRepo, auditLog)
+
+	var tokenHash string
+	mockRepo.On("RequirePasswordReset", mock.MatchedBy(func(r *domain.PasswordReset) bool {
+		return r.UserID == 3 && r.ExpiresAt.After(time.Now())
+	})).Run(func(args mock.Arguments) {
+		tokenHash = args.Get(0).(*domain.PasswordReset).TokenHash
+	}).Return(nil)
+	mockRepo.On("DeleteUserSessions", 3).Return(1, nil)
+
+	resetToken, err := svc.ForcePasswordReset("admin-token", 3, audit.Source{})
+	require.NoError(t, err)
+	assert.NotEmpty(t, resetToken)
+	assert.Equal(t, hashToken(resetToken), tokenHash)
+	assert.NotEqual(t, resetToken, tokenHash)
+
+	// Test the user sets a new password with the token
+	mockRepo.On("ResetPassword", tokenHash, mock.MatchedBy(func(hash string) bool {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte("new password")) == nil
+	})).Return(3, nil)
+	require.NoError(t, svc.ResetPassword(resetToken, "new password", audit.Source{}))
+
+	require.Len(t, auditLog.entries, 2)
+	assert.Equal(t, audit.ActionPasswordResetForced, auditLog.entries[0].Action)
+	assert.Equal(t, audit.ActionPasswordReset, auditLog.entries[1].Action)
+	assert.Equal(t, 3, auditLog.entries[1].ActorID)
+
+	// Test short passwords
+	assert.ErrorIs(t, svc.ResetPassword(resetToken, "short", audit.Source{}), domain.ErrPasswordTooShort)
+
+	mockRepo.AssertExpectations(t)
+}
@@ -0,0 +1,288 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/chizheg/forum/internal/auth/domain"
+	"github.com/chizheg/forum/pkg/audit"
+)
+
+const (
+	oidcStateTTL = 10 * time.Minute
+	// maxUsernameBase leaves room in the username column for the suffix
+	// added when the name derived from an identity is taken
+	maxUsernameBase  = 40
+	usernameAttempts = 5
+)
+
+func (s *service) StartOIDCLogin(provider string) (string, error) {
+	return s.startOIDC(provider, 0)
+}
+
+func (s *service) StartOIDCLink(token, provider string) (string, error) {
+	userID, err := s.ValidateToken(token)
+	if err != nil {
+		return "", err
+	}
+
+	return s.startOIDC(provider, userID)
+}
+
+func (s *service) CompleteOIDCLogin(name, state, code string, source audit.Source) (*domain.LoginResult, error) {
+	provider, ok := s.providers[name]
+	if !ok {
+		return nil, domain.ErrUnknownProvider
+	}
+
+	pending, err := s.repo.ConsumeOIDCState(name, hashToken(state))
+	if err != nil {
+		return nil, err
+	}
+
+	external, err := provider.Exchange(code, pending.CodeVerifier, pending.Nonce)
+	if errors.Is(err, domain.ErrInvalidAuthCode) || errors.Is(err, domain.ErrInvalidIDToken) {
+		s.audit(&audit.Entry{
+			Action:  audit.ActionLoginFailed,
+			Source:  source,
+			Details: map[string]any{"provider": name, "reason": err.Error()},
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if pending.LinkUserID != 0 {
+		return s.linkIdentity(pending.LinkUserID, name, external, source)
+	}
+
+	identity, err := s.repo.GetIdentity(name, external.Subject)
+	if errors.Is(err, domain.ErrIdentityNotFound) {
+		return s.signUpWithIdentity(name, external, source)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.repo.GetUserByID(identity.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.finishLogin(user, source)
+}
+
+func (s *service) GetIdentities(token string) ([]*domain.Identity, error) {
+	userID, err := s.ValidateToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetUserIdentities(userID)
+}
+
+func (s *service) UnlinkIdentity(token, provider string, source audit.Source) error {
+	user, err := s.tokenUser(token)
+	if err != nil {
+		return err
+	}
+
+	identities, err := s.repo.GetUserIdentities(user.ID)
+	if err != nil {
+		return err
+	}
+
+	var identity *domain.Identity
+	for _, i := range identities {
+		if i.Provider == provider {
+			identity = i
+		}
+	}
+	if identity == nil {
+		return domain.ErrIdentityNotFound
+	}
+
+	// Users who signed up with a provider have no password to fall back on
+	if user.PasswordHash == "" && len(identities) == 1 {
+		return domain.ErrLastSignInMethod
+	}
+
+	if err := s.repo.DeleteIdentity(user.ID, provider); err != nil {
+		return err
+	}
+
+	s.audit(&audit.Entry{
+		ActorID:    user.ID,
+		Action:     audit.ActionIdentityUnlinked,
+		TargetType: audit.TargetUser,
+		TargetID:   user.ID,
+		Source:     source,
+		Details:    map[string]any{"provider": provider, "subject": identity.Subject},
+	})
+
+	return nil
+}
+
+// startOIDC stores a pending sign-in and returns the authorization URL of
+// the provider. The state is only stored hashed, the nonce and the code
+// verifier are needed as is to complete the sign-in.
+func (s *service) startOIDC(name string, linkUserID int) (string, error) {
+	provider, ok := s.providers[name]
+	if !ok {
+		return "", domain.ErrUnknownProvider
+	}
+
+	state, err := s.generateToken()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := s.generateToken()
+	if err != nil {
+		return "", err
+	}
+	codeVerifier, err := generateCodeVerifier()
+	if err != nil {
+		return "", err
+	}
+
+	pending := &domain.OIDCState{
+		Provider:     name,
+		StateHash:    hashToken(state),
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		LinkUserID:   linkUserID,
+		ExpiresAt:    time.Now().Add(oidcStateTTL),
+	}
+	if err := s.repo.CreateOIDCState(pending); err != nil {
+		return "", err
+	}
+
+	return provider.AuthCodeURL(state, nonce, codeVerifier), nil
+}
+
+// linkIdentity links the identity to the user who started the sign-in
+func (s *service) linkIdentity(userID int, provider string, external *domain.ExternalIdentity, source audit.Source) (*domain.LoginResult, error) {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	// Deleted accounts are disabled as well
+	if user.DisabledAt != nil {
+		return nil, domain.ErrUserDisabled
+	}
+
+	identity := &domain.Identity{
+		UserID:   user.ID,
+		Provider: provider,
+		Subject:  external.Subject,
+		Email:    external.Email,
+	}
+	if err := s.repo.CreateIdentity(identity); err != nil {
+		return nil, err
+	}
+
+	s.audit(&audit.Entry{
+		ActorID:    user.ID,
+		Action:     audit.ActionIdentityLinked,
+		TargetType: audit.TargetUser,
+		TargetID:   user.ID,
+		Source:     source,
+		Details:    map[string]any{"provider": provider, "subject": external.Subject},
+	})
+
+	return &domain.LoginResult{LinkedIdentity: identity}, nil
+}
+
+// signUpWithIdentity creates a user without a password for an identity
+// seen for the first time. Existing accounts are never matched by email,
+// their owner has to link the provider while signed in.
+func (s *service) signUpWithIdentity(provider string, external *domain.ExternalIdentity, source audit.Source) (*domain.LoginResult, error) {
+	if external.Email == "" || !external.EmailVerified {
+		return nil, domain.ErrEmailNotVerified
+	}
+
+	base := usernameFromIdentity(external)
+	user := &domain.User{Email: external.Email}
+	identity := &domain.Identity{
+		Provider: provider,
+		Subject:  external.Subject,
+		Email:    external.Email,
+	}
+	for attempt := 1; ; attempt++ {
+		user.Username = base
+		if attempt > 1 {
+			suffix, err := usernameSuffix()
+			if err != nil {
+				return nil, err
+			}
+			user.Username = base + "-" + suffix
+		}
+
+		err := s.repo.CreateUserWithIdentity(user, identity)
+		if errors.Is(err, domain.ErrUsernameTaken) && attempt < usernameAttempts {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		break
+	}
+
+	s.audit(&audit.Entry{
+		ActorID:    user.ID,
+		Action:     audit.ActionRegister,
+		TargetType: audit.TargetUser,
+		TargetID:   user.ID,
+		Source:     source,
+		Details:    map[string]any{"provider": provider, "subject": external.Subject},
+	})
+
+	return s.finishLogin(user, source)
+}
+
+// usernameFromIdentity derives a username from the preferred username,
+// the email or the name of the identity
+func usernameFromIdentity(external *domain.ExternalIdentity) string {
+	local, _, _ := strings.Cut(external.Email, "@")
+	for _, candidate := range []string{external.PreferredUsername, local, external.Name} {
+		var b strings.Builder
+		for _, r := range strings.ToLower(candidate) {
+			switch {
+			case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_', r == '-', r == '.':
+				b.WriteRune(r)
+			case r == ' ':
+				b.WriteRune('_')
+			}
+			if b.Len() == maxUsernameBase {
+				break
+			}
+		}
+		if b.Len() > 0 {
+			return b.String()
+		}
+	}
+
+	return "user"
+}
+
+func usernameSuffix() (string, error) {
+	b := make([]byte, 3)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// generateCodeVerifier returns a PKCE code verifier, which only allows
+// unpadded base64url characters
+func generateCodeVerifier() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,277 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chizheg/forum/internal/auth/domain"
+	"github.com/chizheg/forum/pkg/audit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type MockIdentityProvider struct {
+	mock.Mock
+}
+
+func (m *MockIdentityProvider) AuthCodeURL(state, nonce, codeVerifier string) string {
+	args := m.Called(state, nonce, codeVerifier)
+	return args.String(0)
+}
+
+func (m *MockIdentityProvider) Exchange(code, codeVerifier, nonce string) (*domain.ExternalIdentity, error) {
+	args := m.Called(code, codeVerifier, nonce)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.ExternalIdentity), args.Error(1)
+}
+
+// newOIDCTestService creates a service with the provider "example" where
+// the state "state" is pending and exchanging "code" returns external
+func newOIDCTestService(mockRepo *MockRepository, auditLog *MockAuditLog, pending *domain.OIDCState, external *domain.ExternalIdentity) domain.Service {
+	provider := new(MockIdentityProvider)
+	pending.Provider = "example"
+	pending.Nonce = "nonce"
+	pending.CodeVerifier = "verifier"
+	mockRepo.On("ConsumeOIDCState", "example", hashToken("state")).Return(pending, nil)
+	provider.On("Exchange", "code", "verifier", "nonce").Return(external, nil)
+
+	return NewService(mockRepo, auditLog, nil, TwoFactorConfig{}, map[string]domain.IdentityProvider{
+		"example": provider,
+	}, zap.NewNop())
+}
+
+func TestService_StartOIDCLogin(t *testing.T) {
+	mockRepo := new(MockRepository)
+	provider := new(MockIdentityProvider)
+	svc := NewService(mockRepo, new(MockAuditLog), nil, TwoFactorConfig{}, map[string]domain.IdentityProvider{
+		"example": provider,
+	}, zap.NewNop())
+
+	// Test unknown providers
+	_, err := svc.StartOIDCLogin("other")
+	assert.ErrorIs(t, err, domain.ErrUnknownProvider)
+
+	// Test the state is stored hashed with the nonce and code verifier
+	var pending *domain.OIDCState
+	mockRepo.On("CreateOIDCState", mock.AnythingOfType("*domain.OIDCState")).Run(func(args mock.Arguments) {
+		pending = args.Get(0).(*domain.OIDCState)
+	}).Return(nil)
+	provider.On("AuthCodeURL", mock.Anything, mock.Anything, mock.Anything).Return("https://idp.example.com/authorize")
+
+	authURL, err := svc.StartOIDCLogin("example")
+	require.NoError(t, err)
+	assert.Equal(t, "https://idp.example.com/authorize", authURL)
+
+	call := provider.Calls[0]
+	state, nonce, verifier := call.Arguments.String(0), call.Arguments.String(1), call.Arguments.String(2)
+	assert.Equal(t, "example", pending.Provider)
+	assert.Equal(t, hashToken(state), pending.StateHash)
+	assert.Equal(t, nonce, pending.Nonce)
+	assert.Equal(t, verifier, pending.CodeVerifier)
+	assert.Zero(t, pending.LinkUserID)
+	assert.Len(t, verifier, 43)
+	assert.NotContains(t, verifier, "=")
+	assert.WithinDuration(t, time.Now().Add(oidcStateTTL), pending.ExpiresAt, time.Minute)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_CompleteOIDCLogin(t *testing.T) {
+	mockRepo := new(MockRepository)
+	auditLog := new(MockAuditLog)
+	external := &domain.ExternalIdentity{Subject: "subject-1", Email: "alice@example.com", EmailVerified: true}
+	svc := newOIDCTestService(mockRepo, auditLog, &domain.OIDCState{}, external)
+
+	// Test unknown states
+	mockRepo.On("ConsumeOIDCState", "example", hashToken("other")).Return(nil, domain.ErrInvalidOIDCState)
+	_, err := svc.CompleteOIDCLogin("example", "other", "code", audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrInvalidOIDCState)
+
+	// Test linked identities log in their user
+	mockRepo.On("GetIdentity", "example", "subject-1").Return(&domain.Identity{UserID: 1}, nil)
+	mockRepo.On("GetUserByID", 1).Return(&domain.User{ID: 1, Username: "alice"}, nil)
+	mockRepo.On("CreateSession", mock.MatchedBy(func(session *domain.Session) bool {
+		return session.UserID == 1
+	})).Return(nil)
+
+	result, err := svc.CompleteOIDCLogin("example", "state", "code", audit.Source{})
+	require.NoError(t, err)
+	assert.NotEmpty(t, result.Token)
+
+	require.Len(t, auditLog.entries, 1)
+	assert.Equal(t, audit.ActionLogin, auditLog.entries[0].Action)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_CompleteOIDCLoginTwoFactor(t *testing.T) {
+	mockRepo := new(MockRepository)
+	external := &domain.ExternalIdentity{Subject: "subject-1"}
+	svc := newOIDCTestService(mockRepo, new(MockAuditLog), &domain.OIDCState{}, external)
+
+	// Test the provider doesn't replace the second factor
+	user := newTwoFactorTestUser(t)
+	mockRepo.On("GetIdentity", "example", "subject-1").Return(&domain.Identity{UserID: 1}, nil)
+	mockRepo.On("GetUserByID", 1).Return(user, nil)
+	mockRepo.On("CreateLoginChallenge", mock.AnythingOfType("*domain.LoginChallenge")).Return(nil)
+
+	result, err := svc.CompleteOIDCLogin("example", "state", "code", audit.Source{})
+	require.NoError(t, err)
+	assert.Empty(t, result.Token)
+	assert.NotNil(t, result.Challenge)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_CompleteOIDCLoginSignUp(t *testing.T) {
+	mockRepo := new(MockRepository)
+	auditLog := new(MockAuditLog)
+	external := &domain.ExternalIdentity{
+		Subject:           "subject-1",
+		Email:             "alice@example.com",
+		EmailVerified:     true,
+		PreferredUsername: "Alice Smith",
+	}
+	svc := newOIDCTestService(mockRepo, auditLog, &domain.OIDCState{}, external)
+	mockRepo.On("GetIdentity", "example", "subject-1").Return(nil, domain.ErrIdentityNotFound)
+
+	// Test taken usernames get a suffix
+	var usernames []string
+	mockRepo.On("CreateUserWithIdentity", mock.AnythingOfType("*domain.User"), mock.AnythingOfType("*domain.Identity")).Run(func(args mock.Arguments) {
+		usernames = append(usernames, args.Get(0).(*domain.User).Username)
+	}).Return(domain.ErrUsernameTaken).Once()
+	mockRepo.On("CreateUserWithIdentity", mock.MatchedBy(func(user *domain.User) bool {
+		return user.Email == "alice@example.com" && user.PasswordHash == ""
+	}), mock.MatchedBy(func(identity *domain.Identity) bool {
+		return identity.Provider == "example" && identity.Subject == "subject-1"
+	})).Run(func(args mock.Arguments) {
+		user := args.Get(0).(*domain.User)
+		usernames = append(usernames, user.Username)
+		user.ID = 2
+		user.Role = domain.RoleUser
+	}).Return(nil).Once()
+	mockRepo.On("CreateSession", mock.AnythingOfType("*domain.Session")).Return(nil)
+
+	result, err := svc.CompleteOIDCLogin("example", "state", "code", audit.Source{})
+	require.NoError(t, err)
+	assert.NotEmpty(t, result.Token)
+
+	require.Len(t, usernames, 2)
+	assert.Equal(t, "alice_smith", usernames[0])
+	assert.True(t, strings.HasPrefix(usernames[1], "alice_smith-"), usernames[1])
+
+	require.Len(t, auditLog.entries, 2)
+	assert.Equal(t, audit.ActionRegister, auditLog.entries[0].Action)
+	assert.Equal(t, "example", auditLog.entries[0].Details["provider"])
+	assert.Equal(t, audit.ActionLogin, auditLog.entries[1].Action)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_CompleteOIDCLoginSignUpRequiresVerifiedEmail(t *testing.T) {
+	mockRepo := new(MockRepository)
+	external := &domain.ExternalIdentity{Subject: "subject-1", Email: "alice@example.com"}
+	svc := newOIDCTestService(mockRepo, new(MockAuditLog), &domain.OIDCState{}, external)
+	mockRepo.On("GetIdentity", "example", "subject-1").Return(nil, domain.ErrIdentityNotFound)
+
+	_, err := svc.CompleteOIDCLogin("example", "state", "code", audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrEmailNotVerified)
+	mockRepo.AssertNotCalled(t, "CreateUserWithIdentity", mock.Anything, mock.Anything)
+}
+
+func TestService_CompleteOIDCLoginRejectedToken(t *testing.T) {
+	mockRepo := new(MockRepository)
+	auditLog := new(MockAuditLog)
+	provider := new(MockIdentityProvider)
+	svc := NewService(mockRepo, auditLog, nil, TwoFactorConfig{}, map[string]domain.IdentityProvider{
+		"example": provider,
+	}, zap.NewNop())
+
+	pending := &domain.OIDCState{Provider: "example", Nonce: "nonce", CodeVerifier: "verifier"}
+	mockRepo.On("ConsumeOIDCState", "example", hashToken("state")).Return(pending, nil)
+	provider.On("Exchange", "code", "verifier", "nonce").Return(nil, domain.ErrInvalidIDToken)
+
+	_, err := svc.CompleteOIDCLogin("example", "state", "code", audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrInvalidIDToken)
+
+	require.Len(t, auditLog.entries, 1)
+	assert.Equal(t, audit.ActionLoginFailed, auditLog.entries[0].Action)
+	assert.Equal(t, "example", auditLog.entries[0].Details["provider"])
+}
+
+func TestService_OIDCLink(t *testing.T) {
+	mockRepo := new(MockRepository)
+	auditLog := new(MockAuditLog)
+	external := &domain.ExternalIdentity{Subject: "subject-1", Email: "alice@example.com"}
+	svc := newOIDCTestService(mockRepo, auditLog, &domain.OIDCState{LinkUserID: 1}, external)
+
+	// Test the link is completed for the user who started it, without
+	// logging in again
+	mockRepo.On("GetUserByID", 1).Return(&domain.User{ID: 1, Username: "alice"}, nil)
+	mockRepo.On("CreateIdentity", mock.MatchedBy(func(identity *domain.Identity) bool {
+		return identity.UserID == 1 && identity.Provider == "example" && identity.Subject == "subject-1"
+	})).Return(nil)
+
+	result, err := svc.CompleteOIDCLogin("example", "state", "code", audit.Source{})
+	require.NoError(t, err)
+	assert.Empty(t, result.Token)
+	require.NotNil(t, result.LinkedIdentity)
+	assert.Equal(t, "alice@example.com", result.LinkedIdentity.Email)
+
+	require.Len(t, auditLog.entries, 1)
+	assert.Equal(t, audit.ActionIdentityLinked, auditLog.entries[0].Action)
+
+	mockRepo.AssertNotCalled(t, "CreateSession", mock.Anything)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_UnlinkIdentity(t *testing.T) {
+	mockRepo := new(MockRepository)
+	auditLog := new(MockAuditLog)
+	svc := NewService(mockRepo, auditLog, nil, TwoFactorConfig{}, nil, zap.NewNop())
+
+	user := &domain.User{ID: 1}
+	mockRepo.On("GetSessionByToken", "token").Return(&domain.Session{UserID: 1, ExpiresAt: time.Now().Add(time.Hour)}, nil)
+	mockRepo.On("GetUserByID", 1).Return(user, nil)
+	mockRepo.On("GetUserIdentities", 1).Return([]*domain.Identity{{UserID: 1, Provider: "example", Subject: "subject-1"}}, nil)
+
+	// Test providers that aren't linked
+	err := svc.UnlinkIdentity("token", "other", audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrIdentityNotFound)
+
+	// Test users without a password keep their last identity
+	err = svc.UnlinkIdentity("token", "example", audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrLastSignInMethod)
+
+	// Test users with a password can unlink it
+	user.PasswordHash = "hash"
+	mockRepo.On("DeleteIdentity", 1, "example").Return(nil)
+	require.NoError(t, svc.UnlinkIdentity("token", "example", audit.Source{}))
+
+	require.Len(t, auditLog.entries, 1)
+	assert.Equal(t, audit.ActionIdentityUnlinked, auditLog.entries[0].Action)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUsernameFromIdentity(t *testing.T) {
+	tests := []struct {
+		external *domain.ExternalIdentity
+		want     string
+	}{
+		{&domain.ExternalIdentity{PreferredUsername: "Alice", Email: "bob@example.com"}, "alice"},
+		{&domain.ExternalIdentity{Email: "bob.smith@example.com"}, "bob.smith"},
+		{&domain.ExternalIdentity{Name: "Carol Jones"}, "carol_jones"},
+		{&domain.ExternalIdentity{PreferredUsername: "Элис"}, "user"},
+		{&domain.ExternalIdentity{PreferredUsername: strings.Repeat("a", 60)}, strings.Repeat("a", maxUsernameBase)},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, usernameFromIdentity(tt.external))
+	}
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"net/url"
+	"strings"
+	"time"
+	_ "time/tzdata" // Timezones are validated without relying on the host
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/chizheg/forum/internal/auth/domain"
+)
+
+const (
+	maxDisplayNameLength = 50
+	maxBioLength         = 500
+	maxAvatarURLLength   = 2048
+	maxProfilesBatch     = 500
+	defaultTimezone      = "UTC"
+)
+
+func (s *service) GetProfile(userID int) (*domain.Profile, error) {
+	profiles, err := s.repo.GetProfiles([]int{userID})
+	if err != nil {
+		return nil, err
+	}
+	if len(profiles) == 0 {
+		return nil, domain.ErrUserNotFound
+	}
+
+	return profiles[0], nil
+}
+
+func (s *service) GetProfilesBatch(ids []int) ([]*domain.Profile, error) {
+	if len(ids) == 0 {
+		return []*domain.Profile{}, nil
+	}
+	if len(ids) > maxProfilesBatch {
+		ids = ids[:maxProfilesBatch]
+	}
+
+	return s.repo.GetProfiles(ids)
+}
+
+func (s *service) UpdateProfile(token string, profile *domain.Profile) (*domain.Profile, error) {
+	userID, err := s.ValidateToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	update := &domain.Profile{
+		UserID:      userID,
+		DisplayName: strings.Join(strings.Fields(profile.DisplayName), " "),
+		AvatarURL:   strings.TrimSpace(profile.AvatarURL),
+		Bio:         strings.TrimSpace(profile.Bio),
+		Timezone:    strings.TrimSpace(profile.Timezone),
+	}
+	if update.Timezone == "" {
+		update.Timezone = defaultTimezone
+	}
+
+	if err := validateProfile(update); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.UpdateProfile(update); err != nil {
+		return nil, err
+	}
+
+	return s.GetProfile(userID)
+}
+
+// validateProfile checks a normalized profile
+func validateProfile(profile *domain.Profile) error {
+	if utf8.RuneCountInString(profile.DisplayName) > maxDisplayNameLength {
+		return domain.ErrDisplayNameTooLong
+	}
+	// Display names are shown inline, so they must not carry control or
+	// formatting characters such as bidi overrides
+	for _, r := range profile.DisplayName {
+		if unicode.IsControl(r) || unicode.Is(unicode.Cf, r) {
+			return domain.ErrInvalidDisplayName
+		}
+	}
+
+	if utf8.RuneCountInString(profile.Bio) > maxBioLength {
+		return domain.ErrBioTooLong
+	}
+
+	if profile.AvatarURL != "" {
+		u, err := url.Parse(profile.AvatarURL)
+		if err != nil || len(profile.AvatarURL) > maxAvatarURLLength ||
+			(u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return domain.ErrInvalidAvatarURL
+		}
+	}
+
+	// LoadLocation also accepts "Local", which depends on the host
+	if _, err := time.LoadLocation(profile.Timezone); err != nil || profile.Timezone == "Local" {
+		return domain.ErrInvalidTimezone
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chizheg/forum/internal/auth/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestService_GetProfile(t *testing.T) {
+	mockRepo := new(MockRepository)
+	svc := NewService(mockRepo, new(MockAuditLog), nil, TwoFactorConfig{}, nil, zap.NewNop())
+
+	profile := &domain.Profile{UserID: 1, Username: "alice", DisplayName: "alice", Timezone: "UTC"}
+	mockRepo.On("GetProfiles", []int{1}).Return([]*domain.Profile{profile}, nil)
+	mockRepo.On("GetProfiles", []int{9}).Return([]*domain.Profile{}, nil)
+
+	result, err := svc.GetProfile(1)
+	require.NoError(t, err)
+	assert.Equal(t, profile, result)
+
+	// Test unknown user
+	_, err = svc.GetProfile(9)
+	assert.ErrorIs(t, err, domain.ErrUserNotFound)
+
+	// Test empty batch does not hit the repository
+	profiles, err := svc.GetProfilesBatch(nil)
+	require.NoError(t, err)
+	assert.Empty(t, profiles)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_UpdateProfile(t *testing.T) {
+	mockRepo := new(MockRepository)
+	svc := NewService(mockRepo, new(MockAuditLog), nil, TwoFactorConfig{}, nil, zap.NewNop())
+
+	mockRepo.On("GetSessionByToken", "token").Return(&domain.Session{UserID: 1, ExpiresAt: time.Now().Add(time.Hour)}, nil)
+	mockRepo.On("GetProfiles", []int{1}).Return([]*domain.Profile{{UserID: 1, DisplayName: "Alice L."}}, nil)
+
+	// Test the profile is normalized
+	mockRepo.On("UpdateProfile", &domain.Profile{
+		UserID:      1,
+		DisplayName: "Alice L.",
+		AvatarURL:   "https://cdn.example/a.png",
+		Bio:         "Hi",
+		Timezone:    "Europe/Moscow",
+	}).Return(nil).Once()
+	profile, err := svc.UpdateProfile("token", &domain.Profile{
+		UserID:      2,
+		DisplayName: "  Alice \t L. ",
+		AvatarURL:   " https://cdn.example/a.png ",
+		Bio:         "Hi\n",
+		Timezone:    "Europe/Moscow",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Alice L.", profile.DisplayName)
+
+	// Test the timezone defaults to UTC
+	mockRepo.On("UpdateProfile", mock.MatchedBy(func(p *domain.Profile) bool {
+		return p.Timezone == "UTC"
+	})).Return(nil).Once()
+	_, err = svc.UpdateProfile("token", &domain.Profile{})
+	require.NoError(t, err)
+
+	// Test invalid profiles
+	tests := []struct {
+		profile *domain.Profile
+		err     error
+	}{
+		{&domain.Profile{DisplayName: "a\x00b"}, domain.ErrInvalidDisplayName},
+		{&domain.Profile{DisplayName: "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}, domain.ErrDisplayNameTooLong},
+		{&domain.Profile{DisplayName: "evil\u202egnp.exe"}, domain.ErrInvalidDisplayName},
+		{&domain.Profile{AvatarURL: "javascript:alert(1)"}, domain.ErrInvalidAvatarURL},
+		{&domain.Profile{AvatarURL: "/relative.png"}, domain.ErrInvalidAvatarURL},
+		{&domain.Profile{Timezone: "Mars/Olympus"}, domain.ErrInvalidTimezone},
+		{&domain.Profile{Timezone: "Local"}, domain.ErrInvalidTimezone},
+	}
+	for _, tt := range tests {
+		_, err := svc.UpdateProfile("token", tt.profile)
+		assert.ErrorIs(t, err, tt.err)
+	}
+
+	mockRepo.AssertExpectations(t)
+}
@@ -7,19 +7,47 @@ import (
 	"time"
 
 	"github.com/chizheg/forum/internal/auth/domain"
+	"github.com/chizheg/forum/pkg/audit"
+	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type service struct {
-	repo domain.Repository
+	repo      domain.Repository
+	auditLog  audit.Store
+	mailer    domain.Mailer
+	twoFactor TwoFactorConfig
+	providers map[string]domain.IdentityProvider
+	logger    *zap.Logger
 }
 
-// NewService creates a new auth service
-func NewService(repo domain.Repository) domain.Service {
-	return &service{repo: repo}
+// NewService creates a new auth service. Logins, failed logins and other
+// security-relevant actions are recorded in the audit log. Users can also
+// sign in with the OpenID Connect providers, keyed by their name. Email
+// changes are refused without a mailer.
+func NewService(
+	repo domain.Repository,
+	auditLog audit.Store,
+	mailer domain.Mailer,
+	twoFactor TwoFactorConfig,
+	providers map[string]domain.IdentityProvider,
+	logger *zap.Logger,
+) domain.Service {
+	if twoFactor.Issuer == "" {
+		twoFactor.Issuer = defaultTOTPIssuer
+	}
+
+	return &service{
+		repo:      repo,
+		auditLog:  auditLog,
+		mailer:    mailer,
+		twoFactor: twoFactor,
+		providers: providers,
+		logger:    logger,
+	}
 }
 
-func (s *service) Register(username, email, password string) (string, error) {
+func (s *service) Register(username, email, password string, source audit.Source) (string, error) {
 	// Hash password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
@@ -52,27 +80,184 @@ func (s *service) Register(username, email, password string) (string, error) {
 		return "", err
 	}
 
+	s.audit(&audit.Entry{
+		ActorID:    user.ID,
+		Action:     audit.ActionRegister,
+		TargetType: audit.TargetUser,
+		TargetID:   user.ID,
+		Source:     source,
+	})
+
 	return token, nil
 }
 
-func (s *service) Login(username, password string) (string, error) {
+func (s *service) Login(username, password string, source audit.Source) (*domain.LoginResult, error) {
 	user, err := s.repo.GetUserByUsername(username)
+	if errors.Is(err, domain.ErrUserNotFound) {
+		s.audit(&audit.Entry{
+			Action:  audit.ActionLoginFailed,
+			Source:  source,
+			Details: map[string]any{"username": username, "reason": "unknown user"},
+		})
+	}
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
-		return "", errors.New("invalid password")
+		s.audit(&audit.Entry{
+			Action:     audit.ActionLoginFailed,
+			TargetType: audit.TargetUser,
+			TargetID:   user.ID,
+			Source:     source,
+			Details:    map[string]any{"username": username, "reason": "invalid password"},
+		})
+		return nil, domain.ErrInvalidPassword
 	}
 
-	// Create session
+	return s.finishLogin(user, source)
+}
+
+func (s *service) Logout(token string, source audit.Source) error {
+	session, err := s.repo.GetSessionByToken(token)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.DeleteSession(token); err != nil {
+		return err
+	}
+
+	s.audit(&audit.Entry{
+		ActorID:    session.UserID,
+		Action:     audit.ActionSessionRevoked,
+		TargetType: audit.TargetSession,
+		TargetID:   session.ID,
+		Source:     source,
+	})
+
+	return nil
+}
+
+func (s *service) ValidateToken(token string) (int, error) {
+	session, err := s.validSession(token)
+	if err != nil {
+		return 0, err
+	}
+
+	return session.UserID, nil
+}
+
+// validSession returns the session of the token if it has not expired and
+// the account is enabled
+func (s *service) validSession(token string) (*domain.Session, error) {
+	session, err := s.repo.GetSessionByToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if time.Now().After(session.ExpiresAt) {
+		s.repo.DeleteSession(token)
+		return nil, domain.ErrSessionExpired
+	}
+
+	if session.UserDisabled {
+		return nil, domain.ErrUserDisabled
+	}
+
+	return session, nil
+}
+
+func (s *service) GetUsers(ids []int) ([]*domain.User, error) {
+	if len(ids) == 0 {
+		return []*domain.User{}, nil
+	}
+
+	return s.repo.GetUsersByIDs(ids)
+}
+
+func (s *service) GetUsersByUsernames(usernames []string) ([]*domain.User, error) {
+	if len(usernames) == 0 {
+		return []*domain.User{}, nil
+	}
+
+	return s.repo.GetUsersByUsernames(usernames)
+}
+
+func (s *service) GetAuditLog(token string, filter audit.Filter) ([]*audit.Entry, error) {
+	if _, err := s.requireAdmin(token); err != nil {
+		return nil, err
+	}
+
+	return s.auditLog.Query(filter)
+}
+
+// requireAdmin returns the admin the token belongs to
+func (s *service) requireAdmin(token string) (*domain.User, error) {
+	userID, err := s.ValidateToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.Role != domain.RoleAdmin {
+		return nil, domain.ErrForbidden
+	}
+
+	return user, nil
+}
+
+// finishLogin logs in the user whose credentials were checked, unless the
+// account is blocked or needs a second factor
+func (s *service) finishLogin(user *domain.User, source audit.Source) (*domain.LoginResult, error) {
+	// Account state is only revealed to those who proved who they are
+	var blocked error
+	switch {
+	case user.DisabledAt != nil:
+		blocked = domain.ErrUserDisabled
+	case user.PasswordResetRequired:
+		blocked = domain.ErrPasswordResetRequired
+	}
+	if blocked != nil {
+		s.audit(&audit.Entry{
+			Action:     audit.ActionLoginFailed,
+			TargetType: audit.TargetUser,
+			TargetID:   user.ID,
+			Source:     source,
+			Details:    map[string]any{"username": user.Username, "reason": blocked.Error()},
+		})
+		return nil, blocked
+	}
+
+	if user.TOTPEnabledAt != nil || s.twoFactorRequired(user.Role) {
+		challenge, err := s.createLoginChallenge(user)
+		if err != nil {
+			return nil, err
+		}
+		return &domain.LoginResult{Challenge: challenge}, nil
+	}
+
+	token, err := s.createSession(user.ID, source)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.LoginResult{Token: token}, nil
+}
+
+// createSession logs the user in
+func (s *service) createSession(userID int, source audit.Source) (string, error) {
 	token, err := s.generateToken()
 	if err != nil {
 		return "", err
 	}
 
 	session := &domain.Session{
-		UserID:    user.ID,
+		UserID:    userID,
 		Token:     token,
 		ExpiresAt: time.Now().Add(24 * time.Hour),
 	}
@@ -81,21 +266,26 @@ func (s *service) Login(username, password string) (string, error) {
 		return "", err
 	}
 
+	s.audit(&audit.Entry{
+		ActorID:    userID,
+		Action:     audit.ActionLogin,
+		TargetType: audit.TargetSession,
+		TargetID:   session.ID,
+		Source:     source,
+	})
+
 	return token, nil
 }
 
-func (s *service) ValidateToken(token string) (int, error) {
-	session, err := s.repo.GetSessionByToken(token)
-	if err != nil {
-		return 0, err
-	}
-
-	if time.Now().After(session.ExpiresAt) {
-		s.repo.DeleteSession(token)
-		return 0, errors.New("session expired")
+// audit records the entry, failures are logged and don't fail the action
+func (s *service) audit(entry *audit.Entry) {
+	if err := s.auditLog.Write(entry); err != nil {
+		s.logger.Error("failed to write audit log",
+			zap.String("action", string(entry.Action)),
+			zap.Int("actor_id", entry.ActorID),
+			zap.Error(err),
+		)
 	}
-
-	return session.UserID, nil
 }
 
 func (s *service) generateToken() (string, error) {
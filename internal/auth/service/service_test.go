@@ -5,8 +5,11 @@ import (
 	"time"
 
 	"github.com/chizheg/forum/internal/auth/domain"
+	"github.com/chizheg/forum/pkg/audit"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -36,6 +39,22 @@ func (m *MockRepository) GetUserByID(id int) (*domain.User, error) {
 	return args.Get(0).(*domain.User), args.Error(1)
 }
 
+func (m *MockRepository) GetUsersByIDs(ids []int) ([]*domain.User, error) {
+	args := m.Called(ids)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.User), args.Error(1)
+}
+
+func (m *MockRepository) GetUsersByUsernames(usernames []string) ([]*domain.User, error) {
+	args := m.Called(usernames)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.User), args.Error(1)
+}
+
 func (m *MockRepository) CreateSession(session *domain.Session) error {
 	args := m.Called(session)
 	return args.Error(0)
@@ -54,15 +73,232 @@ func (m *MockRepository) DeleteSession(token string) error {
 	return args.Error(0)
 }
 
+func (m *MockRepository) ListUsers(filter domain.UserFilter) ([]*domain.User, int, error) {
+	args := m.Called(filter)
+	if args.Get(0) == nil {
+		return nil, 0, args.Error(2)
+	}
+	return args.Get(0).([]*domain.User), args.Int(1), args.Error(2)
+}
+
+func (m *MockRepository) UpdateRole(userID int, role string) (string, error) {
+	args := m.Called(userID, role)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockRepository) SetDisabled(userID int, disabled bool) (bool, error) {
+	args := m.Called(userID, disabled)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRepository) DeleteUserSessions(userID int) (int, error) {
+	args := m.Called(userID)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockRepository) RequirePasswordReset(reset *domain.PasswordReset) error {
+	args := m.Called(reset)
+	return args.Error(0)
+}
+
+func (m *MockRepository) ResetPassword(tokenHash, passwordHash string) (int, error) {
+	args := m.Called(tokenHash, passwordHash)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockRepository) GetProfiles(ids []int) ([]*domain.Profile, error) {
+	args := m.Called(ids)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.Profile), args.Error(1)
+}
+
+func (m *MockRepository) UpdateProfile(profile *domain.Profile) error {
+	args := m.Called(profile)
+	return args.Error(0)
+}
+
+func (m *MockRepository) UpdatePassword(userID int, passwordHash string) error {
+	args := m.Called(userID, passwordHash)
+	return args.Error(0)
+}
+
+func (m *MockRepository) DeleteOtherSessions(userID int, token string) (int, error) {
+	args := m.Called(userID, token)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockRepository) CreateEmailChange(change *domain.EmailChange) error {
+	args := m.Called(change)
+	return args.Error(0)
+}
+
+func (m *MockRepository) ConfirmEmailChange(tokenHash string) (*domain.EmailChange, error) {
+	args := m.Called(tokenHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.EmailChange), args.Error(1)
+}
+
+func (m *MockRepository) DeleteAccount(userID int) (*domain.AccountDeletion, error) {
+	args := m.Called(userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.AccountDeletion), args.Error(1)
+}
+
+func (m *MockRepository) GetAccountDeletions(afterID int64, limit int) ([]*domain.AccountDeletion, error) {
+	args := m.Called(afterID, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.AccountDeletion), args.Error(1)
+}
+
+func (m *MockRepository) GetUserSessions(userID int) ([]*domain.Session, error) {
+	args := m.Called(userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.Session), args.Error(1)
+}
+
+func (m *MockRepository) SetTOTPSecret(userID int, secret string) (bool, error) {
+	args := m.Called(userID, secret)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRepository) EnableTOTP(userID int, step int64, recoveryCodeHashes []string) error {
+	args := m.Called(userID, step, recoveryCodeHashes)
+	return args.Error(0)
+}
+
+func (m *MockRepository) DisableTOTP(userID int) error {
+	args := m.Called(userID)
+	return args.Error(0)
+}
+
+func (m *MockRepository) UseTOTPStep(userID int, step int64) (bool, error) {
+	args := m.Called(userID, step)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRepository) ReplaceRecoveryCodes(userID int, codeHashes []string) error {
+	args := m.Called(userID, codeHashes)
+	return args.Error(0)
+}
+
+func (m *MockRepository) UseRecoveryCode(userID int, codeHash string) (bool, error) {
+	args := m.Called(userID, codeHash)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRepository) CreateLoginChallenge(challenge *domain.LoginChallenge) error {
+	args := m.Called(challenge)
+	return args.Error(0)
+}
+
+func (m *MockRepository) GetLoginChallenge(tokenHash string) (*domain.LoginChallenge, error) {
+	args := m.Called(tokenHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.LoginChallenge), args.Error(1)
+}
+
+func (m *MockRepository) UseChallengeAttempt(id, maxAttempts int) (int, error) {
+	args := m.Called(id, maxAttempts)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockRepository) UseCodeAttempt(userID, maxFailures int, since time.Time) (bool, error) {
+	args := m.Called(userID, maxFailures, since)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRepository) ResetCodeFailures(userID int) error {
+	args := m.Called(userID)
+	return args.Error(0)
+}
+
+func (m *MockRepository) DeleteLoginChallenge(id int) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockRepository) CreateOIDCState(state *domain.OIDCState) error {
+	args := m.Called(state)
+	return args.Error(0)
+}
+
+func (m *MockRepository) ConsumeOIDCState(provider, stateHash string) (*domain.OIDCState, error) {
+	args := m.Called(provider, stateHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.OIDCState), args.Error(1)
+}
+
+func (m *MockRepository) GetIdentity(provider, subject string) (*domain.Identity, error) {
+	args := m.Called(provider, subject)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Identity), args.Error(1)
+}
+
+func (m *MockRepository) GetUserIdentities(userID int) ([]*domain.Identity, error) {
+	args := m.Called(userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.Identity), args.Error(1)
+}
+
+func (m *MockRepository) CreateIdentity(identity *domain.Identity) error {
+	args := m.Called(identity)
+	return args.Error(0)
+}
+
+func (m *MockRepository) CreateUserWithIdentity(user *domain.User, identity *domain.Identity) error {
+	args := m.Called(user, identity)
+	return args.Error(0)
+}
+
+func (m *MockRepository) DeleteIdentity(userID int, provider string) error {
+	args := m.Called(userID, provider)
+	return args.Error(0)
+}
+
+// MockAuditLog records the written entries and returns a fixed query
+// result
+type MockAuditLog struct {
+	entries []*audit.Entry
+	filters []audit.Filter
+}
+
+func (m *MockAuditLog) Write(entry *audit.Entry) error {
+	m.entries = append(m.entries, entry)
+	return nil
+}
+
+func (m *MockAuditLog) Query(filter audit.Filter) ([]*audit.Entry, error) {
+	m.filters = append(m.filters, filter)
+	return m.entries, nil
+}
+
 func TestService_Register(t *testing.T) {
 	mockRepo := new(MockRepository)
-	svc := NewService(mockRepo)
+	svc := NewService(mockRepo, new(MockAuditLog), nil, TwoFactorConfig{}, nil, zap.NewNop())
 
 	// Test successful registration
 	mockRepo.On("CreateUser", mock.AnythingOfType("*domain.User")).Return(nil)
 	mockRepo.On("CreateSession", mock.AnythingOfType("*domain.Session")).Return(nil)
 
-	token, err := svc.Register("testuser", "test@example.com", "password123")
+	token, err := svc.Register("testuser", "test@example.com", "password123", audit.Source{})
 	assert.NoError(t, err)
 	assert.NotEmpty(t, token)
 
@@ -71,7 +307,7 @@ func TestService_Register(t *testing.T) {
 
 func TestService_Login(t *testing.T) {
 	mockRepo := new(MockRepository)
-	svc := NewService(mockRepo)
+	svc := NewService(mockRepo, new(MockAuditLog), nil, TwoFactorConfig{}, nil, zap.NewNop())
 
 	// Test successful login
 	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.DefaultCost)
@@ -84,21 +320,22 @@ func TestService_Login(t *testing.T) {
 	mockRepo.On("GetUserByUsername", "testuser").Return(mockUser, nil)
 	mockRepo.On("CreateSession", mock.AnythingOfType("*domain.Session")).Return(nil)
 
-	token, err := svc.Login("testuser", "password123")
+	result, err := svc.Login("testuser", "password123", audit.Source{})
 	assert.NoError(t, err)
-	assert.NotEmpty(t, token)
+	assert.NotEmpty(t, result.Token)
+	assert.Nil(t, result.Challenge)
 
 	// Test invalid password
-	token, err = svc.Login("testuser", "wrongpassword")
+	result, err = svc.Login("testuser", "wrongpassword", audit.Source{})
 	assert.Error(t, err)
-	assert.Empty(t, token)
+	assert.Nil(t, result)
 
 	mockRepo.AssertExpectations(t)
 }
 
 func TestService_ValidateToken(t *testing.T) {
 	mockRepo := new(MockRepository)
-	svc := NewService(mockRepo)
+	svc := NewService(mockRepo, new(MockAuditLog), nil, TwoFactorConfig{}, nil, zap.NewNop())
 
 	// Test valid token
 	validSession := &domain.Session{
@@ -129,3 +366,118 @@ func TestService_ValidateToken(t *testing.T) {
 
 	mockRepo.AssertExpectations(t)
 }
+
+func TestService_GetUsers(t *testing.T) {
+	mockRepo := new(MockRepository)
+	svc := NewService(mockRepo, new(MockAuditLog), nil, TwoFactorConfig{}, nil, zap.NewNop())
+
+	mockUsers := []*domain.User{
+		{ID: 1, Username: "alice"},
+		{ID: 2, Username: "bob"},
+	}
+
+	mockRepo.On("GetUsersByIDs", []int{1, 2}).Return(mockUsers, nil)
+	users, err := svc.GetUsers([]int{1, 2})
+	assert.NoError(t, err)
+	assert.Equal(t, mockUsers, users)
+
+	// Test empty lookup does not hit the repository
+	users, err = svc.GetUsers(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, users)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_GetUsersByUsernames(t *testing.T) {
+	mockRepo := new(MockRepository)
+	svc := NewService(mockRepo, new(MockAuditLog), nil, TwoFactorConfig{}, nil, zap.NewNop())
+
+	mockUsers := []*domain.User{{ID: 2, Username: "bob"}}
+
+	mockRepo.On("GetUsersByUsernames", []string{"bob", "nobody"}).Return(mockUsers, nil)
+	users, err := svc.GetUsersByUsernames([]string{"bob", "nobody"})
+	assert.NoError(t, err)
+	assert.Equal(t, mockUsers, users)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_LoginAudit(t *testing.T) {
+	mockRepo := new(MockRepository)
+	auditLog := new(MockAuditLog)
+	svc := NewService(mockRepo, auditLog, nil, TwoFactorConfig{}, nil, zap.NewNop())
+	source := audit.Source{IP: "203.0.113.7", UserAgent: "test"}
+
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	mockRepo.On("GetUserByUsername", "testuser").Return(&domain.User{ID: 1, PasswordHash: string(hashedPassword)}, nil)
+	mockRepo.On("GetUserByUsername", "nobody").Return(nil, domain.ErrUserNotFound)
+	mockRepo.On("CreateSession", mock.AnythingOfType("*domain.Session")).Run(func(args mock.Arguments) {
+		args.Get(0).(*domain.Session).ID = 7
+	}).Return(nil)
+
+	_, err := svc.Login("testuser", "password123", source)
+	require.NoError(t, err)
+	_, err = svc.Login("testuser", "wrongpassword", source)
+	assert.ErrorIs(t, err, domain.ErrInvalidPassword)
+	_, err = svc.Login("nobody", "password123", source)
+	assert.ErrorIs(t, err, domain.ErrUserNotFound)
+
+	require.Len(t, auditLog.entries, 3)
+	assert.Equal(t, &audit.Entry{
+		ActorID:    1,
+		Action:     audit.ActionLogin,
+		TargetType: audit.TargetSession,
+		TargetID:   7,
+		Source:     source,
+	}, auditLog.entries[0])
+	assert.Equal(t, audit.ActionLoginFailed, auditLog.entries[1].Action)
+	assert.Equal(t, 1, auditLog.entries[1].TargetID)
+	assert.Zero(t, auditLog.entries[1].ActorID)
+	assert.Equal(t, audit.ActionLoginFailed, auditLog.entries[2].Action)
+	assert.Equal(t, "nobody", auditLog.entries[2].Details["username"])
+}
+
+func TestService_Logout(t *testing.T) {
+	mockRepo := new(MockRepository)
+	auditLog := new(MockAuditLog)
+	svc := NewService(mockRepo, auditLog, nil, TwoFactorConfig{}, nil, zap.NewNop())
+
+	mockRepo.On("GetSessionByToken", "token").Return(&domain.Session{ID: 3, UserID: 1, Token: "token"}, nil)
+	mockRepo.On("DeleteSession", "token").Return(nil)
+	require.NoError(t, svc.Logout("token", audit.Source{IP: "203.0.113.7"}))
+
+	require.Len(t, auditLog.entries, 1)
+	assert.Equal(t, audit.ActionSessionRevoked, auditLog.entries[0].Action)
+	assert.Equal(t, 1, auditLog.entries[0].ActorID)
+	assert.Equal(t, 3, auditLog.entries[0].TargetID)
+
+	// Test unknown sessions
+	mockRepo.On("GetSessionByToken", "unknown").Return(nil, domain.ErrSessionNotFound)
+	assert.ErrorIs(t, svc.Logout("unknown", audit.Source{}), domain.ErrSessionNotFound)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_GetAuditLog(t *testing.T) {
+	mockRepo := new(MockRepository)
+	auditLog := &MockAuditLog{entries: []*audit.Entry{{ID: 1, Action: audit.ActionLogin}}}
+	svc := NewService(mockRepo, auditLog, nil, TwoFactorConfig{}, nil, zap.NewNop())
+
+	expires := time.Now().Add(time.Hour)
+	mockRepo.On("GetSessionByToken", "admin-token").Return(&domain.Session{UserID: 1, ExpiresAt: expires}, nil)
+	mockRepo.On("GetSessionByToken", "user-token").Return(&domain.Session{UserID: 2, ExpiresAt: expires}, nil)
+	mockRepo.On("GetUserByID", 1).Return(&domain.User{ID: 1, Role: domain.RoleAdmin}, nil)
+	mockRepo.On("GetUserByID", 2).Return(&domain.User{ID: 2, Role: domain.RoleModerator}, nil)
+
+	filter := audit.Filter{ActorID: 2, Action: audit.ActionLogin}
+	entries, err := svc.GetAuditLog("admin-token", filter)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, []audit.Filter{filter}, auditLog.filters)
+
+	// Test only admins can read the log
+	_, err = svc.GetAuditLog("user-token", filter)
+	assert.ErrorIs(t, err, domain.ErrForbidden)
+	assert.Len(t, auditLog.filters, 1)
+}
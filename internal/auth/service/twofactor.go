@@ -0,0 +1,417 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/chizheg/forum/internal/auth/domain"
+	"github.com/chizheg/forum/internal/auth/totp"
+	"github.com/chizheg/forum/pkg/audit"
+)
+
+const (
+	defaultTOTPIssuer    = "Forum"
+	loginChallengeTTL    = 5 * time.Minute
+	maxChallengeAttempts = 5
+	// maxCodeFailures limits the invalid codes entered at login across the
+	// challenges of a user, until codeFailureWindow passed since the last
+	maxCodeFailures   = 10
+	codeFailureWindow = 15 * time.Minute
+	recoveryCodeCount = 10
+	// recoveryCodeSize is the number of random bytes of a recovery code,
+	// which encode to sixteen characters. The codes are stored with a
+	// plain hash like session tokens, 80 bits keep them out of reach of
+	// brute force should the hashes leak.
+	recoveryCodeSize = 10
+	// recoveryCodeGroup is the length of the groups a recovery code is
+	// displayed in
+	recoveryCodeGroup = 4
+)
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TwoFactorConfig holds two-factor authentication configuration
+type TwoFactorConfig struct {
+	// Issuer names the service in authenticator apps
+	Issuer string
+	// RequiredRoles lists the roles that can't log in without two-factor
+	// authentication, their users enroll during their next login
+	RequiredRoles []string
+}
+
+func (s *service) VerifyLogin(challengeToken, code string, source audit.Source) (*domain.LoginResult, error) {
+	challenge, err := s.repo.GetLoginChallenge(hashToken(challengeToken))
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.repo.GetUserByID(challenge.UserID)
+	if err != nil {
+		return nil, err
+	}
+	// The account may have been blocked since the password was checked
+	if user.DisabledAt != nil {
+		return nil, domain.ErrUserDisabled
+	}
+	if user.PasswordResetRequired {
+		return nil, domain.ErrPasswordResetRequired
+	}
+
+	// Attempts are counted before the code is checked, so concurrent
+	// verifications can't guess past the limits
+	attempts, err := s.repo.UseChallengeAttempt(challenge.ID, maxChallengeAttempts)
+	if err != nil {
+		return nil, err
+	}
+	allowed, err := s.repo.UseCodeAttempt(user.ID, maxCodeFailures, time.Now().Add(-codeFailureWindow))
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		s.audit(&audit.Entry{
+			Action:     audit.ActionLoginFailed,
+			TargetType: audit.TargetUser,
+			TargetID:   user.ID,
+			Source:     source,
+			Details:    map[string]any{"username": user.Username, "reason": "too many invalid codes"},
+		})
+		return nil, domain.ErrTooManyCodeAttempts
+	}
+
+	// Without an active secret the challenge completes the enrollment
+	// started by Login
+	enrolling := user.TOTPEnabledAt == nil
+	var step int64
+	var valid bool
+	if enrolling {
+		step, valid = validateTOTP(user.TOTPSecret, code)
+	} else {
+		valid, err = s.checkSecondFactor(user, code, source)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !valid {
+		return nil, s.rejectCode(challenge, attempts, user, source)
+	}
+
+	// Only one verification can consume the challenge
+	if err := s.repo.DeleteLoginChallenge(challenge.ID); err != nil {
+		return nil, err
+	}
+	if err := s.repo.ResetCodeFailures(user.ID); err != nil {
+		return nil, err
+	}
+
+	result := &domain.LoginResult{}
+	if enrolling {
+		if result.RecoveryCodes, err = s.enableTOTP(user, step, source); err != nil {
+			return nil, err
+		}
+	}
+
+	if result.Token, err = s.createSession(user.ID, source); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (s *service) EnrollTOTP(token string) (*domain.TOTPEnrollment, error) {
+	user, err := s.tokenUser(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.TOTPEnabledAt != nil {
+		return nil, domain.ErrTwoFactorEnabled
+	}
+
+	return s.startEnrollment(user)
+}
+
+func (s *service) ConfirmTOTP(token, code string, source audit.Source) ([]string, error) {
+	user, err := s.tokenUser(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.TOTPEnabledAt != nil {
+		return nil, domain.ErrTwoFactorEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, domain.ErrTwoFactorNotEnrolled
+	}
+
+	step, valid := validateTOTP(user.TOTPSecret, code)
+	if !valid {
+		return nil, domain.ErrInvalidCode
+	}
+
+	return s.enableTOTP(user, step, source)
+}
+
+func (s *service) DisableTOTP(token, password, code string, source audit.Source) error {
+	user, err := s.reauthenticate(token, password)
+	if err != nil {
+		return err
+	}
+
+	if user.TOTPEnabledAt == nil {
+		return domain.ErrTwoFactorNotEnabled
+	}
+	if s.twoFactorRequired(user.Role) {
+		return domain.ErrTwoFactorRequired
+	}
+
+	valid, err := s.checkSecondFactor(user, code, source)
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return domain.ErrInvalidCode
+	}
+
+	if err := s.repo.DisableTOTP(user.ID); err != nil {
+		return err
+	}
+
+	s.audit(&audit.Entry{
+		ActorID:    user.ID,
+		Action:     audit.ActionTwoFactorDisabled,
+		TargetType: audit.TargetUser,
+		TargetID:   user.ID,
+		Source:     source,
+	})
+
+	return nil
+}
+
+func (s *service) RegenerateRecoveryCodes(token, code string, source audit.Source) ([]string, error) {
+	user, err := s.tokenUser(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.TOTPEnabledAt == nil {
+		return nil, domain.ErrTwoFactorNotEnabled
+	}
+
+	valid, err := s.checkSecondFactor(user, code, source)
+	if err != nil {
+		return nil, err
+	}
+	if !valid {
+		return nil, domain.ErrInvalidCode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.ReplaceRecoveryCodes(user.ID, hashes); err != nil {
+		return nil, err
+	}
+
+	s.audit(&audit.Entry{
+		ActorID:    user.ID,
+		Action:     audit.ActionRecoveryCodesRegenerated,
+		TargetType: audit.TargetUser,
+		TargetID:   user.ID,
+		Source:     source,
+	})
+
+	return codes, nil
+}
+
+// createLoginChallenge creates the second step of the login of the user,
+// starting an enrollment if their role requires one
+func (s *service) createLoginChallenge(user *domain.User) (*domain.LoginChallenge, error) {
+	var enrollment *domain.TOTPEnrollment
+	if user.TOTPEnabledAt == nil {
+		var err error
+		if enrollment, err = s.startEnrollment(user); err != nil {
+			return nil, err
+		}
+	}
+
+	token, err := s.generateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	challenge := &domain.LoginChallenge{
+		UserID:     user.ID,
+		Token:      token,
+		TokenHash:  hashToken(token),
+		ExpiresAt:  time.Now().Add(loginChallengeTTL),
+		Enrollment: enrollment,
+	}
+	if err := s.repo.CreateLoginChallenge(challenge); err != nil {
+		return nil, err
+	}
+
+	return challenge, nil
+}
+
+// startEnrollment stores a new pending secret for the user, replacing any
+// earlier one that wasn't confirmed
+func (s *service) startEnrollment(user *domain.User) (*domain.TOTPEnrollment, error) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := s.repo.SetTOTPSecret(user.ID, secret)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, domain.ErrTwoFactorEnabled
+	}
+
+	return &domain.TOTPEnrollment{
+		Secret: secret,
+		URI:    totp.URI(s.twoFactor.Issuer, user.Username, secret),
+	}, nil
+}
+
+// enableTOTP activates the pending secret of the user and returns their
+// first recovery codes
+func (s *service) enableTOTP(user *domain.User, step int64, source audit.Source) ([]string, error) {
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.EnableTOTP(user.ID, step, hashes); err != nil {
+		return nil, err
+	}
+
+	s.audit(&audit.Entry{
+		ActorID:    user.ID,
+		Action:     audit.ActionTwoFactorEnabled,
+		TargetType: audit.TargetUser,
+		TargetID:   user.ID,
+		Source:     source,
+	})
+
+	return codes, nil
+}
+
+// checkSecondFactor reports whether the code is a current TOTP code or an
+// unused recovery code of the user, either is consumed
+func (s *service) checkSecondFactor(user *domain.User, code string, source audit.Source) (bool, error) {
+	if step, ok := validateTOTP(user.TOTPSecret, code); ok {
+		return s.repo.UseTOTPStep(user.ID, step)
+	}
+
+	code = normalizeRecoveryCode(code)
+	if code == "" {
+		return false, nil
+	}
+
+	used, err := s.repo.UseRecoveryCode(user.ID, hashToken(code))
+	if err != nil || !used {
+		return false, err
+	}
+
+	s.audit(&audit.Entry{
+		ActorID:    user.ID,
+		Action:     audit.ActionRecoveryCodeUsed,
+		TargetType: audit.TargetUser,
+		TargetID:   user.ID,
+		Source:     source,
+	})
+
+	return true, nil
+}
+
+// rejectCode audits an invalid code entered for the challenge, which is
+// dropped once it used up its attempts
+func (s *service) rejectCode(challenge *domain.LoginChallenge, attempts int, user *domain.User, source audit.Source) error {
+	if attempts >= maxChallengeAttempts {
+		err := s.repo.DeleteLoginChallenge(challenge.ID)
+		if err != nil && !errors.Is(err, domain.ErrInvalidChallenge) {
+			return err
+		}
+	}
+
+	s.audit(&audit.Entry{
+		Action:     audit.ActionLoginFailed,
+		TargetType: audit.TargetUser,
+		TargetID:   user.ID,
+		Source:     source,
+		Details:    map[string]any{"username": user.Username, "reason": "invalid code"},
+	})
+
+	return domain.ErrInvalidCode
+}
+
+// twoFactorRequired reports whether users of the role must use two-factor
+// authentication
+func (s *service) twoFactorRequired(role string) bool {
+	for _, r := range s.twoFactor.RequiredRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenUser returns the user the token belongs to
+func (s *service) tokenUser(token string) (*domain.User, error) {
+	userID, err := s.ValidateToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetUserByID(userID)
+}
+
+func validateTOTP(secret, code string) (int64, bool) {
+	if secret == "" {
+		return 0, false
+	}
+	return totp.Validate(secret, code, time.Now())
+}
+
+// generateRecoveryCodes returns new recovery codes, formatted for display,
+// and the hashes to store
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, recoveryCodeSize)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+
+		code := strings.ToLower(recoveryCodeEncoding.EncodeToString(b))
+		codes = append(codes, formatRecoveryCode(code))
+		hashes = append(hashes, hashToken(code))
+	}
+
+	return codes, hashes, nil
+}
+
+// formatRecoveryCode splits the code in groups separated by dashes
+func formatRecoveryCode(code string) string {
+	groups := make([]string, 0, len(code)/recoveryCodeGroup)
+	for len(code) > recoveryCodeGroup {
+		groups = append(groups, code[:recoveryCodeGroup])
+		code = code[recoveryCodeGroup:]
+	}
+	return strings.Join(append(groups, code), "-")
+}
+
+// normalizeRecoveryCode drops the separators and case of a recovery code
+// as typed by the user
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
@@ -0,0 +1,356 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chizheg/forum/internal/auth/domain"
+	"github.com/chizheg/forum/internal/auth/totp"
+	"github.com/chizheg/forum/pkg/audit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const testTOTPSecret = "JBSWY3DPEHPK3PXP"
+
+// newTwoFactorTestUser returns the user "alice" with the password
+// "password123" and two-factor authentication enabled
+func newTwoFactorTestUser(t *testing.T) *domain.User {
+	hash, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	enabledAt := time.Now().Add(-time.Hour)
+	return &domain.User{
+		ID:            1,
+		Username:      "alice",
+		Role:          domain.RoleUser,
+		PasswordHash:  string(hash),
+		TOTPSecret:    testTOTPSecret,
+		TOTPEnabledAt: &enabledAt,
+	}
+}
+
+func currentCode(t *testing.T, secret string) string {
+	code, err := totp.Code(secret, totp.Step(time.Now()))
+	require.NoError(t, err)
+	return code
+}
+
+func TestService_LoginWithTwoFactor(t *testing.T) {
+	mockRepo := new(MockRepository)
+	auditLog := new(MockAuditLog)
+	svc := NewService(mockRepo, auditLog, nil, TwoFactorConfig{}, nil, zap.NewNop())
+
+	user := newTwoFactorTestUser(t)
+	mockRepo.On("GetUserByUsername", "alice").Return(user, nil)
+	mockRepo.On("GetUserByID", 1).Return(user, nil)
+
+	// Test the password only gets a challenge
+	var challenge *domain.LoginChallenge
+	mockRepo.On("CreateLoginChallenge", mock.AnythingOfType("*domain.LoginChallenge")).Run(func(args mock.Arguments) {
+		challenge = args.Get(0).(*domain.LoginChallenge)
+		challenge.ID = 7
+	}).Return(nil)
+
+	result, err := svc.Login("alice", "password123", audit.Source{})
+	require.NoError(t, err)
+	assert.Empty(t, result.Token)
+	require.NotNil(t, result.Challenge)
+	assert.Nil(t, result.Challenge.Enrollment)
+	assert.Equal(t, hashToken(result.Challenge.Token), challenge.TokenHash)
+	assert.WithinDuration(t, time.Now().Add(loginChallengeTTL), challenge.ExpiresAt, time.Minute)
+	mockRepo.AssertNotCalled(t, "CreateSession", mock.Anything)
+
+	mockRepo.On("GetLoginChallenge", challenge.TokenHash).Return(challenge, nil)
+
+	// Test unknown challenges
+	mockRepo.On("GetLoginChallenge", hashToken("unknown")).Return(nil, domain.ErrInvalidChallenge)
+	_, err = svc.VerifyLogin("unknown", "123456", audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrInvalidChallenge)
+
+	// Test invalid codes are counted
+	mockRepo.On("UseCodeAttempt", 1, maxCodeFailures, mock.AnythingOfType("time.Time")).Return(true, nil)
+	mockRepo.On("UseChallengeAttempt", 7, maxChallengeAttempts).Return(1, nil).Once()
+	mockRepo.On("UseRecoveryCode", 1, hashToken("abcdefghijklmnop")).Return(false, nil).Once()
+	_, err = svc.VerifyLogin(result.Challenge.Token, "ABCD-EFGH-IJKL-MNOP", audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrInvalidCode)
+
+	// Test replayed codes are rejected
+	mockRepo.On("UseChallengeAttempt", 7, maxChallengeAttempts).Return(2, nil).Once()
+	mockRepo.On("UseTOTPStep", 1, mock.AnythingOfType("int64")).Return(false, nil).Once()
+	_, err = svc.VerifyLogin(result.Challenge.Token, currentCode(t, testTOTPSecret), audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrInvalidCode)
+
+	// Test a valid code completes the login and clears the failures
+	mockRepo.On("UseChallengeAttempt", 7, maxChallengeAttempts).Return(3, nil).Once()
+	mockRepo.On("UseTOTPStep", 1, mock.AnythingOfType("int64")).Return(true, nil).Once()
+	mockRepo.On("DeleteLoginChallenge", 7).Return(nil).Once()
+	mockRepo.On("ResetCodeFailures", 1).Return(nil).Once()
+	mockRepo.On("CreateSession", mock.AnythingOfType("*domain.Session")).Return(nil)
+	result, err = svc.VerifyLogin(result.Challenge.Token, currentCode(t, testTOTPSecret), audit.Source{})
+	require.NoError(t, err)
+	assert.NotEmpty(t, result.Token)
+	assert.Empty(t, result.RecoveryCodes)
+
+	var actions []audit.Action
+	for _, entry := range auditLog.entries {
+		actions = append(actions, entry.Action)
+	}
+	assert.Equal(t, []audit.Action{audit.ActionLoginFailed, audit.ActionLoginFailed, audit.ActionLogin}, actions)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_VerifyLoginAttemptLimit(t *testing.T) {
+	mockRepo := new(MockRepository)
+	svc := NewService(mockRepo, new(MockAuditLog), nil, TwoFactorConfig{}, nil, zap.NewNop())
+
+	user := newTwoFactorTestUser(t)
+	challenge := &domain.LoginChallenge{ID: 7, UserID: 1, ExpiresAt: time.Now().Add(time.Minute)}
+	mockRepo.On("GetLoginChallenge", hashToken("challenge")).Return(challenge, nil)
+	mockRepo.On("GetUserByID", 1).Return(user, nil)
+	mockRepo.On("UseCodeAttempt", 1, maxCodeFailures, mock.AnythingOfType("time.Time")).Return(true, nil)
+	mockRepo.On("UseRecoveryCode", 1, mock.Anything).Return(false, nil).Once()
+
+	// Test the challenge is dropped after its last attempt
+	mockRepo.On("UseChallengeAttempt", 7, maxChallengeAttempts).Return(maxChallengeAttempts, nil).Once()
+	mockRepo.On("DeleteLoginChallenge", 7).Return(nil)
+	_, err := svc.VerifyLogin("challenge", "wrong-code", audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrInvalidCode)
+
+	// Test no code is checked once the attempts are used up
+	mockRepo.On("UseChallengeAttempt", 7, maxChallengeAttempts).Return(0, domain.ErrInvalidChallenge).Once()
+	_, err = svc.VerifyLogin("challenge", currentCode(t, testTOTPSecret), audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrInvalidChallenge)
+
+	mockRepo.AssertExpectations(t)
+	mockRepo.AssertNumberOfCalls(t, "UseRecoveryCode", 1)
+	mockRepo.AssertNotCalled(t, "UseTOTPStep", mock.Anything, mock.Anything)
+}
+
+func TestService_VerifyLoginUserFailureLimit(t *testing.T) {
+	mockRepo := new(MockRepository)
+	auditLog := new(MockAuditLog)
+	svc := NewService(mockRepo, auditLog, nil, TwoFactorConfig{}, nil, zap.NewNop())
+
+	user := newTwoFactorTestUser(t)
+	challenge := &domain.LoginChallenge{ID: 8, UserID: 1, ExpiresAt: time.Now().Add(time.Minute)}
+	mockRepo.On("GetLoginChallenge", hashToken("new challenge")).Return(challenge, nil)
+	mockRepo.On("GetUserByID", 1).Return(user, nil)
+	mockRepo.On("UseChallengeAttempt", 8, maxChallengeAttempts).Return(1, nil)
+
+	// Test a new challenge doesn't reset the failures of the user, even a
+	// valid code is refused until they expire
+	mockRepo.On("UseCodeAttempt", 1, maxCodeFailures, mock.MatchedBy(func(since time.Time) bool {
+		age := time.Since(since)
+		return age >= codeFailureWindow && age < codeFailureWindow+time.Minute
+	})).Return(false, nil)
+	_, err := svc.VerifyLogin("new challenge", currentCode(t, testTOTPSecret), audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrTooManyCodeAttempts)
+
+	require.Len(t, auditLog.entries, 1)
+	assert.Equal(t, audit.ActionLoginFailed, auditLog.entries[0].Action)
+	mockRepo.AssertExpectations(t)
+	mockRepo.AssertNotCalled(t, "UseTOTPStep", mock.Anything, mock.Anything)
+}
+
+func TestService_VerifyLoginBlockedAccount(t *testing.T) {
+	mockRepo := new(MockRepository)
+	svc := NewService(mockRepo, new(MockAuditLog), nil, TwoFactorConfig{}, nil, zap.NewNop())
+
+	user := newTwoFactorTestUser(t)
+	challenge := &domain.LoginChallenge{ID: 7, UserID: 1, ExpiresAt: time.Now().Add(time.Minute)}
+	mockRepo.On("GetLoginChallenge", hashToken("challenge")).Return(challenge, nil)
+	mockRepo.On("GetUserByID", 1).Return(user, nil)
+
+	// Test a reset forced after the password step blocks the login
+	user.PasswordResetRequired = true
+	_, err := svc.VerifyLogin("challenge", currentCode(t, testTOTPSecret), audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrPasswordResetRequired)
+
+	// Test disabled accounts
+	user.PasswordResetRequired = false
+	disabledAt := time.Now()
+	user.DisabledAt = &disabledAt
+	_, err = svc.VerifyLogin("challenge", currentCode(t, testTOTPSecret), audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrUserDisabled)
+
+	mockRepo.AssertExpectations(t)
+	mockRepo.AssertNotCalled(t, "UseChallengeAttempt", mock.Anything, mock.Anything)
+	mockRepo.AssertNotCalled(t, "UseTOTPStep", mock.Anything, mock.Anything)
+}
+
+func TestService_VerifyLoginRecoveryCode(t *testing.T) {
+	mockRepo := new(MockRepository)
+	auditLog := new(MockAuditLog)
+	svc := NewService(mockRepo, auditLog, nil, TwoFactorConfig{}, nil, zap.NewNop())
+
+	user := newTwoFactorTestUser(t)
+	challenge := &domain.LoginChallenge{ID: 7, UserID: 1, ExpiresAt: time.Now().Add(time.Minute)}
+	mockRepo.On("GetLoginChallenge", hashToken("challenge")).Return(challenge, nil)
+	mockRepo.On("GetUserByID", 1).Return(user, nil)
+
+	// Test recovery codes are accepted regardless of case and separators
+	mockRepo.On("UseChallengeAttempt", 7, maxChallengeAttempts).Return(1, nil)
+	mockRepo.On("UseCodeAttempt", 1, maxCodeFailures, mock.AnythingOfType("time.Time")).Return(true, nil)
+	mockRepo.On("UseRecoveryCode", 1, hashToken("abcdefghijklmnop")).Return(true, nil)
+	mockRepo.On("DeleteLoginChallenge", 7).Return(nil)
+	mockRepo.On("ResetCodeFailures", 1).Return(nil)
+	mockRepo.On("CreateSession", mock.AnythingOfType("*domain.Session")).Return(nil)
+	result, err := svc.VerifyLogin("challenge", " abcd-EFGH-ijkl-MNOP ", audit.Source{})
+	require.NoError(t, err)
+	assert.NotEmpty(t, result.Token)
+
+	require.Len(t, auditLog.entries, 2)
+	assert.Equal(t, audit.ActionRecoveryCodeUsed, auditLog.entries[0].Action)
+	assert.Equal(t, audit.ActionLogin, auditLog.entries[1].Action)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_LoginEnrollsRequiredRoles(t *testing.T) {
+	mockRepo := new(MockRepository)
+	auditLog := new(MockAuditLog)
+	svc := NewService(mockRepo, auditLog, nil, TwoFactorConfig{
+		Issuer:        "Forum",
+		RequiredRoles: []string{domain.RoleAdmin},
+	}, nil, zap.NewNop())
+
+	user := newTwoFactorTestUser(t)
+	user.Role = domain.RoleAdmin
+	user.TOTPSecret = ""
+	user.TOTPEnabledAt = nil
+	mockRepo.On("GetUserByUsername", "alice").Return(user, nil)
+	mockRepo.On("GetUserByID", 1).Return(user, nil)
+
+	// Test the challenge carries a new secret
+	mockRepo.On("SetTOTPSecret", 1, mock.AnythingOfType("string")).Run(func(args mock.Arguments) {
+		user.TOTPSecret = args.String(1)
+	}).Return(true, nil)
+	var challenge *domain.LoginChallenge
+	mockRepo.On("CreateLoginChallenge", mock.AnythingOfType("*domain.LoginChallenge")).Run(func(args mock.Arguments) {
+		challenge = args.Get(0).(*domain.LoginChallenge)
+		challenge.ID = 7
+	}).Return(nil)
+
+	result, err := svc.Login("alice", "password123", audit.Source{})
+	require.NoError(t, err)
+	require.NotNil(t, result.Challenge)
+	require.NotNil(t, result.Challenge.Enrollment)
+	assert.Equal(t, user.TOTPSecret, result.Challenge.Enrollment.Secret)
+	assert.Contains(t, result.Challenge.Enrollment.URI, "otpauth://totp/Forum:alice?")
+
+	// Test a code of the new secret enables it and returns recovery codes
+	mockRepo.On("GetLoginChallenge", challenge.TokenHash).Return(challenge, nil)
+	mockRepo.On("UseChallengeAttempt", 7, maxChallengeAttempts).Return(1, nil)
+	mockRepo.On("UseCodeAttempt", 1, maxCodeFailures, mock.AnythingOfType("time.Time")).Return(true, nil)
+	mockRepo.On("DeleteLoginChallenge", 7).Return(nil)
+	mockRepo.On("ResetCodeFailures", 1).Return(nil)
+	var hashes []string
+	mockRepo.On("EnableTOTP", 1, mock.AnythingOfType("int64"), mock.Anything).Run(func(args mock.Arguments) {
+		hashes = args.Get(2).([]string)
+	}).Return(nil)
+	mockRepo.On("CreateSession", mock.AnythingOfType("*domain.Session")).Return(nil)
+
+	result, err = svc.VerifyLogin(result.Challenge.Token, currentCode(t, user.TOTPSecret), audit.Source{})
+	require.NoError(t, err)
+	assert.NotEmpty(t, result.Token)
+	require.Len(t, result.RecoveryCodes, recoveryCodeCount)
+	require.Len(t, hashes, recoveryCodeCount)
+	for i, code := range result.RecoveryCodes {
+		assert.Regexp(t, `^[a-z2-7]{4}(-[a-z2-7]{4}){3}$`, code)
+		assert.Equal(t, hashToken(normalizeRecoveryCode(code)), hashes[i])
+	}
+
+	require.Len(t, auditLog.entries, 2)
+	assert.Equal(t, audit.ActionTwoFactorEnabled, auditLog.entries[0].Action)
+	assert.Equal(t, audit.ActionLogin, auditLog.entries[1].Action)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_EnrollTOTP(t *testing.T) {
+	mockRepo := new(MockRepository)
+	auditLog := new(MockAuditLog)
+	svc := newAccountTestService(t, mockRepo, auditLog)
+
+	// Test confirming without an enrollment
+	_, err := svc.ConfirmTOTP("token", "123456", audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrTwoFactorNotEnrolled)
+
+	var secret string
+	mockRepo.On("SetTOTPSecret", 1, mock.AnythingOfType("string")).Run(func(args mock.Arguments) {
+		secret = args.String(1)
+	}).Return(true, nil)
+	enrollment, err := svc.EnrollTOTP("token")
+	require.NoError(t, err)
+	assert.Equal(t, secret, enrollment.Secret)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_DisableTOTP(t *testing.T) {
+	mockRepo := new(MockRepository)
+	auditLog := new(MockAuditLog)
+
+	user := newTwoFactorTestUser(t)
+	mockRepo.On("GetSessionByToken", "token").Return(&domain.Session{UserID: 1, ExpiresAt: time.Now().Add(time.Hour)}, nil)
+	mockRepo.On("GetUserByID", 1).Return(user, nil)
+
+	// Test required roles can't disable it
+	user.Role = domain.RoleModerator
+	svc := NewService(mockRepo, auditLog, nil, TwoFactorConfig{RequiredRoles: []string{domain.RoleModerator}}, nil, zap.NewNop())
+	err := svc.DisableTOTP("token", "password123", currentCode(t, testTOTPSecret), audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrTwoFactorRequired)
+
+	// Test wrong password
+	user.Role = domain.RoleUser
+	err = svc.DisableTOTP("token", "wrong", currentCode(t, testTOTPSecret), audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrInvalidPassword)
+
+	// Test invalid code
+	mockRepo.On("UseRecoveryCode", 1, mock.Anything).Return(false, nil).Once()
+	err = svc.DisableTOTP("token", "password123", "not a code", audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrInvalidCode)
+
+	// Test success
+	mockRepo.On("UseTOTPStep", 1, mock.AnythingOfType("int64")).Return(true, nil)
+	mockRepo.On("DisableTOTP", 1).Return(nil)
+	require.NoError(t, svc.DisableTOTP("token", "password123", currentCode(t, testTOTPSecret), audit.Source{}))
+
+	require.Len(t, auditLog.entries, 1)
+	assert.Equal(t, audit.ActionTwoFactorDisabled, auditLog.entries[0].Action)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_RegenerateRecoveryCodes(t *testing.T) {
+	mockRepo := new(MockRepository)
+	auditLog := new(MockAuditLog)
+	svc := NewService(mockRepo, auditLog, nil, TwoFactorConfig{}, nil, zap.NewNop())
+
+	user := newTwoFactorTestUser(t)
+	mockRepo.On("GetSessionByToken", "token").Return(&domain.Session{UserID: 1, ExpiresAt: time.Now().Add(time.Hour)}, nil)
+	mockRepo.On("GetUserByID", 1).Return(user, nil)
+
+	mockRepo.On("UseTOTPStep", 1, mock.AnythingOfType("int64")).Return(true, nil)
+	mockRepo.On("ReplaceRecoveryCodes", 1, mock.MatchedBy(func(hashes []string) bool {
+		return len(hashes) == recoveryCodeCount
+	})).Return(nil)
+	codes, err := svc.RegenerateRecoveryCodes("token", currentCode(t, testTOTPSecret), audit.Source{})
+	require.NoError(t, err)
+	assert.Len(t, codes, recoveryCodeCount)
+
+	require.Len(t, auditLog.entries, 1)
+	assert.Equal(t, audit.ActionRecoveryCodesRegenerated, auditLog.entries[0].Action)
+
+	// Test it requires two-factor authentication
+	user.TOTPEnabledAt = nil
+	_, err = svc.RegenerateRecoveryCodes("token", currentCode(t, testTOTPSecret), audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrTwoFactorNotEnabled)
+
+	mockRepo.AssertExpectations(t)
+}
@@ -0,0 +1,45 @@
+package local
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_PutOpenDelete(t *testing.T) {
+	s, err := NewStore(t.TempDir())
+	require.NoError(t, err)
+
+	// Test round trip
+	err = s.Put("1/abc", strings.NewReader("hello"), 5, "text/plain")
+	require.NoError(t, err)
+
+	blob, err := s.Open("1/abc")
+	require.NoError(t, err)
+	data, err := io.ReadAll(blob)
+	blob.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	// Test delete
+	assert.NoError(t, s.Delete("1/abc"))
+	_, err = s.Open("1/abc")
+	assert.ErrorIs(t, err, domain.ErrBlobNotFound)
+
+	// Test deleting a missing blob
+	assert.NoError(t, s.Delete("1/abc"))
+}
+
+func TestStore_InvalidKeys(t *testing.T) {
+	s, err := NewStore(t.TempDir())
+	require.NoError(t, err)
+
+	for _, key := range []string{"", "..", "../secret", "1/../../secret", "/etc/passwd", "a\\b"} {
+		err := s.Put(key, strings.NewReader("x"), 1, "text/plain")
+		assert.ErrorIs(t, err, ErrInvalidKey, key)
+	}
+}
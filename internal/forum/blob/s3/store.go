@@ -0,0 +1,77 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+)
+
+const requestTimeout = 30 * time.Second
+
+// ErrNoSuchKey must be returned by clients for missing objects
+var ErrNoSuchKey = errors.New("no such key")
+
+// Client is the subset of the S3 API used by the store. It can be
+// implemented on top of any S3-compatible SDK (AWS, MinIO, ...).
+type Client interface {
+	PutObject(ctx context.Context, bucket, key string, r io.Reader, size int64, contentType string) error
+	GetObject(ctx context.Context, bucket, key string) (io.ReadCloser, error)
+	DeleteObject(ctx context.Context, bucket, key string) error
+}
+
+type store struct {
+	client Client
+	bucket string
+	prefix string
+}
+
+// NewStore creates a blob store keeping objects in the bucket, keys are
+// prepended with prefix
+func NewStore(client Client, bucket, prefix string) domain.BlobStore {
+	return &store{
+		client: client,
+		bucket: bucket,
+		prefix: prefix,
+	}
+}
+
+func (s *store) Put(key string, r io.Reader, size int64, contentType string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	if err := s.client.PutObject(ctx, s.bucket, s.prefix+key, r, size, contentType); err != nil {
+		return fmt.Errorf("error storing blob: %w", err)
+	}
+
+	return nil
+}
+
+// Open does not bound the request time since the body is streamed to the
+// caller
+func (s *store) Open(key string) (io.ReadCloser, error) {
+	body, err := s.client.GetObject(context.Background(), s.bucket, s.prefix+key)
+	if errors.Is(err, ErrNoSuchKey) {
+		return nil, domain.ErrBlobNotFound
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error opening blob: %w", err)
+	}
+
+	return body, nil
+}
+
+func (s *store) Delete(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	if err := s.client.DeleteObject(ctx, s.bucket, s.prefix+key); err != nil && !errors.Is(err, ErrNoSuchKey) {
+		return fmt.Errorf("error deleting blob: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package memory
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+	"go.uber.org/zap"
+)
+
+const (
+	subscriberBufferSize = 256
+
+	// closeEventReserve is the room kept in every subscriber buffer for
+	// events that close connections, so a lagging subscriber still gets
+	// the kicks and bans published before it is dropped
+	closeEventReserve = 16
+)
+
+type broker struct {
+	mu          sync.RWMutex
+	subscribers map[chan *domain.Event]struct{}
+	closed      bool
+	dropped     atomic.Int64
+	logger      *zap.Logger
+}
+
+// NewBroker creates an in-process broker for single instance deployments
+func NewBroker(logger *zap.Logger) domain.Broker {
+	return &broker{
+		subscribers: make(map[chan *domain.Event]struct{}),
+		logger:      logger,
+	}
+}
+
+func (b *broker) Publish(event *domain.Event) error {
+	b.mu.RLock()
+
+	if b.closed {
+		b.mu.RUnlock()
+		return domain.ErrBrokerClosed
+	}
+
+	// Publishing never waits for a subscriber, subscribers that fall a
+	// full buffer behind are dropped instead of silently missing events
+	var lagging []chan *domain.Event
+	for ch := range b.subscribers {
+		if len(ch) >= subscriberBufferSize && event.CloseCode == 0 {
+			lagging = append(lagging, ch)
+			continue
+		}
+
+		select {
+		case ch <- event:
+		default:
+			lagging = append(lagging, ch)
+		}
+	}
+	b.mu.RUnlock()
+
+	for _, ch := range lagging {
+		b.drop(ch)
+	}
+
+	return nil
+}
+
+// drop closes the subscription of a lagging subscriber, which gets the
+// buffered events before seeing its channel closed
+func (b *broker) drop(ch chan *domain.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// The subscription may have been cancelled meanwhile
+	if _, ok := b.subscribers[ch]; !ok {
+		return
+	}
+	delete(b.subscribers, ch)
+	close(ch)
+
+	b.logger.Warn("dropping lagging broker subscriber", zap.Int64("dropped", b.dropped.Add(1)))
+}
+
+func (b *broker) Subscribe() (<-chan *domain.Event, func()) {
+	ch := make(chan *domain.Event, subscriberBufferSize+closeEventReserve)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	b.subscribers[ch] = struct{}{}
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if _, ok := b.subscribers[ch]; ok {
+				delete(b.subscribers, ch)
+				close(ch)
+			}
+		})
+	}
+
+	return ch, cancel
+}
+
+func (b *broker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+
+	for ch := range b.subscribers {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+
+	return nil
+}
@@ -0,0 +1,152 @@
+package memory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func receive(t *testing.T, ch <-chan *domain.Event) *domain.Event {
+	t.Helper()
+	select {
+	case event := <-ch:
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for event")
+		return nil
+	}
+}
+
+func TestBroker_PublishSubscribe(t *testing.T) {
+	b := NewBroker(zap.NewNop())
+	defer b.Close()
+
+	first, cancelFirst := b.Subscribe()
+	defer cancelFirst()
+	second, cancelSecond := b.Subscribe()
+	defer cancelSecond()
+
+	event := &domain.Event{
+		Message: domain.WebsocketMessage{
+			Type:    "message",
+			Payload: map[string]any{"content": "hello"},
+		},
+	}
+	require.NoError(t, b.Publish(event))
+
+	assert.Equal(t, event, receive(t, first))
+	assert.Equal(t, event, receive(t, second))
+}
+
+func TestBroker_Cancel(t *testing.T) {
+	b := NewBroker(zap.NewNop())
+	defer b.Close()
+
+	events, cancel := b.Subscribe()
+	cancel()
+	cancel()
+
+	_, ok := <-events
+	assert.False(t, ok)
+
+	assert.NoError(t, b.Publish(&domain.Event{}))
+}
+
+func TestBroker_Close(t *testing.T) {
+	b := NewBroker(zap.NewNop())
+	events, cancel := b.Subscribe()
+
+	require.NoError(t, b.Close())
+	cancel()
+
+	_, ok := <-events
+	assert.False(t, ok)
+
+	assert.ErrorIs(t, b.Publish(&domain.Event{}), domain.ErrBrokerClosed)
+
+	late, _ := b.Subscribe()
+	_, ok = <-late
+	assert.False(t, ok)
+}
+
+func TestBroker_SlowSubscriber(t *testing.T) {
+	b := NewBroker(zap.NewNop())
+	defer b.Close()
+
+	slow, cancelSlow := b.Subscribe()
+	defer cancelSlow()
+	fast, cancelFast := b.Subscribe()
+	defer cancelFast()
+
+	// Test publishing past a full buffer doesn't block
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < subscriberBufferSize+10; i++ {
+			assert.NoError(t, b.Publish(&domain.Event{}))
+			<-fast
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("publish blocked on a slow subscriber")
+	}
+
+	// Test the slow subscriber gets the buffered events before its
+	// subscription is closed
+	for i := 0; i < subscriberBufferSize; i++ {
+		_, ok := <-slow
+		require.True(t, ok)
+	}
+	_, ok := <-slow
+	assert.False(t, ok)
+
+	// Test the fast subscriber is still subscribed
+	require.NoError(t, b.Publish(&domain.Event{}))
+	receive(t, fast)
+}
+
+func TestBroker_SlowSubscriberCloseEvent(t *testing.T) {
+	b := NewBroker(zap.NewNop())
+	defer b.Close()
+
+	slow, cancel := b.Subscribe()
+	defer cancel()
+
+	for i := 0; i < subscriberBufferSize; i++ {
+		require.NoError(t, b.Publish(&domain.Event{}))
+	}
+
+	// Test events closing connections aren't dropped for a full buffer
+	kick := &domain.Event{UserIDs: []int{1}, CloseCode: domain.CloseCodeKicked}
+	require.NoError(t, b.Publish(kick))
+	require.NoError(t, b.Publish(&domain.Event{}))
+
+	for i := 0; i < subscriberBufferSize; i++ {
+		<-slow
+	}
+	assert.Equal(t, kick, receive(t, slow))
+	_, ok := <-slow
+	assert.False(t, ok)
+}
+
+func TestBroker_CancelDropped(t *testing.T) {
+	b := NewBroker(zap.NewNop())
+	defer b.Close()
+
+	events, cancel := b.Subscribe()
+	for i := 0; i <= subscriberBufferSize; i++ {
+		require.NoError(t, b.Publish(&domain.Event{}))
+	}
+
+	// Test cancelling a dropped subscription doesn't close it twice
+	cancel()
+	for range events {
+	}
+}
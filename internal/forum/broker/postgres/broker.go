@@ -0,0 +1,178 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/chizheg/forum/internal/forum/broker/memory"
+	"github.com/chizheg/forum/internal/forum/domain"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+const (
+	channelName          = "forum_chat_events"
+	minReconnectInterval = 10 * time.Second
+	maxReconnectInterval = time.Minute
+	pingInterval         = 90 * time.Second
+
+	// maxNotifyPayload is the largest payload PostgreSQL accepts in a
+	// notification, larger events are sent through the chat_events table
+	maxNotifyPayload = 7999
+
+	// eventRetention is how long published events can be loaded by the
+	// instances they were announced to
+	eventRetention = 5 * time.Minute
+)
+
+type broker struct {
+	store    eventStore
+	listener *pq.Listener
+	local    domain.Broker
+	logger   *zap.Logger
+	closed   atomic.Bool
+}
+
+// NewBroker creates a broker that fans events out to every forum instance
+// through PostgreSQL LISTEN/NOTIFY. Events are sent in the notification
+// itself, only those over the NOTIFY payload limit are stored in the
+// chat_events table and announced by their id. connStr is used for the
+// dedicated listener connection, db for publishing and loading events.
+func NewBroker(db *sql.DB, connStr string, logger *zap.Logger) (domain.Broker, error) {
+	b := &broker{
+		store:  &pgEventStore{db: db},
+		local:  memory.NewBroker(logger),
+		logger: logger,
+	}
+
+	b.listener = pq.NewListener(connStr, minReconnectInterval, maxReconnectInterval, b.handleListenerEvent)
+	if err := b.listener.Listen(channelName); err != nil {
+		b.listener.Close()
+		return nil, fmt.Errorf("error listening on channel: %w", err)
+	}
+
+	go b.run(b.listener.Notify)
+
+	return b, nil
+}
+
+func (b *broker) Publish(event *domain.Event) error {
+	if b.closed.Load() {
+		return domain.ErrBrokerClosed
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("error encoding event: %w", err)
+	}
+
+	if len(payload) <= maxNotifyPayload {
+		err = b.store.notify(payload)
+	} else {
+		err = b.store.publish(payload)
+	}
+	if err != nil {
+		return fmt.Errorf("error publishing event: %w", err)
+	}
+
+	return nil
+}
+
+func (b *broker) Subscribe() (<-chan *domain.Event, func()) {
+	return b.local.Subscribe()
+}
+
+func (b *broker) Close() error {
+	if !b.closed.CompareAndSwap(false, true) {
+		return nil
+	}
+
+	err := b.listener.Close()
+	b.local.Close()
+	if err != nil {
+		return fmt.Errorf("error closing listener: %w", err)
+	}
+
+	return nil
+}
+
+// run forwards the events sent or announced by notifications to local subscribers
+// until the listener is closed
+func (b *broker) run(notify <-chan *pq.Notification) {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case n, ok := <-notify:
+			if !ok {
+				return
+			}
+
+			// A nil notification is sent after the connection has been
+			// re-established, events published meanwhile are lost
+			if n == nil {
+				continue
+			}
+
+			event, err := b.decodeEvent(n.Extra)
+			if err != nil {
+				b.logger.Error("failed to decode event", zap.String("extra", n.Extra), zap.Error(err))
+				continue
+			}
+
+			if err := b.local.Publish(event); err != nil {
+				return
+			}
+		case <-ticker.C:
+			go b.listener.Ping()
+			go b.deleteExpired()
+		}
+	}
+}
+
+// decodeEvent decodes an event sent in the notification or loads the
+// stored event the notification carries the id of
+func (b *broker) decodeEvent(extra string) (*domain.Event, error) {
+	payload := []byte(extra)
+	if !strings.HasPrefix(extra, "{") {
+		eventID, err := strconv.ParseInt(extra, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing event id: %w", err)
+		}
+
+		payload, err = b.store.load(eventID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var event domain.Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("error decoding event: %w", err)
+	}
+
+	return &event, nil
+}
+
+func (b *broker) deleteExpired() {
+	if err := b.store.deleteBefore(time.Now().Add(-eventRetention)); err != nil {
+		b.logger.Error("failed to delete expired events", zap.Error(err))
+	}
+}
+
+func (b *broker) handleListenerEvent(ev pq.ListenerEventType, err error) {
+	switch ev {
+	case pq.ListenerEventDisconnected:
+		b.logger.Warn("chat event listener disconnected", zap.Error(err))
+	case pq.ListenerEventReconnected:
+		b.logger.Info("chat event listener reconnected")
+	case pq.ListenerEventConnectionAttemptFailed:
+		b.logger.Error("chat event listener connection attempt failed", zap.Error(err))
+	}
+}
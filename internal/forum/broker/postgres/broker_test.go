@@ -0,0 +1,202 @@
+package postgres
+
+import (
+	"database/sql"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chizheg/forum/internal/forum/broker/memory"
+	"github.com/chizheg/forum/internal/forum/domain"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// fakeStore keeps events in memory and sends them or their id to notifications
+// like the listener connection would
+type fakeStore struct {
+	mu            sync.Mutex
+	events        map[int64][]byte
+	lastID        int64
+	notifications chan *pq.Notification
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{
+		events:        map[int64][]byte{},
+		notifications: make(chan *pq.Notification, 10),
+	}
+}
+
+func (s *fakeStore) publish(payload []byte) error {
+	s.mu.Lock()
+	s.lastID++
+	id := s.lastID
+	s.events[id] = payload
+	s.mu.Unlock()
+
+	s.notifications <- &pq.Notification{Channel: channelName, Extra: strconv.FormatInt(id, 10)}
+	return nil
+}
+
+func (s *fakeStore) notify(payload []byte) error {
+	s.notifications <- &pq.Notification{Channel: channelName, Extra: string(payload)}
+	return nil
+}
+
+func (s *fakeStore) stored() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.events)
+}
+
+func (s *fakeStore) load(id int64) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	payload, ok := s.events[id]
+	if !ok {
+		return nil, errEventNotFound
+	}
+	return payload, nil
+}
+
+func (s *fakeStore) deleteBefore(t time.Time) error {
+	return nil
+}
+
+func newTestBroker(t *testing.T) (*broker, *fakeStore) {
+	store := newFakeStore()
+	b := &broker{
+		store:  store,
+		local:  memory.NewBroker(zap.NewNop()),
+		logger: zap.NewNop(),
+	}
+
+	go b.run(store.notifications)
+	t.Cleanup(func() {
+		close(store.notifications)
+		b.local.Close()
+	})
+
+	return b, store
+}
+
+func receive(t *testing.T, ch <-chan *domain.Event) *domain.Event {
+	t.Helper()
+	select {
+	case event := <-ch:
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for event")
+		return nil
+	}
+}
+
+func TestBroker_PublishSmallEvent(t *testing.T) {
+	b, store := newTestBroker(t)
+	events, cancel := b.Subscribe()
+	defer cancel()
+
+	// Test typing and presence events are sent inline and never stored
+	require.NoError(t, b.Publish(&domain.Event{
+		UserIDs: []int{2},
+		Message: domain.WebsocketMessage{
+			Type:    "typing",
+			Payload: map[string]any{"user_id": float64(1)},
+		},
+	}))
+
+	received := receive(t, events)
+	assert.Equal(t, []int{2}, received.UserIDs)
+	assert.Equal(t, "typing", received.Message.Type)
+	assert.Equal(t, float64(1), received.Message.Payload["user_id"])
+	assert.Zero(t, store.stored())
+}
+
+func TestBroker_PublishLargeEvent(t *testing.T) {
+	b, store := newTestBroker(t)
+	events, cancel := b.Subscribe()
+	defer cancel()
+
+	// Test messages over the NOTIFY payload limit are delivered
+	content := strings.Repeat("я", 4000)
+	event := &domain.Event{
+		UserIDs: []int{1, 2},
+		Message: domain.WebsocketMessage{
+			Type:    "message",
+			Payload: map[string]any{"content": content},
+		},
+	}
+	require.NoError(t, b.Publish(event))
+
+	received := receive(t, events)
+	assert.Equal(t, []int{1, 2}, received.UserIDs)
+	assert.Equal(t, "message", received.Message.Type)
+	assert.Equal(t, content, received.Message.Payload["content"])
+	assert.Equal(t, 1, store.stored())
+}
+
+func TestBroker_SkipsUnknownEvents(t *testing.T) {
+	b, store := newTestBroker(t)
+	events, cancel := b.Subscribe()
+	defer cancel()
+
+	store.notifications <- nil
+	store.notifications <- &pq.Notification{Extra: "not an id"}
+	store.notifications <- &pq.Notification{Extra: "42"}
+	store.notifications <- &pq.Notification{Extra: "{not json"}
+	require.NoError(t, b.Publish(&domain.Event{Message: domain.WebsocketMessage{Type: "presence"}}))
+
+	assert.Equal(t, "presence", receive(t, events).Message.Type)
+}
+
+func TestBroker_PublishClosed(t *testing.T) {
+	b, _ := newTestBroker(t)
+	b.closed.Store(true)
+
+	assert.ErrorIs(t, b.Publish(&domain.Event{}), domain.ErrBrokerClosed)
+}
+
+// TestBroker_PostgreSQL runs against the migrated database given by
+// FORUM_TEST_DATABASE_URL
+func TestBroker_PostgreSQL(t *testing.T) {
+	connStr := os.Getenv("FORUM_TEST_DATABASE_URL")
+	if connStr == "" {
+		t.Skip("FORUM_TEST_DATABASE_URL not set")
+	}
+
+	db, err := sql.Open("postgres", connStr)
+	require.NoError(t, err)
+	defer db.Close()
+
+	b, err := NewBroker(db, connStr, zap.NewNop())
+	require.NoError(t, err)
+	defer b.Close()
+
+	events, cancel := b.Subscribe()
+	defer cancel()
+
+	require.NoError(t, b.Publish(&domain.Event{Message: domain.WebsocketMessage{Type: "typing"}}))
+	assert.Equal(t, "typing", receive(t, events).Message.Type)
+
+	content := strings.Repeat("я", 4000)
+	require.NoError(t, b.Publish(&domain.Event{
+		Message: domain.WebsocketMessage{
+			Type:    "message",
+			Payload: map[string]any{"content": content},
+		},
+	}))
+
+	assert.Equal(t, content, receive(t, events).Message.Payload["content"])
+
+	store := &pgEventStore{db: db}
+	require.NoError(t, store.deleteBefore(time.Now().Add(time.Minute)))
+	_, err = store.load(1)
+	assert.ErrorIs(t, err, errEventNotFound)
+}
@@ -0,0 +1,71 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// errEventNotFound is returned for events deleted before they were loaded
+var errEventNotFound = errors.New("event not found")
+
+// eventStore keeps published events until every instance had the chance
+// to load them
+type eventStore interface {
+	// notify sends the event to the listeners in the notification itself
+	notify(payload []byte) error
+	// publish stores the event and notifies the listeners of its id
+	publish(payload []byte) error
+	load(id int64) ([]byte, error)
+	deleteBefore(t time.Time) error
+}
+
+type pgEventStore struct {
+	db *sql.DB
+}
+
+func (s *pgEventStore) notify(payload []byte) error {
+	if _, err := s.db.Exec(`SELECT pg_notify($1, $2)`, channelName, string(payload)); err != nil {
+		return fmt.Errorf("error notifying event: %w", err)
+	}
+
+	return nil
+}
+
+func (s *pgEventStore) publish(payload []byte) error {
+	// The notification is delivered when the insert commits, listeners
+	// always find the event
+	query := `
+		WITH event AS (
+			INSERT INTO chat_events (payload) VALUES ($2) RETURNING id
+		)
+		SELECT pg_notify($1, id::text) FROM event`
+
+	if _, err := s.db.Exec(query, channelName, string(payload)); err != nil {
+		return fmt.Errorf("error storing event: %w", err)
+	}
+
+	return nil
+}
+
+func (s *pgEventStore) load(id int64) ([]byte, error) {
+	var payload []byte
+	err := s.db.QueryRow(`SELECT payload FROM chat_events WHERE id = $1`, id).Scan(&payload)
+	if err == sql.ErrNoRows {
+		return nil, errEventNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading event: %w", err)
+	}
+
+	return payload, nil
+}
+
+func (s *pgEventStore) deleteBefore(t time.Time) error {
+	if _, err := s.db.Exec(`DELETE FROM chat_events WHERE created_at < $1`, t); err != nil {
+		return fmt.Errorf("error deleting events: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/chizheg/forum/pkg/audit"
+	"go.uber.org/zap"
+)
+
+type deleteAccountRequest struct {
+	// Password is empty for accounts signed up with an identity provider,
+	// which have to have signed in within the last minutes instead
+	Password string `json:"password"`
+}
+
+// @Summary Delete the account
+// @Description Delete the account of the user in the auth service and anonymize their messages
+// @Tags account
+// @Accept json
+// @Param Authorization header string true "Bearer token"
+// @Param request body deleteAccountRequest true "Current password"
+// @Success 204
+// @Failure 403 {string} string "Wrong password or sign-in not recent enough"
+// @Router /api/account [delete]
+func (h *Handler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := userIDFromContext(r)
+	token, hasToken := tokenFromContext(r)
+	if !ok || !hasToken {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req deleteAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.DeleteAccount(userID, token, req.Password, audit.SourceFromRequest(r)); err != nil {
+		h.logger.Error("failed to delete account", zap.Error(err))
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary Export the account
+// @Description Download the data kept about the user: account, profile, sessions and messages
+// @Tags account
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Success 200 {object} domain.AccountExport
+// @Router /api/account/export [get]
+func (h *Handler) ExportAccount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := userIDFromContext(r)
+	token, hasToken := tokenFromContext(r)
+	if !ok || !hasToken {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	export, err := h.service.ExportAccount(userID, token, audit.SourceFromRequest(r))
+	if err != nil {
+		h.logger.Error("failed to export account", zap.Error(err))
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="forum-export-%d.json"`, userID))
+	json.NewEncoder(w).Encode(export)
+}
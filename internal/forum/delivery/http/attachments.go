@@ -0,0 +1,179 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+	"go.uber.org/zap"
+)
+
+// multipartOverhead is allowed on top of the maximum file size for the
+// part headers and boundaries, the attachment service enforces the exact
+// file size limit
+const multipartOverhead = 1 << 20
+
+// @Summary Upload an attachment
+// @Description Upload a file to be sent with a message. The file type is detected from its contents.
+// @Tags attachments
+// @Accept multipart/form-data
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param file formData file true "File to upload"
+// @Success 201 {object} domain.Attachment
+// @Failure 403 {string} string "User is muted or banned"
+// @Failure 413 {string} string "File is too large"
+// @Failure 415 {string} string "File type is not allowed"
+// @Router /api/attachments [post]
+func (h *Handler) UploadAttachment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := userIDFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Sanctioned users are refused before the body is read
+	if err := h.service.CheckSendAccess(userID); err != nil {
+		var sanctionErr *domain.SanctionError
+		if !errors.As(err, &sanctionErr) {
+			h.logger.Error("failed to check send access", zap.Error(err))
+		}
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, h.attachments.MaxUploadSize()+multipartOverhead)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "invalid multipart request", http.StatusBadRequest)
+		return
+	}
+
+	// Stream the file part instead of buffering the whole form
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			http.Error(w, "missing file", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			if err := uploadError(err); errors.Is(err, domain.ErrFileTooLarge) {
+				http.Error(w, err.Error(), errorStatus(err))
+				return
+			}
+			http.Error(w, "invalid multipart request", http.StatusBadRequest)
+			return
+		}
+
+		if part.FormName() != "file" {
+			part.Close()
+			continue
+		}
+
+		attachment, err := h.attachments.Upload(userID, part.FileName(), part)
+		part.Close()
+		if err != nil {
+			err = uploadError(err)
+			var sanctionErr *domain.SanctionError
+			if !errors.As(err, &sanctionErr) {
+				h.logger.Error("failed to upload attachment", zap.Error(err))
+			}
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(attachment)
+		return
+	}
+}
+
+// uploadError reports a request body over the limit as a file too large
+func uploadError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return domain.ErrFileTooLarge
+	}
+	return err
+}
+
+// @Summary Download an attachment
+// @Description Download an attachment or its thumbnail using a signed link from the message
+// @Tags attachments
+// @Produce octet-stream
+// @Param id query int true "Attachment ID"
+// @Param expires query int true "Link expiry as a Unix timestamp"
+// @Param signature query string true "Link signature"
+// @Param thumbnail query bool false "Download the image thumbnail"
+// @Success 200 {file} file
+// @Failure 403 {string} string "Link is invalid or expired"
+// @Router /api/attachments/download [get]
+func (h *Handler) DownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	id, err := strconv.Atoi(query.Get("id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid expires", http.StatusBadRequest)
+		return
+	}
+	thumbnail := query.Get("thumbnail") == "1"
+
+	attachment, blob, err := h.attachments.Open(id, thumbnail, expires, query.Get("signature"))
+	if err != nil {
+		if !errors.Is(err, domain.ErrInvalidDownloadLink) {
+			h.logger.Error("failed to open attachment", zap.Error(err))
+		}
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	defer blob.Close()
+
+	// Only images are shown inline, everything else is downloaded so
+	// uploaded files are never rendered in the page origin
+	disposition := "attachment"
+	if strings.HasPrefix(attachment.ContentType, "image/") {
+		disposition = "inline"
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", attachment.ContentType)
+	header.Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{
+		"filename": attachment.FileName,
+	}))
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	if attachment.Size > 0 {
+		header.Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	}
+	if maxAge := time.Until(time.Unix(expires, 0)); maxAge > 0 {
+		header.Set("Cache-Control", "private, max-age="+strconv.Itoa(int(maxAge.Seconds())))
+	}
+
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	if _, err := io.Copy(w, blob); err != nil {
+		h.logger.Warn("failed to send attachment", zap.Error(err))
+	}
+}
@@ -0,0 +1,81 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type stubForumService struct {
+	domain.ForumService
+}
+
+func (s *stubForumService) CheckSendAccess(userID int) error {
+	return nil
+}
+
+// stubAttachmentService reads the whole upload like the real service
+type stubAttachmentService struct {
+	domain.AttachmentService
+	maxSize int64
+}
+
+func (s *stubAttachmentService) MaxUploadSize() int64 {
+	return s.maxSize
+}
+
+func (s *stubAttachmentService) Upload(userID int, fileName string, r io.Reader) (*domain.Attachment, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.Attachment{ID: 1, FileName: fileName, Size: int64(len(data))}, nil
+}
+
+func uploadRequest(t *testing.T, fields map[string]string, content string) *http.Request {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, value := range fields {
+		require.NoError(t, form.WriteField(name, value))
+	}
+	file, err := form.CreateFormFile("file", "a.txt")
+	require.NoError(t, err)
+	_, err = file.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, form.Close())
+
+	r := httptest.NewRequest(http.MethodPost, "/api/attachments", &body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	return r.WithContext(context.WithValue(r.Context(), "userID", 1))
+}
+
+func TestHandler_UploadAttachmentSize(t *testing.T) {
+	const maxSize = 2 << 20
+	h := &Handler{
+		service:     &stubForumService{},
+		attachments: &stubAttachmentService{maxSize: maxSize},
+		logger:      zap.NewNop(),
+	}
+
+	// Test the body limit follows the configured file size
+	rec := httptest.NewRecorder()
+	h.UploadAttachment(rec, uploadRequest(t, nil, strings.Repeat("a", maxSize)))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	// Test a body over the limit is reported as a file too large
+	rec = httptest.NewRecorder()
+	fields := map[string]string{"padding": strings.Repeat("a", multipartOverhead)}
+	h.UploadAttachment(rec, uploadRequest(t, fields, strings.Repeat("a", maxSize)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.Contains(t, rec.Body.String(), domain.ErrFileTooLarge.Error())
+}
@@ -0,0 +1,73 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/chizheg/forum/pkg/audit"
+	"go.uber.org/zap"
+)
+
+// @Summary Get the audit log
+// @Description Get moderation actions recorded by the forum, newest first (admins only)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param actor_id query int false "User who acted"
+// @Param action query string false "Action, e.g. forum.user_banned"
+// @Param from query string false "Earliest time, RFC 3339 or YYYY-MM-DD"
+// @Param to query string false "Latest time, RFC 3339 or YYYY-MM-DD (exclusive)"
+// @Param limit query int false "Number of entries to return"
+// @Param offset query int false "Number of entries to skip"
+// @Success 200 {array} audit.Entry
+// @Router /api/admin/audit [get]
+func (h *Handler) GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := userIDFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := audit.Filter{
+		Action: audit.Action(query.Get("action")),
+	}
+
+	var err error
+	for key, dest := range map[string]*int{
+		"actor_id": &filter.ActorID,
+		"limit":    &filter.Limit,
+		"offset":   &filter.Offset,
+	} {
+		if raw := query.Get(key); raw != "" {
+			if *dest, err = strconv.Atoi(raw); err != nil || *dest < 0 {
+				http.Error(w, "invalid "+key, http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	if filter.Since, err = parseSearchTime(query.Get("from")); err != nil {
+		http.Error(w, "invalid from", http.StatusBadRequest)
+		return
+	}
+	if filter.Until, err = parseSearchTime(query.Get("to")); err != nil {
+		http.Error(w, "invalid to", http.StatusBadRequest)
+		return
+	}
+
+	entries, err := h.service.GetAuditLog(userID, filter)
+	if err != nil {
+		h.logger.Error("failed to get audit log", zap.Error(err))
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(entries)
+}
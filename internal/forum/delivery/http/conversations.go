@@ -0,0 +1,137 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+	"go.uber.org/zap"
+)
+
+type startConversationRequest struct {
+	UserIDs []int `json:"user_ids"`
+}
+
+// @Summary List or start direct conversations
+// @Description GET lists conversations of the current user, POST starts a one-to-one or group conversation
+// @Tags conversations
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param request body startConversationRequest false "Members of the new conversation"
+// @Success 200 {array} domain.Conversation
+// @Success 201 {object} domain.Conversation
+// @Router /api/conversations [get]
+// @Router /api/conversations [post]
+func (h *Handler) HandleConversations(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		conversations, err := h.service.GetConversations(userID)
+		if err != nil {
+			h.logger.Error("failed to get conversations", zap.Error(err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(conversations)
+
+	case http.MethodPost:
+		var req startConversationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		conv, err := h.service.StartConversation(userID, req.UserIDs)
+		if err != nil {
+			h.logger.Error("failed to start conversation", zap.Error(err))
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(conv)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// @Summary Get direct conversation messages
+// @Description Get recent messages of a conversation the current user is a member of
+// @Tags conversations
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param conversation_id query int true "Conversation ID"
+// @Param limit query int false "Number of messages to return"
+// @Success 200 {array} domain.Message
+// @Router /api/conversations/messages [get]
+func (h *Handler) GetConversationMessages(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	conversationID, err := strconv.Atoi(r.URL.Query().Get("conversation_id"))
+	if err != nil || conversationID <= 0 {
+		http.Error(w, "invalid conversation_id", http.StatusBadRequest)
+		return
+	}
+
+	limit := queryLimit(r, 50)
+	messages, err := h.service.GetConversationMessages(userID, conversationID, limit)
+	if err != nil {
+		h.logger.Error("failed to get conversation messages", zap.Error(err))
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(messages)
+}
+
+// sendDirectMessage stores the message and delivers it to the members of
+// the conversation only
+func (h *Handler) sendDirectMessage(userID, conversationID int, content string, replyToID int, attachmentIDs []int) (*domain.Message, error) {
+	conv, err := h.service.GetConversation(userID, conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	message, err := h.service.SendDirectMessage(userID, conversationID, content, replyToID, attachmentIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	h.typing.StopTyping(userID, conversationID)
+
+	h.sendToUsers(conv.MemberIDs, domain.WebsocketMessage{
+		Type:    "message",
+		Payload: messagePayload(message),
+	})
+
+	return message, nil
+}
+
+// conversationRecipients returns the users who may see events of the
+// conversation, nil meaning everyone in the public chat
+func (h *Handler) conversationRecipients(userID, conversationID int) ([]int, error) {
+	if conversationID == domain.PublicConversationID {
+		return nil, nil
+	}
+
+	conv, err := h.service.GetConversation(userID, conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	return conv.MemberIDs, nil
+}
@@ -1,29 +1,70 @@
 package http
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/chizheg/forum/internal/forum/domain"
+	"github.com/chizheg/forum/pkg/audit"
 	"github.com/gorilla/websocket"
 	"go.uber.org/zap"
 )
 
+const (
+	// clientBufferSize is the number of events queued for a websocket
+	// client before it is disconnected as too slow
+	clientBufferSize = 64
+	writeTimeout     = 10 * time.Second
+)
+
+// client is a websocket connection with its own writer goroutine, so a
+// slow connection never holds up delivery to the others
+type client struct {
+	conn   *websocket.Conn
+	userID int
+	send   chan *domain.Event
+}
+
 // Handler handles HTTP requests
 type Handler struct {
 	service      domain.ForumService
+	broker       domain.Broker
+	presence     domain.PresenceService
+	typing       domain.TypingService
+	attachments  domain.AttachmentService
+	users        domain.UserRepository
 	logger       *zap.Logger
 	upgrader     websocket.Upgrader
-	clients      map[*websocket.Conn]int // websocket -> userID
+	clients      map[*client]struct{}
 	clientsMutex sync.RWMutex
 }
 
-// NewHandler creates a new HTTP handler
-func NewHandler(service domain.ForumService, logger *zap.Logger) *Handler {
-	return &Handler{
-		service: service,
-		logger:  logger,
+// NewHandler creates a new HTTP handler and starts delivering broker
+// events to the websocket clients connected to this instance
+func NewHandler(
+	service domain.ForumService,
+	broker domain.Broker,
+	presence domain.PresenceService,
+	typing domain.TypingService,
+	attachments domain.AttachmentService,
+	users domain.UserRepository,
+	logger *zap.Logger,
+) *Handler {
+	h := &Handler{
+		service:     service,
+		broker:      broker,
+		presence:    presence,
+		typing:      typing,
+		attachments: attachments,
+		users:       users,
+		logger:      logger,
 		upgrader: websocket.Upgrader{
 			ReadBufferSize:  1024,
 			WriteBufferSize: 1024,
@@ -31,7 +72,24 @@ func NewHandler(service domain.ForumService, logger *zap.Logger) *Handler {
 				return true // In production, this should be more restrictive
 			},
 		},
-		clients: make(map[*websocket.Conn]int),
+		clients: make(map[*client]struct{}),
+	}
+
+	events, _ := broker.Subscribe()
+	go h.deliverEvents(events)
+
+	return h
+}
+
+// HandleMessages serves the chat history and sending messages over REST
+func (h *Handler) HandleMessages(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.GetMessages(w, r)
+	case http.MethodPost:
+		h.SendMessage(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
@@ -55,6 +113,197 @@ func (h *Handler) GetMessages(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(messages)
 }
 
+type sendMessageRequest struct {
+	Content        string `json:"content"`
+	ConversationID int    `json:"conversation_id"`
+	ReplyToID      int    `json:"reply_to_id"`
+	AttachmentIDs  []int  `json:"attachment_ids"`
+}
+
+// @Summary Send a chat message
+// @Description Send a message to the public chat or, with conversation_id, to a direct conversation
+// @Tags chat
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param request body sendMessageRequest true "Message to send"
+// @Success 201 {object} domain.Message
+// @Success 202 {object} domain.Message "Message held for review"
+// @Failure 429 {string} string "Sending messages too fast"
+// @Router /api/chat/messages [post]
+func (h *Handler) SendMessage(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req sendMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	message, err := h.sendMessage(userID, req.ConversationID, req.Content, req.ReplyToID, req.AttachmentIDs)
+	if err != nil {
+		var limitErr *domain.RateLimitError
+		var sanctionErr *domain.SanctionError
+		switch {
+		case errors.As(err, &limitErr):
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(limitErr.RetryAfter)))
+		case errors.As(err, &sanctionErr), errors.Is(err, domain.ErrMessageRejected):
+		default:
+			h.logger.Error("failed to send message", zap.Error(err))
+		}
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	// Held messages are accepted but not published yet
+	status := http.StatusCreated
+	if message.Status == domain.MessagePending {
+		status = http.StatusAccepted
+	}
+
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(message)
+}
+
+// @Summary Get reply chain
+// @Description Get a message preceded by the messages it replies to, oldest first
+// @Tags chat
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param message_id query int true "Message ID"
+// @Success 200 {array} domain.Message
+// @Router /api/chat/messages/chain [get]
+func (h *Handler) GetReplyChain(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	messageID, err := strconv.Atoi(r.URL.Query().Get("message_id"))
+	if err != nil || messageID <= 0 {
+		http.Error(w, "invalid message_id", http.StatusBadRequest)
+		return
+	}
+
+	messages, err := h.service.GetReplyChain(userID, messageID)
+	if err != nil {
+		h.logger.Error("failed to get reply chain", zap.Error(err))
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(messages)
+}
+
+// @Summary Get online users
+// @Description Get users currently connected to the chat with their presence status
+// @Tags chat
+// @Accept json
+// @Produce json
+// @Success 200 {array} domain.Presence
+// @Router /api/chat/online [get]
+func (h *Handler) GetOnlineUsers(w http.ResponseWriter, r *http.Request) {
+	online, err := h.presence.GetOnline()
+	if err != nil {
+		h.logger.Error("failed to get online users", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ids := make([]int, len(online))
+	for i, p := range online {
+		ids[i] = p.UserID
+	}
+
+	users, err := h.users.GetUsersByIDs(ids)
+	if err != nil {
+		h.logger.Error("failed to resolve usernames", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	usernames := make(map[int]string, len(users))
+	for _, user := range users {
+		usernames[user.ID] = user.Username
+	}
+	for _, p := range online {
+		p.Username = usernames[p.UserID]
+	}
+
+	json.NewEncoder(w).Encode(online)
+}
+
+type markReadRequest struct {
+	MessageID int `json:"message_id"`
+}
+
+// @Summary Mark messages as read
+// @Description Move the read marker of the current user up to the given message
+// @Tags chat
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param request body markReadRequest true "Last read message"
+// @Success 204
+// @Router /api/chat/read [post]
+func (h *Handler) MarkRead(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := userIDFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req markReadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MessageID <= 0 {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.markRead(userID, req.MessageID); err != nil {
+		h.logger.Error("failed to mark messages as read", zap.Error(err))
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary Get unread message count
+// @Description Get the number of messages posted after the read marker of the current user
+// @Tags chat
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Success 200 {object} map[string]int
+// @Router /api/chat/unread [get]
+func (h *Handler) GetUnreadCount(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	count, err := h.service.GetUnreadCount(userID)
+	if err != nil {
+		h.logger.Error("failed to count unread messages", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]int{"unread": count})
+}
+
 // @Summary Connect to chat WebSocket
 // @Description Connect to chat WebSocket for real-time messages
 // @Tags chat
@@ -64,7 +313,11 @@ func (h *Handler) GetMessages(w http.ResponseWriter, r *http.Request) {
 // @Success 101 {string} string "Switching Protocols"
 // @Router /ws/chat [get]
 func (h *Handler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value("userID").(int)
+	userID, ok := userIDFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
 
 	// Upgrade connection to WebSocket
 	conn, err := h.upgrader.Upgrade(w, r, nil)
@@ -73,17 +326,48 @@ func (h *Handler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Banned users are told why with a close code, browsers don't expose
+	// the status of a refused handshake
+	if err := h.service.CheckChatAccess(userID); err != nil {
+		if errors.Is(err, domain.ErrBanned) {
+			closeConn(conn, domain.CloseCodeBanned)
+			return
+		}
+		h.logger.Error("failed to check chat access", zap.Error(err))
+	}
+
+	// Connection IDs are random as the presence of every instance may be
+	// kept in the same store
+	connID, err := newConnID()
+	if err != nil {
+		h.logger.Error("failed to generate connection id", zap.Error(err))
+		conn.Close()
+		return
+	}
+
 	// Register client
+	c := &client{
+		conn:   conn,
+		userID: userID,
+		send:   make(chan *domain.Event, clientBufferSize),
+	}
 	h.clientsMutex.Lock()
-	h.clients[conn] = userID
+	h.clients[c] = struct{}{}
 	h.clientsMutex.Unlock()
 
+	go h.writeEvents(c)
+
+	h.updatePresence(h.presence.Connect(userID, connID))
+
 	// Clean up on disconnect
 	defer func() {
 		h.clientsMutex.Lock()
-		delete(h.clients, conn)
+		delete(h.clients, c)
 		h.clientsMutex.Unlock()
+		close(c.send)
 		conn.Close()
+
+		h.updatePresence(h.presence.Disconnect(userID, connID))
 	}()
 
 	// Handle incoming messages
@@ -104,33 +388,479 @@ func (h *Handler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 				continue
 			}
 
-			err = h.service.SendMessage(userID, content)
+			conversationID, _ := payloadInt(msg.Payload, "conversation_id")
+			replyToID, _ := payloadInt(msg.Payload, "reply_to_id")
+			attachmentIDs := payloadInts(msg.Payload, "attachment_ids")
+
+			_, err := h.sendMessage(userID, conversationID, content, replyToID, attachmentIDs)
+			if err != nil && !h.sendErrorFrame(userID, err) {
+				h.logger.Error("failed to send message", zap.Error(err))
+			}
+
+		case "mark_read":
+			messageID, ok := payloadInt(msg.Payload, "message_id")
+			if !ok {
+				continue
+			}
+
+			if err := h.markRead(userID, messageID); err != nil {
+				h.logger.Error("failed to mark messages as read", zap.Error(err))
+			}
+
+		case "reaction":
+			messageID, ok := payloadInt(msg.Payload, "message_id")
+			if !ok {
+				continue
+			}
+			emoji, ok := msg.Payload["emoji"].(string)
+			if !ok {
+				continue
+			}
+
+			if _, err := h.toggleReaction(userID, messageID, emoji); err != nil {
+				h.logger.Error("failed to toggle reaction", zap.Error(err))
+			}
+
+		case "pin", "unpin":
+			messageID, ok := payloadInt(msg.Payload, "message_id")
+			if !ok {
+				continue
+			}
+
+			if msg.Type == "pin" {
+				_, err = h.pinMessage(userID, messageID)
+			} else {
+				err = h.unpinMessage(userID, messageID)
+			}
+			if err != nil {
+				h.logger.Error("failed to "+msg.Type+" message", zap.Error(err))
+			}
+
+		case "typing":
+			// Typing events are only shown to the other participants and
+			// are never persisted
+			conversationID, _ := payloadInt(msg.Payload, "conversation_id")
+			if typing, ok := msg.Payload["typing"].(bool); ok && !typing {
+				h.typing.StopTyping(userID, conversationID)
+				continue
+			}
+
+			recipients, err := h.conversationRecipients(userID, conversationID)
 			if err != nil {
-				h.logger.Error("failed to save message", zap.Error(err))
 				continue
 			}
 
-			// Broadcast message to all clients
-			h.broadcastMessage(msg)
+			h.typing.StartTyping(userID, conversationID, recipients)
+
+		case "presence":
+			status, ok := msg.Payload["status"].(string)
+			if !ok {
+				continue
+			}
+
+			h.updatePresence(h.presence.SetStatus(userID, connID, domain.PresenceStatus(status)))
 		}
 	}
 }
 
+// sendMessage stores the message and delivers it to everyone who may see
+// it, used by both the websocket and the REST API
+func (h *Handler) sendMessage(userID, conversationID int, content string, replyToID int, attachmentIDs []int) (*domain.Message, error) {
+	if conversationID != domain.PublicConversationID {
+		return h.sendDirectMessage(userID, conversationID, content, replyToID, attachmentIDs)
+	}
+
+	message, err := h.service.SendMessage(userID, content, replyToID, attachmentIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	h.typing.StopTyping(userID, domain.PublicConversationID)
+
+	// Only the author sees messages held for review until they are approved
+	if message.Status == domain.MessagePending {
+		h.sendToUsers([]int{userID}, domain.WebsocketMessage{
+			Type:    "message_held",
+			Payload: messagePayload(message),
+		})
+		return message, nil
+	}
+
+	// Broadcast message to all clients
+	h.broadcastMessage(domain.WebsocketMessage{
+		Type:    "message",
+		Payload: messagePayload(message),
+	})
+
+	return message, nil
+}
+
+// sendErrorFrame tells the clients of the user that their message was
+// rejected by the flood control, a sanction or the content filter. It reports false for other
+// errors, which are not shown to clients.
+func (h *Handler) sendErrorFrame(userID int, err error) bool {
+	payload := map[string]any{
+		"message": err.Error(),
+	}
+
+	var limitErr *domain.RateLimitError
+	var sanctionErr *domain.SanctionError
+	switch {
+	case errors.As(err, &limitErr):
+		payload["code"] = "rate_limited"
+		payload["retry_after"] = retryAfterSeconds(limitErr.RetryAfter)
+	case errors.As(err, &sanctionErr):
+		payload["code"] = "muted"
+		if sanctionErr.Sanction.Type == domain.SanctionBan {
+			payload["code"] = "banned"
+		}
+		if sanctionErr.Sanction.ExpiresAt != nil {
+			payload["expires_at"] = sanctionErr.Sanction.ExpiresAt
+		}
+	case errors.Is(err, domain.ErrMessageRejected):
+		payload["code"] = "message_rejected"
+	default:
+		return false
+	}
+
+	h.sendToUsers([]int{userID}, domain.WebsocketMessage{
+		Type:    "error",
+		Payload: payload,
+	})
+	return true
+}
+
+// markRead moves the read marker and lets everyone know the user has read
+// up to the message
+func (h *Handler) markRead(userID, messageID int) error {
+	advanced, err := h.service.MarkRead(userID, messageID)
+	if err != nil {
+		return err
+	}
+
+	if advanced {
+		h.broadcastMessage(domain.WebsocketMessage{
+			Type: "read_receipt",
+			Payload: map[string]any{
+				"user_id":    userID,
+				"message_id": messageID,
+			},
+		})
+	}
+
+	return nil
+}
+
+// updatePresence broadcasts the presence returned by the presence service
+// when the status of the user changed
+func (h *Handler) updatePresence(p *domain.Presence, err error) {
+	if err != nil {
+		h.logger.Error("failed to update presence", zap.Error(err))
+		return
+	}
+	if p != nil {
+		h.broadcastPresence(p)
+	}
+}
+
+func (h *Handler) broadcastPresence(p *domain.Presence) {
+	h.broadcastMessage(domain.WebsocketMessage{
+		Type: "presence",
+		Payload: map[string]any{
+			"user_id":   p.UserID,
+			"status":    p.Status,
+			"last_seen": p.LastSeen,
+		},
+	})
+}
+
+// broadcastMessage publishes the message to the clients of every instance
 func (h *Handler) broadcastMessage(msg domain.WebsocketMessage) {
+	if err := h.broker.Publish(&domain.Event{Message: msg}); err != nil {
+		h.logger.Error("failed to publish message", zap.Error(err))
+	}
+}
+
+// sendToUsers publishes the message to the given users on every instance
+func (h *Handler) sendToUsers(userIDs []int, msg domain.WebsocketMessage) {
+	if err := h.broker.Publish(&domain.Event{UserIDs: userIDs, Message: msg}); err != nil {
+		h.logger.Error("failed to publish message", zap.Error(err))
+	}
+}
+
+// deliverEvents writes broker events to the matching local clients until
+// the broker is closed. A subscription dropped for falling behind always
+// delivered a full buffer first, one closed without events means the
+// broker was closed.
+func (h *Handler) deliverEvents(events <-chan *domain.Event) {
+	for {
+		delivered := false
+		for event := range events {
+			h.deliverEvent(event)
+			delivered = true
+		}
+		if !delivered {
+			return
+		}
+
+		// The clients may have missed messages and kicks, they get the
+		// current state back by reconnecting
+		h.logger.Warn("broker subscription dropped, disconnecting websocket clients")
+		h.disconnectClients()
+		events, _ = h.broker.Subscribe()
+	}
+}
+
+// disconnectClients closes the connections of every local client, the
+// reading goroutines clean up
+func (h *Handler) disconnectClients() {
 	h.clientsMutex.RLock()
 	defer h.clientsMutex.RUnlock()
 
-	for conn := range h.clients {
-		err := conn.WriteJSON(msg)
-		if err != nil {
+	for c := range h.clients {
+		c.conn.Close()
+	}
+}
+
+func (h *Handler) deliverEvent(event *domain.Event) {
+	var recipients map[int]bool
+	if len(event.UserIDs) > 0 {
+		recipients = make(map[int]bool, len(event.UserIDs))
+		for _, id := range event.UserIDs {
+			recipients[id] = true
+		}
+	}
+
+	h.clientsMutex.RLock()
+	defer h.clientsMutex.RUnlock()
+
+	for c := range h.clients {
+		if recipients != nil && !recipients[c.userID] {
+			continue
+		}
+		if event.ExceptUserID != 0 && event.ExceptUserID == c.userID {
+			continue
+		}
+
+		// The reading goroutine cleans up once the connection is closed
+		select {
+		case c.send <- event:
+		default:
+			h.logger.Warn("disconnecting slow websocket client", zap.Int("user_id", c.userID))
+			c.conn.Close()
+		}
+	}
+}
+
+// writeEvents writes the events queued for the client until its queue is
+// closed or a write fails
+func (h *Handler) writeEvents(c *client) {
+	for event := range c.send {
+		c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if err := c.conn.WriteJSON(event.Message); err != nil {
 			h.logger.Error("failed to send message", zap.Error(err))
-			conn.Close()
+			c.conn.Close()
+			return
 		}
+
+		if event.CloseCode != 0 {
+			closeConn(c.conn, event.CloseCode)
+			return
+		}
+	}
+}
+
+func newConnID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// closeConn sends a close frame with the code before closing the connection
+func closeConn(conn *websocket.Conn, code int) {
+	var reason string
+	switch code {
+	case domain.CloseCodeKicked:
+		reason = "kicked from the chat"
+	case domain.CloseCodeBanned:
+		reason = domain.ErrBanned.Error()
+	case domain.CloseCodeAccountDeleted:
+		reason = "account deleted"
+	}
+
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+	conn.Close()
+}
+
+// RegisterRoutes registers HTTP routes. Every route goes through auth and
+// then limit, e.g. AuthMiddleware.OptionalAuth and RateLimitMiddleware.Limit,
+// so requests are limited per user once authenticated and per client IP
+// otherwise. Handlers reject anonymous requests themselves where needed.
+func (h *Handler) RegisterRoutes(mux *http.ServeMux, auth, limit func(http.HandlerFunc) http.HandlerFunc) {
+	handle := func(pattern string, handler http.HandlerFunc) {
+		mux.HandleFunc(pattern, auth(limit(handler)))
+	}
+
+	handle("/api/chat/messages", h.HandleMessages)
+	handle("/api/chat/messages/chain", h.GetReplyChain)
+	handle("/api/chat/online", h.GetOnlineUsers)
+	handle("/api/chat/read", h.MarkRead)
+	handle("/api/chat/unread", h.GetUnreadCount)
+	handle("/api/chat/reactions", h.ToggleReaction)
+	handle("/api/chat/pinned", h.HandlePinned)
+	handle("/api/chat/search", h.SearchMessages)
+	handle("/api/chat/reports", h.ReportMessage)
+	handle("/api/attachments", h.UploadAttachment)
+	handle("/api/attachments/download", h.DownloadAttachment)
+	handle("/api/conversations", h.HandleConversations)
+	handle("/api/conversations/messages", h.GetConversationMessages)
+	handle("/api/moderation/sanctions", h.HandleSanctions)
+	handle("/api/moderation/reports", h.GetReportQueue)
+	handle("/api/moderation/reports/resolve", h.ResolveReports)
+	handle("/api/moderation/pending", h.GetPendingMessages)
+	handle("/api/moderation/pending/review", h.ReviewMessage)
+	handle("/api/admin/audit", h.GetAuditLog)
+	handle("/api/account", h.DeleteAccount)
+	handle("/api/account/export", h.ExportAccount)
+	handle("/api/notifications", h.GetNotifications)
+	handle("/api/notifications/read", h.MarkNotificationsRead)
+	handle("/ws/chat", h.HandleWebSocket)
+}
+
+func messagePayload(msg *domain.Message) map[string]any {
+	payload := map[string]any{
+		"id":           msg.ID,
+		"user_id":      msg.UserID,
+		"content":      msg.Content,
+		"content_html": msg.ContentHTML,
+		"created_at":   msg.CreatedAt,
+	}
+	if msg.ConversationID != domain.PublicConversationID {
+		payload["conversation_id"] = msg.ConversationID
+	}
+	if msg.Status == domain.MessagePending {
+		payload["status"] = msg.Status
+	}
+	if len(msg.Attachments) > 0 {
+		payload["attachments"] = msg.Attachments
+	}
+	if len(msg.LinkPreviews) > 0 {
+		payload["link_previews"] = msg.LinkPreviews
+	}
+	if msg.ReplyToID != 0 {
+		payload["reply_to_id"] = msg.ReplyToID
+		if msg.ReplyTo != nil {
+			payload["reply_to"] = msg.ReplyTo
+		}
+	}
+
+	return payload
+}
+
+// payloadInt reads an integer field of a decoded websocket payload
+func payloadInt(payload map[string]any, key string) (int, bool) {
+	value, ok := payload[key].(float64)
+	if !ok || value != float64(int(value)) {
+		return 0, false
+	}
+
+	return int(value), true
+}
+
+// payloadInts reads an array of integers of a decoded websocket payload,
+// skipping values that are not integers
+func payloadInts(payload map[string]any, key string) []int {
+	values, _ := payload[key].([]any)
+
+	ints := make([]int, 0, len(values))
+	for _, v := range values {
+		if n, ok := v.(float64); ok && n == float64(int(n)) {
+			ints = append(ints, int(n))
+		}
+	}
+
+	return ints
+}
+
+// queryLimit reads the limit query parameter, falling back to def
+func queryLimit(r *http.Request, def int) int {
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 || limit > 100 {
+		return def
+	}
+
+	return limit
+}
+
+func userIDFromContext(r *http.Request) (int, bool) {
+	userID, ok := r.Context().Value("userID").(int)
+	return userID, ok
+}
+
+// tokenFromContext returns the session token of the request, for calls to
+// the auth service on behalf of the user
+func tokenFromContext(r *http.Request) (string, bool) {
+	token, ok := r.Context().Value("token").(string)
+	return token, ok && token != ""
+}
+
+// errorStatus maps domain errors to HTTP status codes
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, domain.ErrMessageNotFound),
+		errors.Is(err, domain.ErrConversationNotFound),
+		errors.Is(err, domain.ErrUserNotFound),
+		errors.Is(err, domain.ErrAttachmentNotFound),
+		errors.Is(err, domain.ErrSanctionNotFound),
+		errors.Is(err, domain.ErrReportNotFound),
+		errors.Is(err, domain.ErrBlobNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, domain.ErrNotConversationMember),
+		errors.Is(err, domain.ErrForbidden),
+		errors.Is(err, domain.ErrMuted),
+		errors.Is(err, domain.ErrBanned),
+		errors.Is(err, domain.ErrCannotSanction),
+		errors.Is(err, domain.ErrInvalidDownloadLink),
+		errors.Is(err, domain.ErrInvalidPassword),
+		errors.Is(err, domain.ErrReauthenticationRequired):
+		return http.StatusForbidden
+	case errors.Is(err, domain.ErrFileTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, domain.ErrUnsupportedFileType):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, domain.ErrRateLimited):
+		return http.StatusTooManyRequests
+	case errors.Is(err, domain.ErrAlreadyPinned),
+		errors.Is(err, domain.ErrMessageNotPinned),
+		errors.Is(err, domain.ErrSanctionInactive),
+		errors.Is(err, domain.ErrAlreadyReported):
+		return http.StatusConflict
+	case errors.Is(err, domain.ErrEmptyMessage),
+		errors.Is(err, domain.ErrMessageTooLong),
+		errors.Is(err, domain.ErrInvalidMembers),
+		errors.Is(err, domain.ErrTooManyMembers),
+		errors.Is(err, domain.ErrInvalidEmoji),
+		errors.Is(err, domain.ErrInvalidReply),
+		errors.Is(err, domain.ErrEmptyQuery),
+		errors.Is(err, domain.ErrInvalidAttachments),
+		errors.Is(err, domain.ErrTooManyAttachments),
+		errors.Is(err, domain.ErrEmptyFile),
+		errors.Is(err, domain.ErrInvalidDuration),
+		errors.Is(err, domain.ErrEmptyReportReason),
+		errors.Is(err, domain.ErrCannotReport),
+		errors.Is(err, domain.ErrInvalidReportStatus),
+		errors.Is(err, domain.ErrMessageRejected),
+		errors.Is(err, audit.ErrInvalidFilter):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
 	}
 }
 
-// RegisterRoutes registers HTTP routes
-func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
-	mux.HandleFunc("/api/chat/messages", h.GetMessages)
-	mux.HandleFunc("/ws/chat", h.HandleWebSocket)
+// retryAfterSeconds rounds the wait up to whole seconds as used by the
+// Retry-After header
+func retryAfterSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
 }
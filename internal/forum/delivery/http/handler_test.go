@@ -0,0 +1,41 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler_RegisterRoutes(t *testing.T) {
+	var calls []string
+	auth := func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			calls = append(calls, "auth")
+			next(w, r.WithContext(context.WithValue(r.Context(), "userID", 1)))
+		}
+	}
+	limit := func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			userID, _ := userIDFromContext(r)
+			assert.Equal(t, 1, userID)
+			calls = append(calls, "limit")
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+		}
+	}
+
+	mux := http.NewServeMux()
+	(&Handler{}).RegisterRoutes(mux, auth, limit)
+
+	// Test every route is authenticated and then rate limited
+	for _, path := range []string{"/api/chat/messages", "/api/attachments/download", "/ws/chat"} {
+		calls = nil
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code, path)
+		assert.Equal(t, []string{"auth", "limit"}, calls, path)
+	}
+}
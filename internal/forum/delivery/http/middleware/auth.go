@@ -44,8 +44,10 @@ func (m *AuthMiddleware) Authenticate(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		// Add user ID to context
+		// Add user ID and token to context, the token is needed for calls
+		// to the auth service on behalf of the user
 		ctx := context.WithValue(r.Context(), "userID", int(resp.UserId))
+		ctx = context.WithValue(ctx, "token", parts[1])
 		next.ServeHTTP(w, r.WithContext(ctx))
 	}
 }
@@ -74,6 +76,7 @@ func (m *AuthMiddleware) OptionalAuth(next http.HandlerFunc) http.HandlerFunc {
 		}
 
 		ctx := context.WithValue(r.Context(), "userID", int(resp.UserId))
+		ctx = context.WithValue(ctx, "token", parts[1])
 		next.ServeHTTP(w, r.WithContext(ctx))
 	}
 }
@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultRateLimit       = 120
+	defaultAnonymousLimit  = 30
+	defaultRateLimitWindow = time.Minute
+)
+
+// RateLimitConfig holds the request limits of a group of endpoints
+type RateLimitConfig struct {
+	// Name keeps apart the counters of middlewares sharing a store
+	Name string
+	// Limit is how many requests an authenticated user may make per window
+	Limit int
+	// AnonymousLimit is how many requests a client IP may make per window
+	// without authentication
+	AnonymousLimit int
+	Window         time.Duration
+	// TrustedProxies are the CIDRs of the reverse proxies whose
+	// X-Forwarded-For and X-Real-IP headers are used to find the client IP
+	TrustedProxies []string
+}
+
+type RateLimitMiddleware struct {
+	store   domain.RateLimitStore
+	cfg     RateLimitConfig
+	proxies []*net.IPNet
+	logger  *zap.Logger
+}
+
+func NewRateLimitMiddleware(store domain.RateLimitStore, cfg RateLimitConfig, logger *zap.Logger) (*RateLimitMiddleware, error) {
+	if cfg.Limit <= 0 {
+		cfg.Limit = defaultRateLimit
+	}
+	if cfg.AnonymousLimit <= 0 {
+		cfg.AnonymousLimit = defaultAnonymousLimit
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = defaultRateLimitWindow
+	}
+
+	proxies := make([]*net.IPNet, 0, len(cfg.TrustedProxies))
+	for _, cidr := range cfg.TrustedProxies {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing trusted proxy: %w", err)
+		}
+		proxies = append(proxies, network)
+	}
+
+	return &RateLimitMiddleware{
+		store:   store,
+		cfg:     cfg,
+		proxies: proxies,
+		logger:  logger,
+	}, nil
+}
+
+// Limit limits requests by the user ID set by AuthMiddleware, so it must be
+// wrapped by Authenticate or OptionalAuth. Anonymous requests are limited
+// by client IP.
+func (m *RateLimitMiddleware) Limit(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key, limit := m.clientKey(r)
+
+		count, reset, err := m.store.Hit(key, m.cfg.Window)
+		if err != nil {
+			// Rather serve requests than take the API down with the store
+			m.logger.Error("failed to check rate limit", zap.Error(err))
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		header := w.Header()
+		header.Set("X-RateLimit-Limit", strconv.Itoa(limit))
+		header.Set("X-RateLimit-Remaining", strconv.Itoa(max(limit-count, 0)))
+		header.Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+
+		if count > limit {
+			retryAfter := int(math.Ceil(time.Until(reset).Seconds()))
+			header.Set("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// clientKey returns the counter key and limit of the request
+func (m *RateLimitMiddleware) clientKey(r *http.Request) (string, int) {
+	if userID, ok := r.Context().Value("userID").(int); ok {
+		return m.cfg.Name + ":user:" + strconv.Itoa(userID), m.cfg.Limit
+	}
+
+	return m.cfg.Name + ":ip:" + m.clientIP(r), m.cfg.AnonymousLimit
+}
+
+// clientIP returns the address of the client. Forwarding headers are only
+// read from trusted proxies, X-Forwarded-For is walked from the right so
+// addresses prepended by the client are ignored.
+func (m *RateLimitMiddleware) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !m.trusted(ip) {
+		return host
+	}
+
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := net.ParseIP(strings.TrimSpace(hops[i]))
+			if hop == nil {
+				break
+			}
+			ip = hop
+			if !m.trusted(hop) {
+				break
+			}
+		}
+		return ip.String()
+	}
+
+	if realIP := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); realIP != nil {
+		return realIP.String()
+	}
+
+	return host
+}
+
+func (m *RateLimitMiddleware) trusted(ip net.IP) bool {
+	for _, network := range m.proxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
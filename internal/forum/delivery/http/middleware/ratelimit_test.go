@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/chizheg/forum/internal/forum/ratelimit/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestRateLimitMiddleware_Limit(t *testing.T) {
+	m, err := NewRateLimitMiddleware(memory.NewStore(), RateLimitConfig{
+		Name:           "api",
+		Limit:          2,
+		AnonymousLimit: 1,
+		Window:         time.Minute,
+	}, zap.NewNop())
+	require.NoError(t, err)
+
+	handler := m.Limit(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	request := func(userID int, remoteAddr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/chat/messages", nil)
+		r.RemoteAddr = remoteAddr
+		if userID != 0 {
+			r = r.WithContext(context.WithValue(r.Context(), "userID", userID))
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	// Test authenticated users are limited by user ID
+	w := request(1, "10.0.0.1:1234")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("X-RateLimit-Remaining"))
+	assert.NotEmpty(t, w.Header().Get("X-RateLimit-Reset"))
+
+	assert.Equal(t, http.StatusOK, request(1, "10.0.0.2:1234").Code)
+
+	w = request(1, "10.0.0.3:1234")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	// Test other users have their own limit
+	assert.Equal(t, http.StatusOK, request(2, "10.0.0.1:1234").Code)
+
+	// Test anonymous clients are limited by IP
+	assert.Equal(t, http.StatusOK, request(0, "10.0.0.1:1234").Code)
+	assert.Equal(t, http.StatusTooManyRequests, request(0, "10.0.0.1:5678").Code)
+	assert.Equal(t, http.StatusOK, request(0, "10.0.0.2:1234").Code)
+}
+
+func TestRateLimitMiddleware_ClientIP(t *testing.T) {
+	m, err := NewRateLimitMiddleware(memory.NewStore(), RateLimitConfig{
+		TrustedProxies: []string{"10.0.0.0/8"},
+	}, zap.NewNop())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{"direct", "203.0.113.5:1234", nil, "203.0.113.5"},
+		{"untrusted proxy", "203.0.113.5:1234", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "203.0.113.5"},
+		{"trusted proxy", "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "198.51.100.1"},
+		{"spoofed hop", "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "1.2.3.4, 198.51.100.1, 10.0.0.2"}, "198.51.100.1"},
+		{"real ip", "10.0.0.1:1234", map[string]string{"X-Real-IP": "198.51.100.2"}, "198.51.100.2"},
+		{"no header", "10.0.0.1:1234", nil, "10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			assert.Equal(t, tt.want, m.clientIP(r))
+		})
+	}
+
+	// Test invalid proxy configuration
+	_, err = NewRateLimitMiddleware(memory.NewStore(), RateLimitConfig{TrustedProxies: []string{"nope"}}, zap.NewNop())
+	assert.Error(t, err)
+}
@@ -0,0 +1,119 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+	"github.com/chizheg/forum/pkg/audit"
+	"go.uber.org/zap"
+)
+
+type sanctionRequest struct {
+	UserID int                 `json:"user_id"`
+	Type   domain.SanctionType `json:"type"`
+	// DurationSeconds is required for mutes, bans without it are permanent
+	DurationSeconds int64  `json:"duration_seconds"`
+	Reason          string `json:"reason"`
+}
+
+type liftSanctionRequest struct {
+	SanctionID int `json:"sanction_id"`
+}
+
+// @Summary List, apply or lift sanctions
+// @Description GET lists sanctions of a user or the active sanctions of everyone, POST mutes, bans or kicks a user and DELETE lifts a sanction (moderators and admins only)
+// @Tags moderation
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param user_id query int false "User ID, active sanctions of everyone if omitted"
+// @Param active query bool false "Only sanctions in force"
+// @Param request body sanctionRequest false "Sanction to apply"
+// @Success 200 {array} domain.Sanction
+// @Success 201 {object} domain.Sanction
+// @Router /api/moderation/sanctions [get]
+// @Router /api/moderation/sanctions [post]
+// @Router /api/moderation/sanctions [delete]
+func (h *Handler) HandleSanctions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		targetID := 0
+		if raw := query.Get("user_id"); raw != "" {
+			id, err := strconv.Atoi(raw)
+			if err != nil || id <= 0 {
+				http.Error(w, "invalid user_id", http.StatusBadRequest)
+				return
+			}
+			targetID = id
+		}
+		activeOnly := targetID == 0 || query.Get("active") == "true"
+
+		sanctions, err := h.service.GetSanctions(userID, targetID, activeOnly)
+		if err != nil {
+			h.logger.Error("failed to get sanctions", zap.Error(err))
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+
+		json.NewEncoder(w).Encode(sanctions)
+
+	case http.MethodPost:
+		var req sanctionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID <= 0 {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		duration := time.Duration(req.DurationSeconds) * time.Second
+
+		var sanction *domain.Sanction
+		var err error
+		switch req.Type {
+		case domain.SanctionMute:
+			sanction, err = h.service.MuteUser(userID, req.UserID, duration, req.Reason, audit.SourceFromRequest(r))
+		case domain.SanctionBan:
+			sanction, err = h.service.BanUser(userID, req.UserID, duration, req.Reason, audit.SourceFromRequest(r))
+		case domain.SanctionKick:
+			sanction, err = h.service.KickUser(userID, req.UserID, req.Reason, audit.SourceFromRequest(r))
+		default:
+			http.Error(w, "invalid sanction type", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			h.logger.Error("failed to sanction user", zap.Error(err))
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(sanction)
+
+	case http.MethodDelete:
+		var req liftSanctionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.SanctionID <= 0 {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		sanction, err := h.service.LiftSanction(userID, req.SanctionID, audit.SourceFromRequest(r))
+		if err != nil {
+			h.logger.Error("failed to lift sanction", zap.Error(err))
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+
+		json.NewEncoder(w).Encode(sanction)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
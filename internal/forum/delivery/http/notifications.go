@@ -0,0 +1,80 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+type markNotificationsReadRequest struct {
+	// IDs of the notifications to mark, all when empty
+	IDs []int `json:"ids"`
+}
+
+// @Summary Get notifications
+// @Description Get notifications of the current user, newest first
+// @Tags notifications
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param unread query bool false "Only return unread notifications"
+// @Param limit query int false "Number of notifications to return"
+// @Success 200 {array} domain.Notification
+// @Router /api/notifications [get]
+func (h *Handler) GetNotifications(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	unreadOnly := r.URL.Query().Get("unread") == "true"
+	notifications, err := h.service.GetNotifications(userID, unreadOnly, queryLimit(r, 50))
+	if err != nil {
+		h.logger.Error("failed to get notifications", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(notifications)
+}
+
+// @Summary Mark notifications as read
+// @Description Mark the given notifications of the current user as read, or all of them when no ids are given
+// @Tags notifications
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param request body markNotificationsReadRequest false "Notifications to mark"
+// @Success 200 {object} map[string]int
+// @Router /api/notifications/read [post]
+func (h *Handler) MarkNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := userIDFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req markNotificationsReadRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	marked, err := h.service.MarkNotificationsRead(userID, req.IDs)
+	if err != nil {
+		h.logger.Error("failed to mark notifications as read", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]int{"marked": marked})
+}
@@ -0,0 +1,141 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+	"go.uber.org/zap"
+)
+
+type pinMessageRequest struct {
+	MessageID int `json:"message_id"`
+}
+
+// @Summary List, pin or unpin pinned messages
+// @Description GET lists pinned messages of the public chat or of a conversation, POST pins and DELETE unpins a message (moderators and admins only)
+// @Tags chat
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param conversation_id query int false "Conversation ID, the public chat if omitted"
+// @Param request body pinMessageRequest false "Message to pin or unpin"
+// @Success 200 {array} domain.PinnedMessage
+// @Success 201 {object} domain.PinnedMessage
+// @Success 204
+// @Router /api/chat/pinned [get]
+// @Router /api/chat/pinned [post]
+// @Router /api/chat/pinned [delete]
+func (h *Handler) HandlePinned(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		conversationID := domain.PublicConversationID
+		if raw := r.URL.Query().Get("conversation_id"); raw != "" {
+			id, err := strconv.Atoi(raw)
+			if err != nil || id <= 0 {
+				http.Error(w, "invalid conversation_id", http.StatusBadRequest)
+				return
+			}
+			conversationID = id
+		}
+
+		pins, err := h.service.GetPinnedMessages(userID, conversationID)
+		if err != nil {
+			h.logger.Error("failed to get pinned messages", zap.Error(err))
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+
+		json.NewEncoder(w).Encode(pins)
+
+	case http.MethodPost, http.MethodDelete:
+		var req pinMessageRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MessageID <= 0 {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if r.Method == http.MethodDelete {
+			if err := h.unpinMessage(userID, req.MessageID); err != nil {
+				h.logger.Error("failed to unpin message", zap.Error(err))
+				http.Error(w, err.Error(), errorStatus(err))
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		pin, err := h.pinMessage(userID, req.MessageID)
+		if err != nil {
+			h.logger.Error("failed to pin message", zap.Error(err))
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(pin)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// pinMessage pins the message and lets everyone who can see it know
+func (h *Handler) pinMessage(userID, messageID int) (*domain.PinnedMessage, error) {
+	pin, err := h.service.PinMessage(userID, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	recipients, err := h.conversationRecipients(userID, pin.Message.ConversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	h.sendToUsers(recipients, domain.WebsocketMessage{
+		Type: "message_pinned",
+		Payload: map[string]any{
+			"message":   messagePayload(pin.Message),
+			"pinned_by": pin.PinnedBy,
+			"pinned_at": pin.PinnedAt,
+		},
+	})
+
+	return pin, nil
+}
+
+// unpinMessage unpins the message and lets everyone who can see it know
+func (h *Handler) unpinMessage(userID, messageID int) error {
+	msg, err := h.service.UnpinMessage(userID, messageID)
+	if err != nil {
+		return err
+	}
+
+	recipients, err := h.conversationRecipients(userID, msg.ConversationID)
+	if err != nil {
+		return err
+	}
+
+	payload := map[string]any{
+		"message_id":  msg.ID,
+		"unpinned_by": userID,
+	}
+	if msg.ConversationID != domain.PublicConversationID {
+		payload["conversation_id"] = msg.ConversationID
+	}
+
+	h.sendToUsers(recipients, domain.WebsocketMessage{
+		Type:    "message_unpinned",
+		Payload: payload,
+	})
+
+	return nil
+}
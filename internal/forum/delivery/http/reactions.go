@@ -0,0 +1,83 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+	"go.uber.org/zap"
+)
+
+type toggleReactionRequest struct {
+	MessageID int    `json:"message_id"`
+	Emoji     string `json:"emoji"`
+}
+
+// @Summary Toggle a reaction
+// @Description Add the emoji reaction of the current user to a message, or remove it if already present
+// @Tags chat
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param request body toggleReactionRequest true "Reaction"
+// @Success 200 {object} domain.ReactionUpdate
+// @Router /api/chat/reactions [post]
+func (h *Handler) ToggleReaction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := userIDFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req toggleReactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MessageID <= 0 {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	update, err := h.toggleReaction(userID, req.MessageID, req.Emoji)
+	if err != nil {
+		h.logger.Error("failed to toggle reaction", zap.Error(err))
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(update)
+}
+
+// toggleReaction toggles the reaction and lets everyone who can see the
+// message know about the new counts
+func (h *Handler) toggleReaction(userID, messageID int, emoji string) (*domain.ReactionUpdate, error) {
+	update, err := h.service.ToggleReaction(userID, messageID, emoji)
+	if err != nil {
+		return nil, err
+	}
+
+	recipients, err := h.conversationRecipients(userID, update.ConversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	reactions := update.Reactions
+	if reactions == nil {
+		reactions = []*domain.Reaction{}
+	}
+
+	h.sendToUsers(recipients, domain.WebsocketMessage{
+		Type: "reaction",
+		Payload: map[string]any{
+			"message_id": update.MessageID,
+			"user_id":    update.UserID,
+			"emoji":      update.Emoji,
+			"added":      update.Added,
+			"reactions":  reactions,
+		},
+	})
+
+	return update, nil
+}
@@ -0,0 +1,239 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+	"github.com/chizheg/forum/pkg/audit"
+	"go.uber.org/zap"
+)
+
+type reportMessageRequest struct {
+	MessageID int    `json:"message_id"`
+	Reason    string `json:"reason"`
+}
+
+type resolveReportsRequest struct {
+	MessageID     int                 `json:"message_id"`
+	Status        domain.ReportStatus `json:"status"`
+	DeleteMessage bool                `json:"delete_message"`
+}
+
+// @Summary Report a message
+// @Description Flag a message for the moderators
+// @Tags chat
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param request body reportMessageRequest true "Message and reason"
+// @Success 201 {object} domain.Report
+// @Failure 409 {string} string "Message is already reported"
+// @Router /api/chat/reports [post]
+func (h *Handler) ReportMessage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := userIDFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req reportMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MessageID <= 0 {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.service.ReportMessage(userID, req.MessageID, req.Reason)
+	if err != nil {
+		h.logger.Error("failed to report message", zap.Error(err))
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(report)
+}
+
+// @Summary Get the moderation queue
+// @Description Get reported messages with their reports, most reported first (moderators and admins only)
+// @Tags moderation
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param status query string false "Report status: open (default), actioned or dismissed"
+// @Param limit query int false "Number of messages to return"
+// @Param offset query int false "Number of messages to skip"
+// @Success 200 {array} domain.ReportedMessage
+// @Router /api/moderation/reports [get]
+func (h *Handler) GetReportQueue(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := userIDFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	offset := 0
+	if raw := query.Get("offset"); raw != "" {
+		var err error
+		if offset, err = strconv.Atoi(raw); err != nil || offset < 0 {
+			http.Error(w, "invalid offset", http.StatusBadRequest)
+			return
+		}
+	}
+
+	queue, err := h.service.GetReportQueue(userID, domain.ReportStatus(query.Get("status")), queryLimit(r, 50), offset)
+	if err != nil {
+		h.logger.Error("failed to get report queue", zap.Error(err))
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(queue)
+}
+
+// @Summary Resolve reports of a message
+// @Description Action or dismiss the open reports of a message, actioned messages may be deleted (moderators and admins only)
+// @Tags moderation
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param request body resolveReportsRequest true "Resolution"
+// @Success 200 {object} map[string]int
+// @Router /api/moderation/reports/resolve [post]
+func (h *Handler) ResolveReports(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := userIDFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req resolveReportsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MessageID <= 0 {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	resolved, err := h.service.ResolveReports(userID, req.MessageID, req.Status, req.DeleteMessage, audit.SourceFromRequest(r))
+	if err != nil {
+		h.logger.Error("failed to resolve reports", zap.Error(err))
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]int{"resolved": resolved})
+}
+
+type reviewMessageRequest struct {
+	MessageID int  `json:"message_id"`
+	Approve   bool `json:"approve"`
+}
+
+// @Summary Get messages held for review
+// @Description Get messages held by the content filter, oldest first (moderators and admins only)
+// @Tags moderation
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param limit query int false "Number of messages to return"
+// @Param offset query int false "Number of messages to skip"
+// @Success 200 {array} domain.Message
+// @Router /api/moderation/pending [get]
+func (h *Handler) GetPendingMessages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := userIDFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	offset := 0
+	if raw := r.URL.Query().Get("offset"); raw != "" {
+		var err error
+		if offset, err = strconv.Atoi(raw); err != nil || offset < 0 {
+			http.Error(w, "invalid offset", http.StatusBadRequest)
+			return
+		}
+	}
+
+	messages, err := h.service.GetPendingMessages(userID, queryLimit(r, 50), offset)
+	if err != nil {
+		h.logger.Error("failed to get pending messages", zap.Error(err))
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(messages)
+}
+
+// @Summary Review a held message
+// @Description Publish or delete a message held by the content filter (moderators and admins only)
+// @Tags moderation
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param request body reviewMessageRequest true "Message and decision"
+// @Success 200 {object} domain.Message
+// @Failure 404 {string} string "Message is not pending"
+// @Router /api/moderation/pending/review [post]
+func (h *Handler) ReviewMessage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := userIDFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req reviewMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MessageID <= 0 {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	message, err := h.service.ReviewMessage(userID, req.MessageID, req.Approve, audit.SourceFromRequest(r))
+	if err != nil {
+		h.logger.Error("failed to review message", zap.Error(err))
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	if req.Approve {
+		h.broadcastMessage(domain.WebsocketMessage{
+			Type:    "message",
+			Payload: messagePayload(message),
+		})
+	} else {
+		h.sendToUsers([]int{message.UserID}, domain.WebsocketMessage{
+			Type: "message_rejected",
+			Payload: map[string]any{
+				"id": message.ID,
+			},
+		})
+	}
+
+	json.NewEncoder(w).Encode(message)
+}
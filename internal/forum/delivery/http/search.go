@@ -0,0 +1,98 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+	"go.uber.org/zap"
+)
+
+// @Summary Search chat messages
+// @Description Full-text search over the public chat and the conversations of the current user, best matches first
+// @Tags chat
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param q query string true "Search query, supports quoted phrases, OR and -word"
+// @Param author query string false "Author username"
+// @Param author_id query int false "Author ID"
+// @Param from query string false "Earliest creation time, RFC 3339 or YYYY-MM-DD"
+// @Param to query string false "Latest creation time, RFC 3339 or YYYY-MM-DD (exclusive)"
+// @Param limit query int false "Number of results to return"
+// @Param offset query int false "Number of results to skip"
+// @Success 200 {array} domain.SearchResult
+// @Router /api/chat/search [get]
+func (h *Handler) SearchMessages(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDFromContext(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := domain.SearchFilter{
+		Limit: queryLimit(r, 20),
+	}
+
+	var err error
+	if raw := query.Get("offset"); raw != "" {
+		if filter.Offset, err = strconv.Atoi(raw); err != nil || filter.Offset < 0 {
+			http.Error(w, "invalid offset", http.StatusBadRequest)
+			return
+		}
+	}
+	if raw := query.Get("author_id"); raw != "" {
+		if filter.AuthorID, err = strconv.Atoi(raw); err != nil || filter.AuthorID <= 0 {
+			http.Error(w, "invalid author_id", http.StatusBadRequest)
+			return
+		}
+	}
+	if filter.After, err = parseSearchTime(query.Get("from")); err != nil {
+		http.Error(w, "invalid from", http.StatusBadRequest)
+		return
+	}
+	if filter.Before, err = parseSearchTime(query.Get("to")); err != nil {
+		http.Error(w, "invalid to", http.StatusBadRequest)
+		return
+	}
+
+	if author := query.Get("author"); author != "" && filter.AuthorID == 0 {
+		users, err := h.users.GetUsersByUsernames([]string{author})
+		if err != nil {
+			h.logger.Error("failed to resolve author", zap.Error(err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(users) == 0 {
+			json.NewEncoder(w).Encode([]*domain.SearchResult{})
+			return
+		}
+		filter.AuthorID = users[0].ID
+	}
+
+	results, err := h.service.SearchMessages(userID, query.Get("q"), filter)
+	if err != nil {
+		h.logger.Error("failed to search messages", zap.Error(err))
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(results)
+}
+
+// parseSearchTime accepts RFC 3339 timestamps and plain dates, an empty
+// value yields the zero time
+func parseSearchTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	return time.Parse(time.DateOnly, value)
+}
@@ -0,0 +1,62 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidPassword = errors.New("invalid password")
+	// ErrReauthenticationRequired is returned for accounts without a
+	// password when the user has not signed in recently
+	ErrReauthenticationRequired = errors.New("sign in again to confirm this change")
+	// ErrDeletionHandled is returned when another instance anonymized the
+	// user of an account deletion first
+	ErrDeletionHandled = errors.New("account deletion already handled")
+)
+
+// DeletedUserID replaces the author of messages of deleted accounts
+const DeletedUserID = 0
+
+// CloseCodeAccountDeleted closes the websockets of deleted accounts
+const CloseCodeAccountDeleted = 4004
+
+// AccountDeletion signals that the auth service deleted an account and the
+// forum has to erase its data of the user
+type AccountDeletion struct {
+	ID        int64
+	UserID    int
+	DeletedAt time.Time
+}
+
+// AccountData is what the auth service keeps about a user
+type AccountData struct {
+	ID          int            `json:"id"`
+	Username    string         `json:"username"`
+	Email       string         `json:"email"`
+	Role        string         `json:"role"`
+	DisplayName string         `json:"display_name"`
+	AvatarURL   string         `json:"avatar_url,omitempty"`
+	Bio         string         `json:"bio,omitempty"`
+	Timezone    string         `json:"timezone"`
+	Sessions    []*SessionData `json:"sessions"`
+	CreatedAt   time.Time      `json:"created_at"`
+}
+
+// SessionData describes a login session without its token
+type SessionData struct {
+	ID int `json:"id"`
+	// Current is set for the session the export was requested with
+	Current   bool      `json:"current"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AccountExport is the archive of the data kept about a user
+type AccountExport struct {
+	Account *AccountData `json:"account"`
+	// Messages are all messages the user wrote, including direct messages
+	// and deleted ones still stored
+	Messages   []*Message `json:"messages"`
+	ExportedAt time.Time  `json:"exported_at"`
+}
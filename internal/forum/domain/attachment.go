@@ -0,0 +1,72 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// MaxMessageAttachments limits the number of files sent with one message
+const MaxMessageAttachments = 10
+
+var (
+	ErrAttachmentNotFound  = errors.New("attachment not found")
+	ErrInvalidAttachments  = errors.New("attachments do not exist or are already sent")
+	ErrTooManyAttachments  = errors.New("too many attachments")
+	ErrFileTooLarge        = errors.New("file is too large")
+	ErrEmptyFile           = errors.New("file is empty")
+	ErrUnsupportedFileType = errors.New("file type is not allowed")
+	ErrInvalidDownloadLink = errors.New("download link is invalid or expired")
+	ErrBlobNotFound        = errors.New("blob not found")
+)
+
+// Attachment represents a file uploaded to the chat. It is linked to a
+// message once the message is sent.
+type Attachment struct {
+	ID          int    `json:"id"`
+	UserID      int    `json:"user_id"`
+	MessageID   int    `json:"message_id,omitempty"`
+	FileName    string `json:"file_name"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	// Width and Height are set for images only
+	Width        int    `json:"width,omitempty"`
+	Height       int    `json:"height,omitempty"`
+	StorageKey   string `json:"-"`
+	ThumbnailKey string `json:"-"`
+	// URL and ThumbnailURL are signed, short-lived download links
+	URL          string    `json:"url,omitempty"`
+	ThumbnailURL string    `json:"thumbnail_url,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// BlobStore stores the contents of uploaded files
+type BlobStore interface {
+	Put(key string, r io.Reader, size int64, contentType string) error
+	// Open returns ErrBlobNotFound if there is no blob with the key
+	Open(key string) (io.ReadCloser, error)
+	Delete(key string) error
+}
+
+// AttachmentService defines the interface for uploading and downloading
+// chat attachments
+type AttachmentService interface {
+	// Upload stores the file for the user to send, it returns a
+	// *SanctionError if the user is banned or muted
+	Upload(userID int, fileName string, r io.Reader) (*Attachment, error)
+	// Open checks the signature of a download link and opens the file or
+	// its thumbnail, the returned attachment describes the opened file.
+	// Size is zero for thumbnails.
+	Open(attachmentID int, thumbnail bool, expires int64, signature string) (*Attachment, io.ReadCloser, error)
+	// MaxUploadSize returns the maximum file size in bytes
+	MaxUploadSize() int64
+	// SignURLs fills in the download links of the attachments
+	SignURLs(attachments []*Attachment)
+	// DeleteUnsent deletes the files uploaded longer than the configured
+	// time ago and never sent, it returns how many were deleted
+	DeleteUnsent() (int, error)
+	// RunUnsentCleanup calls DeleteUnsent right away and then every
+	// interval until the context is done
+	RunUnsentCleanup(ctx context.Context, interval time.Duration)
+}
@@ -0,0 +1,31 @@
+package domain
+
+import "errors"
+
+// ErrBrokerClosed is returned when publishing to a closed broker
+var ErrBrokerClosed = errors.New("broker closed")
+
+// Event represents a chat event fanned out to every forum instance
+type Event struct {
+	// UserIDs limits delivery to the given users, empty means everyone
+	UserIDs []int `json:"user_ids,omitempty"`
+	// ExceptUserID skips delivery to the given user, usually the sender
+	ExceptUserID int              `json:"except_user_id,omitempty"`
+	Message      WebsocketMessage `json:"message"`
+	// CloseCode closes the connections of the recipients after delivering
+	// the message, zero keeps them open
+	CloseCode int `json:"close_code,omitempty"`
+}
+
+// Broker defines the interface for chat pub/sub between forum instances
+type Broker interface {
+	// Publish sends the event to all subscribers, including this instance
+	Publish(event *Event) error
+	// Subscribe returns a channel of published events and a function
+	// that cancels the subscription. Rather than blocking the publisher,
+	// the channel is closed once the subscriber falls too far behind,
+	// after the events buffered so far. Subscribing to a closed broker
+	// returns a closed channel.
+	Subscribe() (<-chan *Event, func())
+	Close() error
+}
@@ -1,15 +1,57 @@
 package domain
 
 import (
+	"context"
+	"errors"
 	"time"
+
+	"github.com/chizheg/forum/pkg/audit"
+)
+
+var (
+	ErrEmptyMessage    = errors.New("message content is empty")
+	ErrMessageTooLong  = errors.New("message content is too long")
+	ErrMessageNotFound = errors.New("message not found")
+	ErrInvalidReply    = errors.New("reply target is not in this conversation")
+)
+
+// Message statuses
+const (
+	MessageActive = "active"
+	// MessagePending messages are held by the content filter and only
+	// shown once a moderator approves them
+	MessagePending = "pending"
+	MessageDeleted = "deleted"
 )
 
 // Message represents a chat message
 type Message struct {
-	ID        int       `json:"id"`
-	UserID    int       `json:"user_id"`
-	Content   string    `json:"content"`
-	CreatedAt time.Time `json:"created_at"`
+	ID     int `json:"id"`
+	UserID int `json:"user_id"`
+	// Author is only resolved for message history
+	Author *Profile `json:"author,omitempty"`
+	// ConversationID is PublicConversationID for the public chat
+	ConversationID int `json:"conversation_id,omitempty"`
+	// ReplyToID references the parent message, ReplyTo is its preview and
+	// is empty once the parent has been deleted
+	ReplyToID int             `json:"reply_to_id,omitempty"`
+	ReplyTo   *MessagePreview `json:"reply_to,omitempty"`
+	Content   string          `json:"content"`
+	// ContentHTML is Content rendered from Markdown and sanitized, it is
+	// safe to insert into a page as is
+	ContentHTML  string         `json:"content_html"`
+	Status       string         `json:"status,omitempty"`
+	Attachments  []*Attachment  `json:"attachments,omitempty"`
+	LinkPreviews []*LinkPreview `json:"link_previews,omitempty"`
+	Reactions    []*Reaction    `json:"reactions,omitempty"`
+	CreatedAt    time.Time      `json:"created_at"`
+}
+
+// MessagePreview represents a compact quote of a message
+type MessagePreview struct {
+	ID      int    `json:"id"`
+	UserID  int    `json:"user_id"`
+	Content string `json:"content"`
 }
 
 // Participant represents a chat participant
@@ -19,28 +61,158 @@ type Participant struct {
 	JoinedAt time.Time `json:"joined_at"`
 }
 
+// ReadMarker represents the last message a user has read
+type ReadMarker struct {
+	UserID            int       `json:"user_id"`
+	LastReadMessageID int       `json:"last_read_message_id"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
 // Repository defines the interface for chat data access
 type Repository interface {
+	// SaveMessage stores the message and links the attachments listed in
+	// msg.Attachments by id, it returns ErrInvalidAttachments if any of them
+	// is not an unsent upload of the author
 	SaveMessage(msg *Message) error
+	GetMessageByID(id int) (*Message, error)
+	GetMessagesByIDs(ids []int) ([]*Message, error)
+	GetReplyChain(messageID, maxDepth int) ([]*Message, error)
 	GetMessages(limit int, before time.Time) ([]*Message, error)
 	DeleteOldMessages(before time.Time) error
 	AddParticipant(userID int) error
 	RemoveParticipant(userID int) error
 	IsParticipant(userID int) (bool, error)
+	// SetLastRead moves the user's read marker forward, it reports false
+	// if the marker already pointed at or past messageID
+	SetLastRead(userID, messageID int) (bool, error)
+	CountUnread(userID int) (int, error)
+	// CreateConversation creates the conversation. A one-to-one
+	// conversation is only created once per pair of users, conv is filled
+	// with the existing one when it was created concurrently.
+	CreateConversation(conv *Conversation) error
+	GetConversation(id int) (*Conversation, error)
+	FindDirectConversation(userID, otherID int) (*Conversation, error)
+	GetConversations(userID int) ([]*Conversation, error)
+	GetConversationMessages(conversationID, limit int, before time.Time) ([]*Message, error)
+	CreateNotification(n *Notification) error
+	GetNotifications(userID int, unreadOnly bool, limit int) ([]*Notification, error)
+	// MarkNotificationsRead marks the given notifications of the user as
+	// read, or all of them when ids is empty, and returns how many changed
+	MarkNotificationsRead(userID int, ids []int) (int, error)
+	AddReaction(messageID, userID int, emoji string) (bool, error)
+	RemoveReaction(messageID, userID int, emoji string) (bool, error)
+	// GetReactions returns aggregated reactions keyed by message id
+	GetReactions(messageIDs []int) (map[int][]*Reaction, error)
+	// PinMessage pins pin.Message and fills in PinnedAt, it reports false
+	// if the message was already pinned
+	PinMessage(pin *PinnedMessage) (bool, error)
+	UnpinMessage(messageID int) (bool, error)
+	// GetPinnedMessages returns the pinned messages of a conversation,
+	// most recently pinned first
+	GetPinnedMessages(conversationID int) ([]*PinnedMessage, error)
+	// SearchMessages returns messages matching the query, best matches first
+	SearchMessages(query string, filter SearchFilter) ([]*SearchResult, error)
+	SaveAttachment(a *Attachment) error
+	GetAttachment(id int) (*Attachment, error)
+	// GetAttachments returns attachment metadata keyed by message id
+	GetAttachments(messageIDs []int) (map[int][]*Attachment, error)
+	// DeleteUnsentAttachments deletes the uploads created before the time
+	// and not sent with a message, it returns the deleted attachments
+	DeleteUnsentAttachments(before time.Time) ([]*Attachment, error)
+	GetLinkPreview(url string) (*LinkPreview, error)
+	// SaveLinkPreview creates or refreshes the cached preview of the URL
+	SaveLinkPreview(p *LinkPreview) error
+	AddMessageLinkPreviews(messageID int, urls []string) error
+	// GetLinkPreviews returns the previews keyed by message id
+	GetLinkPreviews(messageIDs []int) (map[int][]*LinkPreview, error)
+	CreateSanction(s *Sanction) error
+	GetSanction(id int) (*Sanction, error)
+	// GetSanctions returns the sanctions of the user, or of everyone when
+	// userID is zero, newest first
+	GetSanctions(userID int, activeOnly bool) ([]*Sanction, error)
+	// RevokeSanction lifts an active sanction, it reports false if the
+	// sanction had already expired or been revoked
+	RevokeSanction(id, revokedBy int) (bool, error)
+	// CreateReport stores the report, it reports false if the user has
+	// already reported the message
+	CreateReport(report *Report) (bool, error)
+	// GetReportQueue returns reported messages with reports in the given
+	// status, most reported first
+	GetReportQueue(status ReportStatus, limit, offset int) ([]*ReportedMessage, error)
+	// ResolveReports moves the open reports of the message to the status
+	// and returns how many were resolved. With deleteMessage the message is
+	// soft-deleted in the same transaction, deleted reports false if it was
+	// already deleted or no report was open.
+	ResolveReports(messageID int, status ReportStatus, resolvedBy int, deleteMessage bool) (resolved int, deleted bool, err error)
+	// GetPendingMessages returns messages held for review, oldest first
+	GetPendingMessages(limit, offset int) ([]*Message, error)
+	// ReviewMessage publishes or deletes a pending message, it returns
+	// ErrMessageNotFound if the message is not pending
+	ReviewMessage(id int, approve bool) (*Message, error)
+	// GetUserMessages returns every stored message of the user, oldest
+	// first
+	GetUserMessages(userID int) ([]*Message, error)
+	// GetAccountDeletionCursor returns the ID to fetch new account
+	// deletions after: the latest recorded more than margin before the
+	// latest deletion recorded, zero if there is none. Deletions within
+	// the margin are fetched again in case one before them committed late.
+	GetAccountDeletionCursor(margin time.Duration) (int64, error)
+	// RecordAccountDeletions stores deletions fetched from the auth service
+	// as pending, deletions already recorded are left as they are
+	RecordAccountDeletions(deletions []*AccountDeletion) error
+	// GetPendingAccountDeletions returns the recorded deletions not
+	// anonymized yet with an ID after the given one, oldest first
+	GetPendingAccountDeletions(afterID int64, limit int) ([]*AccountDeletion, error)
+	// AnonymizeUser hands the messages and attachments of the user over to
+	// DeletedUserID, removes the rest of their data and marks the deletion
+	// as handled. It returns the number of messages anonymized, or
+	// ErrDeletionHandled if the deletion was handled already.
+	AnonymizeUser(deletion *AccountDeletion) (int, error)
 }
 
 // Service defines the interface for chat business logic
 type Service interface {
-	SendMessage(userID int, content string) error
+	SendMessage(userID int, content string, replyToID int, attachmentIDs []int) (*Message, error)
 	GetMessages(limit int) ([]*Message, error)
+	GetReplyChain(userID, messageID int) ([]*Message, error)
 	DeleteOldMessages(maxAge time.Duration) error
 	JoinChat(userID int) error
 	LeaveChat(userID int) error
 	IsParticipant(userID int) (bool, error)
+	MarkRead(userID, messageID int) (bool, error)
+	GetUnreadCount(userID int) (int, error)
+	StartConversation(userID int, memberIDs []int) (*Conversation, error)
+	GetConversation(userID, conversationID int) (*Conversation, error)
+	GetConversations(userID int) ([]*Conversation, error)
+	GetConversationMessages(userID, conversationID, limit int) ([]*Message, error)
+	SendDirectMessage(userID, conversationID int, content string, replyToID int, attachmentIDs []int) (*Message, error)
+	GetNotifications(userID int, unreadOnly bool, limit int) ([]*Notification, error)
+	MarkNotificationsRead(userID int, ids []int) (int, error)
+	ToggleReaction(userID, messageID int, emoji string) (*ReactionUpdate, error)
+	PinMessage(userID, messageID int) (*PinnedMessage, error)
+	UnpinMessage(userID, messageID int) (*Message, error)
+	GetPinnedMessages(userID, conversationID int) ([]*PinnedMessage, error)
+	SearchMessages(userID int, query string, filter SearchFilter) ([]*SearchResult, error)
+	MuteUser(moderatorID, userID int, duration time.Duration, reason string, source audit.Source) (*Sanction, error)
+	BanUser(moderatorID, userID int, duration time.Duration, reason string, source audit.Source) (*Sanction, error)
+	KickUser(moderatorID, userID int, reason string, source audit.Source) (*Sanction, error)
+	LiftSanction(moderatorID, sanctionID int, source audit.Source) (*Sanction, error)
+	GetSanctions(moderatorID, userID int, activeOnly bool) ([]*Sanction, error)
+	CheckChatAccess(userID int) error
+	ReportMessage(userID, messageID int, reason string) (*Report, error)
+	GetReportQueue(moderatorID int, status ReportStatus, limit, offset int) ([]*ReportedMessage, error)
+	ResolveReports(moderatorID, messageID int, status ReportStatus, deleteMessage bool, source audit.Source) (int, error)
+	GetPendingMessages(moderatorID, limit, offset int) ([]*Message, error)
+	ReviewMessage(moderatorID, messageID int, approve bool, source audit.Source) (*Message, error)
+	GetAuditLog(adminID int, filter audit.Filter) ([]*audit.Entry, error)
+	DeleteAccount(userID int, token, password string, source audit.Source) error
+	ExportAccount(userID int, token string, source audit.Source) (*AccountExport, error)
+	SyncAccountDeletions() (int, error)
+	RunAccountDeletionSync(ctx context.Context, interval time.Duration)
 }
 
 // WebsocketMessage represents a message sent over websocket
 type WebsocketMessage struct {
-	Type    string          `json:"type"`
+	Type    string         `json:"type"`
 	Payload map[string]any `json:"payload"`
-} 
\ No newline at end of file
+}
@@ -0,0 +1,35 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+// MaxConversationMembers limits the size of group direct conversations
+const MaxConversationMembers = 10
+
+var (
+	ErrConversationNotFound  = errors.New("conversation not found")
+	ErrNotConversationMember = errors.New("not a member of the conversation")
+	ErrInvalidMembers        = errors.New("conversation needs at least one other member")
+	ErrTooManyMembers        = errors.New("too many conversation members")
+)
+
+// Conversation represents a one-to-one or small group direct conversation
+type Conversation struct {
+	ID        int       `json:"id"`
+	CreatedBy int       `json:"created_by"`
+	IsGroup   bool      `json:"is_group"`
+	MemberIDs []int     `json:"member_ids"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// HasMember reports whether the user belongs to the conversation
+func (c *Conversation) HasMember(userID int) bool {
+	for _, id := range c.MemberIDs {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,30 @@
+package domain
+
+import "errors"
+
+var ErrMessageRejected = errors.New("message was blocked by the content filter")
+
+// FilterAction is what happens to a message after filtering, stricter
+// actions have higher values
+type FilterAction int
+
+const (
+	FilterAllow FilterAction = iota
+	// FilterHold stores the message as pending until a moderator reviews it
+	FilterHold
+	FilterReject
+)
+
+// FilterResult is the verdict of a content filter
+type FilterResult struct {
+	// Content is the text to store, filters may rewrite it
+	Content string
+	Action  FilterAction
+	// Reason explains a hold or rejection
+	Reason string
+}
+
+// ContentFilter checks public chat messages before they are stored
+type ContentFilter interface {
+	Filter(userID int, content string) (*FilterResult, error)
+}
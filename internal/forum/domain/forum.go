@@ -1,19 +1,91 @@
 package domain
 
 import (
+	"context"
 	"time"
+
+	"github.com/chizheg/forum/pkg/audit"
 )
 
 // ForumService определяет расширенный интерфейс форума,
 // включающий все функции чата
 type ForumService interface {
 	// Методы чата
-	SendMessage(userID int, content string) error
+	SendMessage(userID int, content string, replyToID int, attachmentIDs []int) (*Message, error)
 	GetMessages(limit int) ([]*Message, error)
+	GetReplyChain(userID, messageID int) ([]*Message, error)
 	DeleteOldMessages(maxAge time.Duration) error
 	JoinChat(userID int) error
 	LeaveChat(userID int) error
 	IsParticipant(userID int) (bool, error)
+	MarkRead(userID, messageID int) (bool, error)
+	GetUnreadCount(userID int) (int, error)
+
+	// Личные сообщения
+	StartConversation(userID int, memberIDs []int) (*Conversation, error)
+	GetConversation(userID, conversationID int) (*Conversation, error)
+	GetConversations(userID int) ([]*Conversation, error)
+	GetConversationMessages(userID, conversationID, limit int) ([]*Message, error)
+	SendDirectMessage(userID, conversationID int, content string, replyToID int, attachmentIDs []int) (*Message, error)
+
+	// Уведомления
+	GetNotifications(userID int, unreadOnly bool, limit int) ([]*Notification, error)
+	MarkNotificationsRead(userID int, ids []int) (int, error)
+
+	// Реакции
+	ToggleReaction(userID, messageID int, emoji string) (*ReactionUpdate, error)
+
+	// Закреплённые сообщения
+	PinMessage(userID, messageID int) (*PinnedMessage, error)
+	UnpinMessage(userID, messageID int) (*Message, error)
+	GetPinnedMessages(userID, conversationID int) ([]*PinnedMessage, error)
+
+	// Поиск
+	SearchMessages(userID int, query string, filter SearchFilter) ([]*SearchResult, error)
+
+	// Модерация
+	MuteUser(moderatorID, userID int, duration time.Duration, reason string, source audit.Source) (*Sanction, error)
+	// BanUser bans the user from the chat, a zero duration bans permanently
+	BanUser(moderatorID, userID int, duration time.Duration, reason string, source audit.Source) (*Sanction, error)
+	KickUser(moderatorID, userID int, reason string, source audit.Source) (*Sanction, error)
+	LiftSanction(moderatorID, sanctionID int, source audit.Source) (*Sanction, error)
+	GetSanctions(moderatorID, userID int, activeOnly bool) ([]*Sanction, error)
+	// CheckChatAccess returns a *SanctionError if the user is banned
+	CheckChatAccess(userID int) error
+	// CheckSendAccess returns a *SanctionError if the user is banned or
+	// muted
+	CheckSendAccess(userID int) error
+
+	// Жалобы
+	ReportMessage(userID, messageID int, reason string) (*Report, error)
+	GetReportQueue(moderatorID int, status ReportStatus, limit, offset int) ([]*ReportedMessage, error)
+	// ResolveReports actions or dismisses the open reports of the message,
+	// actioned messages may be deleted at the same time
+	ResolveReports(moderatorID, messageID int, status ReportStatus, deleteMessage bool, source audit.Source) (int, error)
+
+	// Сообщения на проверке
+	GetPendingMessages(moderatorID, limit, offset int) ([]*Message, error)
+	// ReviewMessage publishes or deletes a message held by the content filter
+	ReviewMessage(moderatorID, messageID int, approve bool, source audit.Source) (*Message, error)
+
+	// Журнал аудита
+	// GetAuditLog queries the audit log of the forum, admins only
+	GetAuditLog(adminID int, filter audit.Filter) ([]*audit.Entry, error)
+
+	// Учётная запись
+	// DeleteAccount deletes the account in the auth service, token and
+	// password are those of the user
+	DeleteAccount(userID int, token, password string, source audit.Source) error
+	// ExportAccount returns the data kept about the user by both services
+	ExportAccount(userID int, token string, source audit.Source) (*AccountExport, error)
+	// SyncAccountDeletions records the accounts deleted in the auth service
+	// since the last sync, anonymizes the data of every deletion still
+	// pending and returns how many were handled. A deletion that fails is
+	// retried by the next sync.
+	SyncAccountDeletions() (int, error)
+	// RunAccountDeletionSync calls SyncAccountDeletions right away and then
+	// every interval until the context is done
+	RunAccountDeletionSync(ctx context.Context, interval time.Duration)
 
 	// Здесь могут быть добавлены дополнительные методы форума
 }
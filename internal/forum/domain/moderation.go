@@ -0,0 +1,79 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrMuted            = errors.New("you are muted in the chat")
+	ErrBanned           = errors.New("you are banned from the chat")
+	ErrSanctionNotFound = errors.New("sanction not found")
+	ErrSanctionInactive = errors.New("sanction is no longer active")
+	ErrInvalidDuration  = errors.New("invalid sanction duration")
+	ErrCannotSanction   = errors.New("this user cannot be sanctioned")
+)
+
+// SanctionType is the kind of a moderation action
+type SanctionType string
+
+const (
+	SanctionMute SanctionType = "mute"
+	SanctionBan  SanctionType = "ban"
+	// SanctionKick closes the connections of the user, it is recorded for
+	// the history and expires immediately
+	SanctionKick SanctionType = "kick"
+)
+
+// MaxMuteDuration bounds mutes, longer silencing is a ban
+const MaxMuteDuration = 30 * 24 * time.Hour
+
+// Websocket close codes sent to sanctioned users
+const (
+	CloseCodeKicked = 4001
+	CloseCodeBanned = 4003
+)
+
+// Sanction represents a moderation action against a user
+type Sanction struct {
+	ID          int          `json:"id"`
+	UserID      int          `json:"user_id"`
+	ModeratorID int          `json:"moderator_id"`
+	Type        SanctionType `json:"type"`
+	Reason      string       `json:"reason,omitempty"`
+	// ExpiresAt is nil for permanent bans
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// RevokedAt is set when a moderator lifts the sanction early
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	RevokedBy int        `json:"revoked_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Active reports whether the sanction is in force at the given time
+func (s *Sanction) Active(now time.Time) bool {
+	if s.RevokedAt != nil {
+		return false
+	}
+	return s.ExpiresAt == nil || now.Before(*s.ExpiresAt)
+}
+
+// SanctionError is returned when a sanctioned user is denied an action. It
+// matches ErrBanned or ErrMuted with errors.Is depending on the sanction.
+type SanctionError struct {
+	Sanction *Sanction
+}
+
+func (e *SanctionError) Error() string {
+	return e.err().Error()
+}
+
+func (e *SanctionError) Unwrap() error {
+	return e.err()
+}
+
+func (e *SanctionError) err() error {
+	if e.Sanction.Type == SanctionBan {
+		return ErrBanned
+	}
+	return ErrMuted
+}
@@ -0,0 +1,24 @@
+package domain
+
+import "time"
+
+// NotificationType represents why a user was notified
+type NotificationType string
+
+const (
+	NotificationMention NotificationType = "mention"
+	NotificationReply   NotificationType = "reply"
+)
+
+// Notification represents an event a user should be told about
+type Notification struct {
+	ID        int              `json:"id"`
+	UserID    int              `json:"user_id"`
+	Type      NotificationType `json:"type"`
+	ActorID   int              `json:"actor_id"`
+	MessageID int              `json:"message_id,omitempty"`
+	// ConversationID is set for notifications about direct messages
+	ConversationID int        `json:"conversation_id,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ReadAt         *time.Time `json:"read_at,omitempty"`
+}
@@ -0,0 +1,19 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrForbidden        = errors.New("insufficient permissions")
+	ErrAlreadyPinned    = errors.New("message is already pinned")
+	ErrMessageNotPinned = errors.New("message is not pinned")
+)
+
+// PinnedMessage represents a message pinned by a moderator
+type PinnedMessage struct {
+	Message  *Message  `json:"message"`
+	PinnedBy int       `json:"pinned_by"`
+	PinnedAt time.Time `json:"pinned_at"`
+}
@@ -0,0 +1,55 @@
+package domain
+
+import "time"
+
+// PresenceStatus represents whether a user is reachable in the chat
+type PresenceStatus string
+
+const (
+	PresenceOnline  PresenceStatus = "online"
+	PresenceAway    PresenceStatus = "away"
+	PresenceOffline PresenceStatus = "offline"
+)
+
+// Presence represents the aggregated status of a user across all tabs
+type Presence struct {
+	UserID   int            `json:"user_id"`
+	Username string         `json:"username,omitempty"`
+	Status   PresenceStatus `json:"status"`
+	LastSeen time.Time      `json:"last_seen"`
+}
+
+// PresenceService defines the interface for tracking connected users.
+// Each websocket connection is identified by connID; a user is online while
+// any of their connections is active, away while all of them are idle and
+// offline once the last one is gone. Methods return the new presence when
+// the aggregated status of the user changed and nil otherwise.
+type PresenceService interface {
+	Connect(userID int, connID string) (*Presence, error)
+	SetStatus(userID int, connID string, status PresenceStatus) (*Presence, error)
+	Disconnect(userID int, connID string) (*Presence, error)
+	GetStatus(userID int) (PresenceStatus, error)
+	GetOnline() ([]*Presence, error)
+}
+
+// Connection is a websocket connection of a user
+type Connection struct {
+	ID        string
+	UserID    int
+	Status    PresenceStatus
+	UpdatedAt time.Time
+}
+
+// PresenceStore keeps the status of the websocket connections, shared by
+// every instance when backed by the database. Connection IDs must be
+// unique across instances.
+type PresenceStore interface {
+	// Update passes the connections of the user, id -> status, to fn and
+	// stores the changes it makes. Updates of the same user never run
+	// concurrently.
+	Update(userID int, fn func(conns map[string]PresenceStatus)) error
+	// GetConnections returns the connections of the user, or of every
+	// user when userID is zero
+	GetConnections(userID int) ([]*Connection, error)
+	Close() error
+}
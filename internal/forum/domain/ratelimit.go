@@ -0,0 +1,45 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrRateLimited      = errors.New("sending messages too fast")
+	ErrDuplicateMessage = errors.New("message was already sent")
+)
+
+// RateLimitError is returned when a message is rejected by the flood
+// control. It matches ErrRateLimited with errors.Is, Err tells the reason.
+type RateLimitError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return e.Err
+}
+
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+// SendLimiter decides whether a user may send another message
+type SendLimiter interface {
+	// Allow records the message and returns a *RateLimitError when the
+	// user is sending too fast or repeating themselves
+	Allow(userID, conversationID int, content string) error
+}
+
+// RateLimitStore counts requests in fixed time windows, shared by every
+// instance when backed by the database
+type RateLimitStore interface {
+	// Hit counts a request of the key and returns the number of requests
+	// made in the current window and when the window ends
+	Hit(key string, window time.Duration) (count int, reset time.Time, err error)
+}
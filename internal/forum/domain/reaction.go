@@ -0,0 +1,22 @@
+package domain
+
+import "errors"
+
+var ErrInvalidEmoji = errors.New("invalid emoji")
+
+// Reaction represents the aggregated reactions of one emoji on a message
+type Reaction struct {
+	Emoji   string `json:"emoji"`
+	Count   int    `json:"count"`
+	UserIDs []int  `json:"user_ids"`
+}
+
+// ReactionUpdate represents the result of toggling a reaction
+type ReactionUpdate struct {
+	MessageID      int         `json:"message_id"`
+	ConversationID int         `json:"conversation_id,omitempty"`
+	UserID         int         `json:"user_id"`
+	Emoji          string      `json:"emoji"`
+	Added          bool        `json:"added"`
+	Reactions      []*Reaction `json:"reactions"`
+}
@@ -0,0 +1,46 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrReportNotFound      = errors.New("no open reports for this message")
+	ErrAlreadyReported     = errors.New("message is already reported")
+	ErrEmptyReportReason   = errors.New("report reason is empty")
+	ErrCannotReport        = errors.New("you cannot report your own message")
+	ErrInvalidReportStatus = errors.New("invalid report status")
+)
+
+// ReportStatus is the state of a report in the moderation queue
+type ReportStatus string
+
+const (
+	ReportOpen ReportStatus = "open"
+	// ReportActioned means a moderator agreed with the report
+	ReportActioned  ReportStatus = "actioned"
+	ReportDismissed ReportStatus = "dismissed"
+)
+
+// Report represents a user flagging a message for moderators
+type Report struct {
+	ID         int          `json:"id"`
+	MessageID  int          `json:"message_id"`
+	ReporterID int          `json:"reporter_id"`
+	Reason     string       `json:"reason"`
+	Status     ReportStatus `json:"status"`
+	ResolvedBy int          `json:"resolved_by,omitempty"`
+	ResolvedAt *time.Time   `json:"resolved_at,omitempty"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+// ReportedMessage is an entry of the moderation queue aggregating the
+// reports of a message
+type ReportedMessage struct {
+	Message     *Message  `json:"message"`
+	ReportCount int       `json:"report_count"`
+	Reasons     []string  `json:"reasons"`
+	FirstReport time.Time `json:"first_reported_at"`
+	LastReport  time.Time `json:"last_reported_at"`
+}
@@ -0,0 +1,29 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrEmptyQuery = errors.New("search query is empty")
+
+// SearchFilter narrows down a message search
+type SearchFilter struct {
+	// ViewerID limits direct messages to the conversations of this user,
+	// public messages are always searched
+	ViewerID int
+	AuthorID int
+	// After and Before bound the creation time, zero values are ignored
+	After  time.Time
+	Before time.Time
+	Limit  int
+	Offset int
+}
+
+// SearchResult represents a message matching a search query
+type SearchResult struct {
+	Message *Message `json:"message"`
+	Rank    float64  `json:"rank"`
+	// Snippet is HTML escaped, matched terms are wrapped in <mark> tags
+	Snippet string `json:"snippet"`
+}
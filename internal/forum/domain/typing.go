@@ -0,0 +1,16 @@
+package domain
+
+// PublicConversationID identifies the public chat room
+const PublicConversationID = 0
+
+// TypingService defines the interface for ephemeral typing indicators.
+// Typing state is kept in memory only and is never persisted.
+type TypingService interface {
+	// StartTyping marks the user as typing in the conversation and notifies
+	// recipients (everyone when empty) except the user. Returns false when
+	// the notification was suppressed by the rate limit.
+	StartTyping(userID, conversationID int, recipients []int) bool
+	// StopTyping clears the typing state before it expires. Returns false
+	// if the user was not typing.
+	StopTyping(userID, conversationID int) bool
+}
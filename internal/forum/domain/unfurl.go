@@ -0,0 +1,32 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrLinkPreviewNotFound = errors.New("link preview not found")
+
+// LinkPreview represents metadata of a page linked from a message
+type LinkPreview struct {
+	URL         string    `json:"url"`
+	Title       string    `json:"title,omitempty"`
+	Description string    `json:"description,omitempty"`
+	ImageURL    string    `json:"image_url,omitempty"`
+	SiteName    string    `json:"site_name,omitempty"`
+	FetchedAt   time.Time `json:"fetched_at"`
+}
+
+// Empty reports whether the page had no usable metadata. Empty previews
+// are cached too so failing links are not fetched over and over.
+func (p *LinkPreview) Empty() bool {
+	return p.Title == "" && p.Description == ""
+}
+
+// Unfurler fetches previews of the links in messages in the background and
+// publishes a message_updated event once they are ready
+type Unfurler interface {
+	// Unfurl returns immediately, recipients are the users who can see the
+	// message or nil for the public chat
+	Unfurl(msg *Message, recipients []int)
+}
@@ -0,0 +1,62 @@
+package domain
+
+import (
+	"errors"
+	"time"
+
+	"github.com/chizheg/forum/pkg/audit"
+)
+
+var ErrUserNotFound = errors.New("user not found")
+
+// User roles as defined by the auth service
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// User represents a forum user as known to the auth service
+type User struct {
+	ID        int       `json:"id"`
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// IsModerator reports whether the user may moderate the chat
+func (u *User) IsModerator() bool {
+	return u.Role == RoleModerator || u.Role == RoleAdmin
+}
+
+// IsAdmin reports whether the user may administer the forum
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+// Profile is the public display info of a user, as shown next to their
+// messages
+type Profile struct {
+	UserID      int    `json:"user_id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+}
+
+// UserRepository defines the interface for the users kept by the auth
+// service
+type UserRepository interface {
+	GetUsersByIDs(ids []int) ([]*User, error)
+	GetUsersByUsernames(usernames []string) ([]*User, error)
+	GetProfiles(ids []int) ([]*Profile, error)
+	// DeleteAccount deletes the account of the token, it returns
+	// ErrInvalidPassword if the password is wrong. Accounts without a
+	// password pass an empty one and get ErrReauthenticationRequired
+	// unless the user signed in recently. The source of the request is
+	// forwarded for the audit log of the auth service.
+	DeleteAccount(token, password string, source audit.Source) error
+	GetAccountData(token string, source audit.Source) (*AccountData, error)
+	// GetAccountDeletions returns the deletions after the given ID, oldest
+	// first
+	GetAccountDeletions(afterID int64, limit int) ([]*AccountDeletion, error)
+}
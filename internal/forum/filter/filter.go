@@ -0,0 +1,102 @@
+// Package filter implements the content filters applied to public chat
+// messages before they are stored.
+package filter
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+	"go.uber.org/zap"
+)
+
+// Reloader is implemented by filters with lists that can be reloaded at
+// runtime
+type Reloader interface {
+	Reload() error
+}
+
+// Func adapts a function to a content filter, custom rules such as holding
+// messages of new users for review are plugged in this way
+type Func func(userID int, content string) (*domain.FilterResult, error)
+
+func (f Func) Filter(userID int, content string) (*domain.FilterResult, error) {
+	return f(userID, content)
+}
+
+// Pipeline runs filters in order. Each filter sees the content rewritten by
+// the previous ones, the strictest action wins and a rejection stops the
+// pipeline.
+type Pipeline struct {
+	filters []domain.ContentFilter
+}
+
+// NewPipeline creates a pipeline of the filters
+func NewPipeline(filters ...domain.ContentFilter) *Pipeline {
+	return &Pipeline{filters: filters}
+}
+
+func (p *Pipeline) Filter(userID int, content string) (*domain.FilterResult, error) {
+	result := &domain.FilterResult{Content: content}
+
+	for _, f := range p.filters {
+		r, err := f.Filter(userID, result.Content)
+		if err != nil {
+			return nil, err
+		}
+
+		result.Content = r.Content
+		if r.Action > result.Action {
+			result.Action = r.Action
+			result.Reason = r.Reason
+		}
+		if result.Action == domain.FilterReject {
+			break
+		}
+	}
+
+	return result, nil
+}
+
+// Reload reloads the lists of every filter of the pipeline
+func (p *Pipeline) Reload() error {
+	var errs []error
+	for _, f := range p.filters {
+		if r, ok := f.(Reloader); ok {
+			if err := r.Reload(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// ReloadOnSignal reloads the filter lists whenever the process receives one
+// of the signals, usually SIGHUP. Call the returned function to stop.
+func ReloadOnSignal(r Reloader, logger *zap.Logger, signals ...os.Signal) func() {
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, signals...)
+
+	go func() {
+		for {
+			select {
+			case <-ch:
+				if err := r.Reload(); err != nil {
+					logger.Error("failed to reload content filters", zap.Error(err))
+					continue
+				}
+				logger.Info("content filters reloaded")
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
@@ -0,0 +1,104 @@
+package filter
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWordFilter(t *testing.T) {
+	f := NewWordFilter([]string{"darn", " Блин "})
+
+	result, err := f.Filter(1, "Darn it, БЛИН! darnit")
+	require.NoError(t, err)
+	assert.Equal(t, "D*** it, Б***! darnit", result.Content)
+	assert.Equal(t, domain.FilterAllow, result.Action)
+}
+
+func TestWordFilter_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "words.txt")
+	require.NoError(t, os.WriteFile(path, []byte("# comment\nheck\n\n"), 0o644))
+
+	f, err := NewWordFilterFromFile(path)
+	require.NoError(t, err)
+
+	result, _ := f.Filter(1, "heck darn")
+	assert.Equal(t, "h*** darn", result.Content)
+
+	// Test the list changes without creating a new filter
+	require.NoError(t, os.WriteFile(path, []byte("darn\n"), 0o644))
+	require.NoError(t, NewPipeline(f).Reload())
+
+	result, _ = f.Filter(1, "heck darn")
+	assert.Equal(t, "heck d***", result.Content)
+
+	// Test a missing file keeps the current list
+	require.NoError(t, os.Remove(path))
+	assert.Error(t, f.Reload())
+	result, _ = f.Filter(1, "darn")
+	assert.Equal(t, "d***", result.Content)
+}
+
+func TestLinkFilter(t *testing.T) {
+	f := &LinkFilter{MaxLinks: 2, Action: domain.FilterHold}
+
+	result, _ := f.Filter(1, "https://a.example and www.b.example")
+	assert.Equal(t, domain.FilterAllow, result.Action)
+
+	result, _ = f.Filter(1, "https://a.example http://b.example WWW.c.example")
+	assert.Equal(t, domain.FilterHold, result.Action)
+	assert.NotEmpty(t, result.Reason)
+}
+
+func TestRepeatFilter(t *testing.T) {
+	f := &RepeatFilter{MaxRepeats: 4, Action: domain.FilterReject}
+
+	result, _ := f.Filter(1, "yesss!!!! a a a a a a")
+	assert.Equal(t, domain.FilterAllow, result.Action)
+
+	result, _ = f.Filter(1, "noooooo")
+	assert.Equal(t, domain.FilterReject, result.Action)
+}
+
+func TestPipeline(t *testing.T) {
+	var calls int
+	counter := Func(func(userID int, content string) (*domain.FilterResult, error) {
+		calls++
+		return &domain.FilterResult{Content: content}, nil
+	})
+
+	p := NewPipeline(
+		NewWordFilter([]string{"darn"}),
+		&LinkFilter{MaxLinks: 0, Action: domain.FilterHold},
+		counter,
+		&RepeatFilter{MaxRepeats: 3, Action: domain.FilterReject},
+		counter,
+	)
+
+	// Test rewritten content is passed on and the strictest action wins
+	result, err := p.Filter(1, "darn https://a.example")
+	require.NoError(t, err)
+	assert.Equal(t, "d*** https://a.example", result.Content)
+	assert.Equal(t, domain.FilterHold, result.Action)
+	assert.Equal(t, 2, calls)
+
+	// Test a rejection stops the pipeline
+	calls = 0
+	result, err = p.Filter(1, "https://a.example aaaa")
+	require.NoError(t, err)
+	assert.Equal(t, domain.FilterReject, result.Action)
+	assert.Equal(t, "too many repeated characters", result.Reason)
+	assert.Equal(t, 1, calls)
+
+	// Test errors are returned
+	failing := NewPipeline(Func(func(int, string) (*domain.FilterResult, error) {
+		return nil, errors.New("boom")
+	}))
+	_, err = failing.Filter(1, "hi")
+	assert.Error(t, err)
+}
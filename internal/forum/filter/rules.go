@@ -0,0 +1,169 @@
+package filter
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"unicode"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+)
+
+// WordFilter masks listed words with asterisks keeping the first letter, so
+// masks don't start Markdown lists or rules. Words are matched whole and
+// case-insensitively in any script.
+type WordFilter struct {
+	path  string
+	words atomic.Pointer[map[string]bool]
+}
+
+// NewWordFilter creates a filter of the words
+func NewWordFilter(words []string) *WordFilter {
+	f := &WordFilter{}
+	f.SetWords(words)
+	return f
+}
+
+// NewWordFilterFromFile creates a filter of the word list file, one word
+// per line with # starting comments. Reload reads the file again.
+func NewWordFilterFromFile(path string) (*WordFilter, error) {
+	f := &WordFilter{path: path}
+	if err := f.Reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// SetWords replaces the word list, it is safe to call while filtering
+func (f *WordFilter) SetWords(words []string) {
+	set := make(map[string]bool, len(words))
+	for _, word := range words {
+		if word = strings.ToLower(strings.TrimSpace(word)); word != "" {
+			set[word] = true
+		}
+	}
+	f.words.Store(&set)
+}
+
+func (f *WordFilter) Reload() error {
+	if f.path == "" {
+		return nil
+	}
+
+	file, err := os.Open(f.path)
+	if err != nil {
+		return fmt.Errorf("error opening word list: %w", err)
+	}
+	defer file.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading word list: %w", err)
+	}
+
+	f.SetWords(words)
+	return nil
+}
+
+func (f *WordFilter) Filter(userID int, content string) (*domain.FilterResult, error) {
+	words := *f.words.Load()
+	if len(words) == 0 {
+		return &domain.FilterResult{Content: content}, nil
+	}
+
+	var b strings.Builder
+	b.Grow(len(content))
+
+	runes := []rune(content)
+	for i := 0; i < len(runes); {
+		if !isWordRune(runes[i]) {
+			b.WriteRune(runes[i])
+			i++
+			continue
+		}
+
+		j := i
+		for j < len(runes) && isWordRune(runes[j]) {
+			j++
+		}
+
+		word := string(runes[i:j])
+		if words[strings.ToLower(word)] {
+			b.WriteRune(runes[i])
+			b.WriteString(strings.Repeat("*", j-i-1))
+		} else {
+			b.WriteString(word)
+		}
+		i = j
+	}
+
+	return &domain.FilterResult{Content: b.String()}, nil
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+var linkPattern = regexp.MustCompile(`(?i)(?:https?://|www\.)\S+`)
+
+// LinkFilter applies the action to messages with more than MaxLinks links
+type LinkFilter struct {
+	MaxLinks int
+	Action   domain.FilterAction
+}
+
+func (f *LinkFilter) Filter(userID int, content string) (*domain.FilterResult, error) {
+	result := &domain.FilterResult{Content: content}
+
+	if len(linkPattern.FindAllStringIndex(content, f.MaxLinks+1)) > f.MaxLinks {
+		result.Action = f.Action
+		result.Reason = fmt.Sprintf("more than %d links", f.MaxLinks)
+	}
+
+	return result, nil
+}
+
+// RepeatFilter applies the action to messages repeating a character more
+// than MaxRepeats times in a row, whitespace aside
+type RepeatFilter struct {
+	MaxRepeats int
+	Action     domain.FilterAction
+}
+
+func (f *RepeatFilter) Filter(userID int, content string) (*domain.FilterResult, error) {
+	result := &domain.FilterResult{Content: content}
+
+	var last rune
+	run := 0
+	for _, r := range content {
+		if unicode.IsSpace(r) {
+			run = 0
+			continue
+		}
+
+		if r == last {
+			run++
+		} else {
+			last, run = r, 1
+		}
+
+		if run > f.MaxRepeats {
+			result.Action = f.Action
+			result.Reason = "too many repeated characters"
+			break
+		}
+	}
+
+	return result, nil
+}
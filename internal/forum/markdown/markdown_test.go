@@ -0,0 +1,42 @@
+package markdown
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"plain text", "hello", "<p>hello</p>"},
+		{"emphasis", "**bold** _it_ ~~gone~~", "<p><strong>bold</strong> <em>it</em> <del>gone</del></p>"},
+		{"line breaks", "one\ntwo", "<p>one<br>\ntwo</p>"},
+		{"code", "`x < y`", "<p><code>x &lt; y</code></p>"},
+		{"code block", "```go\nfmt.Println()\n```", "<pre><code class=\"language-go\">fmt.Println()\n</code></pre>"},
+		{
+			"link",
+			"[docs](https://example.com/a?b=1)",
+			`<p><a href="https://example.com/a?b=1" rel="nofollow noopener" target="_blank">docs</a></p>`,
+		},
+		{
+			"bare link",
+			"see https://example.com",
+			`<p>see <a href="https://example.com" rel="nofollow noopener" target="_blank">https://example.com</a></p>`,
+		},
+		{"raw html", "<script>alert(1)</script>", ""},
+		{"inline html", "hi <img src=x onerror=alert(1)>", "<p>hi </p>"},
+		{"javascript link", "[x](javascript:alert(1))", "<p>x</p>"},
+		{"heading is flattened", "# title", "title"},
+		{"image is dropped", "![alt](https://example.com/a.png)", "<p></p>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Render(tt.content))
+		})
+	}
+}
@@ -0,0 +1,76 @@
+// Package memory implements a presence store for a single forum instance.
+package memory
+
+import (
+	"sync"
+	"time"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+)
+
+type userConns struct {
+	conns     map[string]domain.PresenceStatus
+	updatedAt time.Time
+}
+
+type store struct {
+	mu    sync.RWMutex
+	users map[int]*userConns
+	now   func() time.Time
+}
+
+// NewStore creates an in-memory presence store. Only the connections held
+// by this instance are known.
+func NewStore() domain.PresenceStore {
+	return &store{
+		users: make(map[int]*userConns),
+		now:   time.Now,
+	}
+}
+
+func (s *store) Update(userID int, fn func(conns map[string]domain.PresenceStatus)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		u = &userConns{conns: make(map[string]domain.PresenceStatus)}
+	}
+
+	fn(u.conns)
+	u.updatedAt = s.now()
+
+	if len(u.conns) == 0 {
+		delete(s.users, userID)
+	} else {
+		s.users[userID] = u
+	}
+
+	return nil
+}
+
+func (s *store) GetConnections(userID int) ([]*domain.Connection, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	conns := []*domain.Connection{}
+	for id, u := range s.users {
+		if userID != 0 && id != userID {
+			continue
+		}
+		for connID, status := range u.conns {
+			conns = append(conns, &domain.Connection{
+				ID:        connID,
+				UserID:    id,
+				Status:    status,
+				UpdatedAt: u.updatedAt,
+			})
+		}
+	}
+
+	return conns, nil
+}
+
+func (s *store) Close() error {
+	return nil
+}
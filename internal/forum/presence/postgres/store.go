@@ -0,0 +1,190 @@
+// Package postgres implements a presence store shared by every forum
+// instance through PostgreSQL.
+package postgres
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+	"go.uber.org/zap"
+)
+
+const (
+	heartbeatInterval = 30 * time.Second
+	// staleAfter is how long the connections of an instance are kept
+	// without a heartbeat, e.g. after a crash
+	staleAfter = 3 * heartbeatInterval
+)
+
+type store struct {
+	db         *sql.DB
+	instanceID string
+	logger     *zap.Logger
+	done       chan struct{}
+	closeOnce  sync.Once
+}
+
+// NewStore creates a presence store backed by the chat_connections table
+// and starts refreshing the connections of this instance
+func NewStore(db *sql.DB, logger *zap.Logger) (domain.PresenceStore, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("error generating instance id: %w", err)
+	}
+
+	s := &store{
+		db:         db,
+		instanceID: hex.EncodeToString(b),
+		logger:     logger,
+		done:       make(chan struct{}),
+	}
+
+	go s.run()
+
+	return s, nil
+}
+
+func (s *store) Update(userID int, fn func(conns map[string]domain.PresenceStatus)) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Rows can't be locked before they exist, the lock serializes the
+	// updates of the user instead
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext('chat_connections'), $1)`, userID); err != nil {
+		return fmt.Errorf("error locking connections: %w", err)
+	}
+
+	rows, err := tx.Query(`
+		SELECT id, status
+		FROM chat_connections
+		WHERE user_id = $1 AND seen_at > now() - $2 * interval '1 second'`,
+		userID, staleAfter.Seconds(),
+	)
+	if err != nil {
+		return fmt.Errorf("error getting connections: %w", err)
+	}
+
+	before := make(map[string]domain.PresenceStatus)
+	for rows.Next() {
+		var id string
+		var status domain.PresenceStatus
+		if err := rows.Scan(&id, &status); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning connection: %w", err)
+		}
+		before[id] = status
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error getting connections: %w", err)
+	}
+
+	conns := make(map[string]domain.PresenceStatus, len(before))
+	for id, status := range before {
+		conns[id] = status
+	}
+	fn(conns)
+
+	for id := range before {
+		if _, ok := conns[id]; ok {
+			continue
+		}
+		if _, err := tx.Exec(`DELETE FROM chat_connections WHERE id = $1`, id); err != nil {
+			return fmt.Errorf("error deleting connection: %w", err)
+		}
+	}
+
+	for id, status := range conns {
+		if old, ok := before[id]; ok && old == status {
+			continue
+		}
+		query := `
+			INSERT INTO chat_connections (id, user_id, instance_id, status)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (id) DO UPDATE SET status = EXCLUDED.status, seen_at = now()`
+		if _, err := tx.Exec(query, id, userID, s.instanceID, status); err != nil {
+			return fmt.Errorf("error storing connection: %w", err)
+		}
+	}
+
+	if _, err := tx.Exec(`UPDATE chat_connections SET updated_at = now() WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("error updating connections: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (s *store) GetConnections(userID int) ([]*domain.Connection, error) {
+	query := `
+		SELECT id, user_id, status, updated_at
+		FROM chat_connections
+		WHERE ($1 = 0 OR user_id = $1) AND seen_at > now() - $2 * interval '1 second'
+		ORDER BY user_id, id`
+
+	rows, err := s.db.Query(query, userID, staleAfter.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("error getting connections: %w", err)
+	}
+	defer rows.Close()
+
+	conns := []*domain.Connection{}
+	for rows.Next() {
+		conn := &domain.Connection{}
+		if err := rows.Scan(&conn.ID, &conn.UserID, &conn.Status, &conn.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning connection: %w", err)
+		}
+		conns = append(conns, conn)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error getting connections: %w", err)
+	}
+
+	return conns, nil
+}
+
+// Close stops refreshing the connections of this instance and removes them
+func (s *store) Close() error {
+	s.closeOnce.Do(func() { close(s.done) })
+
+	if _, err := s.db.Exec(`DELETE FROM chat_connections WHERE instance_id = $1`, s.instanceID); err != nil {
+		return fmt.Errorf("error deleting connections: %w", err)
+	}
+
+	return nil
+}
+
+// run keeps the connections of this instance alive and removes the ones
+// of instances gone without closing the store
+func (s *store) run() {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := s.db.Exec(`UPDATE chat_connections SET seen_at = now() WHERE instance_id = $1`, s.instanceID); err != nil {
+				s.logger.Error("failed to refresh connections", zap.Error(err))
+			}
+
+			query := `DELETE FROM chat_connections WHERE seen_at < now() - $1 * interval '1 second'`
+			if _, err := s.db.Exec(query, staleAfter.Seconds()); err != nil {
+				s.logger.Error("failed to delete stale connections", zap.Error(err))
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
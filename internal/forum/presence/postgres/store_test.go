@@ -0,0 +1,71 @@
+package postgres
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// testDB returns the migrated database given by FORUM_TEST_DATABASE_URL
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	connStr := os.Getenv("FORUM_TEST_DATABASE_URL")
+	if connStr == "" {
+		t.Skip("FORUM_TEST_DATABASE_URL not set")
+	}
+
+	db, err := sql.Open("postgres", connStr)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func TestStore_SharedBetweenInstances(t *testing.T) {
+	db := testDB(t)
+	const userID = 1_000_001
+
+	first, err := NewStore(db, zap.NewNop())
+	require.NoError(t, err)
+	defer first.Close()
+	second, err := NewStore(db, zap.NewNop())
+	require.NoError(t, err)
+	defer second.Close()
+
+	require.NoError(t, first.Update(userID, func(conns map[string]domain.PresenceStatus) {
+		assert.Empty(t, conns)
+		conns["first-tab"] = domain.PresenceOnline
+	}))
+	require.NoError(t, second.Update(userID, func(conns map[string]domain.PresenceStatus) {
+		assert.Equal(t, map[string]domain.PresenceStatus{"first-tab": domain.PresenceOnline}, conns)
+		conns["second-tab"] = domain.PresenceAway
+	}))
+
+	conns, err := first.GetConnections(userID)
+	require.NoError(t, err)
+	require.Len(t, conns, 2)
+	assert.Equal(t, "first-tab", conns[0].ID)
+	assert.Equal(t, domain.PresenceOnline, conns[0].Status)
+	assert.Equal(t, "second-tab", conns[1].ID)
+	assert.Equal(t, domain.PresenceAway, conns[1].Status)
+
+	// Test closing a store removes the connections of its instance
+	require.NoError(t, first.Close())
+	conns, err = second.GetConnections(userID)
+	require.NoError(t, err)
+	require.Len(t, conns, 1)
+	assert.Equal(t, "second-tab", conns[0].ID)
+
+	require.NoError(t, second.Update(userID, func(conns map[string]domain.PresenceStatus) {
+		delete(conns, "second-tab")
+	}))
+	conns, err = second.GetConnections(userID)
+	require.NoError(t, err)
+	assert.Empty(t, conns)
+}
@@ -0,0 +1,65 @@
+// Package memory implements a rate limit store for a single forum instance.
+package memory
+
+import (
+	"sync"
+	"time"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+)
+
+const sweepInterval = time.Minute
+
+type counter struct {
+	count int
+	reset time.Time
+}
+
+type store struct {
+	mu        sync.Mutex
+	counters  map[string]*counter
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewStore creates an in-memory rate limit store. Counters are not shared
+// between instances, so the limits apply to each instance separately.
+func NewStore() domain.RateLimitStore {
+	return &store{
+		counters: make(map[string]*counter),
+		now:      time.Now,
+	}
+}
+
+func (s *store) Hit(key string, window time.Duration) (int, time.Time, error) {
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+
+	c, ok := s.counters[key]
+	if !ok || !now.Before(c.reset) {
+		c = &counter{reset: now.Truncate(window).Add(window)}
+		s.counters[key] = c
+	}
+	c.count++
+
+	return c.count, c.reset, nil
+}
+
+// sweep drops the counters of finished windows. Must be called with the
+// lock held.
+func (s *store) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+
+	for key, c := range s.counters {
+		if !now.Before(c.reset) {
+			delete(s.counters, key)
+		}
+	}
+}
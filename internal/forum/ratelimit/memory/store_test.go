@@ -0,0 +1,39 @@
+package memory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_Hit(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 30, 0, time.UTC)
+	s := NewStore().(*store)
+	s.now = func() time.Time { return now }
+
+	// Test requests are counted per key within the window
+	for i := 1; i <= 3; i++ {
+		count, reset, err := s.Hit("user:1", time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, i, count)
+		assert.Equal(t, time.Date(2024, 1, 1, 12, 1, 0, 0, time.UTC), reset)
+	}
+
+	count, _, err := s.Hit("user:2", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	// Test the counter starts over in the next window
+	now = now.Add(30 * time.Second)
+	count, reset, err := s.Hit("user:1", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, time.Date(2024, 1, 1, 12, 2, 0, 0, time.UTC), reset)
+
+	// Test finished windows are swept
+	now = now.Add(2 * time.Minute)
+	s.Hit("user:3", time.Minute)
+	assert.Len(t, s.counters, 1)
+}
@@ -0,0 +1,76 @@
+// Package postgres implements a rate limit store shared by every forum
+// instance through PostgreSQL.
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+	"go.uber.org/zap"
+)
+
+const (
+	cleanupInterval = 5 * time.Minute
+	// maxWindow bounds the windows removed by the cleanup, counters of
+	// longer windows are reset early
+	maxWindow = time.Hour
+)
+
+type store struct {
+	db          *sql.DB
+	lastCleanup atomic.Int64
+	logger      *zap.Logger
+}
+
+// NewStore creates a rate limit store backed by the rate_limits table.
+// Windows are aligned on the database clock so instances agree on them.
+func NewStore(db *sql.DB, logger *zap.Logger) domain.RateLimitStore {
+	return &store{
+		db:     db,
+		logger: logger,
+	}
+}
+
+func (s *store) Hit(key string, window time.Duration) (int, time.Time, error) {
+	query := `
+		INSERT INTO rate_limits (key, window_start, count)
+		VALUES ($1, to_timestamp(floor(extract(epoch FROM now()) / $2) * $2), 1)
+		ON CONFLICT (key) DO UPDATE SET
+			count = CASE
+				WHEN rate_limits.window_start = EXCLUDED.window_start THEN rate_limits.count + 1
+				ELSE 1
+			END,
+			window_start = EXCLUDED.window_start
+		RETURNING count, window_start`
+
+	var count int
+	var windowStart time.Time
+	err := s.db.QueryRow(query, key, window.Seconds()).Scan(&count, &windowStart)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("error counting request: %w", err)
+	}
+
+	s.maybeCleanup()
+
+	return count, windowStart.Add(window), nil
+}
+
+// maybeCleanup removes the counters of clients gone for a while in the
+// background, at most once per cleanup interval per instance
+func (s *store) maybeCleanup() {
+	now := time.Now().Unix()
+	last := s.lastCleanup.Load()
+	if now-last < int64(cleanupInterval.Seconds()) || !s.lastCleanup.CompareAndSwap(last, now) {
+		return
+	}
+
+	go func() {
+		query := `DELETE FROM rate_limits WHERE window_start < now() - $1 * interval '1 second'`
+		if _, err := s.db.Exec(query, maxWindow.Seconds()); err != nil {
+			s.logger.Error("failed to clean up rate limits", zap.Error(err))
+		}
+	}()
+}
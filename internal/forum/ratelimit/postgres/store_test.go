@@ -0,0 +1,100 @@
+package postgres
+
+import (
+	"database/sql"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// testDB returns the migrated database given by FORUM_TEST_DATABASE_URL
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	connStr := os.Getenv("FORUM_TEST_DATABASE_URL")
+	if connStr == "" {
+		t.Skip("FORUM_TEST_DATABASE_URL not set")
+	}
+
+	db, err := sql.Open("postgres", connStr)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+// testKey returns a key no other test run uses
+func testKey(t *testing.T, db *sql.DB) string {
+	key := t.Name() + ":" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM rate_limits WHERE key = $1`, key)
+	})
+	return key
+}
+
+func TestStore_Hit(t *testing.T) {
+	db := testDB(t)
+	s := NewStore(db, zap.NewNop())
+	key := testKey(t, db)
+
+	count, reset, err := s.Hit(key, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.True(t, reset.After(time.Now()))
+	assert.True(t, reset.Before(time.Now().Add(time.Hour+time.Minute)))
+
+	count, secondReset, err := s.Hit(key, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.True(t, reset.Equal(secondReset))
+
+	// Test other keys are counted separately
+	count, _, err = s.Hit(testKey(t, db), time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestStore_HitNewWindow(t *testing.T) {
+	db := testDB(t)
+	s := NewStore(db, zap.NewNop())
+	key := testKey(t, db)
+
+	_, _, err := s.Hit(key, time.Hour)
+	require.NoError(t, err)
+
+	// Test the counter restarts once the window is over
+	_, err = db.Exec(`UPDATE rate_limits SET window_start = window_start - interval '2 hours' WHERE key = $1`, key)
+	require.NoError(t, err)
+
+	count, _, err := s.Hit(key, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestStore_HitConcurrent(t *testing.T) {
+	db := testDB(t)
+	s := NewStore(db, zap.NewNop())
+	key := testKey(t, db)
+
+	// Test concurrent hits from several instances are all counted
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := s.Hit(key, time.Hour)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	count, _, err := s.Hit(key, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 21, count)
+}
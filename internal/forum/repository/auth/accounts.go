@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+	"github.com/chizheg/forum/pkg/audit"
+	"github.com/chizheg/forum/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (r *userRepository) DeleteAccount(token, password string, source audit.Source) error {
+	ctx, cancel := context.WithTimeout(withSource(context.Background(), source), requestTimeout)
+	defer cancel()
+
+	resp, err := r.authClient.DeleteAccount(ctx, &proto.DeleteAccountRequest{
+		Token:    token,
+		Password: password,
+	})
+	// The token was just validated, so the password is what was rejected
+	if status.Code(err) == codes.Unauthenticated {
+		return domain.ErrInvalidPassword
+	}
+	if status.Code(err) == codes.FailedPrecondition {
+		return domain.ErrReauthenticationRequired
+	}
+	if err != nil {
+		return fmt.Errorf("error deleting account: %w", err)
+	}
+
+	if resp.Error != "" {
+		return errors.New(resp.Error)
+	}
+
+	return nil
+}
+
+func (r *userRepository) GetAccountData(token string, source audit.Source) (*domain.AccountData, error) {
+	ctx, cancel := context.WithTimeout(withSource(context.Background(), source), requestTimeout)
+	defer cancel()
+
+	resp, err := r.authClient.ExportAccount(ctx, &proto.ExportAccountRequest{Token: token})
+	if err != nil {
+		return nil, fmt.Errorf("error exporting account: %w", err)
+	}
+
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+
+	data := &domain.AccountData{
+		ID:        int(resp.User.GetId()),
+		Username:  resp.User.GetUsername(),
+		Email:     resp.User.GetEmail(),
+		Role:      resp.User.GetRole(),
+		Sessions:  make([]*domain.SessionData, 0, len(resp.Sessions)),
+		CreatedAt: time.Unix(resp.User.GetCreatedAt(), 0),
+	}
+	if p := resp.Profile; p != nil {
+		data.DisplayName = p.DisplayName
+		data.AvatarURL = p.AvatarUrl
+		data.Bio = p.Bio
+		data.Timezone = p.Timezone
+	}
+	for _, s := range resp.Sessions {
+		data.Sessions = append(data.Sessions, &domain.SessionData{
+			ID:        int(s.Id),
+			Current:   s.Current,
+			ExpiresAt: time.Unix(s.ExpiresAt, 0),
+			CreatedAt: time.Unix(s.CreatedAt, 0),
+		})
+	}
+
+	return data, nil
+}
+
+func (r *userRepository) GetAccountDeletions(afterID int64, limit int) ([]*domain.AccountDeletion, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	resp, err := r.authClient.GetAccountDeletions(ctx, &proto.GetAccountDeletionsRequest{
+		AfterId: afterID,
+		Limit:   int32(limit),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting account deletions: %w", err)
+	}
+
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+
+	deletions := make([]*domain.AccountDeletion, 0, len(resp.Deletions))
+	for _, d := range resp.Deletions {
+		deletions = append(deletions, &domain.AccountDeletion{
+			ID:        d.Id,
+			UserID:    int(d.UserId),
+			DeletedAt: time.Unix(d.DeletedAt, 0),
+		})
+	}
+
+	return deletions, nil
+}
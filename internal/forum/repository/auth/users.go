@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+	"github.com/chizheg/forum/pkg/audit"
+	"github.com/chizheg/forum/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const requestTimeout = 5 * time.Second
+
+type userRepository struct {
+	authClient proto.AuthServiceClient
+}
+
+// NewUserRepository creates a user repository backed by the auth service
+func NewUserRepository(authConn *grpc.ClientConn) domain.UserRepository {
+	return &userRepository{
+		authClient: proto.NewAuthServiceClient(authConn),
+	}
+}
+
+// withSource forwards the address and user agent of the client the request
+// is made for, the auth service records them in its audit log when the
+// forum is one of its trusted peers
+func withSource(ctx context.Context, source audit.Source) context.Context {
+	if source.IP != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "x-forwarded-for", source.IP)
+	}
+	if source.UserAgent != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "x-forwarded-user-agent", source.UserAgent)
+	}
+	return ctx
+}
+
+func (r *userRepository) GetUsersByIDs(ids []int) ([]*domain.User, error) {
+	if len(ids) == 0 {
+		return []*domain.User{}, nil
+	}
+
+	req := &proto.GetUsersRequest{
+		UserIds: make([]int32, len(ids)),
+	}
+	for i, id := range ids {
+		req.UserIds[i] = int32(id)
+	}
+
+	return r.getUsers(req)
+}
+
+func (r *userRepository) GetUsersByUsernames(usernames []string) ([]*domain.User, error) {
+	if len(usernames) == 0 {
+		return []*domain.User{}, nil
+	}
+
+	return r.getUsers(&proto.GetUsersRequest{Usernames: usernames})
+}
+
+func (r *userRepository) getUsers(req *proto.GetUsersRequest) ([]*domain.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	resp, err := r.authClient.GetUsers(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("error getting users: %w", err)
+	}
+
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+
+	users := make([]*domain.User, 0, len(resp.Users))
+	for _, u := range resp.Users {
+		users = append(users, &domain.User{
+			ID:        int(u.Id),
+			Username:  u.Username,
+			Role:      u.Role,
+			CreatedAt: time.Unix(u.CreatedAt, 0),
+		})
+	}
+
+	return users, nil
+}
+
+func (r *userRepository) GetProfiles(ids []int) ([]*domain.Profile, error) {
+	if len(ids) == 0 {
+		return []*domain.Profile{}, nil
+	}
+
+	req := &proto.GetProfilesBatchRequest{
+		UserIds: make([]int32, len(ids)),
+	}
+	for i, id := range ids {
+		req.UserIds[i] = int32(id)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	resp, err := r.authClient.GetProfilesBatch(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("error getting profiles: %w", err)
+	}
+
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+
+	profiles := make([]*domain.Profile, 0, len(resp.Profiles))
+	for _, p := range resp.Profiles {
+		profiles = append(profiles, &domain.Profile{
+			UserID:      int(p.UserId),
+			Username:    p.Username,
+			DisplayName: p.DisplayName,
+			AvatarURL:   p.AvatarUrl,
+		})
+	}
+
+	return profiles, nil
+}
@@ -0,0 +1,22 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/chizheg/forum/pkg/audit"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestWithSource(t *testing.T) {
+	ctx := withSource(context.Background(), audit.Source{IP: "203.0.113.7", UserAgent: "Firefox"})
+	md, ok := metadata.FromOutgoingContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"203.0.113.7"}, md.Get("x-forwarded-for"))
+	assert.Equal(t, []string{"Firefox"}, md.Get("x-forwarded-user-agent"))
+
+	// Test nothing is forwarded for an unknown source
+	_, ok = metadata.FromOutgoingContext(withSource(context.Background(), audit.Source{}))
+	assert.False(t, ok)
+}
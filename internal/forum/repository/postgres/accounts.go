@@ -0,0 +1,172 @@
+package postgres
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+	"github.com/lib/pq"
+)
+
+func (r *repository) GetUserMessages(userID int) ([]*domain.Message, error) {
+	query := `
+		SELECT id, user_id, conversation_id, reply_to_id, content, created_at, status
+		FROM chat_messages
+		WHERE user_id = $1
+		ORDER BY created_at, id`
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting messages: %w", err)
+	}
+	defer rows.Close()
+
+	messages := []*domain.Message{}
+	for rows.Next() {
+		var status string
+		msg, err := scanMessage(rows, &status)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning message: %w", err)
+		}
+		msg.Status = status
+		messages = append(messages, msg)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error getting messages: %w", err)
+	}
+
+	return messages, nil
+}
+
+func (r *repository) GetAccountDeletionCursor(margin time.Duration) (int64, error) {
+	// Deletions recorded before deleted_at was kept count as old
+	query := `
+		SELECT COALESCE(MAX(id), 0)
+		FROM account_deletions
+		WHERE deleted_at IS NULL
+			OR deleted_at < (SELECT MAX(deleted_at) FROM account_deletions) - $1 * interval '1 second'`
+
+	var id int64
+	if err := r.db.QueryRow(query, margin.Seconds()).Scan(&id); err != nil {
+		return 0, fmt.Errorf("error getting account deletion cursor: %w", err)
+	}
+
+	return id, nil
+}
+
+func (r *repository) RecordAccountDeletions(deletions []*domain.AccountDeletion) error {
+	ids := make([]int64, 0, len(deletions))
+	userIDs := make([]int, 0, len(deletions))
+	deletedAt := make([]time.Time, 0, len(deletions))
+	for _, deletion := range deletions {
+		ids = append(ids, deletion.ID)
+		userIDs = append(userIDs, deletion.UserID)
+		deletedAt = append(deletedAt, deletion.DeletedAt)
+	}
+
+	query := `
+		INSERT INTO account_deletions (id, user_id, deleted_at)
+		SELECT unnest($1::bigint[]), unnest($2::integer[]), unnest($3::timestamptz[])
+		ON CONFLICT (id) DO NOTHING`
+
+	if _, err := r.db.Exec(query, pq.Array(ids), pq.Array(userIDs), pq.Array(deletedAt)); err != nil {
+		return fmt.Errorf("error recording account deletions: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) GetPendingAccountDeletions(afterID int64, limit int) ([]*domain.AccountDeletion, error) {
+	query := `
+		SELECT id, user_id
+		FROM account_deletions
+		WHERE anonymized_at IS NULL AND id > $1
+		ORDER BY id
+		LIMIT $2`
+
+	rows, err := r.db.Query(query, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error getting pending account deletions: %w", err)
+	}
+	defer rows.Close()
+
+	deletions := []*domain.AccountDeletion{}
+	for rows.Next() {
+		deletion := &domain.AccountDeletion{}
+		if err := rows.Scan(&deletion.ID, &deletion.UserID); err != nil {
+			return nil, fmt.Errorf("error scanning account deletion: %w", err)
+		}
+		deletions = append(deletions, deletion)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error getting pending account deletions: %w", err)
+	}
+
+	return deletions, nil
+}
+
+func (r *repository) AnonymizeUser(deletion *domain.AccountDeletion) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Marking the deletion first locks its row, an instance handling the
+	// same deletion waits for this transaction and then finds it handled
+	result, err := tx.Exec(`
+		UPDATE account_deletions
+		SET anonymized_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND anonymized_at IS NULL`,
+		deletion.ID)
+	if err != nil {
+		return 0, fmt.Errorf("error marking account deletion: %w", err)
+	}
+	marked, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if marked == 0 {
+		return 0, domain.ErrDeletionHandled
+	}
+
+	// Messages stay in place so conversations keep making sense
+	result, err = tx.Exec(`UPDATE chat_messages SET user_id = $2 WHERE user_id = $1`,
+		deletion.UserID, domain.DeletedUserID)
+	if err != nil {
+		return 0, fmt.Errorf("error anonymizing messages: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error getting rows affected: %w", err)
+	}
+
+	for _, query := range []string{
+		`UPDATE message_attachments SET user_id = $2 WHERE user_id = $1`,
+		`UPDATE notifications SET actor_id = $2 WHERE actor_id = $1`,
+	} {
+		if _, err := tx.Exec(query, deletion.UserID, domain.DeletedUserID); err != nil {
+			return 0, fmt.Errorf("error anonymizing user: %w", err)
+		}
+	}
+
+	for _, table := range []string{
+		"message_reactions",
+		"notifications",
+		"chat_participants",
+		"chat_read_markers",
+		"conversation_members",
+	} {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE user_id = $1`, deletion.UserID); err != nil {
+			return 0, fmt.Errorf("error deleting %s: %w", table, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return int(n), nil
+}
@@ -0,0 +1,72 @@
+package postgres
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testDB returns the migrated database given by FORUM_TEST_DATABASE_URL
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	connStr := os.Getenv("FORUM_TEST_DATABASE_URL")
+	if connStr == "" {
+		t.Skip("FORUM_TEST_DATABASE_URL not set")
+	}
+
+	db, err := sql.Open("postgres", connStr)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func TestRepository_AccountDeletionCommittedLate(t *testing.T) {
+	db := testDB(t)
+	repo := NewRepository(db)
+
+	// IDs and times after any other deletion in the database
+	base := time.Now().UnixNano()
+	deletedAt := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM account_deletions WHERE id BETWEEN $1 AND $2`, base, base+10)
+	})
+
+	first := &domain.AccountDeletion{ID: base + 1, UserID: 1, DeletedAt: deletedAt}
+	// Deletion 3 commits in the auth service while 2 is still in flight
+	synced := &domain.AccountDeletion{ID: base + 3, UserID: 3, DeletedAt: deletedAt.Add(time.Hour)}
+	require.NoError(t, repo.RecordAccountDeletions([]*domain.AccountDeletion{first, synced}))
+
+	cursor, err := repo.GetAccountDeletionCursor(10 * time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, cursor)
+
+	// Test the late deletion is recorded when fetched again with the
+	// deletions after the cursor
+	late := &domain.AccountDeletion{ID: base + 2, UserID: 2, DeletedAt: synced.DeletedAt.Add(-time.Second)}
+	require.NoError(t, repo.RecordAccountDeletions([]*domain.AccountDeletion{late, synced}))
+
+	pending, err := repo.GetPendingAccountDeletions(base, 10)
+	require.NoError(t, err)
+	var ids []int64
+	for _, deletion := range pending {
+		ids = append(ids, deletion.ID)
+	}
+	assert.Equal(t, []int64{first.ID, late.ID, synced.ID}, ids)
+
+	// Test a deletion is only anonymized once
+	_, err = repo.AnonymizeUser(late)
+	require.NoError(t, err)
+	_, err = repo.AnonymizeUser(late)
+	assert.ErrorIs(t, err, domain.ErrDeletionHandled)
+
+	cursor, err = repo.GetAccountDeletionCursor(10 * time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, cursor)
+}
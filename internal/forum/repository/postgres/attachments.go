@@ -0,0 +1,177 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+	"github.com/lib/pq"
+)
+
+const attachmentColumns = `id, message_id, user_id, file_name, content_type, size,
+	width, height, storage_key, thumbnail_key, created_at`
+
+func (r *repository) SaveAttachment(a *domain.Attachment) error {
+	query := `
+		INSERT INTO message_attachments
+			(user_id, file_name, content_type, size, width, height, storage_key, thumbnail_key)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at`
+
+	err := r.db.QueryRow(
+		query,
+		a.UserID,
+		a.FileName,
+		a.ContentType,
+		a.Size,
+		nullableID(a.Width),
+		nullableID(a.Height),
+		a.StorageKey,
+		sql.NullString{String: a.ThumbnailKey, Valid: a.ThumbnailKey != ""},
+	).Scan(&a.ID, &a.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("error saving attachment: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) GetAttachment(id int) (*domain.Attachment, error) {
+	query := `SELECT ` + attachmentColumns + ` FROM message_attachments WHERE id = $1`
+
+	a, err := scanAttachment(r.db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrAttachmentNotFound
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error getting attachment: %w", err)
+	}
+
+	return a, nil
+}
+
+func (r *repository) GetAttachments(messageIDs []int) (map[int][]*domain.Attachment, error) {
+	attachments := make(map[int][]*domain.Attachment)
+	if len(messageIDs) == 0 {
+		return attachments, nil
+	}
+
+	query := `
+		SELECT ` + attachmentColumns + `
+		FROM message_attachments
+		WHERE message_id = ANY($1)
+		ORDER BY message_id, id`
+
+	rows, err := r.db.Query(query, pq.Array(messageIDs))
+	if err != nil {
+		return nil, fmt.Errorf("error getting attachments: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning attachment: %w", err)
+		}
+		attachments[a.MessageID] = append(attachments[a.MessageID], a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error getting attachments: %w", err)
+	}
+
+	return attachments, nil
+}
+
+func (r *repository) DeleteUnsentAttachments(before time.Time) ([]*domain.Attachment, error) {
+	// Uploads linked to a message meanwhile no longer match and are kept
+	query := `
+		DELETE FROM message_attachments
+		WHERE message_id IS NULL AND created_at < $1
+		RETURNING ` + attachmentColumns
+
+	rows, err := r.db.Query(query, before)
+	if err != nil {
+		return nil, fmt.Errorf("error deleting unsent attachments: %w", err)
+	}
+	defer rows.Close()
+
+	var attachments []*domain.Attachment
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning attachment: %w", err)
+		}
+		attachments = append(attachments, a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error deleting unsent attachments: %w", err)
+	}
+
+	return attachments, nil
+}
+
+// linkAttachments attaches the uploads listed in msg.Attachments to the
+// message, all of them must be unsent uploads of the author
+func linkAttachments(tx *sql.Tx, msg *domain.Message) error {
+	if len(msg.Attachments) == 0 {
+		return nil
+	}
+
+	ids := make([]int, len(msg.Attachments))
+	for i, a := range msg.Attachments {
+		ids[i] = a.ID
+	}
+
+	query := `
+		UPDATE message_attachments
+		SET message_id = $1
+		WHERE id = ANY($2) AND user_id = $3 AND message_id IS NULL`
+
+	result, err := tx.Exec(query, msg.ID, pq.Array(ids), msg.UserID)
+	if err != nil {
+		return fmt.Errorf("error linking attachments: %w", err)
+	}
+
+	linked, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error linking attachments: %w", err)
+	}
+	if int(linked) != len(ids) {
+		return domain.ErrInvalidAttachments
+	}
+
+	return nil
+}
+
+func scanAttachment(row scanner) (*domain.Attachment, error) {
+	a := &domain.Attachment{}
+	var messageID, width, height sql.NullInt64
+	var thumbnailKey sql.NullString
+
+	err := row.Scan(
+		&a.ID,
+		&messageID,
+		&a.UserID,
+		&a.FileName,
+		&a.ContentType,
+		&a.Size,
+		&width,
+		&height,
+		&a.StorageKey,
+		&thumbnailKey,
+		&a.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	a.MessageID = int(messageID.Int64)
+	a.Width = int(width.Int64)
+	a.Height = int(height.Int64)
+	a.ThumbnailKey = thumbnailKey.String
+	return a, nil
+}
@@ -0,0 +1,185 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+	"github.com/lib/pq"
+)
+
+func (r *repository) CreateConversation(conv *domain.Conversation) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// One-to-one conversations are keyed by the ordered pair of members,
+	// the insert waits for a concurrent one of the same pair to finish
+	var low, high sql.NullInt64
+	if !conv.IsGroup && len(conv.MemberIDs) == 2 {
+		a, b := conv.MemberIDs[0], conv.MemberIDs[1]
+		if a > b {
+			a, b = b, a
+		}
+		low = sql.NullInt64{Int64: int64(a), Valid: true}
+		high = sql.NullInt64{Int64: int64(b), Valid: true}
+	}
+
+	query := `
+		INSERT INTO conversations (created_by, is_group, direct_user_low, direct_user_high)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (direct_user_low, direct_user_high) DO NOTHING
+		RETURNING id, created_at`
+
+	err = tx.QueryRow(query, conv.CreatedBy, conv.IsGroup, low, high).Scan(&conv.ID, &conv.CreatedAt)
+	if err == sql.ErrNoRows {
+		existing, err := r.FindDirectConversation(int(low.Int64), int(high.Int64))
+		if err != nil {
+			return err
+		}
+		*conv = *existing
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error creating conversation: %w", err)
+	}
+
+	query = `
+		INSERT INTO conversation_members (conversation_id, user_id)
+		SELECT $1, unnest($2::integer[])`
+
+	if _, err := tx.Exec(query, conv.ID, pq.Array(conv.MemberIDs)); err != nil {
+		return fmt.Errorf("error adding conversation members: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) GetConversation(id int) (*domain.Conversation, error) {
+	query := `
+		SELECT c.id, c.created_by, c.is_group, c.created_at,
+			ARRAY(
+				SELECT m.user_id FROM conversation_members m
+				WHERE m.conversation_id = c.id
+				ORDER BY m.user_id
+			)
+		FROM conversations c
+		WHERE c.id = $1`
+
+	conv, err := scanConversation(r.db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrConversationNotFound
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error getting conversation: %w", err)
+	}
+
+	return conv, nil
+}
+
+func (r *repository) FindDirectConversation(userID, otherID int) (*domain.Conversation, error) {
+	var id int
+	query := `
+		SELECT id
+		FROM conversations
+		WHERE direct_user_low = LEAST($1::integer, $2::integer)
+			AND direct_user_high = GREATEST($1::integer, $2::integer)`
+
+	err := r.db.QueryRow(query, userID, otherID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrConversationNotFound
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error finding conversation: %w", err)
+	}
+
+	return r.GetConversation(id)
+}
+
+// GetConversations returns the user's conversations, most recently active
+// first
+func (r *repository) GetConversations(userID int) ([]*domain.Conversation, error) {
+	query := `
+		SELECT c.id, c.created_by, c.is_group, c.created_at,
+			ARRAY(
+				SELECT m.user_id FROM conversation_members m
+				WHERE m.conversation_id = c.id
+				ORDER BY m.user_id
+			)
+		FROM conversations c
+		JOIN conversation_members me ON me.conversation_id = c.id AND me.user_id = $1
+		ORDER BY COALESCE(
+			(SELECT MAX(created_at) FROM chat_messages WHERE conversation_id = c.id),
+			c.created_at
+		) DESC`
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting conversations: %w", err)
+	}
+	defer rows.Close()
+
+	conversations := []*domain.Conversation{}
+	for rows.Next() {
+		conv, err := scanConversation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning conversation: %w", err)
+		}
+		conversations = append(conversations, conv)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error getting conversations: %w", err)
+	}
+
+	return conversations, nil
+}
+
+// GetConversationMessages returns up to limit messages of the conversation
+// created before the given time, oldest first
+func (r *repository) GetConversationMessages(conversationID, limit int, before time.Time) ([]*domain.Message, error) {
+	query := `
+		SELECT id, user_id, conversation_id, reply_to_id, content, created_at
+		FROM (
+			SELECT id, user_id, conversation_id, reply_to_id, content, created_at
+			FROM chat_messages
+			WHERE status = 'active' AND conversation_id = $1 AND created_at < $2
+			ORDER BY created_at DESC, id DESC
+			LIMIT $3
+		) recent
+		ORDER BY created_at, id`
+
+	return r.queryMessages(query, conversationID, before, limit)
+}
+
+func scanConversation(row scanner) (*domain.Conversation, error) {
+	conv := &domain.Conversation{}
+	var memberIDs pq.Int64Array
+
+	err := row.Scan(
+		&conv.ID,
+		&conv.CreatedBy,
+		&conv.IsGroup,
+		&conv.CreatedAt,
+		&memberIDs,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	conv.MemberIDs = make([]int, len(memberIDs))
+	for i, id := range memberIDs {
+		conv.MemberIDs[i] = int(id)
+	}
+
+	return conv, nil
+}
@@ -0,0 +1,107 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+	"github.com/lib/pq"
+)
+
+func (r *repository) GetLinkPreview(url string) (*domain.LinkPreview, error) {
+	query := `
+		SELECT url, title, description, image_url, site_name, fetched_at
+		FROM link_previews
+		WHERE url = $1`
+
+	p, err := scanLinkPreview(r.db.QueryRow(query, url))
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrLinkPreviewNotFound
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error getting link preview: %w", err)
+	}
+
+	return p, nil
+}
+
+func (r *repository) SaveLinkPreview(p *domain.LinkPreview) error {
+	query := `
+		INSERT INTO link_previews (url, title, description, image_url, site_name)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (url) DO UPDATE
+		SET title = EXCLUDED.title,
+			description = EXCLUDED.description,
+			image_url = EXCLUDED.image_url,
+			site_name = EXCLUDED.site_name,
+			fetched_at = CURRENT_TIMESTAMP
+		RETURNING fetched_at`
+
+	err := r.db.QueryRow(query, p.URL, p.Title, p.Description, p.ImageURL, p.SiteName).Scan(&p.FetchedAt)
+	if err != nil {
+		return fmt.Errorf("error saving link preview: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) AddMessageLinkPreviews(messageID int, urls []string) error {
+	query := `
+		INSERT INTO message_link_previews (message_id, url, position)
+		SELECT $1, url, position - 1
+		FROM unnest($2::text[]) WITH ORDINALITY AS u(url, position)
+		ON CONFLICT DO NOTHING`
+
+	if _, err := r.db.Exec(query, messageID, pq.Array(urls)); err != nil {
+		return fmt.Errorf("error adding message link previews: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) GetLinkPreviews(messageIDs []int) (map[int][]*domain.LinkPreview, error) {
+	previews := make(map[int][]*domain.LinkPreview)
+	if len(messageIDs) == 0 {
+		return previews, nil
+	}
+
+	query := `
+		SELECT m.message_id, p.url, p.title, p.description, p.image_url, p.site_name, p.fetched_at
+		FROM message_link_previews m
+		JOIN link_previews p ON p.url = m.url
+		WHERE m.message_id = ANY($1)
+		ORDER BY m.message_id, m.position`
+
+	rows, err := r.db.Query(query, pq.Array(messageIDs))
+	if err != nil {
+		return nil, fmt.Errorf("error getting link previews: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID int
+		p := &domain.LinkPreview{}
+		err := rows.Scan(&messageID, &p.URL, &p.Title, &p.Description, &p.ImageURL, &p.SiteName, &p.FetchedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning link preview: %w", err)
+		}
+		previews[messageID] = append(previews[messageID], p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error getting link previews: %w", err)
+	}
+
+	return previews, nil
+}
+
+func scanLinkPreview(row scanner) (*domain.LinkPreview, error) {
+	p := &domain.LinkPreview{}
+	err := row.Scan(&p.URL, &p.Title, &p.Description, &p.ImageURL, &p.SiteName, &p.FetchedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
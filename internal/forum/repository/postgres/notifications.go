@@ -0,0 +1,102 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+	"github.com/lib/pq"
+)
+
+func (r *repository) CreateNotification(n *domain.Notification) error {
+	query := `
+		INSERT INTO notifications (user_id, type, actor_id, message_id)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`
+
+	err := r.db.QueryRow(
+		query,
+		n.UserID,
+		n.Type,
+		n.ActorID,
+		nullableID(n.MessageID),
+	).Scan(&n.ID, &n.CreatedAt)
+
+	if err != nil {
+		return fmt.Errorf("error creating notification: %w", err)
+	}
+
+	return nil
+}
+
+// GetNotifications returns the user's notifications, newest first
+func (r *repository) GetNotifications(userID int, unreadOnly bool, limit int) ([]*domain.Notification, error) {
+	query := `
+		SELECT n.id, n.user_id, n.type, n.actor_id, n.message_id, m.conversation_id,
+			n.created_at, n.read_at
+		FROM notifications n
+		LEFT JOIN chat_messages m ON m.id = n.message_id
+		WHERE n.user_id = $1 AND (NOT $2 OR n.read_at IS NULL)
+		ORDER BY n.created_at DESC, n.id DESC
+		LIMIT $3`
+
+	rows, err := r.db.Query(query, userID, unreadOnly, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error getting notifications: %w", err)
+	}
+	defer rows.Close()
+
+	notifications := []*domain.Notification{}
+	for rows.Next() {
+		n := &domain.Notification{}
+		var messageID, conversationID sql.NullInt64
+		var readAt sql.NullTime
+
+		err := rows.Scan(
+			&n.ID,
+			&n.UserID,
+			&n.Type,
+			&n.ActorID,
+			&messageID,
+			&conversationID,
+			&n.CreatedAt,
+			&readAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning notification: %w", err)
+		}
+
+		n.MessageID = int(messageID.Int64)
+		n.ConversationID = int(conversationID.Int64)
+		if readAt.Valid {
+			n.ReadAt = &readAt.Time
+		}
+		notifications = append(notifications, n)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error getting notifications: %w", err)
+	}
+
+	return notifications, nil
+}
+
+func (r *repository) MarkNotificationsRead(userID int, ids []int) (int, error) {
+	query := `
+		UPDATE notifications
+		SET read_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND read_at IS NULL
+			AND (cardinality($2::integer[]) = 0 OR id = ANY($2))`
+
+	result, err := r.db.Exec(query, userID, pq.Array(ids))
+	if err != nil {
+		return 0, fmt.Errorf("error marking notifications as read: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error getting rows affected: %w", err)
+	}
+
+	return int(rowsAffected), nil
+}
@@ -0,0 +1,76 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+)
+
+func (r *repository) PinMessage(pin *domain.PinnedMessage) (bool, error) {
+	query := `
+		UPDATE chat_messages
+		SET pinned_at = CURRENT_TIMESTAMP, pinned_by = $2
+		WHERE id = $1 AND status = 'active' AND pinned_at IS NULL
+		RETURNING pinned_at`
+
+	err := r.db.QueryRow(query, pin.Message.ID, pin.PinnedBy).Scan(&pin.PinnedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("error pinning message: %w", err)
+	}
+
+	return true, nil
+}
+
+func (r *repository) UnpinMessage(messageID int) (bool, error) {
+	query := `
+		UPDATE chat_messages
+		SET pinned_at = NULL, pinned_by = NULL
+		WHERE id = $1 AND pinned_at IS NOT NULL`
+
+	result, err := r.db.Exec(query, messageID)
+	if err != nil {
+		return false, fmt.Errorf("error unpinning message: %w", err)
+	}
+
+	return affected(result)
+}
+
+func (r *repository) GetPinnedMessages(conversationID int) ([]*domain.PinnedMessage, error) {
+	query := `
+		SELECT id, user_id, conversation_id, reply_to_id, content, created_at, pinned_by, pinned_at
+		FROM chat_messages
+		WHERE status = 'active' AND pinned_at IS NOT NULL
+			AND conversation_id IS NOT DISTINCT FROM $1
+		ORDER BY pinned_at DESC, id DESC`
+
+	rows, err := r.db.Query(query, nullableID(conversationID))
+	if err != nil {
+		return nil, fmt.Errorf("error getting pinned messages: %w", err)
+	}
+	defer rows.Close()
+
+	pins := []*domain.PinnedMessage{}
+	for rows.Next() {
+		pin := &domain.PinnedMessage{}
+		var pinnedBy sql.NullInt64
+
+		pin.Message, err = scanMessage(rows, &pinnedBy, &pin.PinnedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning pinned message: %w", err)
+		}
+
+		pin.PinnedBy = int(pinnedBy.Int64)
+		pins = append(pins, pin)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error getting pinned messages: %w", err)
+	}
+
+	return pins, nil
+}
@@ -0,0 +1,88 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+	"github.com/lib/pq"
+)
+
+func (r *repository) AddReaction(messageID, userID int, emoji string) (bool, error) {
+	query := `
+		INSERT INTO message_reactions (message_id, user_id, emoji)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING`
+
+	result, err := r.db.Exec(query, messageID, userID, emoji)
+	if err != nil {
+		return false, fmt.Errorf("error adding reaction: %w", err)
+	}
+
+	return affected(result)
+}
+
+func (r *repository) RemoveReaction(messageID, userID int, emoji string) (bool, error) {
+	query := `
+		DELETE FROM message_reactions
+		WHERE message_id = $1 AND user_id = $2 AND emoji = $3`
+
+	result, err := r.db.Exec(query, messageID, userID, emoji)
+	if err != nil {
+		return false, fmt.Errorf("error removing reaction: %w", err)
+	}
+
+	return affected(result)
+}
+
+func (r *repository) GetReactions(messageIDs []int) (map[int][]*domain.Reaction, error) {
+	reactions := make(map[int][]*domain.Reaction)
+	if len(messageIDs) == 0 {
+		return reactions, nil
+	}
+
+	query := `
+		SELECT message_id, emoji, COUNT(*), array_agg(user_id ORDER BY created_at)
+		FROM message_reactions
+		WHERE message_id = ANY($1)
+		GROUP BY message_id, emoji
+		ORDER BY message_id, MIN(created_at)`
+
+	rows, err := r.db.Query(query, pq.Array(messageIDs))
+	if err != nil {
+		return nil, fmt.Errorf("error getting reactions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID int
+		var userIDs pq.Int64Array
+		reaction := &domain.Reaction{}
+
+		if err := rows.Scan(&messageID, &reaction.Emoji, &reaction.Count, &userIDs); err != nil {
+			return nil, fmt.Errorf("error scanning reaction: %w", err)
+		}
+
+		reaction.UserIDs = make([]int, len(userIDs))
+		for i, id := range userIDs {
+			reaction.UserIDs[i] = int(id)
+		}
+		reactions[messageID] = append(reactions[messageID], reaction)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error getting reactions: %w", err)
+	}
+
+	return reactions, nil
+}
+
+// affected reports whether the statement changed any rows
+func affected(result sql.Result) (bool, error) {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error getting rows affected: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
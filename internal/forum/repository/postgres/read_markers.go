@@ -0,0 +1,40 @@
+package postgres
+
+import "fmt"
+
+func (r *repository) SetLastRead(userID, messageID int) (bool, error) {
+	query := `
+		INSERT INTO chat_read_markers (user_id, last_read_message_id)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET last_read_message_id = EXCLUDED.last_read_message_id,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE chat_read_markers.last_read_message_id < EXCLUDED.last_read_message_id`
+
+	result, err := r.db.Exec(query, userID, messageID)
+	if err != nil {
+		return false, fmt.Errorf("error setting read marker: %w", err)
+	}
+
+	return affected(result)
+}
+
+func (r *repository) CountUnread(userID int) (int, error) {
+	var count int
+	query := `
+		SELECT COUNT(*)
+		FROM chat_messages
+		WHERE status = 'active'
+			AND conversation_id IS NULL
+			AND user_id <> $1
+			AND id > COALESCE(
+				(SELECT last_read_message_id FROM chat_read_markers WHERE user_id = $1),
+				0
+			)`
+
+	if err := r.db.QueryRow(query, userID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("error counting unread messages: %w", err)
+	}
+
+	return count, nil
+}
@@ -0,0 +1,158 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+	"github.com/lib/pq"
+)
+
+func (r *repository) CreateReport(report *domain.Report) (bool, error) {
+	query := `
+		INSERT INTO message_reports (message_id, reporter_id, reason)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (message_id, reporter_id) DO NOTHING
+		RETURNING id, status, created_at`
+
+	err := r.db.QueryRow(query, report.MessageID, report.ReporterID, report.Reason).
+		Scan(&report.ID, &report.Status, &report.CreatedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("error creating report: %w", err)
+	}
+
+	return true, nil
+}
+
+func (r *repository) GetReportQueue(status domain.ReportStatus, limit, offset int) ([]*domain.ReportedMessage, error) {
+	// Deleted messages stay listed so actioned reports can be reviewed
+	query := `
+		SELECT m.id, m.user_id, m.conversation_id, m.reply_to_id, m.content, m.created_at,
+			count(*), array_agg(r.reason ORDER BY r.created_at), min(r.created_at), max(r.created_at)
+		FROM message_reports r
+		JOIN chat_messages m ON m.id = r.message_id
+		WHERE r.status = $1
+		GROUP BY m.id
+		ORDER BY count(*) DESC, max(r.created_at) DESC
+		LIMIT $2 OFFSET $3`
+
+	rows, err := r.db.Query(query, status, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("error getting report queue: %w", err)
+	}
+	defer rows.Close()
+
+	queue := []*domain.ReportedMessage{}
+	for rows.Next() {
+		item := &domain.ReportedMessage{}
+
+		item.Message, err = scanMessage(rows, &item.ReportCount, pq.Array(&item.Reasons), &item.FirstReport, &item.LastReport)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning reported message: %w", err)
+		}
+
+		queue = append(queue, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error getting report queue: %w", err)
+	}
+
+	return queue, nil
+}
+
+func (r *repository) ResolveReports(messageID int, status domain.ReportStatus, resolvedBy int, deleteMessage bool) (int, bool, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, false, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE message_reports
+		SET status = $2, resolved_by = $3, resolved_at = CURRENT_TIMESTAMP
+		WHERE message_id = $1 AND status = 'open'`
+
+	result, err := tx.Exec(query, messageID, status, resolvedBy)
+	if err != nil {
+		return 0, false, fmt.Errorf("error resolving reports: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, false, fmt.Errorf("error resolving reports: %w", err)
+	}
+	if n == 0 {
+		return 0, false, nil
+	}
+
+	var deleted bool
+	if deleteMessage {
+		query = `
+			UPDATE chat_messages
+			SET status = 'deleted', deleted_at = CURRENT_TIMESTAMP
+			WHERE id = $1 AND status = 'active'`
+
+		result, err := tx.Exec(query, messageID)
+		if err != nil {
+			return 0, false, fmt.Errorf("error deleting message: %w", err)
+		}
+
+		deleted, err = affected(result)
+		if err != nil {
+			return 0, false, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, false, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return int(n), deleted, nil
+}
+
+func (r *repository) GetPendingMessages(limit, offset int) ([]*domain.Message, error) {
+	query := `
+		SELECT id, user_id, conversation_id, reply_to_id, content, created_at
+		FROM chat_messages
+		WHERE status = 'pending'
+		ORDER BY created_at, id
+		LIMIT $1 OFFSET $2`
+
+	messages, err := r.queryMessages(query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, msg := range messages {
+		msg.Status = domain.MessagePending
+	}
+
+	return messages, nil
+}
+
+func (r *repository) ReviewMessage(id int, approve bool) (*domain.Message, error) {
+	query := `
+		UPDATE chat_messages
+		SET status = CASE WHEN $2 THEN 'active' ELSE 'deleted' END,
+			deleted_at = CASE WHEN $2 THEN NULL ELSE CURRENT_TIMESTAMP END
+		WHERE id = $1 AND status = 'pending'
+		RETURNING id, user_id, conversation_id, reply_to_id, content, created_at, status`
+
+	var status string
+	msg, err := scanMessage(r.db.QueryRow(query, id, approve), &status)
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrMessageNotFound
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error reviewing message: %w", err)
+	}
+
+	msg.Status = status
+	return msg, nil
+}
@@ -0,0 +1,223 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+	"github.com/lib/pq"
+)
+
+type repository struct {
+	db *sql.DB
+}
+
+// NewRepository creates a new PostgreSQL chat repository
+func NewRepository(db *sql.DB) domain.Repository {
+	return &repository{db: db}
+}
+
+func (r *repository) SaveMessage(msg *domain.Message) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO chat_messages (user_id, conversation_id, reply_to_id, content, status)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`
+
+	status := msg.Status
+	if status == "" {
+		status = domain.MessageActive
+	}
+
+	err = tx.QueryRow(
+		query,
+		msg.UserID,
+		nullableID(msg.ConversationID),
+		nullableID(msg.ReplyToID),
+		msg.Content,
+		status,
+	).Scan(&msg.ID, &msg.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("error saving message: %w", err)
+	}
+
+	if err := linkAttachments(tx, msg); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) GetMessageByID(id int) (*domain.Message, error) {
+	query := `
+		SELECT id, user_id, conversation_id, reply_to_id, content, created_at
+		FROM chat_messages
+		WHERE id = $1 AND status = 'active'`
+
+	msg, err := scanMessage(r.db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrMessageNotFound
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error getting message: %w", err)
+	}
+
+	return msg, nil
+}
+
+func (r *repository) GetMessagesByIDs(ids []int) ([]*domain.Message, error) {
+	query := `
+		SELECT id, user_id, conversation_id, reply_to_id, content, created_at
+		FROM chat_messages
+		WHERE id = ANY($1) AND status = 'active'
+		ORDER BY created_at, id`
+
+	return r.queryMessages(query, pq.Array(ids))
+}
+
+// GetReplyChain returns the message preceded by the messages it replies
+// to, oldest first, following at most maxDepth parents
+func (r *repository) GetReplyChain(messageID, maxDepth int) ([]*domain.Message, error) {
+	query := `
+		WITH RECURSIVE chain AS (
+			SELECT id, reply_to_id, 0 AS depth
+			FROM chat_messages
+			WHERE id = $1 AND status = 'active'
+			UNION ALL
+			SELECT m.id, m.reply_to_id, chain.depth + 1
+			FROM chat_messages m
+			JOIN chain ON m.id = chain.reply_to_id
+			WHERE m.status = 'active' AND chain.depth < $2
+		)
+		SELECT m.id, m.user_id, m.conversation_id, m.reply_to_id, m.content, m.created_at
+		FROM chat_messages m
+		JOIN chain ON chain.id = m.id
+		ORDER BY chain.depth DESC`
+
+	return r.queryMessages(query, messageID, maxDepth)
+}
+
+// GetMessages returns up to limit messages created before the given time,
+// oldest first
+func (r *repository) GetMessages(limit int, before time.Time) ([]*domain.Message, error) {
+	query := `
+		SELECT id, user_id, conversation_id, reply_to_id, content, created_at
+		FROM (
+			SELECT id, user_id, conversation_id, reply_to_id, content, created_at
+			FROM chat_messages
+			WHERE status = 'active' AND conversation_id IS NULL AND created_at < $1
+			ORDER BY created_at DESC, id DESC
+			LIMIT $2
+		) recent
+		ORDER BY created_at, id`
+
+	return r.queryMessages(query, before, limit)
+}
+
+func (r *repository) queryMessages(query string, args ...any) ([]*domain.Message, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error getting messages: %w", err)
+	}
+	defer rows.Close()
+
+	messages := []*domain.Message{}
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning message: %w", err)
+		}
+		messages = append(messages, msg)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error getting messages: %w", err)
+	}
+
+	return messages, nil
+}
+
+func (r *repository) DeleteOldMessages(before time.Time) error {
+	query := `DELETE FROM chat_messages WHERE created_at < $1`
+	if _, err := r.db.Exec(query, before); err != nil {
+		return fmt.Errorf("error deleting old messages: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) AddParticipant(userID int) error {
+	query := `
+		INSERT INTO chat_participants (user_id)
+		SELECT $1
+		WHERE NOT EXISTS (SELECT 1 FROM chat_participants WHERE user_id = $1)`
+
+	if _, err := r.db.Exec(query, userID); err != nil {
+		return fmt.Errorf("error adding participant: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) RemoveParticipant(userID int) error {
+	query := `DELETE FROM chat_participants WHERE user_id = $1`
+	if _, err := r.db.Exec(query, userID); err != nil {
+		return fmt.Errorf("error removing participant: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) IsParticipant(userID int) (bool, error) {
+	var exists bool
+	query := `SELECT EXISTS (SELECT 1 FROM chat_participants WHERE user_id = $1)`
+
+	if err := r.db.QueryRow(query, userID).Scan(&exists); err != nil {
+		return false, fmt.Errorf("error checking participant: %w", err)
+	}
+
+	return exists, nil
+}
+
+// scanner is implemented by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanMessage scans the message columns followed by any extra columns
+func scanMessage(row scanner, extra ...any) (*domain.Message, error) {
+	msg := &domain.Message{}
+	var conversationID, replyToID sql.NullInt64
+
+	dest := append([]any{
+		&msg.ID,
+		&msg.UserID,
+		&conversationID,
+		&replyToID,
+		&msg.Content,
+		&msg.CreatedAt,
+	}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	msg.ConversationID = int(conversationID.Int64)
+	msg.ReplyToID = int(replyToID.Int64)
+	return msg, nil
+}
+
+// nullableID stores zero ids as NULL
+func nullableID(id int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id != 0}
+}
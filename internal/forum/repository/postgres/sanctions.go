@@ -0,0 +1,110 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+)
+
+// maxSanctions bounds the sanction lists
+const maxSanctions = 100
+
+const sanctionColumns = `id, user_id, moderator_id, type, reason, expires_at, revoked_at, revoked_by, created_at`
+
+func (r *repository) CreateSanction(s *domain.Sanction) error {
+	query := `
+		INSERT INTO sanctions (user_id, moderator_id, type, reason, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`
+
+	err := r.db.QueryRow(query, s.UserID, s.ModeratorID, s.Type, s.Reason, s.ExpiresAt).Scan(&s.ID, &s.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("error creating sanction: %w", err)
+	}
+
+	return nil
+}
+
+func (r *repository) GetSanction(id int) (*domain.Sanction, error) {
+	query := `SELECT ` + sanctionColumns + ` FROM sanctions WHERE id = $1`
+
+	s, err := scanSanction(r.db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrSanctionNotFound
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error getting sanction: %w", err)
+	}
+
+	return s, nil
+}
+
+func (r *repository) GetSanctions(userID int, activeOnly bool) ([]*domain.Sanction, error) {
+	query := `
+		SELECT ` + sanctionColumns + `
+		FROM sanctions
+		WHERE ($1 = 0 OR user_id = $1)
+			AND (NOT $2 OR (revoked_at IS NULL
+				AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)))
+		ORDER BY created_at DESC, id DESC
+		LIMIT $3`
+
+	rows, err := r.db.Query(query, userID, activeOnly, maxSanctions)
+	if err != nil {
+		return nil, fmt.Errorf("error getting sanctions: %w", err)
+	}
+	defer rows.Close()
+
+	sanctions := []*domain.Sanction{}
+	for rows.Next() {
+		s, err := scanSanction(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning sanction: %w", err)
+		}
+		sanctions = append(sanctions, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error getting sanctions: %w", err)
+	}
+
+	return sanctions, nil
+}
+
+func (r *repository) RevokeSanction(id, revokedBy int) (bool, error) {
+	query := `
+		UPDATE sanctions
+		SET revoked_at = CURRENT_TIMESTAMP, revoked_by = $2
+		WHERE id = $1 AND revoked_at IS NULL
+			AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)`
+
+	result, err := r.db.Exec(query, id, revokedBy)
+	if err != nil {
+		return false, fmt.Errorf("error revoking sanction: %w", err)
+	}
+
+	return affected(result)
+}
+
+func scanSanction(row scanner) (*domain.Sanction, error) {
+	s := &domain.Sanction{}
+	var expiresAt, revokedAt sql.NullTime
+	var revokedBy sql.NullInt64
+
+	err := row.Scan(&s.ID, &s.UserID, &s.ModeratorID, &s.Type, &s.Reason, &expiresAt, &revokedAt, &revokedBy, &s.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if expiresAt.Valid {
+		s.ExpiresAt = &expiresAt.Time
+	}
+	if revokedAt.Valid {
+		s.RevokedAt = &revokedAt.Time
+	}
+	s.RevokedBy = int(revokedBy.Int64)
+
+	return s, nil
+}
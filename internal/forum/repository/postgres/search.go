@@ -0,0 +1,69 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+)
+
+// headlineOptions marks matches with control characters so the service can
+// escape the snippet before turning them into HTML. The characters are
+// removed from the content first so only the markers remain.
+const headlineOptions = "StartSel=\x02, StopSel=\x03, MinWords=10, MaxWords=30, MaxFragments=2"
+
+func (r *repository) SearchMessages(query string, filter domain.SearchFilter) ([]*domain.SearchResult, error) {
+	sqlQuery := `
+		SELECT m.id, m.user_id, m.conversation_id, m.reply_to_id, m.content, m.created_at,
+			ts_rank(m.search_vector, q) AS rank,
+			ts_headline('simple', translate(m.content, E'\x02\x03', ''), q, $7)
+		FROM chat_messages m, websearch_to_tsquery('simple', $1) q
+		WHERE m.status = 'active' AND m.search_vector @@ q
+			AND (m.conversation_id IS NULL OR m.conversation_id IN (
+				SELECT conversation_id FROM conversation_members WHERE user_id = $2
+			))
+			AND ($3 = 0 OR m.user_id = $3)
+			AND ($4::timestamptz IS NULL OR m.created_at >= $4)
+			AND ($5::timestamptz IS NULL OR m.created_at < $5)
+		ORDER BY rank DESC, m.created_at DESC, m.id DESC
+		LIMIT $6 OFFSET $8`
+
+	rows, err := r.db.Query(
+		sqlQuery,
+		query,
+		filter.ViewerID,
+		filter.AuthorID,
+		nullableTime(filter.After),
+		nullableTime(filter.Before),
+		filter.Limit,
+		headlineOptions,
+		filter.Offset,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error searching messages: %w", err)
+	}
+	defer rows.Close()
+
+	results := []*domain.SearchResult{}
+	for rows.Next() {
+		result := &domain.SearchResult{}
+
+		result.Message, err = scanMessage(rows, &result.Rank, &result.Snippet)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning search result: %w", err)
+		}
+		results = append(results, result)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error searching messages: %w", err)
+	}
+
+	return results, nil
+}
+
+// nullableTime stores zero times as NULL
+func nullableTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+	"github.com/chizheg/forum/pkg/audit"
+	"go.uber.org/zap"
+)
+
+const (
+	accountDeletionsBatch = 100
+	// accountDeletionsLookback is well beyond how long a deletion
+	// transaction of the auth service can take
+	accountDeletionsLookback = 10 * time.Minute
+)
+
+func (s *service) DeleteAccount(userID int, token, password string, source audit.Source) error {
+	if err := s.users.DeleteAccount(token, password, source); err != nil {
+		return err
+	}
+
+	// The data is erased right away instead of at the next run of
+	// RunAccountDeletionSync, which retries if this fails
+	if _, err := s.SyncAccountDeletions(); err != nil {
+		s.logger.Error("failed to sync account deletions", zap.Int("user_id", userID), zap.Error(err))
+	}
+
+	return nil
+}
+
+func (s *service) ExportAccount(userID int, token string, source audit.Source) (*domain.AccountExport, error) {
+	account, err := s.users.GetAccountData(token, source)
+	if err != nil {
+		return nil, err
+	}
+	if account.ID != userID {
+		return nil, domain.ErrForbidden
+	}
+
+	messages, err := s.repo.GetUserMessages(userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.attachFiles(messages); err != nil {
+		return nil, err
+	}
+
+	return &domain.AccountExport{
+		Account:    account,
+		Messages:   messages,
+		ExportedAt: time.Now(),
+	}, nil
+}
+
+func (s *service) SyncAccountDeletions() (int, error) {
+	// Deletions already recorded are still anonymized when the auth
+	// service can't be reached
+	recordErr := s.recordAccountDeletions()
+
+	handled, err := s.anonymizeAccounts()
+	if recordErr != nil {
+		return handled, recordErr
+	}
+
+	return handled, err
+}
+
+func (s *service) RunAccountDeletionSync(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.SyncAccountDeletions(); err != nil {
+			s.logger.Error("failed to sync account deletions", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// recordAccountDeletions records the deletions made in the auth service
+// since the last sync, they stay pending until anonymized. IDs are assigned
+// there before the deletion commits, so one can become visible after a
+// later one was synced: the deletions of the last accountDeletionsLookback
+// are fetched again, those already recorded are left as they are.
+func (s *service) recordAccountDeletions() error {
+	afterID, err := s.repo.GetAccountDeletionCursor(accountDeletionsLookback)
+	if err != nil {
+		return err
+	}
+
+	for {
+		deletions, err := s.users.GetAccountDeletions(afterID, accountDeletionsBatch)
+		if err != nil {
+			return err
+		}
+
+		if len(deletions) > 0 {
+			if err := s.repo.RecordAccountDeletions(deletions); err != nil {
+				return err
+			}
+			afterID = deletions[len(deletions)-1].ID
+		}
+
+		if len(deletions) < accountDeletionsBatch {
+			return nil
+		}
+	}
+}
+
+// anonymizeAccounts erases the data of the users of pending deletions. A
+// failing deletion stays pending and doesn't hold up the others, the
+// first error is returned once all were tried.
+func (s *service) anonymizeAccounts() (int, error) {
+	var (
+		afterID  int64
+		handled  int
+		firstErr error
+	)
+	for {
+		deletions, err := s.repo.GetPendingAccountDeletions(afterID, accountDeletionsBatch)
+		if err != nil {
+			return handled, err
+		}
+
+		for _, deletion := range deletions {
+			afterID = deletion.ID
+
+			messages, err := s.repo.AnonymizeUser(deletion)
+			if errors.Is(err, domain.ErrDeletionHandled) {
+				continue
+			}
+			if err != nil {
+				s.logger.Error("failed to anonymize user",
+					zap.Int64("deletion_id", deletion.ID),
+					zap.Int("user_id", deletion.UserID),
+					zap.Error(err))
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+
+			s.audit(&audit.Entry{
+				Action:     audit.ActionUserAnonymized,
+				TargetType: audit.TargetUser,
+				TargetID:   deletion.UserID,
+				Details: map[string]any{
+					"deletion_id": deletion.ID,
+					"messages":    messages,
+				},
+			})
+			s.disconnectUser(deletion.UserID)
+			handled++
+		}
+
+		if len(deletions) < accountDeletionsBatch {
+			return handled, firstErr
+		}
+	}
+}
+
+// disconnectUser closes the websockets the deleted user still has open
+func (s *service) disconnectUser(userID int) {
+	err := s.broker.Publish(&domain.Event{
+		UserIDs: []int{userID},
+		Message: domain.WebsocketMessage{
+			Type:    "account_deleted",
+			Payload: map[string]any{},
+		},
+		CloseCode: domain.CloseCodeAccountDeleted,
+	})
+	if err != nil {
+		s.logger.Error("failed to publish account deletion", zap.Error(err))
+	}
+}
@@ -0,0 +1,244 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/chizheg/forum/internal/forum/broker/memory"
+	"github.com/chizheg/forum/internal/forum/domain"
+	"github.com/chizheg/forum/pkg/audit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// testSource is the source of account requests, forwarded to the auth
+// service
+var testSource = audit.Source{IP: "203.0.113.7", UserAgent: "test-agent"}
+
+func TestService_SyncAccountDeletions(t *testing.T) {
+	mockRepo := new(MockRepository)
+	mockUsers := new(MockUserRepository)
+	broker := memory.NewBroker(zap.NewNop())
+	defer broker.Close()
+	events, cancel := broker.Subscribe()
+	defer cancel()
+	auditLog := new(MockAuditLog)
+	svc := NewService(mockRepo, mockUsers, broker, newTestAttachmentService(mockRepo, nil), new(MockSendLimiter), new(MockContentFilter), new(MockUnfurler), auditLog, zap.NewNop())
+
+	// A full batch is followed by another request
+	batch := make([]*domain.AccountDeletion, accountDeletionsBatch)
+	for i := range batch {
+		batch[i] = &domain.AccountDeletion{ID: int64(i + 6), UserID: i + 100}
+	}
+	last := &domain.AccountDeletion{ID: 200, UserID: 3}
+
+	mockRepo.On("GetAccountDeletionCursor", accountDeletionsLookback).Return(int64(5), nil)
+	mockUsers.On("GetAccountDeletions", int64(5), accountDeletionsBatch).Return(batch, nil)
+	mockRepo.On("RecordAccountDeletions", batch).Return(nil)
+	mockUsers.On("GetAccountDeletions", batch[len(batch)-1].ID, accountDeletionsBatch).Return([]*domain.AccountDeletion{last}, nil)
+	mockRepo.On("RecordAccountDeletions", []*domain.AccountDeletion{last}).Return(nil)
+
+	mockRepo.On("GetPendingAccountDeletions", int64(0), accountDeletionsBatch).Return(batch, nil)
+	mockRepo.On("GetPendingAccountDeletions", batch[len(batch)-1].ID, accountDeletionsBatch).Return([]*domain.AccountDeletion{last}, nil)
+	// Test deletions handled by another instance are skipped
+	mockRepo.On("AnonymizeUser", batch[0]).Return(0, domain.ErrDeletionHandled)
+	for _, deletion := range batch[1:] {
+		mockRepo.On("AnonymizeUser", deletion).Return(0, nil)
+	}
+	mockRepo.On("AnonymizeUser", last).Return(4, nil)
+
+	handled, err := svc.SyncAccountDeletions()
+	require.NoError(t, err)
+	assert.Equal(t, accountDeletionsBatch, handled)
+
+	require.Len(t, auditLog.entries, accountDeletionsBatch)
+	assert.Equal(t, &audit.Entry{
+		Action:     audit.ActionUserAnonymized,
+		TargetType: audit.TargetUser,
+		TargetID:   3,
+		Details:    map[string]any{"deletion_id": int64(200), "messages": 4},
+	}, auditLog.entries[accountDeletionsBatch-1])
+
+	event := <-events
+	assert.Equal(t, []int{101}, event.UserIDs)
+	assert.Equal(t, domain.CloseCodeAccountDeleted, event.CloseCode)
+
+	mockRepo.AssertExpectations(t)
+	mockUsers.AssertExpectations(t)
+}
+
+func TestService_SyncAccountDeletionsRetry(t *testing.T) {
+	mockRepo := new(MockRepository)
+	mockUsers := new(MockUserRepository)
+	svc := newTestService(mockRepo, mockUsers)
+
+	failing := &domain.AccountDeletion{ID: 3, UserID: 1}
+	other := &domain.AccountDeletion{ID: 4, UserID: 2}
+
+	// Test pending deletions are handled while the auth service is down and
+	// a failing one doesn't hold up the others
+	mockRepo.On("GetAccountDeletionCursor", accountDeletionsLookback).Return(int64(4), nil)
+	mockUsers.On("GetAccountDeletions", int64(4), accountDeletionsBatch).Return(nil, errors.New("auth down")).Once()
+	mockRepo.On("GetPendingAccountDeletions", int64(0), accountDeletionsBatch).Return([]*domain.AccountDeletion{failing, other}, nil).Once()
+	mockRepo.On("AnonymizeUser", failing).Return(0, errors.New("db down")).Once()
+	mockRepo.On("AnonymizeUser", other).Return(2, nil).Once()
+
+	handled, err := svc.SyncAccountDeletions()
+	assert.EqualError(t, err, "auth down")
+	assert.Equal(t, 1, handled)
+
+	// Test the failed deletion is retried by the next sync
+	mockUsers.On("GetAccountDeletions", int64(4), accountDeletionsBatch).Return([]*domain.AccountDeletion{}, nil).Once()
+	mockRepo.On("GetPendingAccountDeletions", int64(0), accountDeletionsBatch).Return([]*domain.AccountDeletion{failing}, nil).Once()
+	mockRepo.On("AnonymizeUser", failing).Return(5, nil).Once()
+
+	handled, err = svc.SyncAccountDeletions()
+	require.NoError(t, err)
+	assert.Equal(t, 1, handled)
+
+	mockRepo.AssertExpectations(t)
+	mockUsers.AssertExpectations(t)
+}
+
+func TestService_SyncAccountDeletionsCommittedLate(t *testing.T) {
+	mockRepo := new(MockRepository)
+	mockUsers := new(MockUserRepository)
+	svc := newTestService(mockRepo, mockUsers)
+
+	now := time.Now()
+	late := &domain.AccountDeletion{ID: 5, UserID: 2, DeletedAt: now.Add(-time.Second)}
+	synced := &domain.AccountDeletion{ID: 6, UserID: 3, DeletedAt: now}
+
+	// Deletion 6 committed while 5 was still in flight
+	mockRepo.On("GetAccountDeletionCursor", accountDeletionsLookback).Return(int64(4), nil)
+	mockUsers.On("GetAccountDeletions", int64(4), accountDeletionsBatch).Return([]*domain.AccountDeletion{synced}, nil).Once()
+	mockRepo.On("RecordAccountDeletions", []*domain.AccountDeletion{synced}).Return(nil).Once()
+	mockRepo.On("GetPendingAccountDeletions", int64(0), accountDeletionsBatch).Return([]*domain.AccountDeletion{synced}, nil).Once()
+	mockRepo.On("AnonymizeUser", synced).Return(1, nil).Once()
+
+	handled, err := svc.SyncAccountDeletions()
+	require.NoError(t, err)
+	assert.Equal(t, 1, handled)
+
+	// Test the next sync still fetches after the deletion before the
+	// margin, so 5 is found once it commits
+	mockUsers.On("GetAccountDeletions", int64(4), accountDeletionsBatch).Return([]*domain.AccountDeletion{late, synced}, nil).Once()
+	mockRepo.On("RecordAccountDeletions", []*domain.AccountDeletion{late, synced}).Return(nil).Once()
+	mockRepo.On("GetPendingAccountDeletions", int64(0), accountDeletionsBatch).Return([]*domain.AccountDeletion{late}, nil).Once()
+	mockRepo.On("AnonymizeUser", late).Return(2, nil).Once()
+
+	handled, err = svc.SyncAccountDeletions()
+	require.NoError(t, err)
+	assert.Equal(t, 1, handled)
+
+	mockRepo.AssertExpectations(t)
+	mockUsers.AssertExpectations(t)
+}
+
+func TestService_RunAccountDeletionSync(t *testing.T) {
+	mockRepo := new(MockRepository)
+	mockUsers := new(MockUserRepository)
+	svc := newTestService(mockRepo, mockUsers)
+
+	synced := make(chan struct{})
+	mockRepo.On("GetAccountDeletionCursor", accountDeletionsLookback).Return(int64(0), errors.New("db down"))
+	mockRepo.On("GetPendingAccountDeletions", int64(0), accountDeletionsBatch).
+		Return([]*domain.AccountDeletion{}, nil).
+		Run(func(mock.Arguments) { synced <- struct{}{} })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		svc.RunAccountDeletionSync(ctx, time.Millisecond)
+		close(done)
+	}()
+
+	// Test failed syncs are retried
+	for i := 0; i < 2; i++ {
+		select {
+		case <-synced:
+		case <-time.After(time.Second):
+			t.Fatal("account deletions were not synced")
+		}
+	}
+
+	cancel()
+	for {
+		select {
+		case <-synced:
+		case <-done:
+			return
+		case <-time.After(time.Second):
+			t.Fatal("sync kept running after the context was done")
+		}
+	}
+}
+
+func TestService_DeleteAccount(t *testing.T) {
+	mockRepo := new(MockRepository)
+	mockUsers := new(MockUserRepository)
+	svc := newTestService(mockRepo, mockUsers)
+
+	// Test wrong password
+	mockUsers.On("DeleteAccount", "token", "wrong", testSource).Return(domain.ErrInvalidPassword)
+	err := svc.DeleteAccount(1, "token", "wrong", testSource)
+	assert.ErrorIs(t, err, domain.ErrInvalidPassword)
+
+	// Test the data is anonymized right away
+	deletion := &domain.AccountDeletion{ID: 9, UserID: 1}
+	deletions := []*domain.AccountDeletion{deletion}
+	mockUsers.On("DeleteAccount", "token", "password", testSource).Return(nil)
+	mockRepo.On("GetAccountDeletionCursor", accountDeletionsLookback).Return(int64(8), nil)
+	mockUsers.On("GetAccountDeletions", int64(8), accountDeletionsBatch).Return(deletions, nil)
+	mockRepo.On("RecordAccountDeletions", deletions).Return(nil)
+	mockRepo.On("GetPendingAccountDeletions", int64(0), accountDeletionsBatch).Return(deletions, nil)
+	mockRepo.On("AnonymizeUser", deletion).Return(12, nil)
+	require.NoError(t, svc.DeleteAccount(1, "token", "password", testSource))
+
+	mockRepo.AssertExpectations(t)
+	mockUsers.AssertExpectations(t)
+}
+
+func TestService_DeleteAccountSyncFailure(t *testing.T) {
+	mockRepo := new(MockRepository)
+	mockUsers := new(MockUserRepository)
+	svc := newTestService(mockRepo, mockUsers)
+
+	// The account is deleted, the next sync catches up
+	mockUsers.On("DeleteAccount", "token", "password", testSource).Return(nil)
+	mockRepo.On("GetAccountDeletionCursor", accountDeletionsLookback).Return(int64(0), errors.New("db down"))
+	mockRepo.On("GetPendingAccountDeletions", int64(0), accountDeletionsBatch).Return(nil, errors.New("db down"))
+	assert.NoError(t, svc.DeleteAccount(1, "token", "password", testSource))
+
+	mockUsers.AssertExpectations(t)
+}
+
+func TestService_ExportAccount(t *testing.T) {
+	mockRepo := new(MockRepository)
+	mockUsers := new(MockUserRepository)
+	svc := newTestService(mockRepo, mockUsers)
+
+	account := &domain.AccountData{ID: 1, Username: "alice", Email: "alice@example.com"}
+	messages := []*domain.Message{{ID: 4, UserID: 1, Content: "hi", Status: domain.MessageActive}}
+	attachments := []*domain.Attachment{{ID: 2, MessageID: 4, FileName: "a.png"}}
+	mockUsers.On("GetAccountData", "token", testSource).Return(account, nil)
+	mockRepo.On("GetUserMessages", 1).Return(messages, nil)
+	mockRepo.On("GetAttachments", []int{4}).Return(map[int][]*domain.Attachment{4: attachments}, nil)
+
+	export, err := svc.ExportAccount(1, "token", testSource)
+	require.NoError(t, err)
+	assert.Equal(t, account, export.Account)
+	assert.Equal(t, messages, export.Messages)
+	assert.Len(t, export.Messages[0].Attachments, 1)
+	assert.False(t, export.ExportedAt.IsZero())
+
+	// Test tokens of other users
+	_, err = svc.ExportAccount(2, "token", testSource)
+	assert.ErrorIs(t, err, domain.ErrForbidden)
+
+	mockRepo.AssertExpectations(t)
+}
@@ -0,0 +1,455 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // register the GIF decoder for thumbnails
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultMaxUploadSize  = 10 << 20
+	defaultThumbnailSize  = 320
+	defaultDownloadURLTTL = time.Hour
+	defaultDownloadPath   = "/api/attachments/download"
+	defaultUnsentTTL      = 24 * time.Hour
+	maxFileNameLength     = 255
+	// minURLSecretLength is the size of the HMAC-SHA256 key
+	minURLSecretLength = 32
+	// maxImagePixels keeps decompression bombs from being decoded
+	maxImagePixels = 40_000_000
+)
+
+var defaultAllowedTypes = []string{
+	"image/jpeg",
+	"image/png",
+	"image/gif",
+	"image/webp",
+	"application/pdf",
+	"application/zip",
+	"text/plain",
+}
+
+// AttachmentConfig holds attachment upload and download configuration
+type AttachmentConfig struct {
+	// MaxSize is the maximum file size in bytes
+	MaxSize int64
+	// AllowedTypes lists the accepted media types as detected from the
+	// file contents, the name and declared type are not trusted
+	AllowedTypes []string
+	// ThumbnailSize is the maximum width and height of image thumbnails
+	ThumbnailSize int
+	// URLSecret signs the download links, it must be at least 32 bytes
+	URLSecret []byte
+	// URLTTL is how long a download link stays valid
+	URLTTL time.Duration
+	// DownloadPath is the path of the download endpoint
+	DownloadPath string
+	// UnsentTTL is how long uploads are kept before being sent with a
+	// message
+	UnsentTTL time.Duration
+}
+
+type attachmentService struct {
+	repo    domain.Repository
+	blobs   domain.BlobStore
+	cfg     AttachmentConfig
+	allowed map[string]bool
+	logger  *zap.Logger
+}
+
+// NewAttachmentService creates an attachment service storing files in the
+// blob store
+func NewAttachmentService(
+	repo domain.Repository,
+	blobs domain.BlobStore,
+	cfg AttachmentConfig,
+	logger *zap.Logger,
+) (domain.AttachmentService, error) {
+	// Download links could be forged with a missing or short secret
+	if len(cfg.URLSecret) < minURLSecretLength {
+		return nil, fmt.Errorf("url secret must be at least %d bytes", minURLSecretLength)
+	}
+
+	if cfg.MaxSize <= 0 {
+		cfg.MaxSize = defaultMaxUploadSize
+	}
+	if len(cfg.AllowedTypes) == 0 {
+		cfg.AllowedTypes = defaultAllowedTypes
+	}
+	if cfg.ThumbnailSize <= 0 {
+		cfg.ThumbnailSize = defaultThumbnailSize
+	}
+	if cfg.URLTTL <= 0 {
+		cfg.URLTTL = defaultDownloadURLTTL
+	}
+	if cfg.DownloadPath == "" {
+		cfg.DownloadPath = defaultDownloadPath
+	}
+	if cfg.UnsentTTL <= 0 {
+		cfg.UnsentTTL = defaultUnsentTTL
+	}
+
+	allowed := make(map[string]bool, len(cfg.AllowedTypes))
+	for _, t := range cfg.AllowedTypes {
+		allowed[t] = true
+	}
+
+	return &attachmentService{
+		repo:    repo,
+		blobs:   blobs,
+		cfg:     cfg,
+		allowed: allowed,
+		logger:  logger,
+	}, nil
+}
+
+func (s *attachmentService) Upload(userID int, fileName string, r io.Reader) (*domain.Attachment, error) {
+	// Muted and banned users can't send files, so they don't get to
+	// store them either
+	if err := checkSendAccess(s.repo, userID); err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, s.cfg.MaxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("error reading upload: %w", err)
+	}
+	if len(data) == 0 {
+		return nil, domain.ErrEmptyFile
+	}
+	if int64(len(data)) > s.cfg.MaxSize {
+		return nil, domain.ErrFileTooLarge
+	}
+
+	contentType := http.DetectContentType(data)
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || !s.allowed[mediaType] {
+		return nil, domain.ErrUnsupportedFileType
+	}
+
+	key, err := newStorageKey(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	attachment := &domain.Attachment{
+		UserID:      userID,
+		FileName:    sanitizeFileName(fileName),
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		StorageKey:  key,
+	}
+
+	if err := s.blobs.Put(key, bytes.NewReader(data), attachment.Size, contentType); err != nil {
+		return nil, err
+	}
+
+	if strings.HasPrefix(mediaType, "image/") {
+		s.storeThumbnail(attachment, data)
+	}
+
+	if err := s.repo.SaveAttachment(attachment); err != nil {
+		s.deleteBlobs(attachment)
+		return nil, err
+	}
+
+	s.SignURLs([]*domain.Attachment{attachment})
+
+	return attachment, nil
+}
+
+// storeThumbnail records the image size and stores a downscaled copy.
+// Images that cannot be decoded are kept as plain files.
+func (s *attachmentService) storeThumbnail(attachment *domain.Attachment, data []byte) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+
+	attachment.Width = config.Width
+	attachment.Height = config.Height
+	if config.Width*config.Height > maxImagePixels {
+		return
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+
+	var buf bytes.Buffer
+	thumb := thumbnail(src, s.cfg.ThumbnailSize)
+	contentType := thumbnailContentType(attachment.ContentType)
+	if contentType == "image/jpeg" {
+		err = jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 80})
+	} else {
+		err = png.Encode(&buf, thumb)
+	}
+	if err != nil {
+		s.logger.Warn("failed to encode thumbnail", zap.Error(err))
+		return
+	}
+
+	key := attachment.StorageKey + "_thumb"
+	if err := s.blobs.Put(key, &buf, int64(buf.Len()), contentType); err != nil {
+		s.logger.Warn("failed to store thumbnail", zap.Error(err))
+		return
+	}
+
+	attachment.ThumbnailKey = key
+}
+
+func (s *attachmentService) deleteBlobs(attachment *domain.Attachment) {
+	for _, key := range []string{attachment.StorageKey, attachment.ThumbnailKey} {
+		if key == "" {
+			continue
+		}
+		if err := s.blobs.Delete(key); err != nil {
+			s.logger.Warn("failed to delete blob", zap.String("key", key), zap.Error(err))
+		}
+	}
+}
+
+func (s *attachmentService) MaxUploadSize() int64 {
+	return s.cfg.MaxSize
+}
+
+func (s *attachmentService) DeleteUnsent() (int, error) {
+	attachments, err := s.repo.DeleteUnsentAttachments(time.Now().Add(-s.cfg.UnsentTTL))
+	if err != nil {
+		return 0, err
+	}
+
+	// Blobs that fail to delete are only logged, their rows are gone
+	for _, attachment := range attachments {
+		s.deleteBlobs(attachment)
+	}
+
+	return len(attachments), nil
+}
+
+func (s *attachmentService) RunUnsentCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.DeleteUnsent(); err != nil {
+			s.logger.Error("failed to delete unsent attachments", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *attachmentService) Open(attachmentID int, thumbnail bool, expires int64, signature string) (*domain.Attachment, io.ReadCloser, error) {
+	if time.Now().Unix() > expires {
+		return nil, nil, domain.ErrInvalidDownloadLink
+	}
+
+	expected := s.sign(attachmentID, thumbnail, expires)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return nil, nil, domain.ErrInvalidDownloadLink
+	}
+
+	attachment, err := s.repo.GetAttachment(attachmentID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key := attachment.StorageKey
+	if thumbnail {
+		if attachment.ThumbnailKey == "" {
+			return nil, nil, domain.ErrAttachmentNotFound
+		}
+
+		// Describe the thumbnail rather than the original file
+		thumb := *attachment
+		thumb.ContentType = thumbnailContentType(attachment.ContentType)
+		thumb.Size = 0
+		attachment, key = &thumb, attachment.ThumbnailKey
+	}
+
+	blob, err := s.blobs.Open(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return attachment, blob, nil
+}
+
+func (s *attachmentService) SignURLs(attachments []*domain.Attachment) {
+	// Links stay the same for a while so browsers can cache the files
+	expires := time.Now().Truncate(s.cfg.URLTTL).Add(2 * s.cfg.URLTTL).Unix()
+
+	for _, attachment := range attachments {
+		attachment.URL = s.downloadURL(attachment.ID, false, expires)
+		if attachment.ThumbnailKey != "" {
+			attachment.ThumbnailURL = s.downloadURL(attachment.ID, true, expires)
+		}
+	}
+}
+
+func (s *attachmentService) downloadURL(attachmentID int, thumbnail bool, expires int64) string {
+	query := url.Values{}
+	query.Set("id", strconv.Itoa(attachmentID))
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	if thumbnail {
+		query.Set("thumbnail", "1")
+	}
+	query.Set("signature", s.sign(attachmentID, thumbnail, expires))
+
+	return s.cfg.DownloadPath + "?" + query.Encode()
+}
+
+func (s *attachmentService) sign(attachmentID int, thumbnail bool, expires int64) string {
+	mac := hmac.New(sha256.New, s.cfg.URLSecret)
+	fmt.Fprintf(mac, "%d:%t:%d", attachmentID, thumbnail, expires)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// thumbnailContentType keeps photos as JPEG and stores everything else as
+// PNG to preserve transparency
+func thumbnailContentType(contentType string) string {
+	if contentType == "image/jpeg" {
+		return contentType
+	}
+	return "image/png"
+}
+
+// attachFiles fills in the attachments of the messages along with their
+// download links
+func (s *service) attachFiles(messages []*domain.Message) error {
+	ids := make([]int, len(messages))
+	for i, msg := range messages {
+		ids[i] = msg.ID
+	}
+
+	attachments, err := s.repo.GetAttachments(ids)
+	if err != nil {
+		return err
+	}
+
+	for _, msg := range messages {
+		msg.Attachments = attachments[msg.ID]
+		s.attachments.SignURLs(msg.Attachments)
+	}
+
+	return nil
+}
+
+// uniqueIDs drops invalid and repeated ids keeping the original order
+func uniqueIDs(ids []int) []int {
+	seen := make(map[int]bool, len(ids))
+	var unique []int
+
+	for _, id := range ids {
+		if id <= 0 || seen[id] {
+			continue
+		}
+		seen[id] = true
+		unique = append(unique, id)
+	}
+
+	return unique
+}
+
+func newStorageKey(userID int) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating storage key: %w", err)
+	}
+
+	return fmt.Sprintf("%d/%s", userID, hex.EncodeToString(b)), nil
+}
+
+// sanitizeFileName keeps the base name without control characters
+func sanitizeFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, filepath.Base(strings.ReplaceAll(name, "\\", "/")))
+
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." || name == "/" {
+		name = "file"
+	}
+
+	if runes := []rune(name); len(runes) > maxFileNameLength {
+		name = string(runes[:maxFileNameLength])
+	}
+
+	return name
+}
+
+// thumbnail downscales the image to fit into a size×size box by averaging
+// the source pixels
+func thumbnail(src image.Image, size int) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	thumbWidth, thumbHeight := width, height
+	if width > size || height > size {
+		if width >= height {
+			thumbWidth, thumbHeight = size, max(1, height*size/width)
+		} else {
+			thumbWidth, thumbHeight = max(1, width*size/height), size
+		}
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, thumbWidth, thumbHeight))
+	for y := 0; y < thumbHeight; y++ {
+		y0 := bounds.Min.Y + y*height/thumbHeight
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*height/thumbHeight)
+
+		for x := 0; x < thumbWidth; x++ {
+			x0 := bounds.Min.X + x*width/thumbWidth
+			x1 := max(x0+1, bounds.Min.X+(x+1)*width/thumbWidth)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(b / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+
+	return dst
+}
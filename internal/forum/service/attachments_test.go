@@ -0,0 +1,238 @@
+package service
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// memoryBlobStore is an in-memory domain.BlobStore for tests
+type memoryBlobStore struct {
+	mu    sync.Mutex
+	blobs map[string][]byte
+}
+
+func newMemoryBlobStore() *memoryBlobStore {
+	return &memoryBlobStore{blobs: make(map[string][]byte)}
+}
+
+func (s *memoryBlobStore) Put(key string, r io.Reader, size int64, contentType string) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blobs[key] = data
+	return nil
+}
+
+func (s *memoryBlobStore) Open(key string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, ok := s.blobs[key]
+	if !ok {
+		return nil, domain.ErrBlobNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *memoryBlobStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.blobs, key)
+	return nil
+}
+
+func testPNG(t *testing.T, width, height int) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 200, A: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func TestAttachmentService_UploadImage(t *testing.T) {
+	mockRepo := new(MockRepository)
+	blobs := newMemoryBlobStore()
+	svc := newTestAttachmentService(mockRepo, blobs)
+
+	mockRepo.On("GetSanctions", 1, true).Return([]*domain.Sanction{}, nil)
+	mockRepo.On("SaveAttachment", mock.AnythingOfType("*domain.Attachment")).Run(func(args mock.Arguments) {
+		args.Get(0).(*domain.Attachment).ID = 7
+	}).Return(nil)
+
+	// Test the type is sniffed from the contents, not the name
+	attachment, err := svc.Upload(1, "../../photo.txt", bytes.NewReader(testPNG(t, 640, 480)))
+	require.NoError(t, err)
+	assert.Equal(t, "photo.txt", attachment.FileName)
+	assert.Equal(t, "image/png", attachment.ContentType)
+	assert.Equal(t, 640, attachment.Width)
+	assert.Equal(t, 480, attachment.Height)
+	assert.NotEmpty(t, attachment.URL)
+	assert.NotEmpty(t, attachment.ThumbnailURL)
+
+	// Test the thumbnail fits the configured size
+	thumb, err := png.Decode(bytes.NewReader(blobs.blobs[attachment.ThumbnailKey]))
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, defaultThumbnailSize, 240), thumb.Bounds())
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestAttachmentService_UploadLimits(t *testing.T) {
+	mockRepo := new(MockRepository)
+	blobs := newMemoryBlobStore()
+	svc, err := NewAttachmentService(mockRepo, blobs, AttachmentConfig{MaxSize: 16, URLSecret: testURLSecret}, zap.NewNop())
+	require.NoError(t, err)
+	mockRepo.On("GetSanctions", 1, true).Return([]*domain.Sanction{}, nil)
+
+	// Test empty file
+	_, err = svc.Upload(1, "a.txt", strings.NewReader(""))
+	assert.ErrorIs(t, err, domain.ErrEmptyFile)
+
+	// Test file over the size limit
+	_, err = svc.Upload(1, "a.txt", strings.NewReader(strings.Repeat("a", 17)))
+	assert.ErrorIs(t, err, domain.ErrFileTooLarge)
+
+	// Test HTML disguised as an image
+	_, err = svc.Upload(1, "cat.png", strings.NewReader("<html><script>"))
+	assert.ErrorIs(t, err, domain.ErrUnsupportedFileType)
+
+	assert.Empty(t, blobs.blobs)
+	mockRepo.AssertNotCalled(t, "SaveAttachment", mock.Anything)
+}
+
+func TestAttachmentService_UploadSanctioned(t *testing.T) {
+	mockRepo := new(MockRepository)
+	blobs := newMemoryBlobStore()
+	svc := newTestAttachmentService(mockRepo, blobs)
+
+	mute := &domain.Sanction{ID: 1, UserID: 2, Type: domain.SanctionMute}
+	mockRepo.On("GetSanctions", 2, true).Return([]*domain.Sanction{mute}, nil)
+
+	// Test muted users can't store files, the upload isn't read
+	upload := strings.NewReader("hello")
+	_, err := svc.Upload(2, "a.txt", upload)
+	assert.ErrorIs(t, err, domain.ErrMuted)
+	assert.Equal(t, 5, upload.Len())
+
+	assert.Empty(t, blobs.blobs)
+	mockRepo.AssertNotCalled(t, "SaveAttachment", mock.Anything)
+}
+
+func TestAttachmentService_DeleteUnsent(t *testing.T) {
+	mockRepo := new(MockRepository)
+	blobs := newMemoryBlobStore()
+	svc, err := NewAttachmentService(mockRepo, blobs, AttachmentConfig{URLSecret: testURLSecret, UnsentTTL: time.Hour}, zap.NewNop())
+	require.NoError(t, err)
+
+	blobs.blobs["1/abc"] = []byte("photo")
+	blobs.blobs["1/abc_thumb"] = []byte("thumbnail")
+	blobs.blobs["1/def"] = []byte("sent")
+	unsent := []*domain.Attachment{{ID: 3, StorageKey: "1/abc", ThumbnailKey: "1/abc_thumb"}}
+
+	// Test uploads older than the TTL are deleted with their blobs
+	mockRepo.On("DeleteUnsentAttachments", mock.MatchedBy(func(before time.Time) bool {
+		return time.Until(before) < -59*time.Minute && time.Until(before) > -61*time.Minute
+	})).Return(unsent, nil)
+
+	n, err := svc.DeleteUnsent()
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, map[string][]byte{"1/def": []byte("sent")}, blobs.blobs)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestAttachmentService_Open(t *testing.T) {
+	mockRepo := new(MockRepository)
+	blobs := newMemoryBlobStore()
+	svc := newTestAttachmentService(mockRepo, blobs)
+
+	attachment := &domain.Attachment{ID: 7, StorageKey: "1/abc", ContentType: "text/plain; charset=utf-8"}
+	blobs.blobs["1/abc"] = []byte("hello")
+	mockRepo.On("GetAttachment", 7).Return(attachment, nil)
+
+	svc.SignURLs([]*domain.Attachment{attachment})
+	link, err := url.Parse(attachment.URL)
+	require.NoError(t, err)
+	assert.Empty(t, attachment.ThumbnailURL)
+
+	query := link.Query()
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	require.NoError(t, err)
+
+	// Test valid link
+	_, blob, err := svc.Open(7, false, expires, query.Get("signature"))
+	require.NoError(t, err)
+	data, _ := io.ReadAll(blob)
+	assert.Equal(t, "hello", string(data))
+
+	// Test tampered links
+	_, _, err = svc.Open(8, false, expires, query.Get("signature"))
+	assert.ErrorIs(t, err, domain.ErrInvalidDownloadLink)
+	_, _, err = svc.Open(7, false, expires+1, query.Get("signature"))
+	assert.ErrorIs(t, err, domain.ErrInvalidDownloadLink)
+	_, _, err = svc.Open(7, true, expires, query.Get("signature"))
+	assert.ErrorIs(t, err, domain.ErrInvalidDownloadLink)
+
+	// Test expired link
+	_, _, err = svc.Open(7, false, 1, query.Get("signature"))
+	assert.ErrorIs(t, err, domain.ErrInvalidDownloadLink)
+}
+
+func TestService_SendMessageWithAttachments(t *testing.T) {
+	mockRepo := new(MockRepository)
+	svc := newTestService(mockRepo, new(MockUserRepository))
+	mockRepo.On("GetSanctions", 1, true).Return([]*domain.Sanction{}, nil)
+
+	files := []*domain.Attachment{{ID: 3, MessageID: 10}, {ID: 4, MessageID: 10}}
+	mockRepo.On("SaveMessage", mock.MatchedBy(func(msg *domain.Message) bool {
+		return len(msg.Attachments) == 2 && msg.Attachments[0].ID == 3 && msg.Attachments[1].ID == 4
+	})).Run(func(args mock.Arguments) {
+		args.Get(0).(*domain.Message).ID = 10
+	}).Return(nil)
+	mockRepo.On("GetAttachments", []int{10}).Return(map[int][]*domain.Attachment{10: files}, nil)
+
+	// Test a message without text, repeated ids are dropped
+	msg, err := svc.SendMessage(1, "", 0, []int{3, 4, 3})
+	require.NoError(t, err)
+	assert.Equal(t, files, msg.Attachments)
+	assert.NotEmpty(t, msg.Attachments[0].URL)
+
+	// Test too many attachments
+	_, err = svc.SendMessage(1, "hi", 0, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11})
+	assert.ErrorIs(t, err, domain.ErrTooManyAttachments)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestNewAttachmentService_URLSecret(t *testing.T) {
+	// Test missing and short secrets are refused
+	_, err := NewAttachmentService(new(MockRepository), newMemoryBlobStore(), AttachmentConfig{}, zap.NewNop())
+	assert.Error(t, err)
+	_, err = NewAttachmentService(new(MockRepository), newMemoryBlobStore(), AttachmentConfig{URLSecret: []byte("secret")}, zap.NewNop())
+	assert.Error(t, err)
+}
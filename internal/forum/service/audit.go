@@ -0,0 +1,42 @@
+package service
+
+import (
+	"github.com/chizheg/forum/internal/forum/domain"
+	"github.com/chizheg/forum/pkg/audit"
+	"go.uber.org/zap"
+)
+
+func (s *service) GetAuditLog(adminID int, filter audit.Filter) ([]*audit.Entry, error) {
+	if err := s.requireAdmin(adminID); err != nil {
+		return nil, err
+	}
+
+	return s.auditLog.Query(filter)
+}
+
+func (s *service) requireAdmin(userID int) error {
+	users, err := s.users.GetUsersByIDs([]int{userID})
+	if err != nil {
+		return err
+	}
+	if len(users) == 0 {
+		return domain.ErrUserNotFound
+	}
+
+	if !users[0].IsAdmin() {
+		return domain.ErrForbidden
+	}
+
+	return nil
+}
+
+// audit records the entry, failures are logged and don't fail the action
+func (s *service) audit(entry *audit.Entry) {
+	if err := s.auditLog.Write(entry); err != nil {
+		s.logger.Error("failed to write audit log",
+			zap.String("action", string(entry.Action)),
+			zap.Int("actor_id", entry.ActorID),
+			zap.Error(err),
+		)
+	}
+}
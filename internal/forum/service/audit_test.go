@@ -0,0 +1,33 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/chizheg/forum/internal/forum/broker/memory"
+	"github.com/chizheg/forum/internal/forum/domain"
+	"github.com/chizheg/forum/pkg/audit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestService_GetAuditLog(t *testing.T) {
+	mockRepo := new(MockRepository)
+	mockUsers := new(MockUserRepository)
+	auditLog := &MockAuditLog{entries: []*audit.Entry{{ID: 1, Action: audit.ActionUserBanned}}}
+	svc := NewService(mockRepo, mockUsers, memory.NewBroker(zap.NewNop()), newTestAttachmentService(mockRepo, nil), new(MockSendLimiter), new(MockContentFilter), new(MockUnfurler), auditLog, zap.NewNop())
+
+	mockUsers.On("GetUsersByIDs", []int{1}).Return([]*domain.User{{ID: 1, Role: domain.RoleAdmin}}, nil)
+	mockUsers.On("GetUsersByIDs", []int{2}).Return([]*domain.User{{ID: 2, Role: domain.RoleModerator}}, nil)
+
+	filter := audit.Filter{ActorID: 2, Action: audit.ActionUserBanned}
+	entries, err := svc.GetAuditLog(1, filter)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, []audit.Filter{filter}, auditLog.filters)
+
+	// Test moderators can't read the log
+	_, err = svc.GetAuditLog(2, filter)
+	assert.ErrorIs(t, err, domain.ErrForbidden)
+	assert.Len(t, auditLog.filters, 1)
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+)
+
+func (s *service) StartConversation(userID int, memberIDs []int) (*domain.Conversation, error) {
+	members := uniqueMembers(userID, memberIDs)
+	if len(members) < 2 {
+		return nil, domain.ErrInvalidMembers
+	}
+
+	if len(members) > domain.MaxConversationMembers {
+		return nil, domain.ErrTooManyMembers
+	}
+
+	users, err := s.users.GetUsersByIDs(members)
+	if err != nil {
+		return nil, err
+	}
+	if len(users) != len(members) {
+		return nil, domain.ErrUserNotFound
+	}
+
+	// Reuse the existing one-to-one conversation between two users
+	if len(members) == 2 {
+		otherID := members[0]
+		if otherID == userID {
+			otherID = members[1]
+		}
+
+		conv, err := s.repo.FindDirectConversation(userID, otherID)
+		if err == nil {
+			return conv, nil
+		}
+		if !errors.Is(err, domain.ErrConversationNotFound) {
+			return nil, err
+		}
+	}
+
+	conv := &domain.Conversation{
+		CreatedBy: userID,
+		IsGroup:   len(members) > 2,
+		MemberIDs: members,
+	}
+
+	if err := s.repo.CreateConversation(conv); err != nil {
+		return nil, err
+	}
+
+	return conv, nil
+}
+
+func (s *service) GetConversation(userID, conversationID int) (*domain.Conversation, error) {
+	conv, err := s.repo.GetConversation(conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !conv.HasMember(userID) {
+		return nil, domain.ErrNotConversationMember
+	}
+
+	return conv, nil
+}
+
+func (s *service) GetConversations(userID int) ([]*domain.Conversation, error) {
+	return s.repo.GetConversations(userID)
+}
+
+func (s *service) GetConversationMessages(userID, conversationID, limit int) ([]*domain.Message, error) {
+	if _, err := s.GetConversation(userID, conversationID); err != nil {
+		return nil, err
+	}
+
+	messages, err := s.repo.GetConversationMessages(conversationID, limit, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.enrichMessages(messages); err != nil {
+		return nil, err
+	}
+	s.attachAuthors(messages)
+
+	return messages, nil
+}
+
+func (s *service) SendDirectMessage(userID, conversationID int, content string, replyToID int, attachmentIDs []int) (*domain.Message, error) {
+	conv, err := s.GetConversation(userID, conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, parent, err := s.saveMessage(userID, conversationID, content, replyToID, attachmentIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	s.notifyMessage(msg, parent, conv.MemberIDs)
+	s.unfurler.Unfurl(msg, conv.MemberIDs)
+
+	return msg, nil
+}
+
+// uniqueMembers returns the sorted, deduplicated member list including the
+// creator
+func uniqueMembers(userID int, memberIDs []int) []int {
+	seen := map[int]bool{userID: true}
+	members := []int{userID}
+
+	for _, id := range memberIDs {
+		if id <= 0 || seen[id] {
+			continue
+		}
+		seen[id] = true
+		members = append(members, id)
+	}
+
+	sort.Ints(members)
+	return members
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestService_StartConversation(t *testing.T) {
+	mockRepo := new(MockRepository)
+	mockUsers := new(MockUserRepository)
+	svc := newTestService(mockRepo, mockUsers)
+
+	existing := &domain.Conversation{ID: 3, MemberIDs: []int{1, 2}}
+
+	// Test existing one-to-one conversation is reused
+	mockUsers.On("GetUsersByIDs", []int{1, 2}).Return([]*domain.User{{ID: 1}, {ID: 2}}, nil)
+	mockRepo.On("FindDirectConversation", 1, 2).Return(existing, nil)
+
+	conv, err := svc.StartConversation(1, []int{2, 2, 1})
+	assert.NoError(t, err)
+	assert.Equal(t, existing, conv)
+
+	// Test new group conversation
+	mockUsers.On("GetUsersByIDs", []int{1, 2, 5}).Return([]*domain.User{{ID: 1}, {ID: 2}, {ID: 5}}, nil)
+	mockRepo.On("CreateConversation", mock.MatchedBy(func(c *domain.Conversation) bool {
+		return c.IsGroup && c.CreatedBy == 1
+	})).Return(nil)
+
+	conv, err = svc.StartConversation(1, []int{5, 2})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 2, 5}, conv.MemberIDs)
+
+	// Test one-to-one conversation created concurrently is returned
+	mockUsers.On("GetUsersByIDs", []int{1, 7}).Return([]*domain.User{{ID: 1}, {ID: 7}}, nil)
+	mockRepo.On("FindDirectConversation", 1, 7).Return(nil, domain.ErrConversationNotFound)
+	mockRepo.On("CreateConversation", mock.MatchedBy(func(c *domain.Conversation) bool {
+		return !c.IsGroup && c.CreatedBy == 1
+	})).Run(func(args mock.Arguments) {
+		*args.Get(0).(*domain.Conversation) = domain.Conversation{ID: 4, CreatedBy: 7, MemberIDs: []int{1, 7}}
+	}).Return(nil)
+
+	conv, err = svc.StartConversation(1, []int{7})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, conv.ID)
+	assert.Equal(t, 7, conv.CreatedBy)
+
+	// Test conversation with yourself only
+	_, err = svc.StartConversation(1, []int{1})
+	assert.ErrorIs(t, err, domain.ErrInvalidMembers)
+
+	// Test unknown member
+	mockUsers.On("GetUsersByIDs", []int{1, 9}).Return([]*domain.User{{ID: 1}}, nil)
+	_, err = svc.StartConversation(1, []int{9})
+	assert.ErrorIs(t, err, domain.ErrUserNotFound)
+
+	// Test too many members
+	tooMany := make([]int, domain.MaxConversationMembers)
+	for i := range tooMany {
+		tooMany[i] = i + 2
+	}
+	_, err = svc.StartConversation(1, tooMany)
+	assert.ErrorIs(t, err, domain.ErrTooManyMembers)
+
+	mockRepo.AssertExpectations(t)
+	mockUsers.AssertExpectations(t)
+}
+
+func TestService_SendDirectMessage(t *testing.T) {
+	mockRepo := new(MockRepository)
+	svc := newTestService(mockRepo, new(MockUserRepository))
+	mockRepo.On("GetSanctions", 2, true).Return([]*domain.Sanction{}, nil)
+
+	conv := &domain.Conversation{ID: 3, MemberIDs: []int{1, 2}}
+	mockRepo.On("GetConversation", 3).Return(conv, nil)
+	mockRepo.On("SaveMessage", mock.MatchedBy(func(msg *domain.Message) bool {
+		return msg.ConversationID == 3 && msg.UserID == 2
+	})).Return(nil)
+
+	// Test member can send
+	msg, err := svc.SendDirectMessage(2, 3, "hi", 0, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, msg.ConversationID)
+
+	// Test non-member is rejected
+	_, err = svc.SendDirectMessage(4, 3, "hi", 0, nil)
+	assert.ErrorIs(t, err, domain.ErrNotConversationMember)
+
+	// Test non-member can't read history
+	_, err = svc.GetConversationMessages(4, 3, 50)
+	assert.ErrorIs(t, err, domain.ErrNotConversationMember)
+
+	mockRepo.AssertExpectations(t)
+}
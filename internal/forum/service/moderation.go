@@ -0,0 +1,257 @@
+package service
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+	"github.com/chizheg/forum/pkg/audit"
+	"go.uber.org/zap"
+)
+
+const maxSanctionReasonLength = 500
+
+func (s *service) MuteUser(moderatorID, userID int, duration time.Duration, reason string, source audit.Source) (*domain.Sanction, error) {
+	if duration <= 0 || duration > domain.MaxMuteDuration {
+		return nil, domain.ErrInvalidDuration
+	}
+
+	return s.sanction(moderatorID, userID, domain.SanctionMute, duration, reason, source)
+}
+
+func (s *service) BanUser(moderatorID, userID int, duration time.Duration, reason string, source audit.Source) (*domain.Sanction, error) {
+	if duration < 0 {
+		return nil, domain.ErrInvalidDuration
+	}
+
+	sanction, err := s.sanction(moderatorID, userID, domain.SanctionBan, duration, reason, source)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.RemoveParticipant(userID); err != nil {
+		return nil, err
+	}
+
+	return sanction, nil
+}
+
+func (s *service) KickUser(moderatorID, userID int, reason string, source audit.Source) (*domain.Sanction, error) {
+	return s.sanction(moderatorID, userID, domain.SanctionKick, 0, reason, source)
+}
+
+func (s *service) LiftSanction(moderatorID, sanctionID int, source audit.Source) (*domain.Sanction, error) {
+	if err := s.requireModerator(moderatorID); err != nil {
+		return nil, err
+	}
+
+	sanction, err := s.repo.GetSanction(sanctionID)
+	if err != nil {
+		return nil, err
+	}
+
+	revoked, err := s.repo.RevokeSanction(sanctionID, moderatorID)
+	if err != nil {
+		return nil, err
+	}
+	if !revoked {
+		return nil, domain.ErrSanctionInactive
+	}
+
+	now := time.Now()
+	sanction.RevokedAt = &now
+	sanction.RevokedBy = moderatorID
+
+	s.audit(&audit.Entry{
+		ActorID:    moderatorID,
+		Action:     audit.ActionSanctionLifted,
+		TargetType: audit.TargetSanction,
+		TargetID:   sanction.ID,
+		Source:     source,
+		Details: map[string]any{
+			"user_id": sanction.UserID,
+			"type":    sanction.Type,
+		},
+	})
+	s.publishSanction("sanction_lifted", sanction, 0)
+
+	return sanction, nil
+}
+
+func (s *service) GetSanctions(moderatorID, userID int, activeOnly bool) ([]*domain.Sanction, error) {
+	if err := s.requireModerator(moderatorID); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetSanctions(userID, activeOnly)
+}
+
+func (s *service) CheckChatAccess(userID int) error {
+	sanction, err := activeSanction(s.repo, userID)
+	if err != nil {
+		return err
+	}
+
+	if sanction != nil && sanction.Type == domain.SanctionBan {
+		return &domain.SanctionError{Sanction: sanction}
+	}
+
+	return nil
+}
+
+func (s *service) CheckSendAccess(userID int) error {
+	return checkSendAccess(s.repo, userID)
+}
+
+// checkSendAccess returns a *domain.SanctionError if the user is banned or
+// muted
+func checkSendAccess(repo domain.Repository, userID int) error {
+	sanction, err := activeSanction(repo, userID)
+	if err != nil {
+		return err
+	}
+
+	if sanction != nil {
+		return &domain.SanctionError{Sanction: sanction}
+	}
+
+	return nil
+}
+
+// sanction records a sanction against the user and notifies their
+// clients, closing them on kicks and bans
+func (s *service) sanction(moderatorID, userID int, sanctionType domain.SanctionType, duration time.Duration, reason string, source audit.Source) (*domain.Sanction, error) {
+	if err := s.checkSanctionTarget(moderatorID, userID); err != nil {
+		return nil, err
+	}
+
+	reason = strings.TrimSpace(reason)
+	if utf8.RuneCountInString(reason) > maxSanctionReasonLength {
+		reason = string([]rune(reason)[:maxSanctionReasonLength])
+	}
+
+	sanction := &domain.Sanction{
+		UserID:      userID,
+		ModeratorID: moderatorID,
+		Type:        sanctionType,
+		Reason:      reason,
+	}
+
+	now := time.Now()
+	switch {
+	case sanctionType == domain.SanctionKick:
+		sanction.ExpiresAt = &now
+	case duration > 0:
+		expiresAt := now.Add(duration)
+		sanction.ExpiresAt = &expiresAt
+	}
+
+	if err := s.repo.CreateSanction(sanction); err != nil {
+		return nil, err
+	}
+
+	action := audit.ActionUserMuted
+	var closeCode int
+	switch sanctionType {
+	case domain.SanctionKick:
+		action = audit.ActionUserKicked
+		closeCode = domain.CloseCodeKicked
+	case domain.SanctionBan:
+		action = audit.ActionUserBanned
+		closeCode = domain.CloseCodeBanned
+	}
+
+	details := map[string]any{
+		"sanction_id": sanction.ID,
+		"reason":      sanction.Reason,
+	}
+	if sanctionType != domain.SanctionKick && sanction.ExpiresAt != nil {
+		details["expires_at"] = sanction.ExpiresAt
+	}
+	s.audit(&audit.Entry{
+		ActorID:    moderatorID,
+		Action:     action,
+		TargetType: audit.TargetUser,
+		TargetID:   userID,
+		Source:     source,
+		Details:    details,
+	})
+	s.publishSanction("sanction", sanction, closeCode)
+
+	return sanction, nil
+}
+
+// checkSanctionTarget makes sure the moderator may sanction the user.
+// Moderators can't be sanctioned by other moderators and admins can't be
+// sanctioned at all.
+func (s *service) checkSanctionTarget(moderatorID, userID int) error {
+	if moderatorID == userID {
+		return domain.ErrCannotSanction
+	}
+
+	users, err := s.users.GetUsersByIDs([]int{moderatorID, userID})
+	if err != nil {
+		return err
+	}
+
+	var moderator, target *domain.User
+	for _, u := range users {
+		switch u.ID {
+		case moderatorID:
+			moderator = u
+		case userID:
+			target = u
+		}
+	}
+
+	if moderator == nil || !moderator.IsModerator() {
+		return domain.ErrForbidden
+	}
+	if target == nil {
+		return domain.ErrUserNotFound
+	}
+	if target.Role == domain.RoleAdmin || (target.IsModerator() && moderator.Role != domain.RoleAdmin) {
+		return domain.ErrCannotSanction
+	}
+
+	return nil
+}
+
+// activeSanction returns the ban, or else the mute, in force for the user
+func activeSanction(repo domain.Repository, userID int) (*domain.Sanction, error) {
+	sanctions, err := repo.GetSanctions(userID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var mute *domain.Sanction
+	for _, sanction := range sanctions {
+		switch sanction.Type {
+		case domain.SanctionBan:
+			return sanction, nil
+		case domain.SanctionMute:
+			if mute == nil {
+				mute = sanction
+			}
+		}
+	}
+
+	return mute, nil
+}
+
+func (s *service) publishSanction(eventType string, sanction *domain.Sanction, closeCode int) {
+	err := s.broker.Publish(&domain.Event{
+		UserIDs: []int{sanction.UserID},
+		Message: domain.WebsocketMessage{
+			Type: eventType,
+			Payload: map[string]any{
+				"sanction": sanction,
+			},
+		},
+		CloseCode: closeCode,
+	})
+	if err != nil {
+		s.logger.Error("failed to publish sanction", zap.Error(err))
+	}
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/chizheg/forum/internal/forum/broker/memory"
+	"github.com/chizheg/forum/internal/forum/domain"
+	"github.com/chizheg/forum/pkg/audit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestService_BanUser(t *testing.T) {
+	mockRepo := new(MockRepository)
+	mockUsers := new(MockUserRepository)
+	broker := memory.NewBroker(zap.NewNop())
+	defer broker.Close()
+	events, cancel := broker.Subscribe()
+	defer cancel()
+	auditLog := new(MockAuditLog)
+	svc := NewService(mockRepo, mockUsers, broker, newTestAttachmentService(mockRepo, nil), new(MockSendLimiter), new(MockContentFilter), new(MockUnfurler), auditLog, zap.NewNop())
+
+	mockUsers.On("GetUsersByIDs", []int{1, 2}).Return([]*domain.User{
+		{ID: 2, Role: domain.RoleUser},
+		{ID: 1, Role: domain.RoleModerator},
+	}, nil)
+	mockRepo.On("CreateSanction", mock.MatchedBy(func(s *domain.Sanction) bool {
+		return s.UserID == 2 && s.ModeratorID == 1 && s.Type == domain.SanctionBan && s.ExpiresAt == nil && s.Reason == "spam"
+	})).Run(func(args mock.Arguments) {
+		args.Get(0).(*domain.Sanction).ID = 7
+	}).Return(nil)
+	mockRepo.On("RemoveParticipant", 2).Return(nil)
+
+	// Test permanent ban closes the connections of the user
+	source := audit.Source{IP: "203.0.113.7", UserAgent: "test"}
+	sanction, err := svc.BanUser(1, 2, 0, "  spam ", source)
+	require.NoError(t, err)
+	assert.Equal(t, 7, sanction.ID)
+
+	require.Len(t, auditLog.entries, 1)
+	assert.Equal(t, &audit.Entry{
+		ActorID:    1,
+		Action:     audit.ActionUserBanned,
+		TargetType: audit.TargetUser,
+		TargetID:   2,
+		Source:     source,
+		Details:    map[string]any{"sanction_id": 7, "reason": "spam"},
+	}, auditLog.entries[0])
+
+	event := <-events
+	assert.Equal(t, []int{2}, event.UserIDs)
+	assert.Equal(t, "sanction", event.Message.Type)
+	assert.Equal(t, domain.CloseCodeBanned, event.CloseCode)
+
+	// Test invalid duration
+	_, err = svc.BanUser(1, 2, -time.Hour, "", audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrInvalidDuration)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_SanctionPermissions(t *testing.T) {
+	mockRepo := new(MockRepository)
+	mockUsers := new(MockUserRepository)
+	svc := newTestService(mockRepo, mockUsers)
+
+	mockUsers.On("GetUsersByIDs", []int{1, 2}).Return([]*domain.User{{ID: 1, Role: domain.RoleModerator}, {ID: 2, Role: domain.RoleModerator}}, nil)
+	mockUsers.On("GetUsersByIDs", []int{3, 2}).Return([]*domain.User{{ID: 3, Role: domain.RoleAdmin}, {ID: 2, Role: domain.RoleModerator}}, nil)
+	mockUsers.On("GetUsersByIDs", []int{2, 3}).Return([]*domain.User{{ID: 2, Role: domain.RoleModerator}, {ID: 3, Role: domain.RoleAdmin}}, nil)
+	mockUsers.On("GetUsersByIDs", []int{4, 5}).Return([]*domain.User{{ID: 4, Role: domain.RoleUser}, {ID: 5, Role: domain.RoleUser}}, nil)
+	mockUsers.On("GetUsersByIDs", []int{1, 9}).Return([]*domain.User{{ID: 1, Role: domain.RoleModerator}}, nil)
+	mockRepo.On("CreateSanction", mock.Anything).Return(nil)
+
+	// Test regular users can't sanction
+	_, err := svc.KickUser(4, 5, "", audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrForbidden)
+
+	// Test moderators can't sanction each other, admins can
+	_, err = svc.MuteUser(1, 2, time.Hour, "", audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrCannotSanction)
+	_, err = svc.MuteUser(3, 2, time.Hour, "", audit.Source{})
+	assert.NoError(t, err)
+
+	// Test admins can't be sanctioned
+	_, err = svc.KickUser(2, 3, "", audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrCannotSanction)
+
+	// Test self sanction and unknown users
+	_, err = svc.KickUser(1, 1, "", audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrCannotSanction)
+	_, err = svc.KickUser(1, 9, "", audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrUserNotFound)
+
+	// Test mute duration limits
+	_, err = svc.MuteUser(3, 2, 0, "", audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrInvalidDuration)
+	_, err = svc.MuteUser(3, 2, domain.MaxMuteDuration+time.Hour, "", audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrInvalidDuration)
+
+	mockRepo.AssertNumberOfCalls(t, "CreateSanction", 1)
+}
+
+func TestService_SanctionsAreEnforced(t *testing.T) {
+	mockRepo := new(MockRepository)
+	svc := newTestService(mockRepo, new(MockUserRepository))
+
+	expiresAt := time.Now().Add(time.Hour)
+	mute := &domain.Sanction{ID: 1, UserID: 2, Type: domain.SanctionMute, ExpiresAt: &expiresAt}
+	ban := &domain.Sanction{ID: 2, UserID: 3, Type: domain.SanctionBan}
+	mockRepo.On("GetSanctions", 2, true).Return([]*domain.Sanction{mute}, nil)
+	mockRepo.On("GetSanctions", 3, true).Return([]*domain.Sanction{mute, ban}, nil)
+	mockRepo.On("AddParticipant", 2).Return(nil)
+
+	// Test muted users can't send but may join
+	_, err := svc.SendMessage(2, "hello", 0, nil)
+	assert.ErrorIs(t, err, domain.ErrMuted)
+	var sanctionErr *domain.SanctionError
+	require.True(t, errors.As(err, &sanctionErr))
+	assert.Equal(t, mute, sanctionErr.Sanction)
+	assert.NoError(t, svc.JoinChat(2))
+
+	// Test the ban wins over the mute
+	_, err = svc.SendMessage(3, "hello", 0, nil)
+	assert.ErrorIs(t, err, domain.ErrBanned)
+	assert.ErrorIs(t, svc.JoinChat(3), domain.ErrBanned)
+	assert.ErrorIs(t, svc.CheckChatAccess(3), domain.ErrBanned)
+	assert.ErrorIs(t, svc.CheckSendAccess(2), domain.ErrMuted)
+	assert.ErrorIs(t, svc.CheckSendAccess(3), domain.ErrBanned)
+
+	mockRepo.AssertNotCalled(t, "SaveMessage", mock.Anything)
+	mockRepo.AssertNotCalled(t, "AddParticipant", 3)
+}
+
+func TestService_LiftSanction(t *testing.T) {
+	mockRepo := new(MockRepository)
+	mockUsers := new(MockUserRepository)
+	svc := newTestService(mockRepo, mockUsers)
+
+	mockUsers.On("GetUsersByIDs", []int{1}).Return([]*domain.User{{ID: 1, Role: domain.RoleModerator}}, nil)
+	mockRepo.On("GetSanction", 7).Return(&domain.Sanction{ID: 7, UserID: 2, Type: domain.SanctionMute}, nil)
+
+	mockRepo.On("RevokeSanction", 7, 1).Return(true, nil).Once()
+	sanction, err := svc.LiftSanction(1, 7, audit.Source{})
+	require.NoError(t, err)
+	assert.NotNil(t, sanction.RevokedAt)
+	assert.Equal(t, 1, sanction.RevokedBy)
+
+	// Test lifting twice
+	mockRepo.On("RevokeSanction", 7, 1).Return(false, nil).Once()
+	_, err = svc.LiftSanction(1, 7, audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrSanctionInactive)
+
+	mockRepo.AssertExpectations(t)
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"regexp"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+	"go.uber.org/zap"
+)
+
+// maxMentions limits how many users a single message can notify
+const maxMentions = 20
+
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@(\w[\w.-]*\w|\w)`)
+
+func (s *service) GetNotifications(userID int, unreadOnly bool, limit int) ([]*domain.Notification, error) {
+	return s.repo.GetNotifications(userID, unreadOnly, limit)
+}
+
+func (s *service) MarkNotificationsRead(userID int, ids []int) (int, error) {
+	return s.repo.MarkNotificationsRead(userID, ids)
+}
+
+// notifyMessage tells the author of the parent message about the reply
+// and notifies the users mentioned in the message. Nobody is notified
+// twice about the same message. Only members can be notified about direct
+// messages, pass nil for the public chat. Failures are logged and don't
+// affect sending the message.
+func (s *service) notifyMessage(msg *domain.Message, parent *domain.Message, members []int) {
+	notified := map[int]bool{msg.UserID: true}
+
+	if parent != nil && !notified[parent.UserID] {
+		notified[parent.UserID] = true
+		s.notify(&domain.Notification{
+			UserID:         parent.UserID,
+			Type:           domain.NotificationReply,
+			ActorID:        msg.UserID,
+			MessageID:      msg.ID,
+			ConversationID: msg.ConversationID,
+		})
+	}
+
+	usernames := parseMentions(msg.Content)
+	if len(usernames) == 0 {
+		return
+	}
+
+	users, err := s.users.GetUsersByUsernames(usernames)
+	if err != nil {
+		s.logger.Error("failed to resolve mentions", zap.Error(err))
+		return
+	}
+
+	for _, user := range users {
+		if notified[user.ID] {
+			continue
+		}
+		if members != nil && !containsID(members, user.ID) {
+			continue
+		}
+		notified[user.ID] = true
+
+		s.notify(&domain.Notification{
+			UserID:         user.ID,
+			Type:           domain.NotificationMention,
+			ActorID:        msg.UserID,
+			MessageID:      msg.ID,
+			ConversationID: msg.ConversationID,
+		})
+	}
+}
+
+// notify stores the notification and pushes it to the user's connections
+func (s *service) notify(n *domain.Notification) {
+	if err := s.repo.CreateNotification(n); err != nil {
+		s.logger.Error("failed to create notification", zap.Error(err))
+		return
+	}
+
+	payload := map[string]any{
+		"id":         n.ID,
+		"type":       n.Type,
+		"actor_id":   n.ActorID,
+		"message_id": n.MessageID,
+		"created_at": n.CreatedAt,
+	}
+	if n.ConversationID != domain.PublicConversationID {
+		payload["conversation_id"] = n.ConversationID
+	}
+
+	err := s.broker.Publish(&domain.Event{
+		UserIDs: []int{n.UserID},
+		Message: domain.WebsocketMessage{
+			Type:    "notification",
+			Payload: payload,
+		},
+	})
+	if err != nil {
+		s.logger.Error("failed to publish notification", zap.Error(err))
+	}
+}
+
+// parseMentions returns the unique usernames mentioned as @username
+func parseMentions(content string) []string {
+	var usernames []string
+	seen := make(map[string]bool)
+
+	for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		username := match[1]
+		if seen[username] {
+			continue
+		}
+		seen[username] = true
+
+		usernames = append(usernames, username)
+		if len(usernames) == maxMentions {
+			break
+		}
+	}
+
+	return usernames
+}
+
+func containsID(ids []int, id int) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chizheg/forum/internal/forum/broker/memory"
+	"github.com/chizheg/forum/internal/forum/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestParseMentions(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected []string
+	}{
+		{
+			name:     "single mention",
+			content:  "hi @alice",
+			expected: []string{"alice"},
+		},
+		{
+			name:     "multiple mentions with punctuation",
+			content:  "@bob, @carol.smith: look. @bob again!",
+			expected: []string{"bob", "carol.smith"},
+		},
+		{
+			name:     "email is not a mention",
+			content:  "write to me@example.com",
+			expected: nil,
+		},
+		{
+			name:     "lonely at sign",
+			content:  "meet @ 5",
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, parseMentions(tt.content))
+		})
+	}
+}
+
+func TestService_SendMessageNotifiesMentions(t *testing.T) {
+	mockRepo := new(MockRepository)
+	mockUsers := new(MockUserRepository)
+	broker := memory.NewBroker(zap.NewNop())
+	defer broker.Close()
+	events, cancel := broker.Subscribe()
+	defer cancel()
+
+	svc := NewService(mockRepo, mockUsers, broker, newTestAttachmentService(mockRepo, nil), new(MockSendLimiter), new(MockContentFilter), new(MockUnfurler), new(MockAuditLog), zap.NewNop())
+	mockRepo.On("GetSanctions", 1, true).Return([]*domain.Sanction{}, nil)
+
+	mockRepo.On("SaveMessage", mock.AnythingOfType("*domain.Message")).Run(func(args mock.Arguments) {
+		args.Get(0).(*domain.Message).ID = 10
+	}).Return(nil)
+	mockUsers.On("GetUsersByUsernames", []string{"bob", "alice"}).Return([]*domain.User{
+		{ID: 1, Username: "alice"},
+		{ID: 2, Username: "bob"},
+	}, nil)
+	mockRepo.On("CreateNotification", mock.MatchedBy(func(n *domain.Notification) bool {
+		return n.UserID == 2 && n.ActorID == 1 && n.MessageID == 10 && n.Type == domain.NotificationMention
+	})).Run(func(args mock.Arguments) {
+		args.Get(0).(*domain.Notification).ID = 5
+	}).Return(nil)
+
+	// Mentioning yourself doesn't notify
+	_, err := svc.SendMessage(1, "@bob meet @alice", 0, nil)
+	require.NoError(t, err)
+
+	select {
+	case event := <-events:
+		assert.Equal(t, []int{2}, event.UserIDs)
+		assert.Equal(t, "notification", event.Message.Type)
+		assert.Equal(t, 5, event.Message.Payload["id"])
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for notification")
+	}
+
+	mockRepo.AssertExpectations(t)
+	mockUsers.AssertExpectations(t)
+}
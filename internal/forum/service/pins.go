@@ -0,0 +1,97 @@
+package service
+
+import (
+	"github.com/chizheg/forum/internal/forum/domain"
+)
+
+func (s *service) PinMessage(userID, messageID int) (*domain.PinnedMessage, error) {
+	if err := s.requireModerator(userID); err != nil {
+		return nil, err
+	}
+
+	msg, err := s.getVisibleMessage(userID, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	pin := &domain.PinnedMessage{
+		Message:  msg,
+		PinnedBy: userID,
+	}
+
+	pinned, err := s.repo.PinMessage(pin)
+	if err != nil {
+		return nil, err
+	}
+	if !pinned {
+		return nil, domain.ErrAlreadyPinned
+	}
+
+	if err := s.enrichMessages([]*domain.Message{msg}); err != nil {
+		return nil, err
+	}
+
+	return pin, nil
+}
+
+func (s *service) UnpinMessage(userID, messageID int) (*domain.Message, error) {
+	if err := s.requireModerator(userID); err != nil {
+		return nil, err
+	}
+
+	msg, err := s.getVisibleMessage(userID, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	unpinned, err := s.repo.UnpinMessage(messageID)
+	if err != nil {
+		return nil, err
+	}
+	if !unpinned {
+		return nil, domain.ErrMessageNotPinned
+	}
+
+	return msg, nil
+}
+
+func (s *service) GetPinnedMessages(userID, conversationID int) ([]*domain.PinnedMessage, error) {
+	if conversationID != domain.PublicConversationID {
+		if _, err := s.GetConversation(userID, conversationID); err != nil {
+			return nil, err
+		}
+	}
+
+	pins, err := s.repo.GetPinnedMessages(conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]*domain.Message, len(pins))
+	for i, pin := range pins {
+		messages[i] = pin.Message
+	}
+
+	if err := s.enrichMessages(messages); err != nil {
+		return nil, err
+	}
+
+	return pins, nil
+}
+
+// requireModerator checks the role of the user with the auth service
+func (s *service) requireModerator(userID int) error {
+	users, err := s.users.GetUsersByIDs([]int{userID})
+	if err != nil {
+		return err
+	}
+	if len(users) == 0 {
+		return domain.ErrUserNotFound
+	}
+
+	if !users[0].IsModerator() {
+		return domain.ErrForbidden
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestService_PinMessage(t *testing.T) {
+	mockRepo := new(MockRepository)
+	mockUsers := new(MockUserRepository)
+	svc := newTestService(mockRepo, mockUsers)
+
+	mockUsers.On("GetUsersByIDs", []int{1}).Return([]*domain.User{{ID: 1, Role: domain.RoleModerator}}, nil)
+	mockRepo.On("GetMessageByID", 5).Return(&domain.Message{ID: 5, UserID: 2}, nil)
+	mockRepo.On("GetAttachments", []int{5}).Return(map[int][]*domain.Attachment{}, nil)
+	mockRepo.On("GetLinkPreviews", []int{5}).Return(map[int][]*domain.LinkPreview{}, nil)
+	mockRepo.On("GetReactions", []int{5}).Return(map[int][]*domain.Reaction{}, nil)
+
+	// Test successful pin
+	mockRepo.On("PinMessage", mock.MatchedBy(func(pin *domain.PinnedMessage) bool {
+		return pin.Message.ID == 5 && pin.PinnedBy == 1
+	})).Return(true, nil).Once()
+	pin, err := svc.PinMessage(1, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, pin.Message.ID)
+	assert.Equal(t, 1, pin.PinnedBy)
+
+	// Test pinning twice
+	mockRepo.On("PinMessage", mock.Anything).Return(false, nil).Once()
+	_, err = svc.PinMessage(1, 5)
+	assert.ErrorIs(t, err, domain.ErrAlreadyPinned)
+
+	// Test unpin
+	mockRepo.On("UnpinMessage", 5).Return(true, nil).Once()
+	msg, err := svc.UnpinMessage(1, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, msg.ID)
+
+	// Test unpinning a message that is not pinned
+	mockRepo.On("UnpinMessage", 5).Return(false, nil).Once()
+	_, err = svc.UnpinMessage(1, 5)
+	assert.ErrorIs(t, err, domain.ErrMessageNotPinned)
+
+	mockRepo.AssertExpectations(t)
+	mockUsers.AssertExpectations(t)
+}
+
+func TestService_PinMessageRequiresModerator(t *testing.T) {
+	mockRepo := new(MockRepository)
+	mockUsers := new(MockUserRepository)
+	svc := newTestService(mockRepo, mockUsers)
+
+	mockUsers.On("GetUsersByIDs", []int{1}).Return([]*domain.User{{ID: 1, Role: domain.RoleUser}}, nil)
+	mockUsers.On("GetUsersByIDs", []int{9}).Return([]*domain.User{}, nil)
+
+	// Test regular user
+	_, err := svc.PinMessage(1, 5)
+	assert.ErrorIs(t, err, domain.ErrForbidden)
+
+	_, err = svc.UnpinMessage(1, 5)
+	assert.ErrorIs(t, err, domain.ErrForbidden)
+
+	// Test unknown user
+	_, err = svc.PinMessage(9, 5)
+	assert.ErrorIs(t, err, domain.ErrUserNotFound)
+
+	mockRepo.AssertNotCalled(t, "PinMessage", mock.Anything)
+	mockRepo.AssertNotCalled(t, "UnpinMessage", mock.Anything)
+}
+
+func TestService_GetPinnedMessages(t *testing.T) {
+	mockRepo := new(MockRepository)
+	svc := newTestService(mockRepo, new(MockUserRepository))
+
+	pins := []*domain.PinnedMessage{{Message: &domain.Message{ID: 3}, PinnedBy: 1}}
+	mockRepo.On("GetPinnedMessages", domain.PublicConversationID).Return(pins, nil)
+	mockRepo.On("GetAttachments", []int{3}).Return(map[int][]*domain.Attachment{}, nil)
+	mockRepo.On("GetLinkPreviews", []int{3}).Return(map[int][]*domain.LinkPreview{}, nil)
+	mockRepo.On("GetReactions", []int{3}).Return(map[int][]*domain.Reaction{}, nil)
+
+	// Test public chat
+	result, err := svc.GetPinnedMessages(1, domain.PublicConversationID)
+	assert.NoError(t, err)
+	assert.Equal(t, pins, result)
+
+	// Test conversation the user is not a member of
+	mockRepo.On("GetConversation", 4).Return(&domain.Conversation{ID: 4, MemberIDs: []int{2, 3}}, nil)
+	_, err = svc.GetPinnedMessages(1, 4)
+	assert.ErrorIs(t, err, domain.ErrNotConversationMember)
+
+	mockRepo.AssertExpectations(t)
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"sort"
+	"time"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+)
+
+// aggregateStatus returns the status of a user with the given connection
+// statuses
+func aggregateStatus(statuses []domain.PresenceStatus) domain.PresenceStatus {
+	if len(statuses) == 0 {
+		return domain.PresenceOffline
+	}
+
+	for _, status := range statuses {
+		if status == domain.PresenceOnline {
+			return domain.PresenceOnline
+		}
+	}
+
+	return domain.PresenceAway
+}
+
+func connStatuses(conns map[string]domain.PresenceStatus) []domain.PresenceStatus {
+	statuses := make([]domain.PresenceStatus, 0, len(conns))
+	for _, status := range conns {
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+type presenceService struct {
+	store domain.PresenceStore
+	now   func() time.Time
+}
+
+// NewPresenceService creates a presence tracker keeping the connections in
+// the store, users connected to other instances are only seen with a
+// shared store
+func NewPresenceService(store domain.PresenceStore) domain.PresenceService {
+	return &presenceService{
+		store: store,
+		now:   time.Now,
+	}
+}
+
+func (s *presenceService) Connect(userID int, connID string) (*domain.Presence, error) {
+	return s.update(userID, func(conns map[string]domain.PresenceStatus) {
+		conns[connID] = domain.PresenceOnline
+	})
+}
+
+func (s *presenceService) SetStatus(userID int, connID string, status domain.PresenceStatus) (*domain.Presence, error) {
+	if status != domain.PresenceOnline && status != domain.PresenceAway {
+		return nil, nil
+	}
+
+	return s.update(userID, func(conns map[string]domain.PresenceStatus) {
+		if _, ok := conns[connID]; ok {
+			conns[connID] = status
+		}
+	})
+}
+
+func (s *presenceService) Disconnect(userID int, connID string) (*domain.Presence, error) {
+	return s.update(userID, func(conns map[string]domain.PresenceStatus) {
+		delete(conns, connID)
+	})
+}
+
+func (s *presenceService) GetStatus(userID int) (domain.PresenceStatus, error) {
+	conns, err := s.store.GetConnections(userID)
+	if err != nil {
+		return "", err
+	}
+
+	statuses := make([]domain.PresenceStatus, len(conns))
+	for i, conn := range conns {
+		statuses[i] = conn.Status
+	}
+
+	return aggregateStatus(statuses), nil
+}
+
+func (s *presenceService) GetOnline() ([]*domain.Presence, error) {
+	conns, err := s.store.GetConnections(0)
+	if err != nil {
+		return nil, err
+	}
+
+	users := make(map[int][]*domain.Connection)
+	for _, conn := range conns {
+		users[conn.UserID] = append(users[conn.UserID], conn)
+	}
+
+	online := make([]*domain.Presence, 0, len(users))
+	for userID, conns := range users {
+		p := &domain.Presence{UserID: userID}
+		statuses := make([]domain.PresenceStatus, len(conns))
+		for i, conn := range conns {
+			statuses[i] = conn.Status
+			if conn.UpdatedAt.After(p.LastSeen) {
+				p.LastSeen = conn.UpdatedAt
+			}
+		}
+		p.Status = aggregateStatus(statuses)
+		online = append(online, p)
+	}
+
+	sort.Slice(online, func(i, j int) bool {
+		return online[i].UserID < online[j].UserID
+	})
+
+	return online, nil
+}
+
+// update applies fn to the user's connections and reports the new presence
+// if the aggregated status changed
+func (s *presenceService) update(userID int, fn func(conns map[string]domain.PresenceStatus)) (*domain.Presence, error) {
+	var before, after domain.PresenceStatus
+	err := s.store.Update(userID, func(conns map[string]domain.PresenceStatus) {
+		before = aggregateStatus(connStatuses(conns))
+		fn(conns)
+		after = aggregateStatus(connStatuses(conns))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if before == after {
+		return nil, nil
+	}
+
+	return &domain.Presence{
+		UserID:   userID,
+		Status:   after,
+		LastSeen: s.now(),
+	}, nil
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+	"github.com/chizheg/forum/internal/forum/presence/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func assertStatus(t *testing.T, svc domain.PresenceService, userID int, expected domain.PresenceStatus) {
+	t.Helper()
+	status, err := svc.GetStatus(userID)
+	require.NoError(t, err)
+	assert.Equal(t, expected, status)
+}
+
+func TestPresenceService_MultipleTabs(t *testing.T) {
+	svc := NewPresenceService(memory.NewStore())
+
+	// First tab brings the user online
+	p, err := svc.Connect(1, "tab-1")
+	require.NoError(t, err)
+	require.NotNil(t, p)
+	assert.Equal(t, domain.PresenceOnline, p.Status)
+
+	// Second tab does not change anything
+	p, err = svc.Connect(1, "tab-2")
+	require.NoError(t, err)
+	assert.Nil(t, p)
+
+	// User stays online while one tab is active
+	p, err = svc.SetStatus(1, "tab-1", domain.PresenceAway)
+	require.NoError(t, err)
+	assert.Nil(t, p)
+	assertStatus(t, svc, 1, domain.PresenceOnline)
+
+	// All tabs idle makes the user away
+	p, err = svc.SetStatus(1, "tab-2", domain.PresenceAway)
+	require.NoError(t, err)
+	require.NotNil(t, p)
+	assert.Equal(t, domain.PresenceAway, p.Status)
+
+	// Closing an idle tab keeps the user away
+	p, err = svc.Disconnect(1, "tab-1")
+	require.NoError(t, err)
+	assert.Nil(t, p)
+
+	// Closing the last tab makes the user offline
+	p, err = svc.Disconnect(1, "tab-2")
+	require.NoError(t, err)
+	require.NotNil(t, p)
+	assert.Equal(t, domain.PresenceOffline, p.Status)
+	assertStatus(t, svc, 1, domain.PresenceOffline)
+}
+
+func TestPresenceService_SetStatus(t *testing.T) {
+	svc := NewPresenceService(memory.NewStore())
+	svc.Connect(1, "tab-1")
+
+	// Unknown connections and statuses are ignored
+	p, err := svc.SetStatus(1, "tab-2", domain.PresenceAway)
+	require.NoError(t, err)
+	assert.Nil(t, p)
+	p, err = svc.SetStatus(1, "tab-1", domain.PresenceOffline)
+	require.NoError(t, err)
+	assert.Nil(t, p)
+	assertStatus(t, svc, 1, domain.PresenceOnline)
+
+	// Coming back from away
+	svc.SetStatus(1, "tab-1", domain.PresenceAway)
+	p, err = svc.SetStatus(1, "tab-1", domain.PresenceOnline)
+	require.NoError(t, err)
+	require.NotNil(t, p)
+	assert.Equal(t, domain.PresenceOnline, p.Status)
+}
+
+func TestPresenceService_GetOnline(t *testing.T) {
+	svc := NewPresenceService(memory.NewStore())
+	svc.Connect(2, "tab-1")
+	svc.Connect(1, "tab-2")
+	svc.SetStatus(1, "tab-2", domain.PresenceAway)
+	svc.Connect(3, "tab-3")
+	svc.Disconnect(3, "tab-3")
+
+	online, err := svc.GetOnline()
+	require.NoError(t, err)
+	require.Len(t, online, 2)
+	assert.Equal(t, 1, online[0].UserID)
+	assert.Equal(t, domain.PresenceAway, online[0].Status)
+	assert.False(t, online[0].LastSeen.IsZero())
+	assert.Equal(t, 2, online[1].UserID)
+	assert.Equal(t, domain.PresenceOnline, online[1].Status)
+}
+
+// TestPresenceService_SharedStore checks users connected to another
+// instance are seen through a shared store
+func TestPresenceService_SharedStore(t *testing.T) {
+	store := memory.NewStore()
+	first := NewPresenceService(store)
+	second := NewPresenceService(store)
+
+	p, err := first.Connect(1, "instance-1-tab")
+	require.NoError(t, err)
+	require.NotNil(t, p)
+
+	// A second tab on the other instance does not change the status
+	p, err = second.Connect(1, "instance-2-tab")
+	require.NoError(t, err)
+	assert.Nil(t, p)
+
+	online, err := second.GetOnline()
+	require.NoError(t, err)
+	require.Len(t, online, 1)
+	assert.Equal(t, 1, online[0].UserID)
+
+	p, err = first.Disconnect(1, "instance-1-tab")
+	require.NoError(t, err)
+	assert.Nil(t, p)
+	assertStatus(t, first, 1, domain.PresenceOnline)
+}
@@ -0,0 +1,214 @@
+package service
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+)
+
+const (
+	defaultSendRate            = 1
+	defaultSendBurst           = 5
+	defaultNewAccountSendRate  = 0.2
+	defaultNewAccountSendBurst = 3
+	defaultNewAccountAge       = 24 * time.Hour
+	defaultDuplicateWindow     = 30 * time.Second
+	sendLimiterSweepInterval   = 10 * time.Minute
+)
+
+// RateLimitConfig holds the flood control configuration of sending messages
+type RateLimitConfig struct {
+	// Rate is how many messages per second a user may send on average
+	Rate float64
+	// Burst is how many messages a user may send at once
+	Burst int
+	// NewAccountRate and NewAccountBurst apply to accounts younger than
+	// NewAccountAge
+	NewAccountRate  float64
+	NewAccountBurst int
+	NewAccountAge   time.Duration
+	// DuplicateWindow is how long the same text may not be sent again to
+	// the same conversation
+	DuplicateWindow time.Duration
+}
+
+type sentMessage struct {
+	conversationID int
+	hash           [sha256.Size]byte
+	sentAt         time.Time
+}
+
+// sendBucket is the token bucket of a single user
+type sendBucket struct {
+	tokens     float64
+	updated    time.Time
+	newAccount time.Time // end of the new account period
+	recent     []sentMessage
+}
+
+type sendLimiter struct {
+	users     domain.UserRepository
+	cfg       RateLimitConfig
+	mu        sync.Mutex
+	buckets   map[int]*sendBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewSendLimiter creates an in-memory flood control of sending messages.
+// The users are looked up once to find out how old their accounts are.
+func NewSendLimiter(users domain.UserRepository, cfg RateLimitConfig) domain.SendLimiter {
+	if cfg.Rate <= 0 {
+		cfg.Rate = defaultSendRate
+	}
+	if cfg.Burst <= 0 {
+		cfg.Burst = defaultSendBurst
+	}
+	if cfg.NewAccountRate <= 0 {
+		cfg.NewAccountRate = defaultNewAccountSendRate
+	}
+	if cfg.NewAccountBurst <= 0 {
+		cfg.NewAccountBurst = defaultNewAccountSendBurst
+	}
+	if cfg.NewAccountAge <= 0 {
+		cfg.NewAccountAge = defaultNewAccountAge
+	}
+	if cfg.DuplicateWindow <= 0 {
+		cfg.DuplicateWindow = defaultDuplicateWindow
+	}
+
+	return &sendLimiter{
+		users:   users,
+		cfg:     cfg,
+		buckets: make(map[int]*sendBucket),
+		now:     time.Now,
+	}
+}
+
+func (l *sendLimiter) Allow(userID, conversationID int, content string) error {
+	l.mu.Lock()
+	bucket, ok := l.buckets[userID]
+	l.mu.Unlock()
+
+	if !ok {
+		// Look the user up without holding the lock
+		var err error
+		bucket, err = l.newBucket(userID)
+		if err != nil {
+			return err
+		}
+
+		l.mu.Lock()
+		if existing, ok := l.buckets[userID]; ok {
+			bucket = existing
+		} else {
+			l.buckets[userID] = bucket
+		}
+		l.mu.Unlock()
+	}
+
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rate, burst := l.cfg.Rate, l.cfg.Burst
+	if now.Before(bucket.newAccount) {
+		rate, burst = l.cfg.NewAccountRate, l.cfg.NewAccountBurst
+	}
+
+	bucket.tokens = math.Min(float64(burst), bucket.tokens+now.Sub(bucket.updated).Seconds()*rate)
+	bucket.updated = now
+	l.sweep(now)
+
+	// Forget messages that may be repeated again
+	recent := bucket.recent[:0]
+	for _, sent := range bucket.recent {
+		if now.Sub(sent.sentAt) < l.cfg.DuplicateWindow {
+			recent = append(recent, sent)
+		}
+	}
+	bucket.recent = recent
+
+	var hash [sha256.Size]byte
+	if content != "" {
+		hash = sha256.Sum256([]byte(normalizeContent(content)))
+		for _, sent := range bucket.recent {
+			if sent.conversationID == conversationID && sent.hash == hash {
+				return &domain.RateLimitError{
+					Err:        domain.ErrDuplicateMessage,
+					RetryAfter: l.cfg.DuplicateWindow - now.Sub(sent.sentAt),
+				}
+			}
+		}
+	}
+
+	if bucket.tokens < 1 {
+		return &domain.RateLimitError{
+			Err:        domain.ErrRateLimited,
+			RetryAfter: time.Duration((1 - bucket.tokens) / rate * float64(time.Second)),
+		}
+	}
+	bucket.tokens--
+
+	if content != "" {
+		bucket.recent = append(bucket.recent, sentMessage{
+			conversationID: conversationID,
+			hash:           hash,
+			sentAt:         now,
+		})
+	}
+
+	return nil
+}
+
+// newBucket creates a full bucket of the user, new accounts get the
+// stricter limits
+func (l *sendLimiter) newBucket(userID int) (*sendBucket, error) {
+	users, err := l.users.GetUsersByIDs([]int{userID})
+	if err != nil {
+		return nil, fmt.Errorf("error getting user: %w", err)
+	}
+	if len(users) == 0 {
+		return nil, domain.ErrUserNotFound
+	}
+
+	bucket := &sendBucket{
+		updated:    l.now(),
+		newAccount: users[0].CreatedAt.Add(l.cfg.NewAccountAge),
+	}
+
+	bucket.tokens = float64(l.cfg.Burst)
+	if bucket.updated.Before(bucket.newAccount) {
+		bucket.tokens = float64(l.cfg.NewAccountBurst)
+	}
+
+	return bucket, nil
+}
+
+// sweep drops the buckets of users who have not sent anything for a while,
+// their buckets are full again by then. Must be called with the lock held
+// after the bucket of the current user has been updated.
+func (l *sendLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sendLimiterSweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for userID, bucket := range l.buckets {
+		if now.Sub(bucket.updated) >= sendLimiterSweepInterval {
+			delete(l.buckets, userID)
+		}
+	}
+}
+
+// normalizeContent makes messages differing only in case and spacing
+// count as duplicates
+func normalizeContent(content string) string {
+	return strings.ToLower(strings.Join(strings.Fields(content), " "))
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSendLimiter(users domain.UserRepository, now *time.Time) *sendLimiter {
+	l := NewSendLimiter(users, RateLimitConfig{
+		Rate:            1,
+		Burst:           3,
+		NewAccountRate:  0.1,
+		NewAccountBurst: 1,
+		NewAccountAge:   time.Hour,
+		DuplicateWindow: 10 * time.Second,
+	}).(*sendLimiter)
+	l.now = func() time.Time { return *now }
+	return l
+}
+
+func TestSendLimiter_TokenBucket(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	mockUsers := new(MockUserRepository)
+	mockUsers.On("GetUsersByIDs", []int{1}).Return([]*domain.User{{ID: 1, CreatedAt: now.AddDate(0, -1, 0)}}, nil).Once()
+	l := newTestSendLimiter(mockUsers, &now)
+
+	// Test the burst is allowed
+	for _, content := range []string{"a", "b", "c"} {
+		assert.NoError(t, l.Allow(1, 0, content))
+	}
+
+	// Test the next message waits for a token
+	err := l.Allow(1, 0, "d")
+	var limitErr *domain.RateLimitError
+	require.True(t, errors.As(err, &limitErr))
+	assert.ErrorIs(t, err, domain.ErrRateLimited)
+	assert.Equal(t, time.Second, limitErr.RetryAfter)
+
+	// Test tokens are refilled over time
+	now = now.Add(time.Second)
+	assert.NoError(t, l.Allow(1, 0, "d"))
+
+	// Test the user is looked up once
+	mockUsers.AssertExpectations(t)
+}
+
+func TestSendLimiter_NewAccount(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	mockUsers := new(MockUserRepository)
+	mockUsers.On("GetUsersByIDs", []int{2}).Return([]*domain.User{{ID: 2, CreatedAt: now.Add(-time.Minute)}}, nil)
+	l := newTestSendLimiter(mockUsers, &now)
+
+	assert.NoError(t, l.Allow(2, 0, "a"))
+	assert.ErrorIs(t, l.Allow(2, 0, "b"), domain.ErrRateLimited)
+
+	now = now.Add(10 * time.Second)
+	assert.NoError(t, l.Allow(2, 0, "b"))
+
+	// Test the regular limits apply once the account is old enough
+	now = now.Add(time.Hour)
+	for _, content := range []string{"c", "d", "e"} {
+		assert.NoError(t, l.Allow(2, 0, content))
+	}
+}
+
+func TestSendLimiter_Duplicates(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	mockUsers := new(MockUserRepository)
+	mockUsers.On("GetUsersByIDs", []int{1}).Return([]*domain.User{{ID: 1, CreatedAt: now.AddDate(-1, 0, 0)}}, nil)
+	l := newTestSendLimiter(mockUsers, &now)
+
+	assert.NoError(t, l.Allow(1, 0, "Buy  now"))
+
+	// Test case and spacing are ignored
+	err := l.Allow(1, 0, "buy now")
+	assert.ErrorIs(t, err, domain.ErrRateLimited)
+	assert.ErrorIs(t, err, domain.ErrDuplicateMessage)
+
+	// Test the same text may be sent to another conversation
+	assert.NoError(t, l.Allow(1, 5, "buy now"))
+
+	// Test messages without text are not duplicates
+	assert.NoError(t, l.Allow(1, 0, ""))
+
+	// Test the text may be repeated after the window
+	now = now.Add(10 * time.Second)
+	assert.NoError(t, l.Allow(1, 0, "buy now"))
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+)
+
+// maxEmojiLength allows for skin tones and joined emoji sequences
+const maxEmojiLength = 8
+
+func (s *service) ToggleReaction(userID, messageID int, emoji string) (*domain.ReactionUpdate, error) {
+	if !validEmoji(emoji) {
+		return nil, domain.ErrInvalidEmoji
+	}
+
+	msg, err := s.getVisibleMessage(userID, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	added, err := s.repo.AddReaction(messageID, userID, emoji)
+	if err != nil {
+		return nil, err
+	}
+
+	// The reaction was already there, toggle it off
+	if !added {
+		if _, err := s.repo.RemoveReaction(messageID, userID, emoji); err != nil {
+			return nil, err
+		}
+	}
+
+	reactions, err := s.repo.GetReactions([]int{messageID})
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.ReactionUpdate{
+		MessageID:      messageID,
+		ConversationID: msg.ConversationID,
+		UserID:         userID,
+		Emoji:          emoji,
+		Added:          added,
+		Reactions:      reactions[messageID],
+	}, nil
+}
+
+// attachReactions fills in the aggregated reactions of the messages
+func (s *service) attachReactions(messages []*domain.Message) error {
+	ids := make([]int, len(messages))
+	for i, msg := range messages {
+		ids[i] = msg.ID
+	}
+
+	reactions, err := s.repo.GetReactions(ids)
+	if err != nil {
+		return err
+	}
+
+	for _, msg := range messages {
+		msg.Reactions = reactions[msg.ID]
+	}
+
+	return nil
+}
+
+// emojiTable holds the code points of emoji, including symbols only shown
+// as emoji with a variation selector
+var emojiTable = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x00a9, Hi: 0x00ae, Stride: 5},
+		{Lo: 0x203c, Hi: 0x2049, Stride: 13},
+		{Lo: 0x2122, Hi: 0x2139, Stride: 23},
+		{Lo: 0x2194, Hi: 0x2199, Stride: 1},
+		{Lo: 0x21a9, Hi: 0x21aa, Stride: 1},
+		{Lo: 0x231a, Hi: 0x231b, Stride: 1},
+		{Lo: 0x2328, Hi: 0x2328, Stride: 1},
+		{Lo: 0x23cf, Hi: 0x23cf, Stride: 1},
+		{Lo: 0x23e9, Hi: 0x23f3, Stride: 1},
+		{Lo: 0x23f8, Hi: 0x23fa, Stride: 1},
+		{Lo: 0x24c2, Hi: 0x24c2, Stride: 1},
+		{Lo: 0x25aa, Hi: 0x25ab, Stride: 1},
+		{Lo: 0x25b6, Hi: 0x25c0, Stride: 10},
+		{Lo: 0x25fb, Hi: 0x25fe, Stride: 1},
+		{Lo: 0x2600, Hi: 0x27bf, Stride: 1},
+		{Lo: 0x2934, Hi: 0x2935, Stride: 1},
+		{Lo: 0x2b05, Hi: 0x2b07, Stride: 1},
+		{Lo: 0x2b1b, Hi: 0x2b1c, Stride: 1},
+		{Lo: 0x2b50, Hi: 0x2b55, Stride: 5},
+		{Lo: 0x3030, Hi: 0x303d, Stride: 13},
+		{Lo: 0x3297, Hi: 0x3299, Stride: 2},
+	},
+	R32: []unicode.Range32{
+		// Pictographs, regional indicators and skin tone modifiers
+		{Lo: 0x1f000, Hi: 0x1faff, Stride: 1},
+	},
+	LatinOffset: 1,
+}
+
+// emojiJoinerTable holds the code points only allowed within emoji
+// sequences: the zero width joiner, variation selectors, the keycap and
+// the tags of subdivision flags
+var emojiJoinerTable = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x200d, Hi: 0x200d, Stride: 1},
+		{Lo: 0x20e3, Hi: 0x20e3, Stride: 1},
+		{Lo: 0xfe0e, Hi: 0xfe0f, Stride: 1},
+	},
+	R32: []unicode.Range32{
+		{Lo: 0xe0020, Hi: 0xe007f, Stride: 1},
+	},
+}
+
+// validEmoji accepts short emoji sequences, rejecting text and punctuation
+func validEmoji(emoji string) bool {
+	if emoji == "" || utf8.RuneCountInString(emoji) > maxEmojiLength {
+		return false
+	}
+
+	// Keycaps are the only sequences starting with plain characters
+	if strings.HasSuffix(emoji, "\u20e3") {
+		base, _ := utf8.DecodeRuneInString(emoji)
+		rest := strings.TrimPrefix(emoji[utf8.RuneLen(base):], "\ufe0f")
+		return strings.ContainsRune("0123456789#*", base) && rest == "\u20e3"
+	}
+
+	pictographs := 0
+	for _, r := range emoji {
+		switch {
+		case unicode.Is(emojiTable, r):
+			pictographs++
+		case !unicode.Is(emojiJoinerTable, r):
+			return false
+		}
+	}
+
+	return pictographs > 0
+}
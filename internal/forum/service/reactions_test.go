@@ -0,0 +1,93 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestService_ToggleReaction(t *testing.T) {
+	mockRepo := new(MockRepository)
+	svc := newTestService(mockRepo, new(MockUserRepository))
+
+	thumbsUp := []*domain.Reaction{{Emoji: "👍", Count: 1, UserIDs: []int{1}}}
+	mockRepo.On("GetMessageByID", 5).Return(&domain.Message{ID: 5}, nil)
+	mockRepo.On("GetReactions", []int{5}).Return(map[int][]*domain.Reaction{5: thumbsUp}, nil).Once()
+
+	// Test first toggle adds the reaction
+	mockRepo.On("AddReaction", 5, 1, "👍").Return(true, nil).Once()
+	update, err := svc.ToggleReaction(1, 5, "👍")
+	assert.NoError(t, err)
+	assert.True(t, update.Added)
+	assert.Equal(t, thumbsUp, update.Reactions)
+
+	// Test second toggle removes it
+	mockRepo.On("AddReaction", 5, 1, "👍").Return(false, nil).Once()
+	mockRepo.On("RemoveReaction", 5, 1, "👍").Return(true, nil).Once()
+	mockRepo.On("GetReactions", []int{5}).Return(map[int][]*domain.Reaction{}, nil).Once()
+	update, err = svc.ToggleReaction(1, 5, "👍")
+	assert.NoError(t, err)
+	assert.False(t, update.Added)
+	assert.Empty(t, update.Reactions)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_ToggleReactionVisibility(t *testing.T) {
+	mockRepo := new(MockRepository)
+	svc := newTestService(mockRepo, new(MockUserRepository))
+
+	// Test invalid emoji
+	_, err := svc.ToggleReaction(1, 5, "lol")
+	assert.ErrorIs(t, err, domain.ErrInvalidEmoji)
+
+	// Test direct message of another conversation
+	mockRepo.On("GetMessageByID", 7).Return(&domain.Message{ID: 7, ConversationID: 3}, nil)
+	mockRepo.On("GetConversation", 3).Return(&domain.Conversation{ID: 3, MemberIDs: []int{2, 4}}, nil)
+	_, err = svc.ToggleReaction(1, 7, "👍")
+	assert.ErrorIs(t, err, domain.ErrMessageNotFound)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_GetMessagesIncludesReactions(t *testing.T) {
+	mockRepo := new(MockRepository)
+	users := new(MockUserRepository)
+	svc := newTestService(mockRepo, users)
+
+	messages := []*domain.Message{{ID: 1}, {ID: 2}}
+	heart := []*domain.Reaction{{Emoji: "❤️", Count: 2, UserIDs: []int{3, 4}}}
+	mockRepo.On("GetMessages", 50, mock.AnythingOfType("time.Time")).Return(messages, nil)
+	mockRepo.On("GetAttachments", []int{1, 2}).Return(map[int][]*domain.Attachment{}, nil)
+	mockRepo.On("GetLinkPreviews", []int{1, 2}).Return(map[int][]*domain.LinkPreview{}, nil)
+	mockRepo.On("GetReactions", []int{1, 2}).Return(map[int][]*domain.Reaction{2: heart}, nil)
+	users.On("GetProfiles", []int{0}).Return([]*domain.Profile{}, nil)
+
+	result, err := svc.GetMessages(50)
+	assert.NoError(t, err)
+	assert.Nil(t, result[0].Reactions)
+	assert.Equal(t, heart, result[1].Reactions)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestValidEmoji(t *testing.T) {
+	assert.True(t, validEmoji("👍"))
+	assert.True(t, validEmoji("👍🏽"))
+	assert.True(t, validEmoji("❤️"))
+	assert.False(t, validEmoji(""))
+	assert.False(t, validEmoji("a"))
+	assert.False(t, validEmoji("👍 "))
+	assert.False(t, validEmoji("🎉🎉🎉🎉🎉🎉🎉🎉🎉"))
+	assert.True(t, validEmoji("👨‍👩‍👧"))
+	assert.True(t, validEmoji("🇫🇷"))
+	assert.True(t, validEmoji("#️⃣"))
+	assert.True(t, validEmoji("‼️"))
+	assert.False(t, validEmoji("<>!!"))
+	assert.False(t, validEmoji("!"))
+	assert.False(t, validEmoji("\u200d\ufe0f"))
+	assert.False(t, validEmoji("a\u20e3"))
+	assert.False(t, validEmoji("<b>"))
+}
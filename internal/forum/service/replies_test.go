@@ -0,0 +1,96 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chizheg/forum/internal/forum/broker/memory"
+	"github.com/chizheg/forum/internal/forum/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestService_SendReply(t *testing.T) {
+	mockRepo := new(MockRepository)
+	mockUsers := new(MockUserRepository)
+	broker := memory.NewBroker(zap.NewNop())
+	defer broker.Close()
+	events, cancel := broker.Subscribe()
+	defer cancel()
+
+	svc := NewService(mockRepo, mockUsers, broker, newTestAttachmentService(mockRepo, nil), new(MockSendLimiter), new(MockContentFilter), new(MockUnfurler), new(MockAuditLog), zap.NewNop())
+	mockRepo.On("GetSanctions", 1, true).Return([]*domain.Sanction{}, nil)
+
+	parent := &domain.Message{ID: 5, UserID: 2, Content: strings.Repeat("x", maxPreviewLength+10)}
+	mockRepo.On("GetMessageByID", 5).Return(parent, nil)
+	mockRepo.On("SaveMessage", mock.MatchedBy(func(msg *domain.Message) bool {
+		return msg.ReplyToID == 5
+	})).Run(func(args mock.Arguments) {
+		args.Get(0).(*domain.Message).ID = 6
+	}).Return(nil)
+	mockUsers.On("GetUsersByUsernames", []string{"bob"}).Return([]*domain.User{{ID: 2, Username: "bob"}}, nil)
+	mockRepo.On("CreateNotification", mock.MatchedBy(func(n *domain.Notification) bool {
+		return n.UserID == 2 && n.Type == domain.NotificationReply && n.MessageID == 6
+	})).Return(nil).Once()
+
+	// Replying to and mentioning the same user notifies them once
+	msg, err := svc.SendMessage(1, "@bob agreed", 5, nil)
+	require.NoError(t, err)
+	require.NotNil(t, msg.ReplyTo)
+	assert.Equal(t, 5, msg.ReplyTo.ID)
+	assert.Equal(t, maxPreviewLength+1, len([]rune(msg.ReplyTo.Content)))
+
+	select {
+	case event := <-events:
+		assert.Equal(t, "notification", event.Message.Type)
+		assert.Equal(t, domain.NotificationReply, event.Message.Payload["type"])
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for notification")
+	}
+
+	mockRepo.AssertExpectations(t)
+	mockUsers.AssertExpectations(t)
+}
+
+func TestService_SendReplyAcrossConversations(t *testing.T) {
+	mockRepo := new(MockRepository)
+	svc := newTestService(mockRepo, new(MockUserRepository))
+	mockRepo.On("GetSanctions", 1, true).Return([]*domain.Sanction{}, nil)
+
+	// Test a direct message can't be quoted in the public chat
+	mockRepo.On("GetMessageByID", 7).Return(&domain.Message{ID: 7, ConversationID: 3}, nil)
+	_, err := svc.SendMessage(1, "look", 7, nil)
+	assert.ErrorIs(t, err, domain.ErrInvalidReply)
+
+	// Test unknown parent
+	mockRepo.On("GetMessageByID", 99).Return(nil, domain.ErrMessageNotFound)
+	_, err = svc.SendMessage(1, "look", 99, nil)
+	assert.ErrorIs(t, err, domain.ErrMessageNotFound)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_GetReplyChain(t *testing.T) {
+	mockRepo := new(MockRepository)
+	svc := newTestService(mockRepo, new(MockUserRepository))
+
+	root := &domain.Message{ID: 1, UserID: 2, Content: "question"}
+	reply := &domain.Message{ID: 4, UserID: 3, Content: "answer", ReplyToID: 1}
+
+	mockRepo.On("GetMessageByID", 4).Return(reply, nil)
+	mockRepo.On("GetReplyChain", 4, maxReplyChainDepth).Return([]*domain.Message{root, reply}, nil)
+	mockRepo.On("GetAttachments", []int{1, 4}).Return(map[int][]*domain.Attachment{}, nil)
+	mockRepo.On("GetLinkPreviews", []int{1, 4}).Return(map[int][]*domain.LinkPreview{}, nil)
+	mockRepo.On("GetReactions", []int{1, 4}).Return(map[int][]*domain.Reaction{}, nil)
+	mockRepo.On("GetMessagesByIDs", []int{1}).Return([]*domain.Message{root}, nil)
+
+	chain, err := svc.GetReplyChain(1, 4)
+	require.NoError(t, err)
+	require.Len(t, chain, 2)
+	assert.Equal(t, &domain.MessagePreview{ID: 1, UserID: 2, Content: "question"}, chain[1].ReplyTo)
+
+	mockRepo.AssertExpectations(t)
+}
@@ -0,0 +1,249 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+	"github.com/chizheg/forum/pkg/audit"
+	"go.uber.org/zap"
+)
+
+const (
+	maxReportReasonLength = 500
+	defaultReportLimit    = 50
+	maxReportLimit        = 100
+)
+
+func (s *service) ReportMessage(userID, messageID int, reason string) (*domain.Report, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, domain.ErrEmptyReportReason
+	}
+	if utf8.RuneCountInString(reason) > maxReportReasonLength {
+		reason = string([]rune(reason)[:maxReportReasonLength])
+	}
+
+	msg, err := s.getVisibleMessage(userID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.UserID == userID {
+		return nil, domain.ErrCannotReport
+	}
+
+	report := &domain.Report{
+		MessageID:  messageID,
+		ReporterID: userID,
+		Reason:     reason,
+	}
+
+	created, err := s.repo.CreateReport(report)
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		return nil, domain.ErrAlreadyReported
+	}
+
+	return report, nil
+}
+
+func (s *service) GetReportQueue(moderatorID int, status domain.ReportStatus, limit, offset int) ([]*domain.ReportedMessage, error) {
+	if err := s.requireModerator(moderatorID); err != nil {
+		return nil, err
+	}
+
+	switch status {
+	case "":
+		status = domain.ReportOpen
+	case domain.ReportOpen, domain.ReportActioned, domain.ReportDismissed:
+	default:
+		return nil, domain.ErrInvalidReportStatus
+	}
+
+	if limit <= 0 {
+		limit = defaultReportLimit
+	}
+	if limit > maxReportLimit {
+		limit = maxReportLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	queue, err := s.repo.GetReportQueue(status, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]*domain.Message, len(queue))
+	for i, item := range queue {
+		messages[i] = item.Message
+	}
+
+	if err := s.enrichMessages(messages); err != nil {
+		return nil, err
+	}
+
+	return queue, nil
+}
+
+func (s *service) ResolveReports(moderatorID, messageID int, status domain.ReportStatus, deleteMessage bool, source audit.Source) (int, error) {
+	if err := s.requireModerator(moderatorID); err != nil {
+		return 0, err
+	}
+
+	switch status {
+	case domain.ReportActioned:
+	case domain.ReportDismissed:
+		if deleteMessage {
+			return 0, domain.ErrInvalidReportStatus
+		}
+	default:
+		return 0, domain.ErrInvalidReportStatus
+	}
+
+	var msg *domain.Message
+	if deleteMessage {
+		var err error
+		msg, err = s.repo.GetMessageByID(messageID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	resolved, deleted, err := s.repo.ResolveReports(messageID, status, moderatorID, deleteMessage)
+	if err != nil {
+		return 0, err
+	}
+	if resolved == 0 {
+		return 0, domain.ErrReportNotFound
+	}
+
+	if deleted {
+		s.audit(&audit.Entry{
+			ActorID:    moderatorID,
+			Action:     audit.ActionMessageDeleted,
+			TargetType: audit.TargetMessage,
+			TargetID:   msg.ID,
+			Source:     source,
+			Details: map[string]any{
+				"author_id": msg.UserID,
+				"reports":   resolved,
+			},
+		})
+		s.notifyDeleted(msg)
+	}
+
+	return resolved, nil
+}
+
+// notifyDeleted lets everyone who can see the message know it is gone
+func (s *service) notifyDeleted(msg *domain.Message) {
+	var recipients []int
+	payload := map[string]any{
+		"id": msg.ID,
+	}
+
+	if msg.ConversationID != domain.PublicConversationID {
+		conv, err := s.repo.GetConversation(msg.ConversationID)
+		if err != nil {
+			s.logger.Error("failed to get conversation", zap.Error(err))
+			return
+		}
+		recipients = conv.MemberIDs
+		payload["conversation_id"] = msg.ConversationID
+	}
+
+	err := s.broker.Publish(&domain.Event{
+		UserIDs: recipients,
+		Message: domain.WebsocketMessage{
+			Type:    "message_deleted",
+			Payload: payload,
+		},
+	})
+	if err != nil {
+		s.logger.Error("failed to publish message deletion", zap.Error(err))
+	}
+}
+
+func (s *service) GetPendingMessages(moderatorID, limit, offset int) ([]*domain.Message, error) {
+	if err := s.requireModerator(moderatorID); err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 {
+		limit = defaultReportLimit
+	}
+	if limit > maxReportLimit {
+		limit = maxReportLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	messages, err := s.repo.GetPendingMessages(limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.enrichMessages(messages); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// ReviewMessage publishes or deletes a message held by the content filter.
+// Approved messages notify replied to and mentioned users as if they were
+// just sent.
+func (s *service) ReviewMessage(moderatorID, messageID int, approve bool, source audit.Source) (*domain.Message, error) {
+	if err := s.requireModerator(moderatorID); err != nil {
+		return nil, err
+	}
+
+	msg, err := s.repo.ReviewMessage(messageID, approve)
+	if err != nil {
+		return nil, err
+	}
+
+	action := audit.ActionMessageApproved
+	if !approve {
+		action = audit.ActionMessageDeleted
+	}
+	s.audit(&audit.Entry{
+		ActorID:    moderatorID,
+		Action:     action,
+		TargetType: audit.TargetMessage,
+		TargetID:   msg.ID,
+		Source:     source,
+		Details: map[string]any{
+			"author_id": msg.UserID,
+			"pending":   true,
+		},
+	})
+
+	if !approve {
+		return msg, nil
+	}
+
+	if err := s.enrichMessages([]*domain.Message{msg}); err != nil {
+		return nil, err
+	}
+
+	var parent *domain.Message
+	if msg.ReplyToID != 0 {
+		// The parent may have been deleted while the reply was held
+		parent, err = s.repo.GetMessageByID(msg.ReplyToID)
+		if err != nil && !errors.Is(err, domain.ErrMessageNotFound) {
+			s.logger.Error("failed to get replied message", zap.Error(err))
+		}
+	}
+
+	s.notifyMessage(msg, parent, nil)
+	s.unfurler.Unfurl(msg, nil)
+
+	return msg, nil
+}
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/chizheg/forum/internal/forum/broker/memory"
+	"github.com/chizheg/forum/internal/forum/domain"
+	"github.com/chizheg/forum/pkg/audit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestService_ReportMessage(t *testing.T) {
+	mockRepo := new(MockRepository)
+	svc := newTestService(mockRepo, new(MockUserRepository))
+
+	mockRepo.On("GetMessageByID", 5).Return(&domain.Message{ID: 5, UserID: 2}, nil)
+	mockRepo.On("GetMessageByID", 6).Return(&domain.Message{ID: 6, UserID: 2, ConversationID: 3}, nil)
+	mockRepo.On("GetConversation", 3).Return(&domain.Conversation{ID: 3, MemberIDs: []int{2, 4}}, nil)
+
+	// Test successful report
+	mockRepo.On("CreateReport", mock.MatchedBy(func(r *domain.Report) bool {
+		return r.MessageID == 5 && r.ReporterID == 1 && r.Reason == "spam"
+	})).Run(func(args mock.Arguments) {
+		r := args.Get(0).(*domain.Report)
+		r.ID = 9
+		r.Status = domain.ReportOpen
+	}).Return(true, nil).Once()
+	report, err := svc.ReportMessage(1, 5, " spam ")
+	require.NoError(t, err)
+	assert.Equal(t, 9, report.ID)
+	assert.Equal(t, domain.ReportOpen, report.Status)
+
+	// Test reporting twice
+	mockRepo.On("CreateReport", mock.Anything).Return(false, nil).Once()
+	_, err = svc.ReportMessage(1, 5, "spam")
+	assert.ErrorIs(t, err, domain.ErrAlreadyReported)
+
+	// Test invalid reports
+	_, err = svc.ReportMessage(1, 5, "  ")
+	assert.ErrorIs(t, err, domain.ErrEmptyReportReason)
+	_, err = svc.ReportMessage(2, 5, "spam")
+	assert.ErrorIs(t, err, domain.ErrCannotReport)
+
+	// Test direct messages of other conversations can't be reported
+	_, err = svc.ReportMessage(1, 6, "spam")
+	assert.ErrorIs(t, err, domain.ErrMessageNotFound)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_GetReportQueue(t *testing.T) {
+	mockRepo := new(MockRepository)
+	mockUsers := new(MockUserRepository)
+	svc := newTestService(mockRepo, mockUsers)
+
+	mockUsers.On("GetUsersByIDs", []int{1}).Return([]*domain.User{{ID: 1, Role: domain.RoleModerator}}, nil)
+	mockUsers.On("GetUsersByIDs", []int{2}).Return([]*domain.User{{ID: 2, Role: domain.RoleUser}}, nil)
+
+	queue := []*domain.ReportedMessage{{Message: &domain.Message{ID: 5, Content: "**spam**"}, ReportCount: 2}}
+	mockRepo.On("GetReportQueue", domain.ReportOpen, defaultReportLimit, 0).Return(queue, nil)
+	mockRepo.On("GetAttachments", []int{5}).Return(map[int][]*domain.Attachment{}, nil)
+	mockRepo.On("GetLinkPreviews", []int{5}).Return(map[int][]*domain.LinkPreview{}, nil)
+	mockRepo.On("GetReactions", []int{5}).Return(map[int][]*domain.Reaction{}, nil)
+
+	result, err := svc.GetReportQueue(1, "", 0, -1)
+	require.NoError(t, err)
+	assert.Equal(t, "<p><strong>spam</strong></p>", result[0].Message.ContentHTML)
+
+	// Test regular users can't see the queue
+	_, err = svc.GetReportQueue(2, domain.ReportOpen, 10, 0)
+	assert.ErrorIs(t, err, domain.ErrForbidden)
+
+	// Test unknown status
+	_, err = svc.GetReportQueue(1, "closed", 10, 0)
+	assert.ErrorIs(t, err, domain.ErrInvalidReportStatus)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_ResolveReports(t *testing.T) {
+	mockRepo := new(MockRepository)
+	mockUsers := new(MockUserRepository)
+	broker := memory.NewBroker(zap.NewNop())
+	defer broker.Close()
+	events, cancel := broker.Subscribe()
+	defer cancel()
+	svc := NewService(mockRepo, mockUsers, broker, newTestAttachmentService(mockRepo, nil), new(MockSendLimiter), new(MockContentFilter), new(MockUnfurler), new(MockAuditLog), zap.NewNop())
+
+	mockUsers.On("GetUsersByIDs", []int{1}).Return([]*domain.User{{ID: 1, Role: domain.RoleModerator}}, nil)
+
+	// Test actioning reports deletes the message
+	mockRepo.On("GetMessageByID", 5).Return(&domain.Message{ID: 5, UserID: 2}, nil)
+	mockRepo.On("ResolveReports", 5, domain.ReportActioned, 1, true).Return(2, true, nil)
+	resolved, err := svc.ResolveReports(1, 5, domain.ReportActioned, true, audit.Source{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, resolved)
+
+	event := <-events
+	assert.Empty(t, event.UserIDs)
+	assert.Equal(t, "message_deleted", event.Message.Type)
+	assert.Equal(t, 5, event.Message.Payload["id"])
+
+	// Test dismissing keeps the message
+	mockRepo.On("ResolveReports", 6, domain.ReportDismissed, 1, false).Return(1, false, nil)
+	resolved, err = svc.ResolveReports(1, 6, domain.ReportDismissed, false, audit.Source{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, resolved)
+
+	// Test messages without open reports
+	mockRepo.On("ResolveReports", 7, domain.ReportDismissed, 1, false).Return(0, false, nil)
+	_, err = svc.ResolveReports(1, 7, domain.ReportDismissed, false, audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrReportNotFound)
+
+	// Test invalid resolutions
+	_, err = svc.ResolveReports(1, 6, domain.ReportDismissed, true, audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrInvalidReportStatus)
+	_, err = svc.ResolveReports(1, 6, domain.ReportOpen, false, audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrInvalidReportStatus)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_SendMessageFiltered(t *testing.T) {
+	mockRepo := new(MockRepository)
+	filter := new(MockContentFilter)
+	unfurler := new(MockUnfurler)
+	svc := NewService(mockRepo, new(MockUserRepository), memory.NewBroker(zap.NewNop()), newTestAttachmentService(mockRepo, nil), new(MockSendLimiter), filter, unfurler, new(MockAuditLog), zap.NewNop())
+	mockRepo.On("GetSanctions", 1, true).Return([]*domain.Sanction{}, nil)
+
+	// Test rewritten content is stored
+	filter.result = &domain.FilterResult{Content: "d*** it"}
+	mockRepo.On("SaveMessage", mock.MatchedBy(func(msg *domain.Message) bool {
+		return msg.Content == "d*** it" && msg.Status == ""
+	})).Return(nil).Once()
+	msg, err := svc.SendMessage(1, "darn it", 0, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "<p>d*** it</p>", msg.ContentHTML)
+	assert.Len(t, unfurler.messages, 1)
+
+	// Test held messages are stored as pending and not published
+	filter.result = &domain.FilterResult{Content: "buy now", Action: domain.FilterHold, Reason: "spam"}
+	mockRepo.On("SaveMessage", mock.MatchedBy(func(msg *domain.Message) bool {
+		return msg.Status == domain.MessagePending
+	})).Return(nil).Once()
+	msg, err = svc.SendMessage(1, "buy now", 0, nil)
+	require.NoError(t, err)
+	assert.Equal(t, domain.MessagePending, msg.Status)
+	assert.Len(t, unfurler.messages, 1)
+
+	// Test rejected messages are not stored
+	filter.result = &domain.FilterResult{Action: domain.FilterReject, Reason: "spam"}
+	_, err = svc.SendMessage(1, "buy now!!!", 0, nil)
+	assert.ErrorIs(t, err, domain.ErrMessageRejected)
+
+	mockRepo.AssertExpectations(t)
+	mockRepo.AssertNumberOfCalls(t, "SaveMessage", 2)
+}
+
+func TestService_ReviewMessage(t *testing.T) {
+	mockRepo := new(MockRepository)
+	mockUsers := new(MockUserRepository)
+	unfurler := new(MockUnfurler)
+	svc := NewService(mockRepo, mockUsers, memory.NewBroker(zap.NewNop()), newTestAttachmentService(mockRepo, nil), new(MockSendLimiter), new(MockContentFilter), unfurler, new(MockAuditLog), zap.NewNop())
+
+	mockUsers.On("GetUsersByIDs", []int{1}).Return([]*domain.User{{ID: 1, Role: domain.RoleModerator}}, nil)
+	mockUsers.On("GetUsersByIDs", []int{2}).Return([]*domain.User{{ID: 2, Role: domain.RoleUser}}, nil)
+
+	// Test approving publishes the message
+	mockRepo.On("ReviewMessage", 5, true).Return(&domain.Message{ID: 5, UserID: 2, Content: "hi", Status: domain.MessageActive}, nil)
+	mockRepo.On("GetAttachments", []int{5}).Return(map[int][]*domain.Attachment{}, nil)
+	mockRepo.On("GetLinkPreviews", []int{5}).Return(map[int][]*domain.LinkPreview{}, nil)
+	mockRepo.On("GetReactions", []int{5}).Return(map[int][]*domain.Reaction{}, nil)
+	msg, err := svc.ReviewMessage(1, 5, true, audit.Source{})
+	require.NoError(t, err)
+	assert.Equal(t, "<p>hi</p>", msg.ContentHTML)
+	assert.Equal(t, []*domain.Message{msg}, unfurler.messages)
+
+	// Test rejecting deletes it quietly
+	mockRepo.On("ReviewMessage", 6, false).Return(&domain.Message{ID: 6, UserID: 2, Status: domain.MessageDeleted}, nil)
+	msg, err = svc.ReviewMessage(1, 6, false, audit.Source{})
+	require.NoError(t, err)
+	assert.Equal(t, domain.MessageDeleted, msg.Status)
+	assert.Len(t, unfurler.messages, 1)
+
+	// Test messages which are not pending
+	mockRepo.On("ReviewMessage", 7, true).Return(nil, domain.ErrMessageNotFound)
+	_, err = svc.ReviewMessage(1, 7, true, audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrMessageNotFound)
+
+	// Test regular users can't review
+	_, err = svc.ReviewMessage(2, 5, true, audit.Source{})
+	assert.ErrorIs(t, err, domain.ErrForbidden)
+	_, err = svc.GetPendingMessages(2, 10, 0)
+	assert.ErrorIs(t, err, domain.ErrForbidden)
+
+	mockRepo.AssertExpectations(t)
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"html"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+	maxQueryLength     = 200
+)
+
+// Match markers produced by the repository around highlighted terms
+const (
+	highlightStart = "\x02"
+	highlightStop  = "\x03"
+)
+
+func (s *service) SearchMessages(userID int, query string, filter domain.SearchFilter) ([]*domain.SearchResult, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, domain.ErrEmptyQuery
+	}
+	if utf8.RuneCountInString(query) > maxQueryLength {
+		query = string([]rune(query)[:maxQueryLength])
+	}
+
+	filter.ViewerID = userID
+	if filter.Limit <= 0 || filter.Limit > maxSearchLimit {
+		filter.Limit = defaultSearchLimit
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+
+	results, err := s.repo.SearchMessages(query, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]*domain.Message, len(results))
+	for i, result := range results {
+		result.Snippet = highlightSnippet(result.Snippet)
+		messages[i] = result.Message
+	}
+
+	if err := s.enrichMessages(messages); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// highlightSnippet escapes the snippet and turns the match markers into
+// <mark> tags. Markers out of place are dropped so the tags stay balanced.
+func highlightSnippet(snippet string) string {
+	snippet = html.EscapeString(snippet)
+
+	var b strings.Builder
+	open := false
+	for _, r := range snippet {
+		switch string(r) {
+		case highlightStart:
+			if !open {
+				b.WriteString("<mark>")
+				open = true
+			}
+		case highlightStop:
+			if open {
+				b.WriteString("</mark>")
+				open = false
+			}
+		default:
+			b.WriteRune(r)
+		}
+	}
+	if open {
+		b.WriteString("</mark>")
+	}
+
+	return b.String()
+}
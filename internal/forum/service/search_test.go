@@ -0,0 +1,50 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestService_SearchMessages(t *testing.T) {
+	mockRepo := new(MockRepository)
+	svc := newTestService(mockRepo, new(MockUserRepository))
+
+	after := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	results := []*domain.SearchResult{{
+		Message: &domain.Message{ID: 4, UserID: 2, Content: "deploy <script> tonight"},
+		Rank:    0.6,
+		Snippet: "\x02deploy\x03 <script> tonight",
+	}}
+	mockRepo.On("SearchMessages", "deploy", domain.SearchFilter{
+		ViewerID: 1,
+		AuthorID: 2,
+		After:    after,
+		Limit:    defaultSearchLimit,
+	}).Return(results, nil)
+	mockRepo.On("GetAttachments", []int{4}).Return(map[int][]*domain.Attachment{}, nil)
+	mockRepo.On("GetLinkPreviews", []int{4}).Return(map[int][]*domain.LinkPreview{}, nil)
+	mockRepo.On("GetReactions", []int{4}).Return(map[int][]*domain.Reaction{}, nil)
+
+	// Test the viewer and default limit are filled in and the snippet is escaped
+	result, err := svc.SearchMessages(1, "  deploy ", domain.SearchFilter{ViewerID: 9, AuthorID: 2, After: after})
+	assert.NoError(t, err)
+	assert.Len(t, result, 1)
+	assert.Equal(t, "<mark>deploy</mark> &lt;script&gt; tonight", result[0].Snippet)
+
+	// Test empty query
+	_, err = svc.SearchMessages(1, "   ", domain.SearchFilter{})
+	assert.ErrorIs(t, err, domain.ErrEmptyQuery)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestHighlightSnippet(t *testing.T) {
+	assert.Equal(t, "a <mark>b</mark> c", highlightSnippet("a \x02b\x03 c"))
+
+	// Test stray markers keep the tags balanced
+	assert.Equal(t, "<mark>a</mark> b", highlightSnippet("\x02\x02a\x03\x03 b"))
+	assert.Equal(t, "a <mark>b</mark>", highlightSnippet("\x03a \x02b"))
+}
@@ -0,0 +1,372 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+	"github.com/chizheg/forum/internal/forum/markdown"
+	"github.com/chizheg/forum/pkg/audit"
+	"go.uber.org/zap"
+)
+
+const (
+	maxMessageLength   = 4000
+	maxPreviewLength   = 100
+	maxReplyChainDepth = 50
+)
+
+type service struct {
+	repo        domain.Repository
+	users       domain.UserRepository
+	broker      domain.Broker
+	attachments domain.AttachmentService
+	limiter     domain.SendLimiter
+	filter      domain.ContentFilter
+	unfurler    domain.Unfurler
+	auditLog    audit.Store
+	logger      *zap.Logger
+}
+
+// NewService creates a new forum service. Notifications are pushed to
+// their recipients through the broker, attachments are used to sign the
+// download links of files sent with messages, the limiter throttles users
+// flooding the chat, the filter checks public messages before they are
+// stored, the unfurler fetches previews of links in new messages and
+// moderation actions are recorded in the audit log.
+func NewService(
+	repo domain.Repository,
+	users domain.UserRepository,
+	broker domain.Broker,
+	attachments domain.AttachmentService,
+	limiter domain.SendLimiter,
+	filter domain.ContentFilter,
+	unfurler domain.Unfurler,
+	auditLog audit.Store,
+	logger *zap.Logger,
+) domain.ForumService {
+	return &service{
+		repo:        repo,
+		users:       users,
+		broker:      broker,
+		attachments: attachments,
+		limiter:     limiter,
+		filter:      filter,
+		unfurler:    unfurler,
+		auditLog:    auditLog,
+		logger:      logger,
+	}
+}
+
+func (s *service) SendMessage(userID int, content string, replyToID int, attachmentIDs []int) (*domain.Message, error) {
+	msg, parent, err := s.saveMessage(userID, domain.PublicConversationID, content, replyToID, attachmentIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Held messages are published once a moderator approves them
+	if msg.Status == domain.MessagePending {
+		return msg, nil
+	}
+
+	s.notifyMessage(msg, parent, nil)
+	s.unfurler.Unfurl(msg, nil)
+
+	return msg, nil
+}
+
+// saveMessage validates and stores a message of the given conversation.
+// The parent message is returned for replies.
+func (s *service) saveMessage(userID, conversationID int, content string, replyToID int, attachmentIDs []int) (*domain.Message, *domain.Message, error) {
+	attachmentIDs = uniqueIDs(attachmentIDs)
+	if len(attachmentIDs) > domain.MaxMessageAttachments {
+		return nil, nil, domain.ErrTooManyAttachments
+	}
+
+	// Files may be sent without a caption
+	content = strings.TrimSpace(content)
+	if content == "" && len(attachmentIDs) == 0 {
+		return nil, nil, domain.ErrEmptyMessage
+	}
+
+	if utf8.RuneCountInString(content) > maxMessageLength {
+		return nil, nil, domain.ErrMessageTooLong
+	}
+
+	if err := s.CheckSendAccess(userID); err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.limiter.Allow(userID, conversationID, content); err != nil {
+		return nil, nil, err
+	}
+
+	// Only held messages carry a status, everything else is active
+	var status string
+	if conversationID == domain.PublicConversationID {
+		result, err := s.filter.Filter(userID, content)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error filtering message: %w", err)
+		}
+
+		switch result.Action {
+		case domain.FilterReject:
+			return nil, nil, fmt.Errorf("%w: %s", domain.ErrMessageRejected, result.Reason)
+		case domain.FilterHold:
+			status = domain.MessagePending
+		}
+		content = result.Content
+	}
+
+	msg := &domain.Message{
+		UserID:         userID,
+		ConversationID: conversationID,
+		Content:        content,
+		ContentHTML:    markdown.Render(content),
+		Status:         status,
+	}
+
+	var parent *domain.Message
+	if replyToID != 0 {
+		var err error
+		parent, err = s.repo.GetMessageByID(replyToID)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// Replies must stay within the conversation the parent belongs to,
+		// which also keeps direct messages from being quoted elsewhere
+		if parent.ConversationID != conversationID {
+			return nil, nil, domain.ErrInvalidReply
+		}
+
+		msg.ReplyToID = parent.ID
+		msg.ReplyTo = newPreview(parent)
+	}
+
+	for _, id := range attachmentIDs {
+		msg.Attachments = append(msg.Attachments, &domain.Attachment{ID: id})
+	}
+
+	if err := s.repo.SaveMessage(msg); err != nil {
+		return nil, nil, err
+	}
+
+	if len(attachmentIDs) > 0 {
+		if err := s.attachFiles([]*domain.Message{msg}); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return msg, parent, nil
+}
+
+func (s *service) GetMessages(limit int) ([]*domain.Message, error) {
+	messages, err := s.repo.GetMessages(limit, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.enrichMessages(messages); err != nil {
+		return nil, err
+	}
+	s.attachAuthors(messages)
+
+	return messages, nil
+}
+
+func (s *service) GetReplyChain(userID, messageID int) ([]*domain.Message, error) {
+	if _, err := s.getVisibleMessage(userID, messageID); err != nil {
+		return nil, err
+	}
+
+	messages, err := s.repo.GetReplyChain(messageID, maxReplyChainDepth)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.enrichMessages(messages); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+func (s *service) DeleteOldMessages(maxAge time.Duration) error {
+	return s.repo.DeleteOldMessages(time.Now().Add(-maxAge))
+}
+
+func (s *service) JoinChat(userID int) error {
+	if err := s.CheckChatAccess(userID); err != nil {
+		return err
+	}
+
+	return s.repo.AddParticipant(userID)
+}
+
+func (s *service) LeaveChat(userID int) error {
+	return s.repo.RemoveParticipant(userID)
+}
+
+func (s *service) IsParticipant(userID int) (bool, error) {
+	return s.repo.IsParticipant(userID)
+}
+
+func (s *service) MarkRead(userID, messageID int) (bool, error) {
+	// Make sure the marker can't be moved past messages that don't exist yet
+	msg, err := s.repo.GetMessageByID(messageID)
+	if err != nil {
+		return false, err
+	}
+
+	// Read markers only track the public chat
+	if msg.ConversationID != domain.PublicConversationID {
+		return false, domain.ErrMessageNotFound
+	}
+
+	return s.repo.SetLastRead(userID, messageID)
+}
+
+func (s *service) GetUnreadCount(userID int) (int, error) {
+	return s.repo.CountUnread(userID)
+}
+
+// getVisibleMessage returns the message if the user is allowed to see it.
+// Direct messages of other conversations are reported as not found.
+func (s *service) getVisibleMessage(userID, messageID int) (*domain.Message, error) {
+	msg, err := s.repo.GetMessageByID(messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	if msg.ConversationID != domain.PublicConversationID {
+		conv, err := s.repo.GetConversation(msg.ConversationID)
+		if err != nil {
+			return nil, err
+		}
+		if !conv.HasMember(userID) {
+			return nil, domain.ErrMessageNotFound
+		}
+	}
+
+	return msg, nil
+}
+
+// enrichMessages renders the content and fills in the attachments, link
+// previews, reactions and reply previews of the messages. HTML is rendered
+// on every read so sanitizer fixes apply to old messages too.
+func (s *service) enrichMessages(messages []*domain.Message) error {
+	for _, msg := range messages {
+		msg.ContentHTML = markdown.Render(msg.Content)
+	}
+
+	if err := s.attachFiles(messages); err != nil {
+		return err
+	}
+
+	if err := s.attachLinkPreviews(messages); err != nil {
+		return err
+	}
+
+	if err := s.attachReactions(messages); err != nil {
+		return err
+	}
+
+	return s.attachReplyPreviews(messages)
+}
+
+func (s *service) attachLinkPreviews(messages []*domain.Message) error {
+	ids := make([]int, len(messages))
+	for i, msg := range messages {
+		ids[i] = msg.ID
+	}
+
+	previews, err := s.repo.GetLinkPreviews(ids)
+	if err != nil {
+		return err
+	}
+
+	for _, msg := range messages {
+		msg.LinkPreviews = previews[msg.ID]
+	}
+
+	return nil
+}
+
+// attachAuthors resolves the display info of the message authors in one
+// batch. History is still served without it when the auth service is
+// unavailable.
+func (s *service) attachAuthors(messages []*domain.Message) {
+	seen := make(map[int]bool)
+	var ids []int
+	for _, msg := range messages {
+		if !seen[msg.UserID] {
+			seen[msg.UserID] = true
+			ids = append(ids, msg.UserID)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	profiles, err := s.users.GetProfiles(ids)
+	if err != nil {
+		s.logger.Warn("failed to get message authors", zap.Error(err))
+		return
+	}
+
+	byID := make(map[int]*domain.Profile, len(profiles))
+	for _, profile := range profiles {
+		byID[profile.UserID] = profile
+	}
+
+	for _, msg := range messages {
+		msg.Author = byID[msg.UserID]
+	}
+}
+
+func (s *service) attachReplyPreviews(messages []*domain.Message) error {
+	var ids []int
+	for _, msg := range messages {
+		if msg.ReplyToID != 0 {
+			ids = append(ids, msg.ReplyToID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	parents, err := s.repo.GetMessagesByIDs(ids)
+	if err != nil {
+		return err
+	}
+
+	previews := make(map[int]*domain.MessagePreview, len(parents))
+	for _, parent := range parents {
+		previews[parent.ID] = newPreview(parent)
+	}
+
+	for _, msg := range messages {
+		if msg.ReplyToID != 0 {
+			msg.ReplyTo = previews[msg.ReplyToID]
+		}
+	}
+
+	return nil
+}
+
+// newPreview quotes the beginning of the message
+func newPreview(msg *domain.Message) *domain.MessagePreview {
+	content := msg.Content
+	if utf8.RuneCountInString(content) > maxPreviewLength {
+		content = string([]rune(content)[:maxPreviewLength]) + "…"
+	}
+
+	return &domain.MessagePreview{
+		ID:      msg.ID,
+		UserID:  msg.UserID,
+		Content: content,
+	}
+}
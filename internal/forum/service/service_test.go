@@ -0,0 +1,595 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chizheg/forum/internal/forum/broker/memory"
+	"github.com/chizheg/forum/internal/forum/domain"
+	"github.com/chizheg/forum/pkg/audit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap"
+)
+
+// MockRepository is a mock implementation of domain.Repository
+type MockRepository struct {
+	mock.Mock
+}
+
+func (m *MockRepository) SaveMessage(msg *domain.Message) error {
+	args := m.Called(msg)
+	return args.Error(0)
+}
+
+func (m *MockRepository) GetMessageByID(id int) (*domain.Message, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Message), args.Error(1)
+}
+
+func (m *MockRepository) GetMessagesByIDs(ids []int) ([]*domain.Message, error) {
+	args := m.Called(ids)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.Message), args.Error(1)
+}
+
+func (m *MockRepository) GetReplyChain(messageID, maxDepth int) ([]*domain.Message, error) {
+	args := m.Called(messageID, maxDepth)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.Message), args.Error(1)
+}
+
+func (m *MockRepository) GetMessages(limit int, before time.Time) ([]*domain.Message, error) {
+	args := m.Called(limit, before)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.Message), args.Error(1)
+}
+
+func (m *MockRepository) DeleteOldMessages(before time.Time) error {
+	args := m.Called(before)
+	return args.Error(0)
+}
+
+func (m *MockRepository) AddParticipant(userID int) error {
+	args := m.Called(userID)
+	return args.Error(0)
+}
+
+func (m *MockRepository) RemoveParticipant(userID int) error {
+	args := m.Called(userID)
+	return args.Error(0)
+}
+
+func (m *MockRepository) IsParticipant(userID int) (bool, error) {
+	args := m.Called(userID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRepository) SetLastRead(userID, messageID int) (bool, error) {
+	args := m.Called(userID, messageID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRepository) CountUnread(userID int) (int, error) {
+	args := m.Called(userID)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockRepository) CreateConversation(conv *domain.Conversation) error {
+	args := m.Called(conv)
+	return args.Error(0)
+}
+
+func (m *MockRepository) GetConversation(id int) (*domain.Conversation, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Conversation), args.Error(1)
+}
+
+func (m *MockRepository) FindDirectConversation(userID, otherID int) (*domain.Conversation, error) {
+	args := m.Called(userID, otherID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Conversation), args.Error(1)
+}
+
+func (m *MockRepository) GetConversations(userID int) ([]*domain.Conversation, error) {
+	args := m.Called(userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.Conversation), args.Error(1)
+}
+
+func (m *MockRepository) GetConversationMessages(conversationID, limit int, before time.Time) ([]*domain.Message, error) {
+	args := m.Called(conversationID, limit, before)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.Message), args.Error(1)
+}
+
+func (m *MockRepository) CreateNotification(n *domain.Notification) error {
+	args := m.Called(n)
+	return args.Error(0)
+}
+
+func (m *MockRepository) GetNotifications(userID int, unreadOnly bool, limit int) ([]*domain.Notification, error) {
+	args := m.Called(userID, unreadOnly, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.Notification), args.Error(1)
+}
+
+func (m *MockRepository) MarkNotificationsRead(userID int, ids []int) (int, error) {
+	args := m.Called(userID, ids)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockRepository) AddReaction(messageID, userID int, emoji string) (bool, error) {
+	args := m.Called(messageID, userID, emoji)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRepository) RemoveReaction(messageID, userID int, emoji string) (bool, error) {
+	args := m.Called(messageID, userID, emoji)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRepository) GetReactions(messageIDs []int) (map[int][]*domain.Reaction, error) {
+	args := m.Called(messageIDs)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[int][]*domain.Reaction), args.Error(1)
+}
+
+func (m *MockRepository) PinMessage(pin *domain.PinnedMessage) (bool, error) {
+	args := m.Called(pin)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRepository) UnpinMessage(messageID int) (bool, error) {
+	args := m.Called(messageID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRepository) GetPinnedMessages(conversationID int) ([]*domain.PinnedMessage, error) {
+	args := m.Called(conversationID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.PinnedMessage), args.Error(1)
+}
+
+func (m *MockRepository) SearchMessages(query string, filter domain.SearchFilter) ([]*domain.SearchResult, error) {
+	args := m.Called(query, filter)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.SearchResult), args.Error(1)
+}
+
+func (m *MockRepository) GetLinkPreview(url string) (*domain.LinkPreview, error) {
+	args := m.Called(url)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.LinkPreview), args.Error(1)
+}
+
+func (m *MockRepository) SaveLinkPreview(p *domain.LinkPreview) error {
+	args := m.Called(p)
+	return args.Error(0)
+}
+
+func (m *MockRepository) AddMessageLinkPreviews(messageID int, urls []string) error {
+	args := m.Called(messageID, urls)
+	return args.Error(0)
+}
+
+func (m *MockRepository) GetLinkPreviews(messageIDs []int) (map[int][]*domain.LinkPreview, error) {
+	args := m.Called(messageIDs)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[int][]*domain.LinkPreview), args.Error(1)
+}
+
+func (m *MockRepository) CreateSanction(sanction *domain.Sanction) error {
+	args := m.Called(sanction)
+	return args.Error(0)
+}
+
+func (m *MockRepository) GetSanction(id int) (*domain.Sanction, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Sanction), args.Error(1)
+}
+
+func (m *MockRepository) GetSanctions(userID int, activeOnly bool) ([]*domain.Sanction, error) {
+	args := m.Called(userID, activeOnly)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.Sanction), args.Error(1)
+}
+
+func (m *MockRepository) RevokeSanction(id, revokedBy int) (bool, error) {
+	args := m.Called(id, revokedBy)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRepository) CreateReport(report *domain.Report) (bool, error) {
+	args := m.Called(report)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRepository) GetReportQueue(status domain.ReportStatus, limit, offset int) ([]*domain.ReportedMessage, error) {
+	args := m.Called(status, limit, offset)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.ReportedMessage), args.Error(1)
+}
+
+func (m *MockRepository) ResolveReports(messageID int, status domain.ReportStatus, resolvedBy int, deleteMessage bool) (int, bool, error) {
+	args := m.Called(messageID, status, resolvedBy, deleteMessage)
+	return args.Int(0), args.Bool(1), args.Error(2)
+}
+
+func (m *MockRepository) GetPendingMessages(limit, offset int) ([]*domain.Message, error) {
+	args := m.Called(limit, offset)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.Message), args.Error(1)
+}
+
+func (m *MockRepository) ReviewMessage(id int, approve bool) (*domain.Message, error) {
+	args := m.Called(id, approve)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Message), args.Error(1)
+}
+
+func (m *MockRepository) GetUserMessages(userID int) ([]*domain.Message, error) {
+	args := m.Called(userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.Message), args.Error(1)
+}
+
+func (m *MockRepository) GetAccountDeletionCursor(margin time.Duration) (int64, error) {
+	args := m.Called(margin)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRepository) RecordAccountDeletions(deletions []*domain.AccountDeletion) error {
+	args := m.Called(deletions)
+	return args.Error(0)
+}
+
+func (m *MockRepository) GetPendingAccountDeletions(afterID int64, limit int) ([]*domain.AccountDeletion, error) {
+	args := m.Called(afterID, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.AccountDeletion), args.Error(1)
+}
+
+func (m *MockRepository) AnonymizeUser(deletion *domain.AccountDeletion) (int, error) {
+	args := m.Called(deletion)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockRepository) SaveAttachment(a *domain.Attachment) error {
+	args := m.Called(a)
+	return args.Error(0)
+}
+
+func (m *MockRepository) GetAttachment(id int) (*domain.Attachment, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Attachment), args.Error(1)
+}
+
+func (m *MockRepository) GetAttachments(messageIDs []int) (map[int][]*domain.Attachment, error) {
+	args := m.Called(messageIDs)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[int][]*domain.Attachment), args.Error(1)
+}
+
+func (m *MockRepository) DeleteUnsentAttachments(before time.Time) ([]*domain.Attachment, error) {
+	args := m.Called(before)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.Attachment), args.Error(1)
+}
+
+// MockUnfurler records the messages passed to the unfurler
+type MockUnfurler struct {
+	mu       sync.Mutex
+	messages []*domain.Message
+}
+
+func (m *MockUnfurler) Unfurl(msg *domain.Message, recipients []int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+}
+
+// MockSendLimiter rejects every message with err when it is set
+type MockSendLimiter struct {
+	err error
+}
+
+func (m *MockSendLimiter) Allow(userID, conversationID int, content string) error {
+	return m.err
+}
+
+// MockContentFilter applies result to every message when it is set and
+// allows messages unchanged otherwise
+type MockContentFilter struct {
+	result *domain.FilterResult
+}
+
+func (m *MockContentFilter) Filter(userID int, content string) (*domain.FilterResult, error) {
+	if m.result != nil {
+		return m.result, nil
+	}
+	return &domain.FilterResult{Content: content}, nil
+}
+
+// MockAuditLog records the written entries and returns them from queries
+type MockAuditLog struct {
+	mu      sync.Mutex
+	entries []*audit.Entry
+	filters []audit.Filter
+}
+
+func (m *MockAuditLog) Write(entry *audit.Entry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = append(m.entries, entry)
+	return nil
+}
+
+func (m *MockAuditLog) Query(filter audit.Filter) ([]*audit.Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.filters = append(m.filters, filter)
+	return m.entries, nil
+}
+
+// MockUserRepository is a mock implementation of domain.UserRepository
+type MockUserRepository struct {
+	mock.Mock
+}
+
+func (m *MockUserRepository) GetUsersByIDs(ids []int) ([]*domain.User, error) {
+	args := m.Called(ids)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.User), args.Error(1)
+}
+
+func (m *MockUserRepository) GetUsersByUsernames(usernames []string) ([]*domain.User, error) {
+	args := m.Called(usernames)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.User), args.Error(1)
+}
+
+func (m *MockUserRepository) GetProfiles(ids []int) ([]*domain.Profile, error) {
+	args := m.Called(ids)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.Profile), args.Error(1)
+}
+
+func (m *MockUserRepository) DeleteAccount(token, password string, source audit.Source) error {
+	args := m.Called(token, password, source)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) GetAccountData(token string, source audit.Source) (*domain.AccountData, error) {
+	args := m.Called(token, source)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.AccountData), args.Error(1)
+}
+
+func (m *MockUserRepository) GetAccountDeletions(afterID int64, limit int) ([]*domain.AccountDeletion, error) {
+	args := m.Called(afterID, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.AccountDeletion), args.Error(1)
+}
+
+func newTestService(repo domain.Repository, users domain.UserRepository) domain.ForumService {
+	return NewService(repo, users, memory.NewBroker(zap.NewNop()), newTestAttachmentService(repo, nil), new(MockSendLimiter), new(MockContentFilter), new(MockUnfurler), new(MockAuditLog), zap.NewNop())
+}
+
+// testURLSecret signs the download links in tests
+var testURLSecret = []byte("0123456789abcdef0123456789abcdef")
+
+func newTestAttachmentService(repo domain.Repository, blobs domain.BlobStore) domain.AttachmentService {
+	svc, err := NewAttachmentService(repo, blobs, AttachmentConfig{URLSecret: testURLSecret}, zap.NewNop())
+	if err != nil {
+		panic(err)
+	}
+	return svc
+}
+
+func TestService_SendMessage(t *testing.T) {
+	mockRepo := new(MockRepository)
+	limiter := new(MockSendLimiter)
+	unfurler := new(MockUnfurler)
+	svc := NewService(mockRepo, new(MockUserRepository), memory.NewBroker(zap.NewNop()), newTestAttachmentService(mockRepo, nil), limiter, new(MockContentFilter), unfurler, new(MockAuditLog), zap.NewNop())
+	mockRepo.On("GetSanctions", 1, true).Return([]*domain.Sanction{}, nil)
+
+	// Test successful send
+	mockRepo.On("SaveMessage", mock.MatchedBy(func(msg *domain.Message) bool {
+		return msg.UserID == 1 && msg.Content == "hello"
+	})).Run(func(args mock.Arguments) {
+		args.Get(0).(*domain.Message).ID = 10
+	}).Return(nil)
+
+	msg, err := svc.SendMessage(1, "  hello  ", 0, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, msg.ID)
+	assert.Equal(t, "<p>hello</p>", msg.ContentHTML)
+	assert.Equal(t, []*domain.Message{msg}, unfurler.messages)
+
+	// Test empty message
+	msg, err = svc.SendMessage(1, "   ", 0, nil)
+	assert.ErrorIs(t, err, domain.ErrEmptyMessage)
+	assert.Nil(t, msg)
+
+	// Test too long message
+	msg, err = svc.SendMessage(1, strings.Repeat("a", maxMessageLength+1), 0, nil)
+	assert.ErrorIs(t, err, domain.ErrMessageTooLong)
+	assert.Nil(t, msg)
+
+	// Test flood control
+	limiter.err = &domain.RateLimitError{Err: domain.ErrRateLimited, RetryAfter: time.Second}
+	msg, err = svc.SendMessage(1, "hello again", 0, nil)
+	assert.ErrorIs(t, err, domain.ErrRateLimited)
+	assert.Nil(t, msg)
+
+	mockRepo.AssertExpectations(t)
+	mockRepo.AssertNumberOfCalls(t, "SaveMessage", 1)
+}
+
+func TestService_MarkRead(t *testing.T) {
+	mockRepo := new(MockRepository)
+	svc := newTestService(mockRepo, new(MockUserRepository))
+
+	// Test marker moved forward
+	mockRepo.On("GetMessageByID", 5).Return(&domain.Message{ID: 5}, nil)
+	mockRepo.On("SetLastRead", 1, 5).Return(true, nil).Once()
+	advanced, err := svc.MarkRead(1, 5)
+	assert.NoError(t, err)
+	assert.True(t, advanced)
+
+	// Test marker already past the message
+	mockRepo.On("SetLastRead", 1, 5).Return(false, nil).Once()
+	advanced, err = svc.MarkRead(1, 5)
+	assert.NoError(t, err)
+	assert.False(t, advanced)
+
+	// Test direct messages have no read marker
+	mockRepo.On("GetMessageByID", 7).Return(&domain.Message{ID: 7, ConversationID: 3}, nil)
+	advanced, err = svc.MarkRead(1, 7)
+	assert.ErrorIs(t, err, domain.ErrMessageNotFound)
+	assert.False(t, advanced)
+
+	// Test unknown message
+	mockRepo.On("GetMessageByID", 99).Return(nil, domain.ErrMessageNotFound)
+	advanced, err = svc.MarkRead(1, 99)
+	assert.ErrorIs(t, err, domain.ErrMessageNotFound)
+	assert.False(t, advanced)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_GetUnreadCount(t *testing.T) {
+	mockRepo := new(MockRepository)
+	svc := newTestService(mockRepo, new(MockUserRepository))
+
+	mockRepo.On("CountUnread", 1).Return(3, nil)
+	count, err := svc.GetUnreadCount(1)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_GetMessagesRendersContent(t *testing.T) {
+	mockRepo := new(MockRepository)
+	users := new(MockUserRepository)
+	svc := newTestService(mockRepo, users)
+
+	messages := []*domain.Message{{ID: 1, Content: "**hi** <script>alert(1)</script>"}}
+	mockRepo.On("GetMessages", 50, mock.AnythingOfType("time.Time")).Return(messages, nil)
+	mockRepo.On("GetAttachments", []int{1}).Return(map[int][]*domain.Attachment{}, nil)
+	previews := []*domain.LinkPreview{{URL: "https://example.com", Title: "Example"}}
+	mockRepo.On("GetLinkPreviews", []int{1}).Return(map[int][]*domain.LinkPreview{1: previews}, nil)
+	mockRepo.On("GetReactions", []int{1}).Return(map[int][]*domain.Reaction{}, nil)
+	users.On("GetProfiles", []int{0}).Return([]*domain.Profile{}, nil)
+
+	result, err := svc.GetMessages(50)
+	assert.NoError(t, err)
+	assert.Equal(t, "**hi** <script>alert(1)</script>", result[0].Content)
+	assert.Equal(t, "<p><strong>hi</strong> alert(1)</p>", result[0].ContentHTML)
+	assert.Equal(t, previews, result[0].LinkPreviews)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestService_GetMessagesIncludesAuthors(t *testing.T) {
+	mockRepo := new(MockRepository)
+	users := new(MockUserRepository)
+	svc := newTestService(mockRepo, users)
+
+	messages := []*domain.Message{{ID: 1, UserID: 2}, {ID: 2, UserID: 3}, {ID: 3, UserID: 2}}
+	mockRepo.On("GetMessages", 50, mock.AnythingOfType("time.Time")).Return(messages, nil)
+	mockRepo.On("GetAttachments", []int{1, 2, 3}).Return(map[int][]*domain.Attachment{}, nil)
+	mockRepo.On("GetLinkPreviews", []int{1, 2, 3}).Return(map[int][]*domain.LinkPreview{}, nil)
+	mockRepo.On("GetReactions", []int{1, 2, 3}).Return(map[int][]*domain.Reaction{}, nil)
+
+	// Authors are resolved in one batch of unique IDs
+	alice := &domain.Profile{UserID: 2, Username: "alice", DisplayName: "Alice"}
+	users.On("GetProfiles", []int{2, 3}).Return([]*domain.Profile{alice}, nil).Once()
+
+	result, err := svc.GetMessages(50)
+	assert.NoError(t, err)
+	assert.Equal(t, alice, result[0].Author)
+	assert.Nil(t, result[1].Author)
+	assert.Equal(t, alice, result[2].Author)
+
+	// History is still returned when the auth service fails
+	for _, msg := range messages {
+		msg.Author = nil
+	}
+	users.On("GetProfiles", []int{2, 3}).Return(nil, errors.New("unavailable")).Once()
+
+	result, err = svc.GetMessages(50)
+	assert.NoError(t, err)
+	assert.Len(t, result, 3)
+	assert.Nil(t, result[0].Author)
+
+	mockRepo.AssertExpectations(t)
+	users.AssertExpectations(t)
+}
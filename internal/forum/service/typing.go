@@ -0,0 +1,146 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultTypingInterval = 2 * time.Second
+	defaultTypingTimeout  = 5 * time.Second
+)
+
+// TypingConfig holds typing indicator configuration
+type TypingConfig struct {
+	// Interval is the minimum time between two notifications of a user
+	Interval time.Duration
+	// Timeout is how long a user is shown as typing without new events
+	Timeout time.Duration
+}
+
+type typingKey struct {
+	userID         int
+	conversationID int
+}
+
+type typingState struct {
+	timer      *time.Timer
+	generation uint64
+	lastSent   time.Time
+	recipients []int
+}
+
+type typingService struct {
+	broker domain.Broker
+	cfg    TypingConfig
+	logger *zap.Logger
+	mu     sync.Mutex
+	typing map[typingKey]*typingState
+	// generation identifies the timers, it is never reset so a timer of a
+	// deleted state can't match a later one
+	generation uint64
+}
+
+// NewTypingService creates a typing indicator service publishing through
+// the broker
+func NewTypingService(broker domain.Broker, cfg TypingConfig, logger *zap.Logger) domain.TypingService {
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultTypingInterval
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTypingTimeout
+	}
+
+	return &typingService{
+		broker: broker,
+		cfg:    cfg,
+		logger: logger,
+		typing: make(map[typingKey]*typingState),
+	}
+}
+
+func (s *typingService) StartTyping(userID, conversationID int, recipients []int) bool {
+	key := typingKey{userID: userID, conversationID: conversationID}
+	now := time.Now()
+
+	s.mu.Lock()
+	state, ok := s.typing[key]
+	if ok {
+		// Keep the indicator alive while the user keeps typing
+		state.timer.Stop()
+		state.recipients = recipients
+	} else {
+		state = &typingState{recipients: recipients}
+		s.typing[key] = state
+	}
+
+	s.generation++
+	generation := s.generation
+	state.generation = generation
+	state.timer = time.AfterFunc(s.cfg.Timeout, func() {
+		s.expire(key, generation)
+	})
+
+	if ok && now.Sub(state.lastSent) < s.cfg.Interval {
+		s.mu.Unlock()
+		return false
+	}
+	state.lastSent = now
+	s.mu.Unlock()
+
+	s.publish(key, recipients, true)
+	return true
+}
+
+func (s *typingService) StopTyping(userID, conversationID int) bool {
+	key := typingKey{userID: userID, conversationID: conversationID}
+
+	s.mu.Lock()
+	state, ok := s.typing[key]
+	if !ok {
+		s.mu.Unlock()
+		return false
+	}
+	state.timer.Stop()
+	delete(s.typing, key)
+	s.mu.Unlock()
+
+	s.publish(key, state.recipients, false)
+	return true
+}
+
+// expire clears the typing state unless it was refreshed after the timer
+// had been scheduled
+func (s *typingService) expire(key typingKey, generation uint64) {
+	s.mu.Lock()
+	state, ok := s.typing[key]
+	if !ok || state.generation != generation {
+		s.mu.Unlock()
+		return
+	}
+	delete(s.typing, key)
+	s.mu.Unlock()
+
+	s.publish(key, state.recipients, false)
+}
+
+func (s *typingService) publish(key typingKey, recipients []int, typing bool) {
+	err := s.broker.Publish(&domain.Event{
+		UserIDs:      recipients,
+		ExceptUserID: key.userID,
+		Message: domain.WebsocketMessage{
+			Type: "typing",
+			Payload: map[string]any{
+				"user_id":         key.userID,
+				"conversation_id": key.conversationID,
+				"typing":          typing,
+			},
+		},
+	})
+	if err != nil {
+		s.logger.Error("failed to publish typing event", zap.Int("user_id", key.userID), zap.Error(err))
+	}
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chizheg/forum/internal/forum/broker/memory"
+	"github.com/chizheg/forum/internal/forum/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func nextTypingEvent(t *testing.T, events <-chan *domain.Event) *domain.Event {
+	t.Helper()
+	select {
+	case event := <-events:
+		require.Equal(t, "typing", event.Message.Type)
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for typing event")
+		return nil
+	}
+}
+
+func assertNoEvent(t *testing.T, events <-chan *domain.Event, wait time.Duration) {
+	t.Helper()
+	select {
+	case event := <-events:
+		t.Fatalf("unexpected event: %+v", event)
+	case <-time.After(wait):
+	}
+}
+
+func TestTypingService_StartStop(t *testing.T) {
+	broker := memory.NewBroker(zap.NewNop())
+	defer broker.Close()
+	events, cancel := broker.Subscribe()
+	defer cancel()
+
+	svc := NewTypingService(broker, TypingConfig{Interval: time.Minute, Timeout: time.Minute}, zap.NewNop())
+
+	assert.True(t, svc.StartTyping(1, 7, []int{1, 2}))
+	event := nextTypingEvent(t, events)
+	assert.Equal(t, []int{1, 2}, event.UserIDs)
+	assert.Equal(t, 1, event.ExceptUserID)
+	assert.Equal(t, 7, event.Message.Payload["conversation_id"])
+	assert.Equal(t, true, event.Message.Payload["typing"])
+
+	assert.True(t, svc.StopTyping(1, 7))
+	event = nextTypingEvent(t, events)
+	assert.Equal(t, false, event.Message.Payload["typing"])
+
+	assert.False(t, svc.StopTyping(1, 7))
+	assertNoEvent(t, events, 20*time.Millisecond)
+}
+
+func TestTypingService_RateLimit(t *testing.T) {
+	broker := memory.NewBroker(zap.NewNop())
+	defer broker.Close()
+	events, cancel := broker.Subscribe()
+	defer cancel()
+
+	svc := NewTypingService(broker, TypingConfig{Interval: 100 * time.Millisecond, Timeout: time.Minute}, zap.NewNop())
+
+	assert.True(t, svc.StartTyping(1, domain.PublicConversationID, nil))
+	nextTypingEvent(t, events)
+
+	assert.False(t, svc.StartTyping(1, domain.PublicConversationID, nil))
+	assertNoEvent(t, events, 20*time.Millisecond)
+
+	// Other users are limited independently
+	assert.True(t, svc.StartTyping(2, domain.PublicConversationID, nil))
+	nextTypingEvent(t, events)
+
+	time.Sleep(100 * time.Millisecond)
+	assert.True(t, svc.StartTyping(1, domain.PublicConversationID, nil))
+	nextTypingEvent(t, events)
+}
+
+func TestTypingService_Expire(t *testing.T) {
+	broker := memory.NewBroker(zap.NewNop())
+	defer broker.Close()
+	events, cancel := broker.Subscribe()
+	defer cancel()
+
+	svc := NewTypingService(broker, TypingConfig{Interval: time.Minute, Timeout: 50 * time.Millisecond}, zap.NewNop())
+
+	svc.StartTyping(1, domain.PublicConversationID, nil)
+	nextTypingEvent(t, events)
+
+	event := nextTypingEvent(t, events)
+	assert.Equal(t, false, event.Message.Payload["typing"])
+	assert.False(t, svc.StopTyping(1, domain.PublicConversationID))
+}
+
+func TestTypingService_StaleTimer(t *testing.T) {
+	broker := memory.NewBroker(zap.NewNop())
+	defer broker.Close()
+	events, cancel := broker.Subscribe()
+	defer cancel()
+
+	svc := NewTypingService(broker, TypingConfig{Interval: time.Minute, Timeout: time.Minute}, zap.NewNop()).(*typingService)
+
+	svc.StartTyping(1, 7, nil)
+	nextTypingEvent(t, events)
+	svc.StopTyping(1, 7)
+	nextTypingEvent(t, events)
+	svc.StartTyping(1, 7, nil)
+	nextTypingEvent(t, events)
+
+	// Test a timer of the stopped indicator that fired late doesn't clear
+	// the new one
+	svc.expire(typingKey{userID: 1, conversationID: 7}, 1)
+	assertNoEvent(t, events, 20*time.Millisecond)
+	assert.True(t, svc.StopTyping(1, 7))
+}
@@ -0,0 +1,112 @@
+package unfurl
+
+import (
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// parseMetadata reads the Open Graph tags of the page head, falling back to
+// the title and description meta tags. Parsing stops at the body.
+func parseMetadata(r io.Reader, base *url.URL) *domain.LinkPreview {
+	preview := &domain.LinkPreview{}
+	var title, description string
+
+	z := html.NewTokenizer(r)
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			return finishPreview(preview, title, description, base)
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			switch atom.Lookup(name) {
+			case atom.Body:
+				return finishPreview(preview, title, description, base)
+
+			case atom.Title:
+				if title == "" && z.Next() == html.TextToken {
+					title = strings.TrimSpace(string(z.Text()))
+				}
+
+			case atom.Meta:
+				if !hasAttr {
+					continue
+				}
+
+				var key, content string
+				for {
+					attr, value, more := z.TagAttr()
+					switch string(attr) {
+					case "property", "name":
+						key = strings.ToLower(string(value))
+					case "content":
+						content = strings.TrimSpace(string(value))
+					}
+					if !more {
+						break
+					}
+				}
+
+				switch key {
+				case "og:title":
+					preview.Title = content
+				case "og:description":
+					preview.Description = content
+				case "og:image", "og:image:url":
+					if preview.ImageURL == "" {
+						preview.ImageURL = content
+					}
+				case "og:site_name":
+					preview.SiteName = content
+				case "description":
+					description = content
+				}
+			}
+
+		case html.EndTagToken:
+			if name, _ := z.TagName(); atom.Lookup(name) == atom.Head {
+				return finishPreview(preview, title, description, base)
+			}
+		}
+	}
+}
+
+func finishPreview(preview *domain.LinkPreview, title, description string, base *url.URL) *domain.LinkPreview {
+	if preview.Title == "" {
+		preview.Title = title
+	}
+	if preview.Description == "" {
+		preview.Description = description
+	}
+
+	preview.ImageURL = resolveImageURL(preview.ImageURL, base)
+	return preview
+}
+
+// resolveImageURL makes relative image links absolute and drops anything
+// that is not an http(s) link
+func resolveImageURL(image string, base *url.URL) string {
+	if image == "" {
+		return ""
+	}
+
+	ref, err := url.Parse(image)
+	if err != nil {
+		return ""
+	}
+	if base != nil {
+		ref = base.ResolveReference(ref)
+	}
+
+	if ref.Scheme != "http" && ref.Scheme != "https" {
+		return ""
+	}
+
+	return ref.String()
+}
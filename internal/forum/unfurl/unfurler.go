@@ -0,0 +1,352 @@
+// Package unfurl fetches previews of links posted in the chat.
+package unfurl
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/chizheg/forum/internal/forum/domain"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultTimeout       = 5 * time.Second
+	defaultMaxBodySize   = 512 << 10
+	defaultCacheTTL      = 24 * time.Hour
+	defaultWorkers       = 4
+	defaultQueueSize     = 256
+	maxLinksPerMessage   = 3
+	maxRedirects         = 3
+	maxURLLength         = 2048
+	maxTitleLength       = 300
+	maxDescriptionLength = 500
+	userAgent            = "ForumLinkPreview/1.0"
+)
+
+var (
+	ErrBlockedAddress = errors.New("address is not allowed")
+	ErrNotHTML        = errors.New("response is not an HTML page")
+
+	urlPattern = regexp.MustCompile(`https?://[^\s<>"'` + "`" + `]+`)
+
+	// Ranges not covered by the net.IP helpers that must not be reached
+	blockedNetworks = mustParseCIDRs(
+		"0.0.0.0/8",     // "this" network
+		"100.64.0.0/10", // carrier-grade NAT
+		"192.0.0.0/24",  // IETF protocol assignments
+		"198.18.0.0/15", // benchmarking
+		"240.0.0.0/4",   // reserved
+		"64:ff9b::/96",  // NAT64
+		"2001:db8::/32", // documentation
+	)
+)
+
+// Store is the part of the chat repository used by the unfurler
+type Store interface {
+	GetLinkPreview(url string) (*domain.LinkPreview, error)
+	SaveLinkPreview(p *domain.LinkPreview) error
+	AddMessageLinkPreviews(messageID int, urls []string) error
+}
+
+// Config holds link unfurling configuration
+type Config struct {
+	// Timeout bounds fetching a single page including redirects
+	Timeout time.Duration
+	// MaxBodySize is how much of a page is read looking for metadata
+	MaxBodySize int64
+	// CacheTTL is how long fetched previews are reused
+	CacheTTL time.Duration
+	Workers  int
+	// QueueSize is the number of messages waiting to be unfurled, messages
+	// are skipped when the queue is full
+	QueueSize int
+	// AllowPrivateNetworks disables the SSRF protection, for tests only
+	AllowPrivateNetworks bool
+}
+
+type job struct {
+	msg        *domain.Message
+	urls       []string
+	recipients []int
+}
+
+type unfurler struct {
+	store  Store
+	broker domain.Broker
+	client *http.Client
+	cfg    Config
+	jobs   chan job
+	logger *zap.Logger
+}
+
+// NewUnfurler creates an unfurler and starts its workers. Previews are
+// published to the recipients of the message through the broker.
+func NewUnfurler(store Store, broker domain.Broker, cfg Config, logger *zap.Logger) domain.Unfurler {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	if cfg.MaxBodySize <= 0 {
+		cfg.MaxBodySize = defaultMaxBodySize
+	}
+	if cfg.CacheTTL <= 0 {
+		cfg.CacheTTL = defaultCacheTTL
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = defaultWorkers
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaultQueueSize
+	}
+
+	u := &unfurler{
+		store:  store,
+		broker: broker,
+		client: newClient(cfg),
+		cfg:    cfg,
+		jobs:   make(chan job, cfg.QueueSize),
+		logger: logger,
+	}
+
+	for i := 0; i < cfg.Workers; i++ {
+		go u.work()
+	}
+
+	return u
+}
+
+func (u *unfurler) Unfurl(msg *domain.Message, recipients []int) {
+	urls := extractURLs(msg.Content)
+	if len(urls) == 0 {
+		return
+	}
+
+	select {
+	case u.jobs <- job{msg: msg, urls: urls, recipients: recipients}:
+	default:
+		u.logger.Warn("unfurl queue is full, skipping message", zap.Int("message_id", msg.ID))
+	}
+}
+
+func (u *unfurler) work() {
+	for j := range u.jobs {
+		u.unfurl(j)
+	}
+}
+
+func (u *unfurler) unfurl(j job) {
+	var previews []*domain.LinkPreview
+	var urls []string
+
+	for _, link := range j.urls {
+		preview, err := u.preview(link)
+		if err != nil {
+			u.logger.Error("failed to get link preview", zap.String("url", link), zap.Error(err))
+			continue
+		}
+		if preview.Empty() {
+			continue
+		}
+
+		previews = append(previews, preview)
+		urls = append(urls, link)
+	}
+
+	if len(previews) == 0 {
+		return
+	}
+
+	if err := u.store.AddMessageLinkPreviews(j.msg.ID, urls); err != nil {
+		u.logger.Error("failed to save message link previews", zap.Error(err))
+		return
+	}
+
+	payload := map[string]any{
+		"id":            j.msg.ID,
+		"link_previews": previews,
+	}
+	if j.msg.ConversationID != domain.PublicConversationID {
+		payload["conversation_id"] = j.msg.ConversationID
+	}
+
+	err := u.broker.Publish(&domain.Event{
+		UserIDs: j.recipients,
+		Message: domain.WebsocketMessage{
+			Type:    "message_updated",
+			Payload: payload,
+		},
+	})
+	if err != nil {
+		u.logger.Error("failed to publish link previews", zap.Error(err))
+	}
+}
+
+// preview returns the cached preview of the URL, fetching it when missing
+// or stale. Failed fetches are cached as empty previews.
+func (u *unfurler) preview(link string) (*domain.LinkPreview, error) {
+	cached, err := u.store.GetLinkPreview(link)
+	if err != nil && !errors.Is(err, domain.ErrLinkPreviewNotFound) {
+		return nil, err
+	}
+	if cached != nil && time.Since(cached.FetchedAt) < u.cfg.CacheTTL {
+		return cached, nil
+	}
+
+	preview, err := u.fetch(link)
+	if err != nil {
+		u.logger.Debug("failed to fetch link preview", zap.String("url", link), zap.Error(err))
+		preview = &domain.LinkPreview{URL: link}
+	}
+
+	if err := u.store.SaveLinkPreview(preview); err != nil {
+		return nil, err
+	}
+
+	return preview, nil
+}
+
+func (u *unfurler) fetch(link string) (*domain.LinkPreview, error) {
+	req, err := http.NewRequest(http.MethodGet, link, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, ErrNotHTML
+	}
+
+	preview := parseMetadata(io.LimitReader(resp.Body, u.cfg.MaxBodySize), resp.Request.URL)
+	preview.URL = link
+	preview.Title = truncate(preview.Title, maxTitleLength)
+	preview.Description = truncate(preview.Description, maxDescriptionLength)
+
+	return preview, nil
+}
+
+// newClient creates an HTTP client that refuses to connect to private,
+// loopback and other internal addresses. The check runs on the resolved
+// address of every connection, so redirects and DNS rebinding are covered.
+func newClient(cfg Config) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: cfg.Timeout,
+	}
+	if !cfg.AllowPrivateNetworks {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+				return ErrBlockedAddress
+			}
+			return nil
+		}
+	}
+
+	return &http.Client{
+		Timeout: cfg.Timeout,
+		Transport: &http.Transport{
+			// Proxies from the environment would bypass the address check
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   cfg.Timeout,
+			ResponseHeaderTimeout: cfg.Timeout,
+			MaxIdleConns:          16,
+			IdleConnTimeout:       30 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errors.New("too many redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return ErrBlockedAddress
+			}
+			return nil
+		},
+	}
+}
+
+// isPublicIP reports whether the address is routable on the internet
+func isPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+
+	for _, network := range blockedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// extractURLs returns the distinct http(s) links of the message
+func extractURLs(content string) []string {
+	var urls []string
+	seen := make(map[string]bool)
+
+	for _, match := range urlPattern.FindAllString(content, -1) {
+		// Drop punctuation ending the sentence around the link
+		match = strings.TrimRight(match, ".,;:!?)]}*_~")
+		if len(match) > maxURLLength || seen[match] {
+			continue
+		}
+
+		parsed, err := url.Parse(match)
+		if err != nil || parsed.Host == "" {
+			continue
+		}
+
+		seen[match] = true
+		urls = append(urls, match)
+		if len(urls) == maxLinksPerMessage {
+			break
+		}
+	}
+
+	return urls
+}
+
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n]) + "…"
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+	return networks
+}
@@ -0,0 +1,198 @@
+package unfurl
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chizheg/forum/internal/forum/broker/memory"
+	"github.com/chizheg/forum/internal/forum/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// memoryStore is an in-memory Store for tests
+type memoryStore struct {
+	mu       sync.Mutex
+	previews map[string]*domain.LinkPreview
+	messages map[int][]string
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		previews: make(map[string]*domain.LinkPreview),
+		messages: make(map[int][]string),
+	}
+}
+
+func (s *memoryStore) GetLinkPreview(url string) (*domain.LinkPreview, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.previews[url]
+	if !ok {
+		return nil, domain.ErrLinkPreviewNotFound
+	}
+	return p, nil
+}
+
+func (s *memoryStore) SaveLinkPreview(p *domain.LinkPreview) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p.FetchedAt = time.Now()
+	s.previews[p.URL] = p
+	return nil
+}
+
+func (s *memoryStore) AddMessageLinkPreviews(messageID int, urls []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.messages[messageID] = append(s.messages[messageID], urls...)
+	return nil
+}
+
+const testPage = `<!DOCTYPE html>
+<html><head>
+<title>Fallback title</title>
+<meta property="og:title" content="Release notes">
+<meta name="description" content="What changed this week">
+<meta property="og:image" content="/img/cover.png">
+<meta property="og:site_name" content="Example">
+</head><body><meta property="og:title" content="ignored"></body></html>`
+
+func TestUnfurler_PublishesPreview(t *testing.T) {
+	var requests int
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, testPage)
+	}))
+	defer server.Close()
+
+	store := newMemoryStore()
+	broker := memory.NewBroker(zap.NewNop())
+	defer broker.Close()
+	events, cancel := broker.Subscribe()
+	defer cancel()
+
+	u := NewUnfurler(store, broker, Config{AllowPrivateNetworks: true}, zap.NewNop())
+
+	link := server.URL + "/notes"
+	u.Unfurl(&domain.Message{ID: 7, ConversationID: 3, Content: "see " + link + "."}, []int{1, 2})
+
+	select {
+	case event := <-events:
+		assert.Equal(t, []int{1, 2}, event.UserIDs)
+		assert.Equal(t, "message_updated", event.Message.Type)
+		assert.Equal(t, 7, event.Message.Payload["id"])
+		assert.Equal(t, 3, event.Message.Payload["conversation_id"])
+
+		previews := event.Message.Payload["link_previews"].([]*domain.LinkPreview)
+		require.Len(t, previews, 1)
+		assert.Equal(t, link, previews[0].URL)
+		assert.Equal(t, "Release notes", previews[0].Title)
+		assert.Equal(t, "What changed this week", previews[0].Description)
+		assert.Equal(t, server.URL+"/img/cover.png", previews[0].ImageURL)
+		assert.Equal(t, "Example", previews[0].SiteName)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message_updated event")
+	}
+
+	assert.Equal(t, []string{link}, store.messages[7])
+
+	// Test the cached preview is reused
+	u.Unfurl(&domain.Message{ID: 8, Content: link}, nil)
+	select {
+	case <-events:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message_updated event")
+	}
+
+	mu.Lock()
+	assert.Equal(t, 1, requests)
+	mu.Unlock()
+}
+
+func TestUnfurler_BlocksPrivateAddresses(t *testing.T) {
+	var requested bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = true
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, testPage)
+	}))
+	defer server.Close()
+
+	u := NewUnfurler(newMemoryStore(), memory.NewBroker(zap.NewNop()), Config{}, zap.NewNop()).(*unfurler)
+
+	_, err := u.fetch(server.URL)
+	assert.ErrorIs(t, err, ErrBlockedAddress)
+	assert.False(t, requested)
+}
+
+func TestUnfurler_Limits(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow":
+			time.Sleep(500 * time.Millisecond)
+		case "/large":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, "<html><head>"+strings.Repeat("<!-- padding -->", 1024))
+			fmt.Fprint(w, `<meta property="og:title" content="too far"></head></html>`)
+			return
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, testPage)
+	}))
+	defer server.Close()
+
+	u := NewUnfurler(newMemoryStore(), memory.NewBroker(zap.NewNop()), Config{
+		Timeout:              100 * time.Millisecond,
+		MaxBodySize:          1024,
+		AllowPrivateNetworks: true,
+	}, zap.NewNop()).(*unfurler)
+
+	// Test timeout
+	_, err := u.fetch(server.URL + "/slow")
+	assert.Error(t, err)
+
+	// Test metadata past the size limit is not read
+	preview, err := u.fetch(server.URL + "/large")
+	assert.NoError(t, err)
+	assert.True(t, preview.Empty())
+
+	// Test non-HTML responses
+	_, err = u.fetch(server.URL + "/image")
+	assert.ErrorIs(t, err, ErrNotHTML)
+}
+
+func TestExtractURLs(t *testing.T) {
+	urls := extractURLs("look (https://a.example/x?y=1), http://b.example. https://a.example/x?y=1 ftp://c.example https://d.example https://e.example")
+	assert.Equal(t, []string{"https://a.example/x?y=1", "http://b.example", "https://d.example"}, urls)
+
+	assert.Empty(t, extractURLs("no links here"))
+}
+
+func TestIsPublicIP(t *testing.T) {
+	for _, addr := range []string{"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "100.64.0.1", "0.0.0.0", "::1", "fe80::1", "fc00::1", "::ffff:10.0.0.1"} {
+		assert.False(t, isPublicIP(net.ParseIP(addr)), addr)
+	}
+
+	for _, addr := range []string{"93.184.216.34", "2606:4700::1111"} {
+		assert.True(t, isPublicIP(net.ParseIP(addr)), addr)
+	}
+}
@@ -0,0 +1,15 @@
+ALTER TABLE users
+ADD COLUMN disabled_at TIMESTAMP WITH TIME ZONE,
+ADD COLUMN password_reset_required BOOLEAN NOT NULL DEFAULT false;
+
+CREATE TABLE password_resets (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_password_resets_user_id ON password_resets(user_id);
+CREATE INDEX idx_sessions_user_id ON sessions(user_id);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS account_deletions;
+
+ALTER TABLE users
+DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,10 @@
+ALTER TABLE users
+ADD COLUMN deleted_at TIMESTAMP WITH TIME ZONE;
+
+-- Deleted accounts for other services to erase their data of the user,
+-- user_id has no foreign key as the account may not exist anymore
+CREATE TABLE account_deletions (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    deleted_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,3 @@
+ALTER TABLE users
+DROP COLUMN IF EXISTS code_failed_at,
+DROP COLUMN IF EXISTS code_failures;
@@ -0,0 +1,6 @@
+-- code_failures counts the two-factor codes entered at login since the
+-- last valid one, across login challenges, and expires some time after
+-- code_failed_at
+ALTER TABLE users
+ADD COLUMN code_failures INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN code_failed_at TIMESTAMP WITH TIME ZONE;
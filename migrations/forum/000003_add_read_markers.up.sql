@@ -0,0 +1,5 @@
+CREATE TABLE chat_read_markers (
+    user_id INTEGER PRIMARY KEY,
+    last_read_message_id INTEGER NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_chat_messages_conversation_id;
+
+ALTER TABLE chat_messages
+DROP COLUMN conversation_id;
+
+DROP TABLE IF EXISTS conversation_members;
+DROP TABLE IF EXISTS conversations;
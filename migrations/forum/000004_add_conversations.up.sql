@@ -0,0 +1,21 @@
+CREATE TABLE conversations (
+    id SERIAL PRIMARY KEY,
+    created_by INTEGER NOT NULL,
+    is_group BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE conversation_members (
+    conversation_id INTEGER NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL,
+    joined_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (conversation_id, user_id)
+);
+
+CREATE INDEX idx_conversation_members_user_id ON conversation_members(user_id);
+
+-- Messages without a conversation belong to the public chat
+ALTER TABLE chat_messages
+ADD COLUMN conversation_id INTEGER REFERENCES conversations(id) ON DELETE CASCADE;
+
+CREATE INDEX idx_chat_messages_conversation_id ON chat_messages(conversation_id, created_at);
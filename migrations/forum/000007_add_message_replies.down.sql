@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_chat_messages_reply_to_id;
+
+ALTER TABLE chat_messages
+DROP COLUMN reply_to_id;
@@ -0,0 +1,4 @@
+ALTER TABLE chat_messages
+ADD COLUMN reply_to_id INTEGER REFERENCES chat_messages(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_chat_messages_reply_to_id ON chat_messages(reply_to_id);
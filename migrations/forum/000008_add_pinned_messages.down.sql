@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_chat_messages_pinned;
+
+ALTER TABLE chat_messages
+DROP COLUMN pinned_by,
+DROP COLUMN pinned_at;
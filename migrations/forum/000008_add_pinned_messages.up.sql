@@ -0,0 +1,5 @@
+ALTER TABLE chat_messages
+ADD COLUMN pinned_at TIMESTAMP WITH TIME ZONE,
+ADD COLUMN pinned_by INTEGER;
+
+CREATE INDEX idx_chat_messages_pinned ON chat_messages(conversation_id, pinned_at) WHERE pinned_at IS NOT NULL;
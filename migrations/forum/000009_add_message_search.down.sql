@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_chat_messages_search_vector;
+
+ALTER TABLE chat_messages
+DROP COLUMN search_vector;
@@ -0,0 +1,5 @@
+-- The simple configuration does not stem, so it works for any language
+ALTER TABLE chat_messages
+ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (to_tsvector('simple', content)) STORED;
+
+CREATE INDEX idx_chat_messages_search_vector ON chat_messages USING GIN (search_vector);
@@ -0,0 +1,17 @@
+-- Attachments are uploaded before the message is sent, message_id is set
+-- when the message is saved
+CREATE TABLE message_attachments (
+    id SERIAL PRIMARY KEY,
+    message_id INTEGER REFERENCES chat_messages(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL,
+    file_name VARCHAR(255) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    size BIGINT NOT NULL,
+    width INTEGER,
+    height INTEGER,
+    storage_key VARCHAR(255) NOT NULL UNIQUE,
+    thumbnail_key VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_message_attachments_message_id ON message_attachments(message_id);
@@ -0,0 +1,9 @@
+-- Request counters of the HTTP rate limiter, one row per client and limit
+-- holding the current fixed window only
+CREATE TABLE rate_limits (
+    key TEXT PRIMARY KEY,
+    window_start TIMESTAMP WITH TIME ZONE NOT NULL,
+    count INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX idx_rate_limits_window_start ON rate_limits(window_start);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS sanctions;
+DROP TYPE IF EXISTS sanction_type;
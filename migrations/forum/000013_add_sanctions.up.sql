@@ -0,0 +1,16 @@
+CREATE TYPE sanction_type AS ENUM ('mute', 'ban', 'kick');
+
+-- Moderation history, a NULL expires_at is a permanent ban
+CREATE TABLE sanctions (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    moderator_id INTEGER NOT NULL,
+    type sanction_type NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    expires_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    revoked_by INTEGER,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_sanctions_user_id ON sanctions(user_id, created_at DESC);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS message_reports;
+DROP TYPE IF EXISTS report_status;
@@ -0,0 +1,15 @@
+CREATE TYPE report_status AS ENUM ('open', 'actioned', 'dismissed');
+
+CREATE TABLE message_reports (
+    id SERIAL PRIMARY KEY,
+    message_id INTEGER NOT NULL REFERENCES chat_messages(id) ON DELETE CASCADE,
+    reporter_id INTEGER NOT NULL,
+    reason TEXT NOT NULL,
+    status report_status NOT NULL DEFAULT 'open',
+    resolved_by INTEGER,
+    resolved_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (message_id, reporter_id)
+);
+
+CREATE INDEX idx_message_reports_status ON message_reports(status, created_at);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_chat_messages_user_id;
+DROP TABLE IF EXISTS account_deletions;
@@ -0,0 +1,9 @@
+-- Account deletions of the auth service the forum has handled, id is the
+-- id of the deletion in the auth service
+CREATE TABLE account_deletions (
+    id BIGINT PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    anonymized_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_chat_messages_user_id ON chat_messages(user_id);
@@ -0,0 +1,10 @@
+-- Chat events too large for a notification, published by the PostgreSQL
+-- broker. Their notification only carries the id, which keeps it under the
+-- NOTIFY payload limit whatever the size of the message.
+CREATE TABLE chat_events (
+    id BIGSERIAL PRIMARY KEY,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_chat_events_created_at ON chat_events(created_at);
@@ -0,0 +1,15 @@
+-- Websocket connections of every forum instance for the presence of users.
+-- Instances refresh seen_at of their connections, connections of an
+-- instance that stopped doing so are considered gone.
+CREATE TABLE chat_connections (
+    id TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    instance_id TEXT NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    seen_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_chat_connections_user_id ON chat_connections(user_id);
+CREATE INDEX idx_chat_connections_instance_id ON chat_connections(instance_id);
+CREATE INDEX idx_chat_connections_seen_at ON chat_connections(seen_at);
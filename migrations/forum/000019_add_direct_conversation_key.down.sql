@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_conversations_direct_users;
+
+ALTER TABLE conversations
+DROP COLUMN IF EXISTS direct_user_high,
+DROP COLUMN IF EXISTS direct_user_low;
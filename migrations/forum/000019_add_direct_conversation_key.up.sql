@@ -0,0 +1,25 @@
+-- One-to-one conversations are unique per ordered pair of members, group
+-- conversations leave the pair empty
+ALTER TABLE conversations
+ADD COLUMN direct_user_low INTEGER,
+ADD COLUMN direct_user_high INTEGER;
+
+-- The oldest conversation of a pair is kept as the direct one, duplicates
+-- created before remain reachable from the conversation list
+UPDATE conversations c
+SET direct_user_low = pair.low, direct_user_high = pair.high
+FROM (
+    SELECT DISTINCT ON (low, high) conversation_id, low, high
+    FROM (
+        SELECT conversation_id, MIN(user_id) AS low, MAX(user_id) AS high
+        FROM conversation_members
+        GROUP BY conversation_id
+        HAVING COUNT(*) = 2
+    ) members
+    JOIN conversations ON conversations.id = members.conversation_id
+    WHERE NOT conversations.is_group
+    ORDER BY low, high, conversation_id
+) pair
+WHERE c.id = pair.conversation_id;
+
+CREATE UNIQUE INDEX idx_conversations_direct_users ON conversations(direct_user_low, direct_user_high);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_account_deletions_pending;
+
+DELETE FROM account_deletions WHERE anonymized_at IS NULL;
+
+ALTER TABLE account_deletions ALTER COLUMN anonymized_at SET DEFAULT CURRENT_TIMESTAMP;
@@ -0,0 +1,6 @@
+-- Deletions are recorded as soon as they are fetched from the auth service,
+-- anonymized_at stays NULL until the data of the user is erased so a
+-- failed deletion is retried instead of skipped
+ALTER TABLE account_deletions ALTER COLUMN anonymized_at DROP DEFAULT;
+
+CREATE INDEX idx_account_deletions_pending ON account_deletions(id) WHERE anonymized_at IS NULL;
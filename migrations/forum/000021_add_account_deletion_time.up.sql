@@ -0,0 +1,4 @@
+-- deleted_at is when the auth service deleted the account. Deletions can
+-- commit there out of ID order, the sync re-reads those recorded within a
+-- margin of the latest so none committed late is skipped.
+ALTER TABLE account_deletions ADD COLUMN deleted_at TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,3 @@
+-- Uploads never sent with a message are deleted after a while, the index
+-- keeps the cleanup from scanning every sent attachment.
+CREATE INDEX idx_message_attachments_unsent ON message_attachments(created_at) WHERE message_id IS NULL;
@@ -0,0 +1,157 @@
+// Package audit records privileged and security-relevant actions, such as
+// logins, role changes, deletions and bans, in an append-only log shared by
+// the auth and forum services.
+package audit
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+var ErrInvalidFilter = errors.New("invalid audit log filter")
+
+// Action identifies what was done, prefixed by the service recording it
+type Action string
+
+// Auth service actions
+const (
+	ActionRegister       Action = "auth.register"
+	ActionLogin          Action = "auth.login"
+	ActionLoginFailed    Action = "auth.login_failed"
+	ActionSessionRevoked Action = "auth.session_revoked"
+	ActionRoleChanged    Action = "auth.role_changed"
+	ActionUserDisabled   Action = "auth.user_disabled"
+	ActionUserEnabled    Action = "auth.user_enabled"
+	// ActionPasswordResetForced is recorded when an admin forces a reset,
+	// ActionPasswordReset when the user completes it
+	ActionPasswordResetForced Action = "auth.password_reset_forced"
+	ActionPasswordReset       Action = "auth.password_reset"
+	ActionPasswordChanged     Action = "auth.password_changed"
+	// ActionEmailChangeRequested is recorded when a user asks to change
+	// their email, ActionEmailChanged once the new address is verified
+	ActionEmailChangeRequested Action = "auth.email_change_requested"
+	ActionEmailChanged         Action = "auth.email_changed"
+	ActionAccountDeleted       Action = "auth.account_deleted"
+	ActionAccountExported      Action = "auth.account_exported"
+	ActionTwoFactorEnabled     Action = "auth.two_factor_enabled"
+	ActionTwoFactorDisabled    Action = "auth.two_factor_disabled"
+	// ActionRecoveryCodeUsed is recorded when a recovery code replaces a
+	// TOTP code
+	ActionRecoveryCodeUsed         Action = "auth.recovery_code_used"
+	ActionRecoveryCodesRegenerated Action = "auth.recovery_codes_regenerated"
+	ActionIdentityLinked           Action = "auth.identity_linked"
+	ActionIdentityUnlinked         Action = "auth.identity_unlinked"
+)
+
+// Forum service actions
+const (
+	ActionMessageDeleted  Action = "forum.message_deleted"
+	ActionMessageApproved Action = "forum.message_approved"
+	ActionUserMuted       Action = "forum.user_muted"
+	ActionUserBanned      Action = "forum.user_banned"
+	ActionUserKicked      Action = "forum.user_kicked"
+	ActionSanctionLifted  Action = "forum.sanction_lifted"
+	// ActionUserAnonymized is recorded when the forum erases the data of
+	// a deleted account
+	ActionUserAnonymized Action = "forum.user_anonymized"
+)
+
+// Target types
+const (
+	TargetUser     = "user"
+	TargetSession  = "session"
+	TargetMessage  = "message"
+	TargetSanction = "sanction"
+)
+
+// Source describes where a request came from
+type Source struct {
+	IP        string `json:"ip,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+}
+
+// SourceFromRequest returns the source of an HTTP request. The IP is the
+// address of the peer, proxies are expected to be handled by the server.
+func SourceFromRequest(r *http.Request) Source {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	return Source{
+		IP:        ip,
+		UserAgent: r.UserAgent(),
+	}
+}
+
+// Entry is a single record of the audit log
+type Entry struct {
+	ID int64 `json:"id"`
+	// ActorID is the user who acted, zero for anonymous requests such as
+	// failed logins of unknown users
+	ActorID    int    `json:"actor_id,omitempty"`
+	Action     Action `json:"action"`
+	TargetType string `json:"target_type,omitempty"`
+	TargetID   int    `json:"target_id,omitempty"`
+	Source
+	// Details holds action specific data, e.g. the old and new role
+	Details   map[string]any `json:"details,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// Filter selects entries of the audit log, zero fields match everything
+type Filter struct {
+	ActorID int
+	Action  Action
+	Since   time.Time
+	Until   time.Time
+	Limit   int
+	Offset  int
+}
+
+// Validate checks the filter and applies the default and maximum limit
+func (f *Filter) Validate() error {
+	if f.ActorID < 0 || f.Offset < 0 {
+		return ErrInvalidFilter
+	}
+	if !f.Since.IsZero() && !f.Until.IsZero() && f.Until.Before(f.Since) {
+		return ErrInvalidFilter
+	}
+
+	if f.Limit <= 0 {
+		f.Limit = DefaultLimit
+	}
+	if f.Limit > MaxLimit {
+		f.Limit = MaxLimit
+	}
+
+	return nil
+}
+
+const (
+	DefaultLimit = 50
+	MaxLimit     = 500
+)
+
+// Writer appends entries to the audit log. Entries are never updated or
+// deleted.
+type Writer interface {
+	Write(entry *Entry) error
+}
+
+// Store is an audit log that can also be queried
+type Store interface {
+	Writer
+	// Query returns the entries matching the filter, newest first
+	Query(filter Filter) ([]*Entry, error)
+}
+
+// Discard is a writer dropping every entry, for deployments and tests
+// without an audit log
+var Discard Writer = discard{}
+
+type discard struct{}
+
+func (discard) Write(*Entry) error { return nil }
@@ -0,0 +1,34 @@
+package audit
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilter_Validate(t *testing.T) {
+	filter := Filter{}
+	assert.NoError(t, filter.Validate())
+	assert.Equal(t, DefaultLimit, filter.Limit)
+
+	filter = Filter{Limit: MaxLimit + 1}
+	assert.NoError(t, filter.Validate())
+	assert.Equal(t, MaxLimit, filter.Limit)
+
+	now := time.Now()
+	filter = Filter{Since: now, Until: now.Add(-time.Hour)}
+	assert.ErrorIs(t, filter.Validate(), ErrInvalidFilter)
+
+	filter = Filter{Offset: -1}
+	assert.ErrorIs(t, filter.Validate(), ErrInvalidFilter)
+}
+
+func TestSourceFromRequest(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "[2001:db8::1]:4321"
+	r.Header.Set("User-Agent", "test")
+
+	assert.Equal(t, Source{IP: "2001:db8::1", UserAgent: "test"}, SourceFromRequest(r))
+}
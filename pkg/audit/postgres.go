@@ -0,0 +1,136 @@
+package audit
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type postgresStore struct {
+	db *sql.DB
+}
+
+// NewPostgresStore creates an audit log backed by the audit_log table. The
+// table rejects updates and deletes, so the log can only be appended to.
+func NewPostgresStore(db *sql.DB) Store {
+	return &postgresStore{db: db}
+}
+
+func (s *postgresStore) Write(entry *Entry) error {
+	details, err := json.Marshal(entry.Details)
+	if err != nil {
+		return fmt.Errorf("error encoding audit details: %w", err)
+	}
+
+	query := `
+		INSERT INTO audit_log (actor_id, action, target_type, target_id, ip, user_agent, details)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at`
+
+	err = s.db.QueryRow(
+		query,
+		nullableInt(entry.ActorID),
+		entry.Action,
+		nullableString(entry.TargetType),
+		nullableInt(entry.TargetID),
+		nullableString(entry.IP),
+		nullableString(entry.UserAgent),
+		details,
+	).Scan(&entry.ID, &entry.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("error writing audit log: %w", err)
+	}
+
+	return nil
+}
+
+func (s *postgresStore) Query(filter Filter) ([]*Entry, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+
+	var conditions []string
+	var args []any
+	where := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.ActorID != 0 {
+		where("actor_id = $%d", filter.ActorID)
+	}
+	if filter.Action != "" {
+		where("action = $%d", filter.Action)
+	}
+	if !filter.Since.IsZero() {
+		where("created_at >= $%d", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		where("created_at < $%d", filter.Until)
+	}
+
+	query := `
+		SELECT id, actor_id, action, target_type, target_id, ip, user_agent, details, created_at
+		FROM audit_log`
+	if len(conditions) > 0 {
+		query += "\n\t\tWHERE " + strings.Join(conditions, " AND ")
+	}
+	query += fmt.Sprintf("\n\t\tORDER BY created_at DESC, id DESC\n\t\tLIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying audit log: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []*Entry{}
+	for rows.Next() {
+		entry := &Entry{}
+		var actorID, targetID sql.NullInt64
+		var targetType, ip, userAgent sql.NullString
+		var details []byte
+
+		err := rows.Scan(
+			&entry.ID,
+			&actorID,
+			&entry.Action,
+			&targetType,
+			&targetID,
+			&ip,
+			&userAgent,
+			&details,
+			&entry.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning audit entry: %w", err)
+		}
+
+		if err := json.Unmarshal(details, &entry.Details); err != nil {
+			return nil, fmt.Errorf("error decoding audit details: %w", err)
+		}
+
+		entry.ActorID = int(actorID.Int64)
+		entry.TargetType = targetType.String
+		entry.TargetID = int(targetID.Int64)
+		entry.IP = ip.String
+		entry.UserAgent = userAgent.String
+		entries = append(entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error querying audit log: %w", err)
+	}
+
+	return entries, nil
+}
+
+// nullableInt stores zero ids as NULL
+func nullableInt(n int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(n), Valid: n != 0}
+}
+
+func nullableString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -16,14 +16,17 @@ type Config struct {
 	SSLMode  string
 }
 
-// NewPostgresDB creates a new PostgreSQL connection
-func NewPostgresDB(cfg Config) (*sql.DB, error) {
-	connStr := fmt.Sprintf(
+// ConnString returns the lib/pq connection string for the configuration
+func (cfg Config) ConnString() string {
+	return fmt.Sprintf(
 		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
 		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.DBName, cfg.SSLMode,
 	)
+}
 
-	db, err := sql.Open("postgres", connStr)
+// NewPostgresDB creates a new PostgreSQL connection
+func NewPostgresDB(cfg Config) (*sql.DB, error) {
+	db, err := sql.Open("postgres", cfg.ConnString())
 	if err != nil {
 		return nil, fmt.Errorf("error opening database: %w", err)
 	}